@@ -0,0 +1,96 @@
+// Package api holds the OpenAPI description of the HTTP API and serves it,
+// together with a bundled Swagger UI.
+package api
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	_ "embed"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+var (
+	loadOnce sync.Once
+	spec     *openapi3.T
+	specJSON []byte
+	loadErr  error
+)
+
+// Spec returns the parsed and validated specification.
+func Spec() (*openapi3.T, error) {
+	load()
+	return spec, loadErr
+}
+
+func load() {
+	loadOnce.Do(func() {
+		loader := openapi3.NewLoader()
+		spec, loadErr = loader.LoadFromData(specYAML)
+		if loadErr != nil {
+			return
+		}
+		if loadErr = spec.Validate(context.Background()); loadErr != nil {
+			return
+		}
+		specJSON, loadErr = spec.MarshalJSON()
+	})
+}
+
+// Register mounts /openapi.json and the Swagger UI under /docs/.
+func Register(r gin.IRouter) {
+	r.GET("/openapi.json", serveSpec)
+	r.GET("/docs", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/docs/")
+	})
+	r.GET("/docs/*filepath", serveDocs)
+}
+
+func serveSpec(c *gin.Context) {
+	load()
+	if loadErr != nil {
+		c.Error(loadErr)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", specJSON)
+}
+
+// swaggerInitializer replaces the one shipped with Swagger UI, which points
+// at the petstore example.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+var docsServer = http.StripPrefix("/docs", http.FileServer(http.FS(swaggerFiles.FS)))
+
+func serveDocs(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	if name == "swagger-initializer.js" {
+		c.Data(http.StatusOK, "application/javascript", []byte(swaggerInitializer))
+		return
+	}
+	if name != "" {
+		if _, err := fs.Stat(swaggerFiles.FS, name); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+	}
+	docsServer.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecIsValid(t *testing.T) {
+	spec, err := Spec()
+	require.NoError(t, err)
+	assert.NotNil(t, spec.Paths.Find("/transactions/{id}"))
+}
+
+func TestServeSpecAndDocs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Register(router)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"/openapi.json", http.StatusOK, "application/json", `"openapi":"3.0.3"`},
+		{"/docs/", http.StatusOK, "text/html", "swagger-ui"},
+		{"/docs/swagger-initializer.js", http.StatusOK, "application/javascript", `url: "/openapi.json"`},
+		{"/docs/swagger-ui-bundle.js", http.StatusOK, "javascript", ""},
+		{"/docs/missing.js", http.StatusNotFound, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), test.contentType)
+			assert.Contains(t, w.Body.String(), test.contains)
+		})
+	}
+}
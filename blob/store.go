@@ -0,0 +1,185 @@
+// Package blob keeps the contents of transaction attachments. The database
+// only holds their metadata and the key each content is stored under, so the
+// storage can move from local disk to an object store without touching the
+// rest of the service.
+package blob
+
+import (
+	configs "DZ_ITOG/config"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned by Open for a key that holds nothing.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps contents by key. Keys are chosen by the caller and are made of
+// letters, digits, hyphens and underscores. Put replaces what a key held;
+// Delete of a missing key is not an error.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// StoreFactory builds a store from the attachment settings.
+type StoreFactory func(config configs.AttachmentConfig) (Store, error)
+
+var (
+	storesMu sync.RWMutex
+	stores   = map[string]StoreFactory{
+		"local": func(config configs.AttachmentConfig) (Store, error) {
+			return NewLocalStore(config.Dir), nil
+		},
+		"memory": func(configs.AttachmentConfig) (Store, error) { return NewMemoryStore(), nil },
+	}
+)
+
+// RegisterStore makes a store available as attachments.store: name,
+// typically from the init function of a package wrapping an S3 client.
+func RegisterStore(name string, factory StoreFactory) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	stores[name] = factory
+}
+
+// NewStore builds the store named by config.Store.
+func NewStore(config configs.AttachmentConfig) (Store, error) {
+	storesMu.RLock()
+	factory, ok := stores[config.Store]
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	storesMu.RUnlock()
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown attachment store %q, registered: %v", config.Store, names)
+	}
+	return factory(config)
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+func checkKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalStore keeps each content in a file named after its key under a
+// directory, which is created on the first Put.
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Put writes r to a temporary file and renames it into place, so a failed or
+// concurrent upload never leaves a partial content under key.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// MemoryStore keeps contents in the process, for tests and single-instance
+// trials. They are lost on restart.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
@@ -0,0 +1,64 @@
+package blob
+
+import (
+	configs "DZ_ITOG/config"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "attachments")
+	for name, store := range map[string]Store{
+		"local":  NewLocalStore(dir),
+		"memory": NewMemoryStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.Put(ctx, "receipt_1", strings.NewReader("first")))
+			require.NoError(t, store.Put(ctx, "receipt_1", strings.NewReader("second")))
+
+			r, err := store.Open(ctx, "receipt_1")
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			r.Close()
+			require.NoError(t, err)
+			assert.Equal(t, "second", string(data))
+
+			require.NoError(t, store.Delete(ctx, "receipt_1"))
+			require.NoError(t, store.Delete(ctx, "receipt_1"))
+			_, err = store.Open(ctx, "receipt_1")
+			assert.True(t, errors.Is(err, ErrNotFound))
+
+			assert.Error(t, store.Put(ctx, "../escape", strings.NewReader("x")))
+			_, err = store.Open(ctx, "../escape")
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, ErrNotFound))
+			assert.Error(t, store.Delete(ctx, "../escape"))
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no temporary files are left behind")
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := NewStore(configs.AttachmentConfig{Store: "memory"})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	_, err = NewStore(configs.AttachmentConfig{Store: "s3"})
+	assert.ErrorContains(t, err, `unknown attachment store "s3"`)
+
+	RegisterStore("s3", func(configs.AttachmentConfig) (Store, error) { return NewMemoryStore(), nil })
+	_, err = NewStore(configs.AttachmentConfig{Store: "s3"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// admin is the state shared by the maintenance commands: the loaded config,
+// the positional arguments, the result printer and, once connect is called,
+// the database.
+type admin struct {
+	config *configs.Config
+	args   []string
+	out    printer
+	db     *sql.DB
+}
+
+// setup parses the shared config and --output flags plus whatever register
+// adds, loads the config and applies the logger and service settings. Logs go
+// to stderr so stdout carries only the command result.
+func setup(name string, args []string, register func(fs *pflag.FlagSet)) (*admin, error) {
+	a := &admin{out: printer{w: os.Stdout}}
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	configs.RegisterFlags(fs)
+	fs.StringVarP(&a.out.format, "output", "o", formatText, "result format: text or json")
+	if register != nil {
+		register(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return nil, err
+		}
+		return nil, usagef("%v", err)
+	}
+	if err := checkFormat("output", a.out.format, formatText, formatJSON); err != nil {
+		return nil, err
+	}
+
+	config, err := configs.Load(fs)
+	if err != nil {
+		return nil, err
+	}
+	logger := config.Logger
+	if logger.Output == "stdout" {
+		logger.Output = "stderr"
+	}
+	if !fs.Changed("log-level") {
+		logger.Level = "warn"
+	}
+	if err := logging.Configure(logger); err != nil {
+		return nil, err
+	}
+	service.Configure(config)
+
+	a.config = config
+	a.args = fs.Args()
+	return a, nil
+}
+
+// connect opens the database without migrating it.
+func (a *admin) connect() error {
+	db, err := repo.Open(a.config)
+	if err != nil {
+		return fmt.Errorf("database connection failed: %w", err)
+	}
+	a.db = db
+	return nil
+}
+
+func (a *admin) close() {
+	if a.db != nil {
+		a.db.Close()
+	}
+}
+
+// commandContext is cancelled on SIGINT or SIGTERM so a long import or
+// recalculation stops cleanly and rolls back.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// connected runs fn with a connected admin built by setup.
+func connected(name string, args []string, register func(fs *pflag.FlagSet), fn func(ctx context.Context, a *admin) error) error {
+	a, err := setup(name, args, register)
+	if err != nil {
+		return err
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	defer a.close()
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	return fn(ctx, a)
+}
+
+// filterFlags are the transaction selection flags shared by export, report
+// and recalc-commissions.
+type filterFlags struct {
+	user, account                       int
+	currency, transactionType, category string
+	from, to                            string
+}
+
+func (f *filterFlags) register(fs *pflag.FlagSet) {
+	fs.IntVar(&f.user, "user", 0, "only transactions of this user id")
+	fs.IntVar(&f.account, "account", 0, "only transactions of this account id")
+	fs.StringVar(&f.currency, "currency", "", "only transactions in this currency")
+	fs.StringVar(&f.transactionType, "type", "", "only transactions of this type")
+	fs.StringVar(&f.category, "category", "", "only transactions in this category")
+	fs.StringVar(&f.from, "from", "", "only transactions on or after this date (YYYY-MM-DD or RFC 3339)")
+	fs.StringVar(&f.to, "to", "", "only transactions before this date (YYYY-MM-DD or RFC 3339)")
+}
+
+func (f *filterFlags) filter() (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		Currency:        f.currency,
+		TransactionType: f.transactionType,
+		Category:        f.category,
+	}
+	if f.user != 0 {
+		filter.UserID = &f.user
+	}
+	if f.account != 0 {
+		filter.AccountID = &f.account
+	}
+	var err error
+	if filter.From, err = parseDate("from", f.from); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDate("to", f.to); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func parseDate(flag, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, usagef("--%s must be a date such as 2024-01-31 or 2024-01-31T15:04:05Z, got %q", flag, value)
+}
+
+func runMigrate(args []string) error {
+	return connected("migrate", args, nil, migrate)
+}
+
+func migrate(ctx context.Context, a *admin) error {
+	if err := repo.Migrate(ctx, a.db); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	if err := repo.CheckSchema(ctx, a.db); err != nil {
+		return err
+	}
+	return a.out.print(map[string]string{"schema": "up to date"}, func(w io.Writer) {
+		fmt.Fprintln(w, "Schema is up to date")
+	})
+}
+
+func runRecalcCommissions(args []string) error {
+	var filters filterFlags
+	var dryRun bool
+	return connected("recalc-commissions", args, func(fs *pflag.FlagSet) {
+		filters.register(fs)
+		fs.BoolVar(&dryRun, "dry-run", false, "report the changes without writing them")
+	}, func(ctx context.Context, a *admin) error {
+		filter, err := filters.filter()
+		if err != nil {
+			return err
+		}
+		return recalcCommissions(ctx, a, filter, dryRun)
+	})
+}
+
+func recalcCommissions(ctx context.Context, a *admin, filter models.TransactionFilter, dryRun bool) error {
+	changes, err := service.NewTransactionService(a.db).RecalculateCommissions(ctx, filter, dryRun)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		DryRun  bool                       `json:"dry_run"`
+		Changes []service.CommissionChange `json:"changes"`
+	}{dryRun, changes}
+	return a.out.print(result, func(w io.Writer) {
+		if len(changes) > 0 {
+			fmt.Fprintln(w, "TRANSACTION\tOLD\tNEW")
+			for _, change := range changes {
+				fmt.Fprintf(w, "%d\t%s\t%s\n", change.TransactionID, formatOptional(change.Old), formatOptional(change.New))
+			}
+		}
+		verb := "changed"
+		if dryRun {
+			verb = "would change"
+		}
+		fmt.Fprintf(w, "%d commissions %s\n", len(changes), verb)
+	})
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *v)
+}
+
+func runReport(args []string) error {
+	var filters filterFlags
+	return connected("report", args, filters.register, func(ctx context.Context, a *admin) error {
+		filter, err := filters.filter()
+		if err != nil {
+			return err
+		}
+		return summarize(ctx, a, filter)
+	})
+}
+
+func summarize(ctx context.Context, a *admin, filter models.TransactionFilter) error {
+	summaries, err := service.NewTransactionService(a.db).Summarize(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return a.out.print(summaries, func(w io.Writer) {
+		writeSummaries(w, summaries)
+	})
+}
+
+// writeSummaries is the report table, shared with seed so its expected
+// totals can be compared line by line.
+func writeSummaries(w io.Writer, summaries []models.TransactionSummary) {
+	fmt.Fprintln(w, "CURRENCY\tTYPE\tCOUNT\tAMOUNT\tCOMMISSION")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%.2f\n", s.Currency, s.TransactionType, s.Count, s.Amount, s.Commission)
+	}
+}
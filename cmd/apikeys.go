@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// The CLI manages API keys with full rights, which is how the first key of
+// a deployment is issued; from then on the /api-keys endpoints take over.
+
+func runAPIKeyCreate(args []string) error {
+	var input models.APIKeyInput
+	var expires string
+	return connected("api-key create", args, func(fs *pflag.FlagSet) {
+		fs.IntVar(&input.UserID, "user", 0, "id of the user the key acts for")
+		fs.StringVar(&input.Name, "name", "", "name telling the key apart, e.g. the client using it")
+		fs.StringSliceVar(&input.Scopes, "scope", nil, "scope to grant, repeatable: "+strings.Join(models.Scopes, ", "))
+		fs.StringVar(&expires, "expires", "", "expiry date (YYYY-MM-DD or RFC 3339); by default the key does not expire")
+	}, func(ctx context.Context, a *admin) error {
+		var err error
+		if input.ExpiresAt, err = parseDate("expires", expires); err != nil {
+			return err
+		}
+		key, err := service.NewAPIKeyService(a.db).Create(ctx, nil, input)
+		if err != nil {
+			return err
+		}
+		return a.out.print(key, func(w io.Writer) {
+			fmt.Fprintf(w, "Created API key %d (%s) for user %d with %s\n", key.ID, key.Prefix, key.UserID, strings.Join(key.Scopes, ", "))
+			fmt.Fprintf(w, "Key: %s\n", key.Key)
+		})
+	})
+}
+
+func runAPIKeyList(args []string) error {
+	var user int
+	return connected("api-key list", args, func(fs *pflag.FlagSet) {
+		fs.IntVar(&user, "user", 0, "only keys of this user id")
+	}, func(ctx context.Context, a *admin) error {
+		var userID *int
+		if user != 0 {
+			userID = &user
+		}
+		keys, err := service.NewAPIKeyService(a.db).List(ctx, nil, userID)
+		if err != nil {
+			return err
+		}
+		return a.out.print(keys, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tUSER\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+			for _, k := range keys {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.UserID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+					formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+			}
+		})
+	})
+}
+
+func runAPIKeyRevoke(args []string) error {
+	return connected("api-key revoke", args, nil, func(ctx context.Context, a *admin) error {
+		if len(a.args) != 1 {
+			return usagef("api-key revoke takes exactly one key id")
+		}
+		id, err := strconv.Atoi(a.args[0])
+		if err != nil {
+			return usagef("key id must be an integer, got %q", a.args[0])
+		}
+		if err := service.NewAPIKeyService(a.db).Revoke(ctx, nil, id); err != nil {
+			return err
+		}
+		return a.out.print(map[string]int{"revoked": id}, func(w io.Writer) {
+			fmt.Fprintf(w, "Revoked API key %d\n", id)
+		})
+	})
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+const usage = `Usage:
+  app [serve] [flags]                 run the HTTP API (default)
+  app config print [flags]            print the effective configuration
+  app migrate [flags]                 create or update the database schema
+  app seed [flags]                    generate reproducible demo users, accounts and transactions
+  app import [flags] FILE             create transactions from a CSV or JSON file ("-" reads stdin)
+  app export [flags]                  write transactions as CSV or JSON
+  app recalc-commissions [flags]      recompute commissions with the current rules
+  app rates show [flags]              print exchange rates for a base currency
+  app rates fetch [flags]             ask every rate provider directly and report which answer
+  app user create [flags]             create a user
+  app user reset-password [flags]     set a new password for a user
+  app user set-roles [flags] ID       replace the roles of a user
+  app report [flags]                  count and total transactions per currency and type
+  app api-key create [flags]          issue an API key for a user
+  app api-key list [flags]            list API keys
+  app api-key revoke [flags] ID       revoke an API key at once
+
+Maintenance commands accept --output json (-o json) for machine-readable
+results on stdout; logs and errors always go to stderr. They exit 0 on
+success, 1 on failure and 2 on usage errors.
+
+Run "app <command> --help" for the flags of a command.
+`
+
+// Execute runs the command named by args and returns the process exit code.
+func Execute(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return report(serve(args))
+	}
+
+	switch args[0] {
+	case "serve":
+		return report(serve(args[1:]))
+	case "config":
+		if len(args) < 2 || args[1] != "print" {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		return report(printConfig(os.Stdout, args[2:]))
+	case "migrate":
+		return report(runMigrate(args[1:]))
+	case "seed":
+		return report(runSeed(args[1:]))
+	case "import":
+		return report(runImport(args[1:]))
+	case "export":
+		return report(runExport(args[1:]))
+	case "recalc-commissions":
+		return report(runRecalcCommissions(args[1:]))
+	case "report":
+		return report(runReport(args[1:]))
+	case "rates":
+		return subcommand(args, map[string]func([]string) error{
+			"show":  runRatesShow,
+			"fetch": runRatesFetch,
+		})
+	case "user":
+		return subcommand(args, map[string]func([]string) error{
+			"create":         runUserCreate,
+			"reset-password": runUserResetPassword,
+			"set-roles":      runUserSetRoles,
+		})
+	case "api-key":
+		return subcommand(args, map[string]func([]string) error{
+			"create": runAPIKeyCreate,
+			"list":   runAPIKeyList,
+			"revoke": runAPIKeyRevoke,
+		})
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// subcommand runs the second word of args, as in "rates show".
+func subcommand(args []string, commands map[string]func([]string) error) int {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	run, ok := commands[args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0]+" "+args[1], usage)
+		return 2
+	}
+	return report(run(args[2:]))
+}
+
+func report(err error) int {
+	if err == nil || errors.Is(err, pflag.ErrHelp) {
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return 2
+	}
+	return 1
+}
+
+// usageError is a bad command line rather than a failed operation.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// loadConfig parses the shared config flags plus whatever register adds.
+func loadConfig(name string, args []string, register func(fs *pflag.FlagSet)) (*configs.Config, error) {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	configs.RegisterFlags(fs)
+	if register != nil {
+		register(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return configs.Load(fs)
+}
+
+func serve(args []string) error {
+	fs := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	configs.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	reloader, err := configs.NewReloader(fs, logging.Logger())
+	if err != nil {
+		return err
+	}
+
+	config := reloader.Current()
+	if err := logging.Configure(config.Logger); err != nil {
+		return err
+	}
+	service.Configure(config)
+	reloader.OnReload(func(config *configs.Config) {
+		if err := logging.Configure(config.Logger); err != nil {
+			logrus.WithError(err).Error("Applying reloaded logger settings failed")
+		}
+		service.Configure(config)
+	})
+
+	db, err := repo.InitDB(config)
+	if err != nil {
+		return fmt.Errorf("database initialization failed: %w", err)
+	}
+
+	Run(reloader, db)
+	return nil
+}
+
+func printConfig(w io.Writer, args []string) error {
+	redacted := true
+	config, err := loadConfig("config print", args, func(fs *pflag.FlagSet) {
+		fs.BoolVar(&redacted, "redacted", true, "mask passwords and API keys")
+	})
+	if err != nil {
+		return err
+	}
+	if redacted {
+		config = config.Redacted()
+	}
+	return config.WriteYAML(w)
+}
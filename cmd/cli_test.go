@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteUsageErrors(t *testing.T) {
+	assert.Equal(t, 2, Execute([]string{"frobnicate"}))
+	assert.Equal(t, 2, Execute([]string{"rates"}))
+	assert.Equal(t, 2, Execute([]string{"user", "delete"}))
+	assert.Equal(t, 2, Execute([]string{"report", "--output", "xml"}))
+	assert.Equal(t, 2, Execute([]string{"report", "--no-such-flag"}))
+	assert.Equal(t, 0, Execute([]string{"help"}))
+}
+
+func TestReadTransactionsCSV(t *testing.T) {
+	input := "user_id,amount,currency,transaction_type,account_id,description\n" +
+		"1,10.50,USD,покупка,,coffee\n" +
+		"x,5,USD,покупка,,\n" +
+		"2,7,RUB,перевод,3,\n"
+
+	rows, err := readTransactions(strings.NewReader(input), formatCSV)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	assert.NoError(t, rows[0].err)
+	assert.Equal(t, 2, rows[0].line)
+	assert.Equal(t, models.Transaction{UserID: 1, Amount: 10.5, Currency: "USD", TransactionType: "покупка", Description: "coffee"}, rows[0].transaction)
+
+	assert.EqualError(t, rows[1].err, `user_id: "x" is not a number`)
+	assert.Equal(t, 3, rows[1].line)
+
+	require.NotNil(t, rows[2].transaction.AccountID)
+	assert.Equal(t, 3, *rows[2].transaction.AccountID)
+
+	_, err = readTransactions(strings.NewReader("user_id,amount\n"), formatCSV)
+	assert.EqualError(t, err, "CSV header has no currency column")
+}
+
+func TestExportCanBeImported(t *testing.T) {
+	accountID := 4
+	exported := []models.Transaction{
+		{ID: 1, UserID: 1, AccountID: &accountID, Amount: 12.3, Currency: "USD", TransactionType: "перевод", Category: "rent", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Description: "May, rent"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeTransactions(&buf, formatCSV, exported))
+	assert.Equal(t, "id,user_id,account_id,amount,currency,transaction_type,category,date,description\n"+
+		"1,1,4,12.30,USD,перевод,rent,2024-05-01T00:00:00Z,\"May, rent\"\n", buf.String())
+
+	rows, err := readTransactions(&buf, formatCSV)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	want := exported[0]
+	want.ID, want.Date = 0, time.Time{}
+	assert.Equal(t, want, rows[0].transaction)
+}
+
+func TestImportTransactionsReportsFailedRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(10))
+	mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var out bytes.Buffer
+	a := &admin{db: db, out: printer{w: &out, format: formatJSON}}
+	rows := []importRow{
+		{line: 2, transaction: models.Transaction{UserID: 1, Amount: 5, Currency: "USD", TransactionType: "покупка"}},
+		{line: 3, transaction: models.Transaction{UserID: 1, Amount: -1, Currency: "USD", TransactionType: "покупка"}},
+	}
+	err = importTransactions(context.Background(), a, rows, false)
+	assert.EqualError(t, err, "1 of 2 rows failed")
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	var result importResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	assert.Equal(t, 1, result.Created)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, 3, result.Failed[0].Row)
+	assert.Contains(t, result.Failed[0].Error, "amount")
+}
+
+func TestReportText(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`GROUP BY currency, transaction_type`).WithArgs("USD").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "transaction_type", "count", "amount", "commission"}).
+			AddRow("USD", "перевод", 2, 300.0, 6.0))
+
+	var out bytes.Buffer
+	a := &admin{db: db, out: printer{w: &out, format: formatText}}
+	require.NoError(t, summarize(context.Background(), a, models.TransactionFilter{Currency: "USD"}))
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "CURRENCY  TYPE     COUNT  AMOUNT  COMMISSION\n"+
+		"USD       перевод  2      300.00  6.00\n", out.String())
+}
+
+func TestFilterFlags(t *testing.T) {
+	f := filterFlags{user: 3, from: "2024-01-01", to: "2024-02-01T00:00:00Z"}
+	filter, err := f.filter()
+	require.NoError(t, err)
+	assert.Equal(t, 3, *filter.UserID)
+	assert.Nil(t, filter.AccountID)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *filter.From)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), *filter.To)
+
+	_, err = (&filterFlags{from: "yesterday"}).filter()
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// printer writes a command result to stdout, either as aligned text for
+// people or, with --output json, as a single JSON document for scripts. Logs
+// and errors go to stderr in both modes.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes v as JSON, or calls text with a tab-aligned writer.
+func (p printer) print(v interface{}, text func(w io.Writer)) error {
+	if p.format == formatJSON {
+		return writeJSON(p.w, v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func checkFormat(flag, format string, allowed ...string) error {
+	for _, a := range allowed {
+		if format == a {
+			return nil
+		}
+	}
+	return usagef("--%s must be one of %v, got %q", flag, allowed, format)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+func runRatesShow(args []string) error {
+	var base string
+	var currencies []string
+	a, err := setup("rates show", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&base, "base", "USD", "base currency")
+		fs.StringSliceVar(&currencies, "currency", nil, "only these currencies (repeat or comma-separate)")
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+	return showRates(ctx, a, strings.ToUpper(base), currencies)
+}
+
+func showRates(ctx context.Context, a *admin, base string, currencies []string) error {
+	rates, err := service.Rates(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	list := []models.Rate{}
+	if len(currencies) == 0 {
+		for code, rate := range rates {
+			list = append(list, models.Rate{CurrencyCode: code, Rate: rate})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].CurrencyCode < list[j].CurrencyCode })
+	} else {
+		for _, code := range currencies {
+			code = strings.ToUpper(code)
+			rate, ok := rates[code]
+			if !ok {
+				return fmt.Errorf("%w: no rate for %s", service.ErrUnknownCurrency, code)
+			}
+			list = append(list, models.Rate{CurrencyCode: code, Rate: rate})
+		}
+	}
+
+	result := struct {
+		Base  string        `json:"base"`
+		Rates []models.Rate `json:"rates"`
+	}{base, list}
+	return a.out.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "CURRENCY\tRATE (1 %s)\n", base)
+		for _, rate := range list {
+			fmt.Fprintf(w, "%s\t%g\n", rate.CurrencyCode, rate.Rate)
+		}
+	})
+}
+
+func runRatesFetch(args []string) error {
+	var base string
+	a, err := setup("rates fetch", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&base, "base", "USD", "base currency")
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+	return fetchRates(ctx, a, strings.ToUpper(base))
+}
+
+// fetchRates fails only when no provider answered, so a degraded but working
+// fallback chain still exits 0.
+func fetchRates(ctx context.Context, a *admin, base string) error {
+	statuses := service.ProbeProviders(ctx, base)
+	if err := a.out.print(statuses, func(w io.Writer) {
+		fmt.Fprintln(w, "PROVIDER\tSTATUS\tRATES\tLATENCY")
+		for _, s := range statuses {
+			status := "ok"
+			if s.Error != "" {
+				status = s.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%dms\n", s.Name, status, s.Rates, s.LatencyMS)
+		}
+	}); err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		if s.Error == "" {
+			return nil
+		}
+	}
+	return errors.New("no rate provider answered")
+}
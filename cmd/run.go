@@ -1,14 +1,78 @@
 package cmd
 
 import (
-	"DZ_ITOG/handlers"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/outbox"
+	"DZ_ITOG/server"
+	"DZ_ITOG/webhook"
+	"context"
 	"database/sql"
-	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
 )
 
-func Run(db *sql.DB) {
-	http.HandleFunc("/item", handlers.Item(db))
-	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// Run serves the HTTP API until SIGINT or SIGTERM, then drains in-flight
+// requests and closes the database. Meanwhile the config is reloaded on file
+// changes and SIGHUP, and the webhook dispatcher and outbox relay run if
+// enabled.
+func Run(reloader *configs.Reloader, db *sql.DB) {
+	config := reloader.Current()
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if err := reloader.Watch(watchCtx); err != nil {
+		logrus.WithError(err).Warn("Config file watching disabled, reload with SIGHUP")
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+	if config.Webhooks.Enabled {
+		startWorker(webhook.NewDispatcher(config.Webhooks, db, nil).Run)
+	}
+	if config.Outbox.Enabled {
+		if sink, err := outbox.NewSink(config.Outbox); err != nil {
+			logrus.WithError(err).Error("Outbox relay disabled, events accumulate until it is fixed")
+		} else {
+			startWorker(outbox.NewRelay(config.Outbox, db, sink).Run)
+		}
+	}
+
+	srv := server.New(reloader, db)
+	serverErr := srv.Start()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		logrus.Errorf("Server failed: %v", err)
+	case sig := <-stop:
+		logrus.Infof("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.Errorf("Graceful shutdown did not finish in %s: %v", config.Server.ShutdownTimeout, err)
+	}
+	// Webhook deliveries in flight are retried after their lease expires, and
+	// an interrupted outbox batch is published again.
+	stopWorkers()
+	workers.Wait()
+
+	if err := db.Close(); err != nil {
+		logrus.Errorf("Closing database failed: %v", err)
+	}
+	logrus.Info("Server stopped")
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/seed"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runSeed(args []string) error {
+	options := seed.DefaultOptions()
+	var from, to string
+	var dryRun bool
+	a, err := setup("seed", args, func(fs *pflag.FlagSet) {
+		fs.Int64Var(&options.Seed, "seed", options.Seed, "random seed; the same seed and counts give the same data")
+		fs.IntVar(&options.Users, "users", options.Users, "number of users, each with one to three accounts")
+		fs.IntVar(&options.Transactions, "transactions", options.Transactions, "number of transactions")
+		fs.StringVar(&from, "from", options.From.Format("2006-01-02"), "first day of the generated dates")
+		fs.StringVar(&to, "to", options.To.Format("2006-01-02"), "day after the last generated date")
+		fs.BoolVar(&dryRun, "dry-run", false, "print the expected totals without writing anything")
+	})
+	if err != nil {
+		return err
+	}
+	fromDate, err := parseDate("from", from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseDate("to", to)
+	if err != nil {
+		return err
+	}
+	if fromDate != nil {
+		options.From = *fromDate
+	}
+	if toDate != nil {
+		options.To = *toDate
+	}
+	data, err := seed.Generate(options)
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	if dryRun {
+		return printSeed(a, options, data, "")
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	defer a.close()
+	return loadSeed(ctx, a, options, data)
+}
+
+// loadSeed stores data with one generated password shared by every seeded
+// user, hashed once because bcrypt is deliberately slow.
+func loadSeed(ctx context.Context, a *admin, options seed.Options, data *seed.Dataset) error {
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := seed.Load(ctx, a.db, data, string(hash)); err != nil {
+		return err
+	}
+	return printSeed(a, options, data, password)
+}
+
+func printSeed(a *admin, options seed.Options, data *seed.Dataset, password string) error {
+	result := struct {
+		Seed         int64                       `json:"seed"`
+		Stored       bool                        `json:"stored"`
+		Users        int                         `json:"users"`
+		Accounts     int                         `json:"accounts"`
+		Transactions int                         `json:"transactions"`
+		Commissions  int                         `json:"commissions"`
+		Password     string                      `json:"password,omitempty"`
+		Totals       []models.TransactionSummary `json:"totals"`
+	}{options.Seed, password != "", len(data.Users), len(data.Accounts), len(data.Transactions), len(data.Commissions), password, data.Totals}
+
+	return a.out.print(result, func(w io.Writer) {
+		verb := "Would seed"
+		if result.Stored {
+			verb = "Seeded"
+		}
+		fmt.Fprintf(w, "%s %d users, %d accounts, %d transactions and %d commissions from seed %d\n",
+			verb, result.Users, result.Accounts, result.Transactions, result.Commissions, options.Seed)
+		if password != "" {
+			fmt.Fprintf(w, "Password for every seeded user: %s\n", password)
+		}
+		fmt.Fprintln(w)
+		writeSummaries(w, data.Totals)
+	})
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const formatCSV = "csv"
+
+// csvColumns is the export layout. Import reads the same header, ignoring the
+// columns the server assigns itself (id and date).
+var csvColumns = []string{"id", "user_id", "account_id", "amount", "currency", "transaction_type", "category", "date", "description"}
+
+// importRow is one parsed input record; err is set when it could not be read.
+type importRow struct {
+	line        int
+	transaction models.Transaction
+	err         error
+}
+
+type rowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importResult struct {
+	DryRun  bool       `json:"dry_run"`
+	Rows    int        `json:"rows"`
+	Created int        `json:"created"`
+	Failed  []rowError `json:"failed"`
+}
+
+func runImport(args []string) error {
+	var format string
+	var dryRun bool
+	return connected("import", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&format, "format", "", "input format: csv or json (default from the file extension, csv for stdin)")
+		fs.BoolVar(&dryRun, "dry-run", false, "validate every row without storing anything")
+	}, func(ctx context.Context, a *admin) error {
+		if len(a.args) != 1 {
+			return usagef("import needs exactly one FILE argument, or - for stdin")
+		}
+		path := a.args[0]
+		if format == "" {
+			format = formatCSV
+			if strings.EqualFold(filepath.Ext(path), ".json") {
+				format = formatJSON
+			}
+		}
+		if err := checkFormat("format", format, formatCSV, formatJSON); err != nil {
+			return err
+		}
+
+		in := io.Reader(os.Stdin)
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			in = file
+		}
+		rows, err := readTransactions(in, format)
+		if err != nil {
+			return err
+		}
+		return importTransactions(ctx, a, rows, dryRun)
+	})
+}
+
+// importTransactions creates each row through the transaction service, so
+// imported rows are validated and charged exactly like API requests. Rows are
+// independent: a bad row is reported and the rest are still imported.
+func importTransactions(ctx context.Context, a *admin, rows []importRow, dryRun bool) error {
+	transactions := service.NewTransactionService(a.db)
+	result := importResult{DryRun: dryRun, Rows: len(rows), Failed: []rowError{}}
+	for _, row := range rows {
+		err := row.err
+		if err == nil && dryRun {
+			err = transactions.Validate(ctx, row.transaction)
+		} else if err == nil {
+			_, err = transactions.Create(ctx, row.transaction)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result.Failed = append(result.Failed, rowError{Row: row.line, Error: err.Error()})
+			continue
+		}
+		result.Created++
+	}
+
+	if err := a.out.print(result, func(w io.Writer) {
+		for _, failed := range result.Failed {
+			fmt.Fprintf(w, "row %d\t%s\n", failed.Row, failed.Error)
+		}
+		verb := "imported"
+		if dryRun {
+			verb = "valid"
+		}
+		fmt.Fprintf(w, "%d of %d rows %s\n", result.Created, result.Rows, verb)
+	}); err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d of %d rows failed", len(result.Failed), result.Rows)
+	}
+	return nil
+}
+
+// readTransactions parses the whole input. Rows are numbered as in the file:
+// the CSV header is row 1, the first JSON array element is row 1.
+func readTransactions(r io.Reader, format string) ([]importRow, error) {
+	if format == formatJSON {
+		var transactions []models.Transaction
+		if err := json.NewDecoder(r).Decode(&transactions); err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		rows := make([]importRow, 0, len(transactions))
+		for i, transaction := range transactions {
+			rows = append(rows, importRow{line: i + 1, transaction: transaction})
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"user_id", "amount", "currency", "transaction_type"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header has no %s column", required)
+		}
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, importRow{line: line, err: err})
+			continue
+		}
+		transaction, err := transactionFromRecord(record, columns)
+		rows = append(rows, importRow{line: line, transaction: transaction, err: err})
+	}
+}
+
+func transactionFromRecord(record []string, columns map[string]int) (models.Transaction, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	transaction := models.Transaction{
+		Currency:        field("currency"),
+		TransactionType: field("transaction_type"),
+		Category:        field("category"),
+		Description:     field("description"),
+	}
+	var err error
+	if transaction.UserID, err = strconv.Atoi(field("user_id")); err != nil {
+		return transaction, fmt.Errorf("user_id: %q is not a number", field("user_id"))
+	}
+	if transaction.Amount, err = strconv.ParseFloat(field("amount"), 64); err != nil {
+		return transaction, fmt.Errorf("amount: %q is not a number", field("amount"))
+	}
+	if value := field("account_id"); value != "" {
+		accountID, err := strconv.Atoi(value)
+		if err != nil {
+			return transaction, fmt.Errorf("account_id: %q is not a number", value)
+		}
+		transaction.AccountID = &accountID
+	}
+	return transaction, nil
+}
+
+func runExport(args []string) error {
+	var filters filterFlags
+	var format, path string
+	return connected("export", args, func(fs *pflag.FlagSet) {
+		filters.register(fs)
+		fs.StringVar(&format, "format", formatCSV, "file format: csv or json")
+		fs.StringVar(&path, "file", "", "write to this file instead of stdout")
+	}, func(ctx context.Context, a *admin) error {
+		if err := checkFormat("format", format, formatCSV, formatJSON); err != nil {
+			return err
+		}
+		filter, err := filters.filter()
+		if err != nil {
+			return err
+		}
+		transactions, err := service.NewTransactionService(a.db).Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			return writeTransactions(os.Stdout, format, transactions)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := writeTransactions(file, format, transactions); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		result := map[string]interface{}{"file": path, "transactions": len(transactions)}
+		return a.out.print(result, func(w io.Writer) {
+			fmt.Fprintf(w, "Exported %d transactions to %s\n", len(transactions), path)
+		})
+	})
+}
+
+func writeTransactions(w io.Writer, format string, transactions []models.Transaction) error {
+	if format == formatJSON {
+		return writeJSON(w, transactions)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, t := range transactions {
+		accountID := ""
+		if t.AccountID != nil {
+			accountID = strconv.Itoa(*t.AccountID)
+		}
+		if err := writer.Write([]string{
+			strconv.Itoa(t.ID),
+			strconv.Itoa(t.UserID),
+			accountID,
+			strconv.FormatFloat(t.Amount, 'f', 2, 64),
+			t.Currency,
+			t.TransactionType,
+			t.Category,
+			t.Date.Format(time.RFC3339),
+			t.Description,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
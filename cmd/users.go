@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Passwords are never taken as flag values, which would leave them in the
+// shell history and the process list: they are read from stdin with
+// --password-stdin or generated and printed once.
+
+func runUserCreate(args []string) error {
+	var name, email string
+	var passwordStdin bool
+	return connected("user create", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&name, "name", "", "display name")
+		fs.StringVar(&email, "email", "", "email address, unique per user")
+		fs.BoolVar(&passwordStdin, "password-stdin", false, "read the password from the first line of stdin instead of generating one")
+	}, func(ctx context.Context, a *admin) error {
+		password, generated, err := choosePassword(os.Stdin, passwordStdin)
+		if err != nil {
+			return err
+		}
+		return createUser(ctx, a, name, email, password, generated)
+	})
+}
+
+func createUser(ctx context.Context, a *admin, name, email, password string, generated bool) error {
+	user, err := service.NewUserService(a.db).Create(ctx, name, email, password)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password,omitempty"`
+	}{ID: user.ID, Name: user.Name, Email: user.Email}
+	if generated {
+		result.Password = password
+	}
+	return a.out.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Created user %d <%s>\n", user.ID, user.Email)
+		if generated {
+			fmt.Fprintf(w, "Password: %s\n", password)
+		}
+	})
+}
+
+func runUserResetPassword(args []string) error {
+	var email string
+	var passwordStdin bool
+	return connected("user reset-password", args, func(fs *pflag.FlagSet) {
+		fs.StringVar(&email, "email", "", "email address of the user")
+		fs.BoolVar(&passwordStdin, "password-stdin", false, "read the password from the first line of stdin instead of generating one")
+	}, func(ctx context.Context, a *admin) error {
+		password, generated, err := choosePassword(os.Stdin, passwordStdin)
+		if err != nil {
+			return err
+		}
+		if err := service.NewUserService(a.db).ResetPassword(ctx, email, password); err != nil {
+			return err
+		}
+
+		result := struct {
+			Email    string `json:"email"`
+			Password string `json:"password,omitempty"`
+		}{Email: email}
+		if generated {
+			result.Password = password
+		}
+		return a.out.print(result, func(w io.Writer) {
+			fmt.Fprintf(w, "Password reset for <%s>\n", email)
+			if generated {
+				fmt.Fprintf(w, "Password: %s\n", password)
+			}
+		})
+	})
+}
+
+func runUserSetRoles(args []string) error {
+	var roles []string
+	return connected("user set-roles", args, func(fs *pflag.FlagSet) {
+		fs.StringSliceVar(&roles, "role", nil, "role to grant, repeatable: "+strings.Join(models.Roles, ", ")+"; none makes the user a customer")
+	}, func(ctx context.Context, a *admin) error {
+		if len(a.args) != 1 {
+			return usagef("user set-roles takes exactly one user id")
+		}
+		id, err := strconv.Atoi(a.args[0])
+		if err != nil {
+			return usagef("user id must be an integer, got %q", a.args[0])
+		}
+		result, err := service.NewUserService(a.db).SetRoles(ctx, models.UserRoles{UserID: id, Roles: append([]string{}, roles...)})
+		if err != nil {
+			return err
+		}
+		event := models.AuditEvent{
+			Action:   "cli user set-roles",
+			Resource: fmt.Sprintf("/admin/users/%d/roles", id),
+			Outcome:  models.AuditAllowed,
+			Reason:   "roles set to [" + strings.Join(result.Roles, ", ") + "]",
+		}
+		if err := repo.CreateAuditEvent(ctx, event, a.db); err != nil {
+			return fmt.Errorf("roles changed but the audit event was not written: %w", err)
+		}
+		return a.out.print(result, func(w io.Writer) {
+			if len(result.Roles) == 0 {
+				fmt.Fprintf(w, "User %d now has no roles and is treated as a customer\n", id)
+				return
+			}
+			fmt.Fprintf(w, "User %d now has roles: %s\n", id, strings.Join(result.Roles, ", "))
+		})
+	})
+}
+
+// choosePassword reads the password from in, or generates one, and reports
+// whether it was generated.
+func choosePassword(in io.Reader, fromStdin bool) (string, bool, error) {
+	if fromStdin {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", false, err
+		}
+		return strings.TrimRight(line, "\r\n"), false, nil
+	}
+	password, err := generatePassword()
+	return password, true, err
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
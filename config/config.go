@@ -1,34 +1,571 @@
 package configs
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// DefaultConfigFile is read when no --config flag or APP_CONFIG is given.
+// Unlike an explicitly named file, it may be missing.
+const DefaultConfigFile = "./config/config.yaml"
+
+// EnvPrefix prefixes every environment override, e.g. APP_SERVER_PORT or
+// APP_DATABASE_PASSWORD.
+const EnvPrefix = "APP"
+
 type Config struct {
-	Logger struct {
-		LogFile string `mapstructure:"logFile"`
-	} `mapstructure:"logger"`
-	Database struct {
-		Host     string `mapstructure:"host"`
-		Port     int    `mapstructure:"port"`
-		User     string `mapstructure:"user"`
-		Password string `mapstructure:"password"`
-		DBName   string `mapstructure:"dbname"`
-		SSLMode  string `mapstructure:"sslmode"`
-	} `mapstructure:"database"`
+	Server      ServerConfig     `mapstructure:"server"`
+	GRPC        GRPCConfig       `mapstructure:"grpc"`
+	GraphQL     GraphQLConfig    `mapstructure:"graphql"`
+	Logger      LoggerConfig     `mapstructure:"logger"`
+	Database    DatabaseConfig   `mapstructure:"database"`
+	Rates       RatesConfig      `mapstructure:"rates"`
+	Commission  CommissionConfig `mapstructure:"commission"`
+	RateLimit   RateLimitConfig  `mapstructure:"rateLimit"`
+	Auth        AuthConfig       `mapstructure:"auth"`
+	Webhooks    WebhookConfig    `mapstructure:"webhooks"`
+	Outbox      OutboxConfig     `mapstructure:"outbox"`
+	Stream      StreamConfig     `mapstructure:"stream"`
+	Risk        RiskConfig       `mapstructure:"risk"`
+	Attachments AttachmentConfig `mapstructure:"attachments"`
+	Search      SearchConfig     `mapstructure:"search"`
+}
+
+// ServerConfig.TrustedProxies lists the addresses and CIDR ranges of the
+// reverse proxies in front of the API. Only requests from them may set the
+// client IP through X-Forwarded-For or X-Real-IP; the default, none, uses the
+// address of the connection.
+type ServerConfig struct {
+	Port              int           `mapstructure:"port"`
+	AdminPort         int           `mapstructure:"adminPort"`
+	ReadTimeout       time.Duration `mapstructure:"readTimeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `mapstructure:"writeTimeout"`
+	IdleTimeout       time.Duration `mapstructure:"idleTimeout"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdownTimeout"`
+	TrustedProxies    []string      `mapstructure:"trustedProxies"`
+}
+
+// GRPCConfig.Port 0, the default, disables the gRPC listener. A listener
+// needs AuthToken (or the file at AuthTokenFile): every call except health
+// and reflection must send it as "authorization: Bearer <token>" metadata.
+// Holders of the token have admin access to every user's transactions, so
+// the listener is meant for trusted internal services only.
+type GRPCConfig struct {
+	Port          int    `mapstructure:"port"`
+	Reflection    bool   `mapstructure:"reflection"`
+	AuthToken     string `mapstructure:"authToken"`
+	AuthTokenFile string `mapstructure:"authTokenFile"`
+}
+
+// GraphQLConfig.ComplexityLimit caps the cost of one /graphql operation:
+// every field costs 1 and list fields multiply their selection by the page
+// size asked for. Playground serves the GraphiQL IDE on GET /graphql.
+type GraphQLConfig struct {
+	ComplexityLimit int  `mapstructure:"complexityLimit"`
+	Playground      bool `mapstructure:"playground"`
+}
+
+// LoggerConfig.Output is "stdout", "stderr" or "file"; the latter writes to
+// LogFile and rotates it once it reaches MaxSizeMB.
+type LoggerConfig struct {
+	Level      string `mapstructure:"level"`
+	Format     string `mapstructure:"format"`
+	Output     string `mapstructure:"output"`
+	LogFile    string `mapstructure:"logFile"`
+	MaxSizeMB  int    `mapstructure:"maxSizeMB"`
+	MaxBackups int    `mapstructure:"maxBackups"`
+	MaxAgeDays int    `mapstructure:"maxAgeDays"`
+	Compress   bool   `mapstructure:"compress"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `mapstructure:"host"`
+	Port            int           `mapstructure:"port"`
+	User            string        `mapstructure:"user"`
+	Password        string        `mapstructure:"password"`
+	PasswordFile    string        `mapstructure:"passwordFile"`
+	DBName          string        `mapstructure:"dbname"`
+	SSLMode         string        `mapstructure:"sslmode"`
+	MaxOpenConns    int           `mapstructure:"maxOpenConns"`
+	MaxIdleConns    int           `mapstructure:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `mapstructure:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"connMaxIdleTime"`
+}
+
+// RatesConfig.CacheTTL is how long fetched rates are reused per base
+// currency; 0 fetches on every conversion.
+type RatesConfig struct {
+	Timeout   time.Duration  `mapstructure:"timeout"`
+	CacheTTL  time.Duration  `mapstructure:"cacheTTL"`
+	Providers []RateProvider `mapstructure:"providers"`
+}
+
+// RateProvider describes one currency rate API. URL may contain {apiKey} and
+// {base} placeholders; RatesField names the JSON object holding the rates.
+// The key itself comes from APIKey, the file at APIKeyFile or the environment
+// variable named by APIKeyEnv, in that order.
+type RateProvider struct {
+	Name       string `mapstructure:"name"`
+	URL        string `mapstructure:"url"`
+	RatesField string `mapstructure:"ratesField"`
+	APIKey     string `mapstructure:"apiKey"`
+	APIKeyFile string `mapstructure:"apiKeyFile"`
+	APIKeyEnv  string `mapstructure:"apiKeyEnv"`
+}
+
+type CommissionConfig struct {
+	Rules []CommissionRule `mapstructure:"rules"`
+}
+
+// CommissionRule charges Rate (a fraction, 0.02 is 2%) on transactions of the
+// given type and currency. With Refundable, refunds return the commission in
+// proportion to the amount refunded.
+type CommissionRule struct {
+	TransactionType string  `mapstructure:"transactionType" json:"transaction_type"`
+	Currency        string  `mapstructure:"currency" json:"currency,omitempty"`
+	Rate            float64 `mapstructure:"rate" json:"rate"`
+	Refundable      bool    `mapstructure:"refundable" json:"refundable,omitempty"`
+}
+
+// RateLimitConfig throttles the public HTTP API with token buckets. A request
+// is counted against both its API key and the key's user, else its user, else
+// its client IP. Requests
+// that convert currencies also spend the caller's Conversion quota, since each
+// may cost a paid rate API call. Store is "memory" for a single instance or
+// "postgres" to share the buckets between instances.
+type RateLimitConfig struct {
+	Enabled    bool        `mapstructure:"enabled"`
+	Store      string      `mapstructure:"store"`
+	PerIP      LimitConfig `mapstructure:"perIP"`
+	PerUser    LimitConfig `mapstructure:"perUser"`
+	PerAPIKey  LimitConfig `mapstructure:"perAPIKey"`
+	Conversion LimitConfig `mapstructure:"conversion"`
+}
+
+// AuthConfig governs API keys. With RequireAPIKey unset, anonymous requests
+// keep full access to the public API and only keyed requests are held to
+// their scopes. RotationGrace is how long a rotated key keeps working by
+// default, so clients can switch over without downtime.
+type AuthConfig struct {
+	RequireAPIKey bool          `mapstructure:"requireAPIKey"`
+	RotationGrace time.Duration `mapstructure:"rotationGrace"`
+}
+
+// WebhookConfig drives webhook delivery. The dispatcher looks for due
+// deliveries every PollInterval and sends up to BatchSize of them, each
+// within Timeout. A failed delivery is retried after BackoffBase, doubling up
+// to BackoffMax, until MaxAttempts have failed and it is marked dead. With
+// Enabled unset, events are still queued but nothing is sent.
+type WebhookConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	BatchSize    int           `mapstructure:"batchSize"`
+	MaxAttempts  int           `mapstructure:"maxAttempts"`
+	BackoffBase  time.Duration `mapstructure:"backoffBase"`
+	BackoffMax   time.Duration `mapstructure:"backoffMax"`
+}
+
+// OutboxConfig drives the outbox relay. Every PollInterval it publishes up
+// to BatchSize unpublished events to Sink ("stdout", "file" writing JSON
+// lines to File, "memory", or a sink registered with outbox.RegisterSink),
+// and deletes events published more than Retention ago. With Enabled unset,
+// events still accumulate in the outbox and are published once it is set.
+type OutboxConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Sink         string        `mapstructure:"sink"`
+	File         string        `mapstructure:"file"`
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+	BatchSize    int           `mapstructure:"batchSize"`
+	Retention    time.Duration `mapstructure:"retention"`
+}
+
+// StreamConfig shapes GET /transactions/stream. A comment is sent every
+// Heartbeat so proxies keep the connection open, and each stream ends after
+// MaxDuration, before server.writeTimeout cuts it; clients reconnect and
+// resume with Last-Event-ID.
+type StreamConfig struct {
+	Heartbeat   time.Duration `mapstructure:"heartbeat"`
+	MaxDuration time.Duration `mapstructure:"maxDuration"`
+}
+
+// AttachmentConfig governs the files attached to transactions. They are kept
+// in Store: "local" writes them under Dir, "memory" keeps them in the process
+// and other stores can be added with blob.RegisterStore. Uploads larger than
+// MaxSize bytes, or whose content is not of one of Types, are refused.
+type AttachmentConfig struct {
+	Store   string   `mapstructure:"store"`
+	Dir     string   `mapstructure:"dir"`
+	MaxSize int64    `mapstructure:"maxSize"`
+	Types   []string `mapstructure:"types"`
+}
+
+// SearchConfig drives GET /transactions/search. Backend "postgres" searches
+// with the database's full-text search and pg_trgm; "memory" keeps an index
+// of the transactions in the process, for databases without them. A word
+// resembling a searched one with at least Similarity (0 to 1, in trigrams)
+// counts as a typo of it.
+type SearchConfig struct {
+	Backend    string  `mapstructure:"backend"`
+	Similarity float64 `mapstructure:"similarity"`
+}
+
+// Risk rule actions. A flagged transaction is stored and listed for review,
+// a held one waits in the review queue until it is approved, and a rejected
+// one is refused. The strictest action of the rules that fire wins.
+const (
+	RiskOff    = "off"
+	RiskFlag   = "flag"
+	RiskHold   = "hold"
+	RiskReject = "reject"
+)
+
+// RiskConfig holds the rules new transactions are checked against before
+// they are stored. A rule with no action or "off" is not evaluated.
+type RiskConfig struct {
+	Velocity          VelocityRule          `mapstructure:"velocity"`
+	LargeAmount       LargeAmountRule       `mapstructure:"largeAmount"`
+	CurrencySwitching CurrencySwitchingRule `mapstructure:"currencySwitching"`
+	SmallTransfers    SmallTransfersRule    `mapstructure:"smallTransfers"`
+}
+
+// VelocityRule fires when a user would have more than MaxCount transactions
+// within Window.
+type VelocityRule struct {
+	Action   string        `mapstructure:"action"`
+	Window   time.Duration `mapstructure:"window"`
+	MaxCount int           `mapstructure:"maxCount"`
+}
+
+// LargeAmountRule fires when an amount is more than Factor times the user's
+// average in the same currency over Lookback. Users with fewer than
+// MinHistory such transactions are not judged.
+type LargeAmountRule struct {
+	Action     string        `mapstructure:"action"`
+	Factor     float64       `mapstructure:"factor"`
+	Lookback   time.Duration `mapstructure:"lookback"`
+	MinHistory int           `mapstructure:"minHistory"`
+}
+
+// CurrencySwitchingRule fires when a user's transactions within Window would
+// use more than MaxCurrencies currencies.
+type CurrencySwitchingRule struct {
+	Action        string        `mapstructure:"action"`
+	Window        time.Duration `mapstructure:"window"`
+	MaxCurrencies int           `mapstructure:"maxCurrencies"`
+}
+
+// SmallTransfersRule fires when a user would have more than MaxCount
+// transfers ("перевод") of at most MaxAmount, in any currency, within Window.
+type SmallTransfersRule struct {
+	Action    string        `mapstructure:"action"`
+	Window    time.Duration `mapstructure:"window"`
+	MaxAmount float64       `mapstructure:"maxAmount"`
+	MaxCount  int           `mapstructure:"maxCount"`
+}
+
+// LimitConfig allows Requests per Per on average, and up to Burst at once.
+type LimitConfig struct {
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+// Default returns the built-in settings every other layer overrides.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   15 * time.Second,
+		},
+		GRPC: GRPCConfig{
+			Port:       0,
+			Reflection: true,
+		},
+		GraphQL: GraphQLConfig{
+			ComplexityLimit: 1000,
+			Playground:      true,
+		},
+		Logger: LoggerConfig{
+			Level:      "info",
+			Format:     "json",
+			Output:     "stdout",
+			LogFile:    "app.log",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAgeDays: 30,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			DBName:          "postgres",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Rates: RatesConfig{
+			Timeout:  10 * time.Second,
+			CacheTTL: 10 * time.Minute,
+			Providers: []RateProvider{
+				{
+					Name:       "freecurrencyapi",
+					URL:        "https://api.freecurrencyapi.com/v1/latest?apikey={apiKey}&base_currency={base}",
+					RatesField: "data",
+					APIKeyEnv:  "FREECURRENCYAPI_KEY",
+				},
+				{
+					Name:       "exchangerate-api",
+					URL:        "https://v6.exchangerate-api.com/v6/{apiKey}/latest/{base}",
+					RatesField: "conversion_rates",
+					APIKeyEnv:  "EXCHANGERATE_API_KEY",
+				},
+			},
+		},
+		Commission: CommissionConfig{
+			Rules: []CommissionRule{
+				{TransactionType: "перевод", Currency: "USD", Rate: 0.02},
+				{TransactionType: "перевод", Currency: "RUB", Rate: 0.05},
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:    true,
+			Store:      "memory",
+			PerIP:      LimitConfig{Requests: 300, Per: time.Minute, Burst: 60},
+			PerUser:    LimitConfig{Requests: 600, Per: time.Minute, Burst: 100},
+			PerAPIKey:  LimitConfig{Requests: 1200, Per: time.Minute, Burst: 200},
+			Conversion: LimitConfig{Requests: 100, Per: time.Hour, Burst: 20},
+		},
+		Auth: AuthConfig{
+			RotationGrace: 24 * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			Enabled:      true,
+			PollInterval: 2 * time.Second,
+			Timeout:      10 * time.Second,
+			BatchSize:    20,
+			MaxAttempts:  8,
+			BackoffBase:  30 * time.Second,
+			BackoffMax:   time.Hour,
+		},
+		Outbox: OutboxConfig{
+			Sink:         "stdout",
+			PollInterval: time.Second,
+			BatchSize:    100,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Stream: StreamConfig{
+			Heartbeat:   10 * time.Second,
+			MaxDuration: 25 * time.Second,
+		},
+		Risk: RiskConfig{
+			Velocity:          VelocityRule{Action: RiskOff, Window: time.Hour, MaxCount: 20},
+			LargeAmount:       LargeAmountRule{Action: RiskOff, Factor: 10, Lookback: 90 * 24 * time.Hour, MinHistory: 5},
+			CurrencySwitching: CurrencySwitchingRule{Action: RiskOff, Window: time.Hour, MaxCurrencies: 3},
+			SmallTransfers:    SmallTransfersRule{Action: RiskOff, Window: time.Hour, MaxAmount: 100, MaxCount: 10},
+		},
+		Attachments: AttachmentConfig{
+			Store:   "local",
+			Dir:     "./data/attachments",
+			MaxSize: 10 << 20,
+			Types:   []string{"image/jpeg", "image/png", "image/webp", "application/pdf"},
+		},
+		Search: SearchConfig{
+			Backend:    "postgres",
+			Similarity: 0.4,
+		},
+	}
+}
+
+// RegisterFlags adds the command-line overrides understood by Load. Secrets
+// have no flags so they never show up in the process list.
+func RegisterFlags(fs *pflag.FlagSet) {
+	fs.String("config", DefaultConfigFile, "path to the YAML config file")
+	fs.Int("port", 0, "public HTTP port")
+	fs.Int("admin-port", 0, "admin HTTP port, 0 serves admin endpoints on the public port")
+	fs.Int("grpc-port", 0, "gRPC port")
+	fs.String("log-level", "", "log level (trace, debug, info, warn, error)")
+	fs.String("db-host", "", "database host")
+	fs.Int("db-port", 0, "database port")
+	fs.String("db-user", "", "database user")
+	fs.String("db-name", "", "database name")
+	fs.String("db-sslmode", "", "database sslmode")
+}
+
+var flagKeys = map[string]string{
+	"port":       "server.port",
+	"admin-port": "server.adminPort",
+	"grpc-port":  "grpc.port",
+	"log-level":  "logger.level",
+	"db-host":    "database.host",
+	"db-port":    "database.port",
+	"db-user":    "database.user",
+	"db-name":    "database.dbname",
+	"db-sslmode": "database.sslmode",
 }
 
 func LoadConfig(configFilePath string) (*Config, error) {
-	viper.SetConfigFile(configFilePath)
+	v, err := newViper(configFilePath, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decode(v)
+}
 
-	if err := viper.ReadInConfig(); err != nil {
+// Load builds the configuration from defaults, the config file, APP_*
+// environment variables and the flags registered by RegisterFlags, each layer
+// overriding the previous one. Secrets are resolved and the result validated.
+func Load(flags *pflag.FlagSet) (*Config, error) {
+	path, explicit := configPath(flags)
+	v, err := newViper(path, explicit, flags)
+	if err != nil {
 		return nil, err
 	}
+	return decode(v)
+}
+
+// configPath picks the config file from --config, then APP_CONFIG, then the
+// default location, and reports whether it was chosen explicitly.
+func configPath(flags *pflag.FlagSet) (string, bool) {
+	path, explicit := DefaultConfigFile, false
+	if env := os.Getenv(EnvPrefix + "_CONFIG"); env != "" {
+		path, explicit = env, true
+	}
+	if flags != nil {
+		if f := flags.Lookup("config"); f != nil && f.Changed {
+			path, explicit = f.Value.String(), true
+		}
+	}
+	return path, explicit
+}
+
+func newViper(path string, required bool, flags *pflag.FlagSet) (*viper.Viper, error) {
+	v := viper.New()
+
+	defaults := map[string]interface{}{}
+	if err := mapstructure.Decode(Default(), &defaults); err != nil {
+		return nil, err
+	}
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound *os.PathError
+		if required || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+	}
 
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if flags != nil {
+		for name, key := range flagKeys {
+			if f := flags.Lookup(name); f != nil {
+				if err := v.BindPFlag(key, f); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return v, nil
+}
+
+func decode(v *viper.Viper) (*Config, error) {
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
 	return &config, nil
 }
+
+// resolveSecrets fills the database password, gRPC token and provider API keys from
+// files or environment variables when they are not set inline.
+func (c *Config) resolveSecrets() error {
+	if c.Database.Password == "" && c.Database.PasswordFile != "" {
+		secret, err := readSecretFile(c.Database.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("database.passwordFile: %w", err)
+		}
+		c.Database.Password = secret
+	}
+	if c.GRPC.AuthToken == "" && c.GRPC.AuthTokenFile != "" {
+		secret, err := readSecretFile(c.GRPC.AuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("grpc.authTokenFile: %w", err)
+		}
+		c.GRPC.AuthToken = secret
+	}
+	for i := range c.Rates.Providers {
+		p := &c.Rates.Providers[i]
+		if p.APIKey != "" {
+			continue
+		}
+		switch {
+		case p.APIKeyFile != "":
+			secret, err := readSecretFile(p.APIKeyFile)
+			if err != nil {
+				return fmt.Errorf("rates.providers[%s].apiKeyFile: %w", p.Name, err)
+			}
+			p.APIKey = secret
+		case p.APIKeyEnv != "":
+			p.APIKey = os.Getenv(p.APIKeyEnv)
+		}
+	}
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+const redactedValue = "******"
+
+// Redacted returns a copy of the config with every secret masked, suitable
+// for printing or logging.
+func (c *Config) Redacted() *Config {
+	out := *c
+	if out.Database.Password != "" {
+		out.Database.Password = redactedValue
+	}
+	if out.GRPC.AuthToken != "" {
+		out.GRPC.AuthToken = redactedValue
+	}
+	out.Rates.Providers = append([]RateProvider(nil), c.Rates.Providers...)
+	for i := range out.Rates.Providers {
+		if out.Rates.Providers[i].APIKey != "" {
+			out.Rates.Providers[i].APIKey = redactedValue
+		}
+	}
+	out.Commission.Rules = append([]CommissionRule(nil), c.Commission.Rules...)
+	return &out
+}
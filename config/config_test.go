@@ -0,0 +1,135 @@
+package configs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.yaml", `
+server:
+  port: 8081
+  shutdownTimeout: "3s"
+database:
+  user: "file-user"
+  host: "file-host"
+`)
+
+	t.Setenv("APP_DATABASE_HOST", "env-host")
+	t.Setenv("APP_SERVER_PORT", "8082")
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--config", path, "--port", "8083"}))
+
+	config, err := Load(fs)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8083, config.Server.Port, "flag overrides env")
+	assert.Equal(t, "env-host", config.Database.Host, "env overrides file")
+	assert.Equal(t, "file-user", config.Database.User, "file overrides default")
+	assert.Equal(t, 3*time.Second, config.Server.ShutdownTimeout)
+	assert.Equal(t, 5432, config.Database.Port, "default kept")
+	assert.Len(t, config.Commission.Rules, 2)
+}
+
+func TestLoadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := writeFile(t, dir, "db-password", "s3cret\n")
+	keyFile := writeFile(t, dir, "api-key", "file-key")
+	tokenFile := writeFile(t, dir, "grpc-token", "grpc-token-value\n")
+	path := writeFile(t, dir, "config.yaml", `
+grpc:
+  authTokenFile: "`+tokenFile+`"
+database:
+  user: "user"
+  passwordFile: "`+passwordFile+`"
+rates:
+  providers:
+    - name: "primary"
+      url: "https://rates.example/{apiKey}/{base}"
+      ratesField: "data"
+      apiKeyFile: "`+keyFile+`"
+    - name: "backup"
+      url: "https://backup.example/{base}?key={apiKey}"
+      ratesField: "rates"
+      apiKeyEnv: "BACKUP_RATES_KEY"
+`)
+	t.Setenv("BACKUP_RATES_KEY", "env-key")
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "s3cret", config.Database.Password)
+	assert.Equal(t, "file-key", config.Rates.Providers[0].APIKey)
+	assert.Equal(t, "env-key", config.Rates.Providers[1].APIKey)
+	assert.Equal(t, "grpc-token-value", config.GRPC.AuthToken)
+
+	var out bytes.Buffer
+	require.NoError(t, config.Redacted().WriteYAML(&out))
+	assert.NotContains(t, out.String(), "s3cret")
+	assert.NotContains(t, out.String(), "file-key")
+	assert.NotContains(t, out.String(), "env-key")
+	assert.NotContains(t, out.String(), "grpc-token-value")
+	assert.Contains(t, out.String(), "password: '******'")
+	assert.Equal(t, "s3cret", config.Database.Password, "Redacted must not modify the original")
+}
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	config.Database.User = "user"
+	require.NoError(t, config.Validate())
+
+	config.Server.Port = 0
+	config.GRPC.Port = 8081
+	config.Server.AdminPort = 8081
+	config.Database.SSLMode = "sometimes"
+	config.Commission.Rules[0].Rate = 2
+	config.Rates.Providers = nil
+	config.GraphQL.ComplexityLimit = 0
+	config.RateLimit.Store = "redis"
+	config.RateLimit.Conversion.Per = 0
+	config.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "proxy.local"}
+
+	err := config.Validate()
+	require.Error(t, err)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, 10)
+	assert.Contains(t, err.Error(), "grpc.port needs grpc.authToken")
+
+	config.GRPC.AuthToken = "token"
+	err = config.Validate()
+	require.Error(t, err)
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, 9)
+	assert.Contains(t, err.Error(), "server.port must be between 1 and 65535")
+	assert.Contains(t, err.Error(), "grpc.port must differ")
+	assert.Contains(t, err.Error(), `database.sslmode "sometimes"`)
+	assert.Contains(t, err.Error(), "commission.rules[0].rate")
+	assert.Contains(t, err.Error(), "rates.providers needs at least one provider")
+	assert.Contains(t, err.Error(), "graphql.complexityLimit must be positive")
+	assert.Contains(t, err.Error(), `rateLimit.store "redis"`)
+	assert.Contains(t, err.Error(), "rateLimit.conversion needs positive")
+	assert.Contains(t, err.Error(), `server.trustedProxies[2] "proxy.local"`)
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
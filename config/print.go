@@ -0,0 +1,56 @@
+package configs
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WriteYAML writes the config in the layout of config.yaml. Call Redacted
+// first unless the secrets are meant to be shown.
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(plain(reflect.ValueOf(*c))); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// plain converts a config value into maps, slices and scalars keyed by the
+// mapstructure tags, with durations spelled the way the file accepts them.
+func plain(v reflect.Value) interface{} {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		out := yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			var value yaml.Node
+			if err := value.Encode(plain(v.Field(i))); err != nil {
+				continue
+			}
+			out.Content = append(out.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &value)
+		}
+		return &out
+	case reflect.Slice:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = plain(v.Index(i))
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,190 @@
+package configs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Version identifies the config currently in effect.
+type Version struct {
+	Version  int64     `json:"version"`
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Reloader keeps the effective config and re-reads it on file changes or
+// SIGHUP. Only the hot-reloadable subset (see applySafe) changes at runtime;
+// everything else keeps its startup value until the process restarts.
+type Reloader struct {
+	mu        sync.Mutex
+	v         *viper.Viper
+	current   atomic.Pointer[Config]
+	version   atomic.Pointer[Version]
+	listeners []func(*Config)
+	log       *logrus.Logger
+}
+
+// NewReloader loads the initial config the same way Load does. Reloads are
+// logged to log.
+func NewReloader(flags *pflag.FlagSet, log *logrus.Logger) (*Reloader, error) {
+	path, explicit := configPath(flags)
+	v, err := newViper(path, explicit, flags)
+	if err != nil {
+		return nil, err
+	}
+	config, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{v: v, log: log}
+	r.store(config, 1)
+	return r, nil
+}
+
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+func (r *Reloader) Version() Version {
+	return *r.version.Load()
+}
+
+// OnReload registers fn to run with the new config after every successful
+// reload. Listeners run in registration order while the reload lock is held.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Reload re-reads the config file. An invalid config is rejected and the
+// running one kept; changes outside the hot-reloadable subset are logged and
+// ignored.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.v.ReadInConfig(); err != nil {
+		r.log.WithError(err).Error("Config reload rejected: cannot read file")
+		return err
+	}
+	loaded, err := decode(r.v)
+	if err != nil {
+		r.log.WithError(err).Error("Config reload rejected")
+		return err
+	}
+
+	old := r.Current()
+	next := applySafe(old, loaded)
+	if !reflect.DeepEqual(next, applySafe(loaded, loaded)) {
+		r.log.Warn("Config reload: settings outside logger, commission, rates providers/cache and risk changed and need a restart")
+	}
+	if reflect.DeepEqual(old, next) {
+		r.log.Debug("Config reload: nothing to apply")
+		return nil
+	}
+
+	version := r.Version().Version + 1
+	r.store(next, version)
+	for _, fn := range r.listeners {
+		fn(next)
+	}
+	r.log.WithField("version", version).Info("Config reloaded")
+	return nil
+}
+
+func (r *Reloader) store(config *Config, version int64) {
+	r.current.Store(config)
+	r.version.Store(&Version{Version: version, Checksum: checksum(config), LoadedAt: time.Now().UTC()})
+}
+
+// Watch reloads on config file changes and on SIGHUP until ctx is done. The
+// directory is watched rather than the file so editors that replace the file
+// and mounted ConfigMaps that swap a symlink are picked up too. If the file
+// cannot be watched the error is returned and SIGHUP keeps working.
+func (r *Reloader) Watch(ctx context.Context) error {
+	file := filepath.Clean(r.v.ConfigFileUsed())
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			watcher = nil
+		}
+	}
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	if watcher != nil {
+		events, watchErrs = watcher.Events, watcher.Errors
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		if watcher != nil {
+			defer watcher.Close()
+		}
+		defer signal.Stop(hup)
+
+		// Editors often emit several events per save; reload once they settle.
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.log.Info("Received SIGHUP, reloading config")
+				r.Reload()
+			case event := <-events:
+				if filepath.Clean(event.Name) == file || event.Op&fsnotify.Create != 0 {
+					debounce = time.After(reloadDebounce)
+				}
+			case err := <-watchErrs:
+				r.log.WithError(err).Warn("Config watcher error")
+			case <-debounce:
+				debounce = nil
+				r.log.WithField("file", file).Info("Config file changed, reloading")
+				r.Reload()
+			}
+		}
+	}()
+	return err
+}
+
+const reloadDebounce = 200 * time.Millisecond
+
+// applySafe returns old with the hot-reloadable settings taken from loaded.
+func applySafe(old, loaded *Config) *Config {
+	next := *old
+	next.Logger = loaded.Logger
+	next.Commission.Rules = append([]CommissionRule(nil), loaded.Commission.Rules...)
+	next.Rates.CacheTTL = loaded.Rates.CacheTTL
+	next.Rates.Providers = append([]RateProvider(nil), loaded.Rates.Providers...)
+	next.Risk = loaded.Risk
+	return &next
+}
+
+func checksum(config *Config) string {
+	var buf bytes.Buffer
+	if err := config.Redacted().WriteYAML(&buf); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,126 @@
+package configs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadBase = `
+server:
+  port: 8080
+logger:
+  level: "info"
+database:
+  user: "user"
+commission:
+  rules:
+    - transactionType: "перевод"
+      currency: "USD"
+      rate: 0.02
+`
+
+func newTestReloader(t *testing.T, content string) (*Reloader, string, *test.Hook) {
+	t.Helper()
+	path := writeFile(t, t.TempDir(), "config.yaml", content)
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--config", path}))
+	log, hook := test.NewNullLogger()
+	reloader, err := NewReloader(fs, log)
+	require.NoError(t, err)
+	return reloader, path, hook
+}
+
+func TestReloadAppliesSafeSubset(t *testing.T) {
+	reloader, path, hook := newTestReloader(t, reloadBase)
+	first := reloader.Version()
+	assert.Equal(t, int64(1), first.Version)
+
+	var notified *Config
+	reloader.OnReload(func(c *Config) { notified = c })
+
+	writeFile(t, filepath.Dir(path), "config.yaml", `
+server:
+  port: 9191
+logger:
+  level: "debug"
+database:
+  user: "user"
+rates:
+  cacheTTL: "1m"
+commission:
+  rules:
+    - transactionType: "перевод"
+      currency: "USD"
+      rate: 0.03
+`)
+	require.NoError(t, reloader.Reload())
+
+	current := reloader.Current()
+	assert.Equal(t, "debug", current.Logger.Level)
+	assert.Equal(t, 0.03, current.Commission.Rules[0].Rate)
+	assert.Equal(t, time.Minute, current.Rates.CacheTTL)
+	assert.Equal(t, 8080, current.Server.Port, "server.port is not hot-reloadable")
+	assert.True(t, logged(hook, logrus.WarnLevel, "need a restart"), "the ignored server.port change is logged")
+	assert.Same(t, current, notified)
+
+	second := reloader.Version()
+	assert.Equal(t, int64(2), second.Version)
+	assert.NotEqual(t, first.Checksum, second.Checksum)
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	reloader, path, _ := newTestReloader(t, reloadBase)
+	before := reloader.Current()
+
+	writeFile(t, filepath.Dir(path), "config.yaml", `
+logger:
+  level: "chatty"
+database:
+  user: "user"
+`)
+	err := reloader.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "logger.level")
+	assert.Same(t, before, reloader.Current())
+	assert.Equal(t, int64(1), reloader.Version().Version)
+}
+
+func TestReloadWithoutChangesKeepsVersion(t *testing.T) {
+	reloader, _, _ := newTestReloader(t, reloadBase)
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, int64(1), reloader.Version().Version)
+}
+
+func TestWatchReloadsOnFileChange(t *testing.T) {
+	reloader, path, _ := newTestReloader(t, reloadBase)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, reloader.Watch(ctx))
+
+	writeFile(t, filepath.Dir(path), "config.yaml", reloadBase+`
+rates:
+  cacheTTL: "30s"
+`)
+	assert.Eventually(t, func() bool {
+		return reloader.Current().Rates.CacheTTL == 30*time.Second
+	}, 3*time.Second, 20*time.Millisecond)
+}
+
+func logged(hook *test.Hook, level logrus.Level, message string) bool {
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == level && strings.Contains(entry.Message, message) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package configs
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ValidationError lists every problem found in a config so they can be fixed
+// in one go instead of one restart at a time.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+func (c *Config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		addf("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.AdminPort < 0 || c.Server.AdminPort > 65535 {
+		addf("server.adminPort must be between 0 and 65535, got %d", c.Server.AdminPort)
+	}
+	if c.Server.AdminPort != 0 && c.Server.AdminPort == c.Server.Port {
+		addf("server.adminPort must differ from server.port (%d)", c.Server.Port)
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				addf("server.trustedProxies[%d] %q is neither an IP address nor a CIDR range", i, proxy)
+			}
+		}
+	}
+	if c.GRPC.Port < 0 || c.GRPC.Port > 65535 {
+		addf("grpc.port must be between 0 and 65535, got %d", c.GRPC.Port)
+	}
+	if c.GRPC.Port != 0 && (c.GRPC.Port == c.Server.Port || c.GRPC.Port == c.Server.AdminPort) {
+		addf("grpc.port must differ from server.port and server.adminPort (%d)", c.GRPC.Port)
+	}
+	if c.GRPC.Port != 0 && c.GRPC.AuthToken == "" {
+		addf("grpc.port needs grpc.authToken or grpc.authTokenFile, the gRPC API has no other authentication")
+	}
+	if c.GraphQL.ComplexityLimit < 1 {
+		addf("graphql.complexityLimit must be positive, got %d", c.GraphQL.ComplexityLimit)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.readTimeout", c.Server.ReadTimeout},
+		{"server.readHeaderTimeout", c.Server.ReadHeaderTimeout},
+		{"server.writeTimeout", c.Server.WriteTimeout},
+		{"server.idleTimeout", c.Server.IdleTimeout},
+		{"server.shutdownTimeout", c.Server.ShutdownTimeout},
+	} {
+		if d.value < 0 {
+			addf("%s must not be negative", d.name)
+		}
+	}
+
+	if _, err := logrus.ParseLevel(c.Logger.Level); err != nil {
+		addf("logger.level %q is not one of trace, debug, info, warn, error, fatal, panic", c.Logger.Level)
+	}
+
+	if c.Logger.Format != "json" && c.Logger.Format != "text" {
+		addf("logger.format %q must be json or text", c.Logger.Format)
+	}
+	if c.Logger.MaxSizeMB < 0 || c.Logger.MaxBackups < 0 || c.Logger.MaxAgeDays < 0 {
+		addf("logger.maxSizeMB, logger.maxBackups and logger.maxAgeDays must not be negative")
+	}
+	switch c.Logger.Output {
+	case "stdout", "stderr":
+	case "file":
+		if c.Logger.LogFile == "" {
+			addf("logger.logFile is required when logger.output is \"file\"")
+		}
+	default:
+		addf("logger.output %q must be stdout, stderr or file", c.Logger.Output)
+	}
+
+	if c.Database.Host == "" {
+		addf("database.host is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		addf("database.port must be between 1 and 65535, got %d", c.Database.Port)
+	}
+	if c.Database.User == "" {
+		addf("database.user is required")
+	}
+	if c.Database.DBName == "" {
+		addf("database.dbname is required")
+	}
+	if !sslModes[c.Database.SSLMode] {
+		addf("database.sslmode %q is not a valid libpq sslmode", c.Database.SSLMode)
+	}
+	if c.Database.MaxOpenConns < 0 {
+		addf("database.maxOpenConns must not be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		addf("database.maxIdleConns must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		addf("database.maxIdleConns (%d) must not exceed database.maxOpenConns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+
+	if c.Rates.Timeout <= 0 {
+		addf("rates.timeout must be positive")
+	}
+	if c.Rates.CacheTTL < 0 {
+		addf("rates.cacheTTL must not be negative")
+	}
+	if len(c.Rates.Providers) == 0 {
+		addf("rates.providers needs at least one provider")
+	}
+	seen := map[string]bool{}
+	for i, p := range c.Rates.Providers {
+		if p.Name == "" {
+			addf("rates.providers[%d].name is required", i)
+		} else if seen[p.Name] {
+			addf("rates.providers[%d].name %q is used twice", i, p.Name)
+		}
+		seen[p.Name] = true
+		if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+			addf("rates.providers[%d].url must be an http(s) URL", i)
+		}
+		if !strings.Contains(p.URL, "{base}") {
+			addf("rates.providers[%d].url must contain the {base} placeholder", i)
+		}
+		if p.RatesField == "" {
+			addf("rates.providers[%d].ratesField is required", i)
+		}
+	}
+
+	for i, r := range c.Commission.Rules {
+		if r.TransactionType == "" {
+			addf("commission.rules[%d].transactionType is required", i)
+		}
+		if r.Rate < 0 || r.Rate >= 1 {
+			addf("commission.rules[%d].rate must be in [0, 1), got %v", i, r.Rate)
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+			addf("rateLimit.store %q must be memory or postgres", c.RateLimit.Store)
+		}
+		for _, l := range []struct {
+			name  string
+			limit LimitConfig
+		}{
+			{"rateLimit.perIP", c.RateLimit.PerIP},
+			{"rateLimit.perUser", c.RateLimit.PerUser},
+			{"rateLimit.perAPIKey", c.RateLimit.PerAPIKey},
+			{"rateLimit.conversion", c.RateLimit.Conversion},
+		} {
+			if l.limit.Requests < 1 || l.limit.Per <= 0 || l.limit.Burst < 1 {
+				addf("%s needs positive requests, per and burst", l.name)
+			}
+		}
+	}
+
+	if c.Auth.RotationGrace < 0 {
+		addf("auth.rotationGrace must not be negative, got %s", c.Auth.RotationGrace)
+	}
+
+	if c.Webhooks.Enabled {
+		if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 || c.Webhooks.BackoffBase <= 0 {
+			addf("webhooks.pollInterval, timeout and backoffBase must be positive")
+		}
+		if c.Webhooks.BackoffMax < c.Webhooks.BackoffBase {
+			addf("webhooks.backoffMax must be at least backoffBase, got %s", c.Webhooks.BackoffMax)
+		}
+		if c.Webhooks.BatchSize < 1 || c.Webhooks.MaxAttempts < 1 {
+			addf("webhooks.batchSize and maxAttempts must be at least 1")
+		}
+	}
+
+	if c.Outbox.Enabled {
+		if c.Outbox.PollInterval <= 0 || c.Outbox.BatchSize < 1 {
+			addf("outbox.pollInterval must be positive and outbox.batchSize at least 1")
+		}
+		if c.Outbox.Sink == "file" && c.Outbox.File == "" {
+			addf("outbox.file is required with the file sink")
+		}
+	}
+	if c.Outbox.Retention <= 0 {
+		addf("outbox.retention must be positive, got %s", c.Outbox.Retention)
+	}
+
+	if c.Stream.Heartbeat <= 0 || c.Stream.MaxDuration <= c.Stream.Heartbeat {
+		addf("stream.heartbeat must be positive and shorter than stream.maxDuration")
+	}
+	if c.Server.WriteTimeout > 0 && c.Stream.MaxDuration >= c.Server.WriteTimeout {
+		addf("stream.maxDuration (%s) must be shorter than server.writeTimeout (%s)", c.Stream.MaxDuration, c.Server.WriteTimeout)
+	}
+
+	// active reports whether a risk rule is on, after checking its action.
+	active := func(name, action string) bool {
+		switch action {
+		case "", RiskOff:
+			return false
+		case RiskFlag, RiskHold, RiskReject:
+			return true
+		}
+		addf("%s.action %q must be off, flag, hold or reject", name, action)
+		return false
+	}
+	if r := c.Risk.Velocity; active("risk.velocity", r.Action) && (r.Window <= 0 || r.MaxCount < 1) {
+		addf("risk.velocity needs a positive window and maxCount")
+	}
+	if r := c.Risk.LargeAmount; active("risk.largeAmount", r.Action) && (r.Lookback <= 0 || r.Factor <= 1 || r.MinHistory < 1) {
+		addf("risk.largeAmount needs a positive lookback and minHistory and a factor above 1")
+	}
+	if r := c.Risk.CurrencySwitching; active("risk.currencySwitching", r.Action) && (r.Window <= 0 || r.MaxCurrencies < 1) {
+		addf("risk.currencySwitching needs a positive window and maxCurrencies")
+	}
+	if r := c.Risk.SmallTransfers; active("risk.smallTransfers", r.Action) && (r.Window <= 0 || r.MaxAmount <= 0 || r.MaxCount < 1) {
+		addf("risk.smallTransfers needs a positive window, maxAmount and maxCount")
+	}
+
+	if c.Attachments.MaxSize < 1 {
+		addf("attachments.maxSize must be positive, got %d", c.Attachments.MaxSize)
+	}
+	if c.Attachments.Store == "local" && c.Attachments.Dir == "" {
+		addf("attachments.dir is required with the local store")
+	}
+	if len(c.Attachments.Types) == 0 {
+		addf("attachments.types must list at least one content type")
+	}
+
+	if c.Search.Backend != "postgres" && c.Search.Backend != "memory" {
+		addf("search.backend %q must be postgres or memory", c.Search.Backend)
+	}
+	if c.Search.Similarity <= 0 || c.Search.Similarity > 1 {
+		addf("search.similarity must be above 0 and at most 1, got %g", c.Search.Similarity)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package graph serves the read-only GraphQL API on /graphql. The schema is
+// in schema.graphqls; generated.go is produced from it by gqlgen (make
+// graphql) and the resolvers map onto the repo and service packages.
+package graph
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// MaxPageSize caps the limit argument of list fields.
+const MaxPageSize = 100
+
+// complexityLimitCode is the extensions.code gqlgen gives operations over the
+// complexity limit.
+const complexityLimitCode = "COMPLEXITY_LIMIT_EXCEEDED"
+
+func init() {
+	// Answer 422 like other rejected operations instead of 200.
+	errcode.RegisterErrorType(complexityLimitCode, errcode.KindProtocol)
+}
+
+// ratesInput reuses the ISO 4217 rule for the rates query.
+type ratesInput struct {
+	Base string `json:"base" binding:"required,iso4217"`
+}
+
+// NewHandler serves GraphQL operations sent with POST. Operations costing
+// more than config.ComplexityLimit are rejected before any resolver runs.
+func NewHandler(db *sql.DB, config configs.GraphQLConfig) http.Handler {
+	cfg := Config{Resolvers: &Resolver{db: db}}
+	cfg.Complexity.Query.Transactions = func(childComplexity int, _ *models.TransactionFilter, limit int, _ int) int {
+		return 1 + childComplexity*limit
+	}
+
+	srv := handler.New(NewExecutableSchema(cfg))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(config.ComplexityLimit))
+	srv.SetErrorPresenter(presentError)
+	srv.SetRecoverFunc(recoverPanic)
+	return withLoaders(db, srv)
+}
+
+// Playground serves the GraphiQL IDE pointed at /graphql.
+func Playground() http.Handler {
+	return playground.Handler("Transactions GraphQL", "/graphql")
+}
+
+// presentError reports resolver errors with the REST error codes from
+// docs/errors.md in extensions.code. Parse, validation and complexity errors
+// from gqlgen are passed through unchanged.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	cause := gqlErr.Err
+	if cause == nil {
+		return gqlErr
+	}
+
+	problem := handlers.ProblemFor(cause)
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"module": "graphql",
+		"code":   problem.Code,
+		"path":   gqlErr.Path.String(),
+		"error":  cause,
+	})
+	if problem.Status >= http.StatusInternalServerError {
+		entry.Error("GraphQL field failed")
+	} else {
+		entry.Debug("GraphQL field rejected")
+	}
+
+	gqlErr.Message = problem.Title
+	if problem.Detail != "" {
+		gqlErr.Message = problem.Detail
+	}
+	gqlErr.Extensions = map[string]interface{}{"code": problem.Code}
+	if len(problem.Errors) > 0 {
+		gqlErr.Extensions["errors"] = problem.Errors
+	}
+	return gqlErr
+}
+
+func recoverPanic(ctx context.Context, p interface{}) error {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"module": "graphql",
+		"panic":  p,
+		"stack":  string(debug.Stack()),
+	}).Error("Panic in GraphQL resolver")
+	return fmt.Errorf("panic: %v", p)
+}
@@ -0,0 +1,164 @@
+package graph
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// execute posts query to a fresh handler and checks every mocked query ran.
+func execute(t *testing.T, query string, setupMock func(sqlmock.Sqlmock)) (int, gqlResponse) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	if setupMock != nil {
+		setupMock(mock)
+	}
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NewHandler(db, configs.Default().GraphQL).ServeHTTP(w, req)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+	var resp gqlResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, resp
+}
+
+func errorCodes(resp gqlResponse) []interface{} {
+	var codes []interface{}
+	for _, e := range resp.Errors {
+		codes = append(codes, e.Extensions["code"])
+	}
+	return codes
+}
+
+func TestNestedFieldsAreBatched(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	accountID := 4
+	_, resp := execute(t, `{
+		transactions(filter: {currency: "USD"}, limit: 3) {
+			id
+			user { name accounts { name } }
+			account { name }
+			commission { commission }
+		}
+	}`, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM transactions WHERE currency = \$1 ORDER BY date DESC, transaction_id DESC LIMIT \$2`).
+			WithArgs("USD", 3).
+			WillReturnRows(repotest.TransactionRows(
+				models.Transaction{ID: 1, UserID: 10, Amount: 100, Currency: "USD", TransactionType: "перевод", Date: date, AccountID: &accountID},
+				models.Transaction{ID: 2, UserID: 10, Amount: 50, Currency: "USD", TransactionType: "покупка", Date: date},
+				models.Transaction{ID: 3, UserID: 11, Amount: 70, Currency: "USD", TransactionType: "перевод", Date: date},
+			))
+		// One query per relation, however many transactions there are.
+		mock.ExpectQuery(`FROM users WHERE user_id = ANY`).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email"}).
+				AddRow(10, "Ann", "ann@example.com").
+				AddRow(11, "Bob", "bob@example.com"))
+		mock.ExpectQuery(`FROM accounts WHERE account_id = ANY`).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"account_id", "user_id", "name", "currency"}).AddRow(4, 10, "Main", "USD"))
+		mock.ExpectQuery(`FROM accounts WHERE user_id = ANY`).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"account_id", "user_id", "name", "currency"}).AddRow(4, 10, "Main", "USD"))
+		mock.ExpectQuery(`FROM commissions WHERE transaction_id = ANY`).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"transaction_id", "amount", "currency", "transaction_type", "commission", "date", "description"}).
+				AddRow(1, 100.0, "USD", "перевод", 2.0, "2024-01-01", "fee"))
+	})
+
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `[
+		{"id": "1", "user": {"name": "Ann", "accounts": [{"name": "Main"}]}, "account": {"name": "Main"}, "commission": {"commission": 2}},
+		{"id": "2", "user": {"name": "Ann", "accounts": [{"name": "Main"}]}, "account": null, "commission": null},
+		{"id": "3", "user": {"name": "Bob", "accounts": []}, "account": null, "commission": null}
+	]`, string(resp.Data["transactions"]))
+}
+
+func TestComplexityLimit(t *testing.T) {
+	status, resp := execute(t, `{
+		transactions(limit: 100) {
+			id amount currency category description date
+			user { id name email accounts { id name currency } }
+		}
+	}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, []interface{}{complexityLimitCode}, errorCodes(resp))
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		description string
+		query       string
+		setupMock   func(sqlmock.Sqlmock)
+		code        string
+	}{
+		{"limit out of range", `{ transactions(limit: 0) { id } }`, nil, "validation-error"},
+		{"malformed id", `{ transaction(id: "abc") { id } }`, nil, "invalid-parameter"},
+		{"bad currency code", `{ rates(base: "dollars") { currencyCode } }`, nil, "validation-error"},
+		{"database failure", `{ transaction(id: 1) { id } }`, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WillReturnError(errors.New("pq: connection refused"))
+		}, "internal-error"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, resp := execute(t, test.query, test.setupMock)
+			require.Len(t, resp.Errors, 1)
+			assert.Equal(t, test.code, resp.Errors[0].Extensions["code"])
+			assert.NotContains(t, resp.Errors[0].Message, "pq:", "internal details must not leak")
+		})
+	}
+}
+
+func TestMissingTransactionIsNull(t *testing.T) {
+	_, resp := execute(t, `{ transaction(id: 9) { id } }`, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(9).WillReturnError(sql.ErrNoRows)
+	})
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `null`, string(resp.Data["transaction"]))
+}
+
+func TestConversionAndRates(t *testing.T) {
+	originalFetch := service.FetchCurrencyRates
+	defer func() { service.FetchCurrencyRates = originalFetch }()
+	service.FetchCurrencyRates = func(ctx context.Context, base string) (models.CurrencyRates, error) {
+		return models.CurrencyRates{Rates: map[string]float64{"RUB": 90, "EUR": 0.5}}, nil
+	}
+
+	_, resp := execute(t, `{
+		transaction(id: 1) { eur: convertedAmount(currency: "EUR") }
+		rates(base: "USD") { currencyCode rate }
+	}`, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).
+			WillReturnRows(repotest.TransactionRows(models.Transaction{ID: 1, UserID: 10, Amount: 100, Currency: "USD", TransactionType: "перевод", Date: time.Now()}))
+	})
+
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"eur": 50}`, string(resp.Data["transaction"]))
+	assert.JSONEq(t, `[{"currencyCode": "EUR", "rate": 0.5}, {"currencyCode": "RUB", "rate": 90}]`, string(resp.Data["rates"]))
+}
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+// loaderWait is how long a loader collects keys before running its batch.
+// Sibling fields are resolved concurrently, so a short window is enough.
+const loaderWait = 2 * time.Millisecond
+
+// loaders batch the per-item lookups of one request so that resolving a
+// field on N transactions costs one query instead of N. They are created per
+// request, which also scopes their cache to it.
+type loaders struct {
+	users        *dataloader.Loader[int, *models.User]
+	accounts     *dataloader.Loader[int, *models.Account]
+	userAccounts *dataloader.Loader[int, []models.Account]
+	commissions  *dataloader.Loader[int, *models.Commission]
+}
+
+func newLoaders(db *sql.DB) *loaders {
+	return &loaders{
+		users: newLoader(func(ctx context.Context, ids []int) (map[int]*models.User, error) {
+			users, err := repo.UsersByIDs(ctx, ids, db)
+			found := make(map[int]*models.User, len(users))
+			for i := range users {
+				found[users[i].ID] = &users[i]
+			}
+			return found, err
+		}),
+		accounts: newLoader(func(ctx context.Context, ids []int) (map[int]*models.Account, error) {
+			accounts, err := repo.AccountsByIDs(ctx, ids, db)
+			found := make(map[int]*models.Account, len(accounts))
+			for i := range accounts {
+				found[accounts[i].ID] = &accounts[i]
+			}
+			return found, err
+		}),
+		userAccounts: newLoader(func(ctx context.Context, userIDs []int) (map[int][]models.Account, error) {
+			accounts, err := repo.AccountsByUserIDs(ctx, userIDs, db)
+			found := make(map[int][]models.Account, len(userIDs))
+			for _, account := range accounts {
+				found[account.UserID] = append(found[account.UserID], account)
+			}
+			return found, err
+		}),
+		commissions: newLoader(func(ctx context.Context, transactionIDs []int) (map[int]*models.Commission, error) {
+			commissions, err := repo.CommissionsByTransactionIDs(ctx, transactionIDs, db)
+			found := make(map[int]*models.Commission, len(commissions))
+			for i := range commissions {
+				found[commissions[i].TransactionID] = &commissions[i]
+			}
+			return found, err
+		}),
+	}
+}
+
+// newLoader adapts a multi-row lookup to a loader. Keys the lookup does not
+// return resolve to the zero value; a failed lookup fails every key.
+func newLoader[V any](lookup func(ctx context.Context, keys []int) (map[int]V, error)) *dataloader.Loader[int, V] {
+	batch := func(ctx context.Context, keys []int) []*dataloader.Result[V] {
+		found, err := lookup(ctx, keys)
+		results := make([]*dataloader.Result[V], len(keys))
+		for i, key := range keys {
+			if err != nil {
+				results[i] = &dataloader.Result[V]{Error: err}
+				continue
+			}
+			results[i] = &dataloader.Result[V]{Data: found[key]}
+		}
+		return results
+	}
+	return dataloader.NewBatchedLoader(batch, dataloader.WithWait[int, V](loaderWait))
+}
+
+type loadersKey struct{}
+
+// withLoaders gives every request its own loaders.
+func withLoaders(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders(db))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func loadersFor(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Resolver is the root of the resolver tree. Nested user, account and
+// commission fields go through the request's loaders rather than r.db.
+type Resolver struct {
+	db *sql.DB
+}
+
+// authorize passes err, the outcome of a policy check, through and records
+// it in the audit log when access was denied. GraphQL answers 200 either
+// way, so the REST error handler never sees these denials.
+func (r *Resolver) authorize(ctx context.Context, action string, err error) error {
+	if err == nil {
+		return nil
+	}
+	event := models.AuditEvent{
+		Action:    action,
+		Resource:  "/graphql",
+		Outcome:   models.AuditDenied,
+		Reason:    err.Error(),
+		RequestID: logging.RequestID(ctx),
+	}
+	if p := policy.FromContext(ctx); p != nil {
+		event.UserID, event.APIKeyID = &p.UserID, &p.APIKeyID
+	}
+	if auditErr := repo.CreateAuditEvent(ctx, event, r.db); auditErr != nil {
+		logging.FromContext(ctx).WithError(auditErr).WithField("action", action).Error("Writing audit event failed")
+	}
+	return err
+}
+
+// readUser checks that p may see the user with id and that user's accounts.
+func readUser(p *policy.Principal, id int) error {
+	if p == nil || p.UserID == id || p.Can(models.PermissionReadAnyTransaction) {
+		return nil
+	}
+	return fmt.Errorf("%w: details of user %d", policy.ErrDenied, id)
+}
@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"DZ_ITOG/handlers"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// The ID and Time scalars wrap gqlgen's built-ins so malformed arguments are
+// reported as invalid-parameter rather than as internal errors.
+
+func MarshalID(id int) graphql.Marshaler {
+	return graphql.MarshalIntID(id)
+}
+
+func UnmarshalID(v interface{}) (int, error) {
+	id, err := graphql.UnmarshalIntID(v)
+	if err != nil {
+		return 0, &handlers.APIError{Code: handlers.CodeInvalidParameter, Detail: "IDs must be integers", Err: err}
+	}
+	return id, nil
+}
+
+func MarshalTime(t time.Time) graphql.Marshaler {
+	return graphql.MarshalTime(t)
+}
+
+func UnmarshalTime(v interface{}) (time.Time, error) {
+	t, err := graphql.UnmarshalTime(v)
+	if err != nil {
+		return time.Time{}, &handlers.APIError{Code: handlers.CodeInvalidParameter, Detail: "times must be RFC 3339 strings", Err: err}
+	}
+	return t, nil
+}
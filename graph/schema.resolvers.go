@@ -0,0 +1,149 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.43
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"DZ_ITOG/validation"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// User is the resolver for the user field.
+func (r *accountResolver) User(ctx context.Context, obj *models.Account) (*models.User, error) {
+	return loadersFor(ctx).users.Load(ctx, obj.UserID)()
+}
+
+// Transaction is the resolver for the transaction field.
+func (r *queryResolver) Transaction(ctx context.Context, id int) (*models.Transaction, error) {
+	transaction, err := repo.GetTransactionByID(ctx, int64(id), r.db)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.authorize(ctx, "query transaction", policy.FromContext(ctx).ReadTransaction(*transaction)); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// Transactions is the resolver for the transactions field.
+func (r *queryResolver) Transactions(ctx context.Context, filter *models.TransactionFilter, limit int, offset int) ([]models.Transaction, error) {
+	var fields []models.FieldError
+	if limit < 1 || limit > MaxPageSize {
+		fields = append(fields, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxPageSize)})
+	}
+	if offset < 0 {
+		fields = append(fields, models.FieldError{Field: "offset", Message: "must not be negative"})
+	}
+	if len(fields) > 0 {
+		return nil, validation.Fields(fields...)
+	}
+
+	var query models.TransactionFilter
+	if filter != nil {
+		query = *filter
+	}
+	if err := r.authorize(ctx, "query transactions", policy.FromContext(ctx).ScopeTransactions(&query)); err != nil {
+		return nil, err
+	}
+	query.Limit, query.Offset = limit, offset
+	return repo.ListTransactions(ctx, query, r.db)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id int) (*models.User, error) {
+	if err := r.authorize(ctx, "query user", readUser(policy.FromContext(ctx), id)); err != nil {
+		return nil, err
+	}
+	return loadersFor(ctx).users.Load(ctx, id)()
+}
+
+// Account is the resolver for the account field.
+func (r *queryResolver) Account(ctx context.Context, id int) (*models.Account, error) {
+	account, err := loadersFor(ctx).accounts.Load(ctx, id)()
+	if err != nil || account == nil {
+		return account, err
+	}
+	if err := r.authorize(ctx, "query account", readUser(policy.FromContext(ctx), account.UserID)); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Rates is the resolver for the rates field.
+func (r *queryResolver) Rates(ctx context.Context, base string) ([]models.Rate, error) {
+	input := ratesInput{Base: base}
+	if err := validation.Struct(&input); err != nil {
+		return nil, err
+	}
+	rates, err := service.Rates(ctx, input.Base)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.Rate, 0, len(rates))
+	for code, rate := range rates {
+		out = append(out, models.Rate{CurrencyCode: code, Rate: rate})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CurrencyCode < out[j].CurrencyCode })
+	return out, nil
+}
+
+// User is the resolver for the user field.
+func (r *transactionResolver) User(ctx context.Context, obj *models.Transaction) (*models.User, error) {
+	return loadersFor(ctx).users.Load(ctx, obj.UserID)()
+}
+
+// Account is the resolver for the account field.
+func (r *transactionResolver) Account(ctx context.Context, obj *models.Transaction) (*models.Account, error) {
+	if obj.AccountID == nil {
+		return nil, nil
+	}
+	return loadersFor(ctx).accounts.Load(ctx, *obj.AccountID)()
+}
+
+// Commission is the resolver for the commission field.
+func (r *transactionResolver) Commission(ctx context.Context, obj *models.Transaction) (*models.Commission, error) {
+	return loadersFor(ctx).commissions.Load(ctx, obj.ID)()
+}
+
+// ConvertedAmount is the resolver for the convertedAmount field.
+func (r *transactionResolver) ConvertedAmount(ctx context.Context, obj *models.Transaction, currency string) (float64, error) {
+	return service.ConvertAmount(ctx, obj.Amount, obj.Currency, currency)
+}
+
+// Accounts is the resolver for the accounts field.
+func (r *userResolver) Accounts(ctx context.Context, obj *models.User) ([]models.Account, error) {
+	accounts, err := loadersFor(ctx).userAccounts.Load(ctx, obj.ID)()
+	if accounts == nil && err == nil {
+		accounts = []models.Account{}
+	}
+	return accounts, err
+}
+
+// Account returns AccountResolver implementation.
+func (r *Resolver) Account() AccountResolver { return &accountResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Transaction returns TransactionResolver implementation.
+func (r *Resolver) Transaction() TransactionResolver { return &transactionResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type accountResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type transactionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
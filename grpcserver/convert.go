@@ -0,0 +1,60 @@
+package grpcserver
+
+import (
+	transactionsv1 "DZ_ITOG/gen/transactions/v1"
+	"DZ_ITOG/models"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func transactionFromInput(in *transactionsv1.TransactionInput) models.Transaction {
+	transaction := models.Transaction{
+		UserID:          int(in.GetUserId()),
+		Amount:          in.GetAmount(),
+		Currency:        in.GetCurrency(),
+		TransactionType: in.GetTransactionType(),
+		Category:        in.GetCategory(),
+		Description:     in.GetDescription(),
+	}
+	if in != nil && in.AccountId != nil {
+		accountID := int(in.GetAccountId())
+		transaction.AccountID = &accountID
+	}
+	return transaction
+}
+
+func transactionToProto(t models.Transaction) *transactionsv1.Transaction {
+	out := &transactionsv1.Transaction{
+		Id:                int64(t.ID),
+		UserId:            int64(t.UserID),
+		Amount:            t.Amount,
+		Currency:          t.Currency,
+		TransactionType:   t.TransactionType,
+		Category:          t.Category,
+		Description:       t.Description,
+		ConvertedCurrency: t.ConvertedCurrency,
+	}
+	if t.AccountID != nil {
+		out.AccountId = proto.Int64(int64(*t.AccountID))
+	}
+	if !t.Date.IsZero() {
+		out.Date = timestamppb.New(t.Date)
+	}
+	if t.ConvertedCurrency != "" {
+		out.ConvertedAmount = proto.Float64(t.ConvertedAmount)
+	}
+	return out
+}
+
+func commissionToProto(c models.Commission) *transactionsv1.Commission {
+	return &transactionsv1.Commission{
+		TransactionId:   int64(c.TransactionID),
+		Amount:          c.Amount,
+		Currency:        c.Currency,
+		TransactionType: c.TransactionType,
+		Commission:      c.Commission,
+		Date:            c.Date,
+		Description:     c.Description,
+	}
+}
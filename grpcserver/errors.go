@@ -0,0 +1,59 @@
+package grpcserver
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"DZ_ITOG/validation"
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes mirrors the REST error catalogue (docs/errors.md) in gRPC terms.
+// The first match wins; anything unmatched is INTERNAL.
+var errorCodes = []struct {
+	err     error
+	code    codes.Code
+	message string
+}{
+	{repo.ErrNotFound, codes.NotFound, "resource not found"},
+	{repo.ErrConflict, codes.Aborted, "conflicting change"},
+	{repo.ErrConstraint, codes.FailedPrecondition, "data constraint violated"},
+	{service.ErrUnknownCurrency, codes.InvalidArgument, "unknown currency"},
+	{service.ErrRateUnavailable, codes.Unavailable, "currency rates unavailable"},
+	{service.ErrRiskRejected, codes.FailedPrecondition, "rejected by risk rules"},
+	{service.ErrHeldForReview, codes.FailedPrecondition, "held for review"},
+	{context.DeadlineExceeded, codes.DeadlineExceeded, "request timed out"},
+	{context.Canceled, codes.Canceled, "request canceled"},
+}
+
+// statusFromError converts a business-layer error into a gRPC status.
+// Validation errors carry a google.rpc.BadRequest with one violation per
+// field. Underlying error messages are never returned since they may contain
+// SQL or upstream responses; unclassified errors are logged.
+func statusFromError(ctx context.Context, err error) error {
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		st := status.New(codes.InvalidArgument, "one or more fields are invalid")
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(invalid.Fields))
+		for _, fe := range invalid.Fields {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: fe.Field, Description: fe.Message})
+		}
+		if detailed, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); detailErr == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+
+	for _, m := range errorCodes {
+		if errors.Is(err, m.err) {
+			return status.Error(m.code, m.message)
+		}
+	}
+	logging.FromContext(ctx).WithError(err).Error("Unclassified error in gRPC call")
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,155 @@
+package grpcserver
+
+import (
+	"DZ_ITOG/logging"
+	"context"
+	"crypto/subtle"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID, the gRPC
+// counterpart of the X-Request-ID header.
+const requestIDKey = "x-request-id"
+
+// publicServicePrefixes are reachable without the auth token so load
+// balancers and tooling can probe the server.
+var publicServicePrefixes = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.",
+}
+
+// withRequestID reuses a well-formed incoming request ID or generates one,
+// returns it to the caller as a header and stores it in the context.
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return logging.WithRequestID(ctx, id)
+}
+
+// logCall writes one structured line per call, like the HTTP access log.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"grpc_method": method,
+		"grpc_code":   code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	switch code {
+	case codes.OK:
+		entry.Info("gRPC call")
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		entry.Error("gRPC call")
+	default:
+		entry.Warn("gRPC call")
+	}
+}
+
+func unaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = withRequestID(ctx)
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func streamLogging(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := withRequestID(ss.Context())
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// recovered turns a panic into an INTERNAL status so one bad call cannot
+// take the process down.
+func recovered(ctx context.Context, method string, p interface{}) error {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"grpc_method": method,
+		"panic":       p,
+		"stack":       string(debug.Stack()),
+	}).Error("Panic in gRPC handler")
+	return status.Error(codes.Internal, "internal error")
+}
+
+func unaryRecovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func streamRecovery(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ss.Context(), info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// authorize checks the bearer token in the authorization metadata. An empty
+// token disables the check; Config.Validate refuses one for a listening
+// server, so that only happens in tests.
+func authorize(ctx context.Context, token, method string) error {
+	if token == "" {
+		return nil
+	}
+	for _, prefix := range publicServicePrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return nil
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given := strings.TrimPrefix(value, "Bearer ")
+		if given != value && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func unaryAuth(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, token, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), token, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// contextStream replaces the context of a server stream so handlers see the
+// request ID set by streamLogging.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,159 @@
+// Package grpcserver serves transactions.v1.TransactionService. It is a thin
+// transport over service.TransactionService, the same business layer the REST
+// handlers use, so both APIs accept the same input and apply the same rules.
+//
+// It is a trusted channel for internal services, off unless grpc.port is set.
+// Callers authenticate with the shared grpc.authToken only and act as an
+// admin: there are no users, roles, policy checks, rate limits or audit
+// entries, and every user's transactions can be read and written. Risk rules
+// still apply. Do not expose it to end users or partners.
+package grpcserver
+
+import (
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	transactionsv1 "DZ_ITOG/gen/transactions/v1"
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// New builds a gRPC server with the transaction service, the standard health
+// service and, if enabled, server reflection. The returned health server lets
+// the caller report NOT_SERVING while shutting down. Deleted transactions
+// have their attachment contents removed from store unless it is nil.
+func New(config configs.GRPCConfig, db *sql.DB, store blob.Store) (*grpc.Server, *health.Server) {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryLogging, unaryRecovery, unaryAuth(config.AuthToken)),
+		grpc.ChainStreamInterceptor(streamLogging, streamRecovery, streamAuth(config.AuthToken)),
+	)
+	transactionsv1.RegisterTransactionServiceServer(s, &TransactionServer{transactions: service.NewTransactionService(db).WithStore(store)})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(transactionsv1.TransactionService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	if config.Reflection {
+		reflection.Register(s)
+	}
+	return s, healthServer
+}
+
+// TransactionServer implements transactionsv1.TransactionServiceServer.
+type TransactionServer struct {
+	transactionsv1.UnimplementedTransactionServiceServer
+	transactions *service.TransactionService
+}
+
+func (s *TransactionServer) CreateTransaction(ctx context.Context, req *transactionsv1.CreateTransactionRequest) (*transactionsv1.CreateTransactionResponse, error) {
+	created, err := s.transactions.Create(ctx, transactionFromInput(req.GetTransaction()))
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	resp := &transactionsv1.CreateTransactionResponse{Transaction: transactionToProto(created.Transaction)}
+	if created.Commission != nil {
+		resp.Commission = commissionToProto(*created.Commission)
+	}
+	return resp, nil
+}
+
+func (s *TransactionServer) GetTransaction(ctx context.Context, req *transactionsv1.GetTransactionRequest) (*transactionsv1.GetTransactionResponse, error) {
+	transaction, err := s.transactions.Get(ctx, req.GetId(), req.GetCurrency())
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+	return &transactionsv1.GetTransactionResponse{Transaction: transactionToProto(*transaction)}, nil
+}
+
+func (s *TransactionServer) ListTransactions(_ *transactionsv1.ListTransactionsRequest, stream transactionsv1.TransactionService_ListTransactionsServer) error {
+	ctx := stream.Context()
+	transactions, err := s.transactions.List(ctx)
+	if err != nil {
+		return statusFromError(ctx, err)
+	}
+	for _, transaction := range transactions {
+		if err := stream.Send(&transactionsv1.ListTransactionsResponse{Transaction: transactionToProto(transaction)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TransactionServer) UpdateTransaction(ctx context.Context, req *transactionsv1.UpdateTransactionRequest) (*transactionsv1.UpdateTransactionResponse, error) {
+	if err := s.transactions.Update(ctx, req.GetId(), transactionFromInput(req.GetTransaction())); err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	updated, err := s.transactions.Get(ctx, req.GetId(), "")
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+	return &transactionsv1.UpdateTransactionResponse{Transaction: transactionToProto(*updated)}, nil
+}
+
+func (s *TransactionServer) DeleteTransaction(ctx context.Context, req *transactionsv1.DeleteTransactionRequest) (*transactionsv1.DeleteTransactionResponse, error) {
+	if err := s.transactions.Delete(ctx, req.GetId()); err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+	return &transactionsv1.DeleteTransactionResponse{}, nil
+}
+
+// conversionInput reuses the transaction tag rules for ConvertAmount.
+type conversionInput struct {
+	Amount       float64 `json:"amount" binding:"amount"`
+	FromCurrency string  `json:"from_currency" binding:"required,iso4217"`
+	ToCurrency   string  `json:"to_currency" binding:"required,iso4217"`
+}
+
+func (s *TransactionServer) ConvertAmount(ctx context.Context, req *transactionsv1.ConvertAmountRequest) (*transactionsv1.ConvertAmountResponse, error) {
+	input := conversionInput{Amount: req.GetAmount(), FromCurrency: req.GetFromCurrency(), ToCurrency: req.GetToCurrency()}
+	if err := validation.Struct(&input); err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	amount := input.Amount
+	if input.FromCurrency != input.ToCurrency {
+		converted, err := service.ConvertAmount(ctx, input.Amount, input.FromCurrency, input.ToCurrency)
+		if err != nil {
+			return nil, statusFromError(ctx, err)
+		}
+		amount = converted
+	}
+	return &transactionsv1.ConvertAmountResponse{Amount: amount, Currency: input.ToCurrency}, nil
+}
+
+// quoteInput reuses the transaction tag rules for QuoteCommission.
+type quoteInput struct {
+	Amount          float64 `json:"amount" binding:"amount"`
+	Currency        string  `json:"currency" binding:"required,iso4217"`
+	TransactionType string  `json:"transaction_type" binding:"required,transaction_type"`
+}
+
+func (s *TransactionServer) QuoteCommission(ctx context.Context, req *transactionsv1.QuoteCommissionRequest) (*transactionsv1.QuoteCommissionResponse, error) {
+	input := quoteInput{Amount: req.GetAmount(), Currency: req.GetCurrency(), TransactionType: req.GetTransactionType()}
+	if err := validation.Struct(&input); err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	commission, ok := service.CommissionFor(models.Transaction{
+		Amount:          input.Amount,
+		Currency:        input.Currency,
+		TransactionType: input.TransactionType,
+	})
+	if !ok {
+		return &transactionsv1.QuoteCommissionResponse{}, nil
+	}
+	return &transactionsv1.QuoteCommissionResponse{
+		Rate:        service.CommissionRate(input.TransactionType, input.Currency),
+		Commission:  commission.Commission,
+		Description: commission.Description,
+	}, nil
+}
@@ -0,0 +1,317 @@
+package grpcserver
+
+import (
+	configs "DZ_ITOG/config"
+	transactionsv1 "DZ_ITOG/gen/transactions/v1"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// startServer serves New over an in-memory listener and returns a connected
+// client connection plus the sqlmock behind the server.
+func startServer(t *testing.T, config configs.GRPCConfig) (*grpc.ClientConn, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	srv, _ := New(config, db, nil)
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+		require.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	return conn, mock
+}
+
+func newClient(t *testing.T) (transactionsv1.TransactionServiceClient, sqlmock.Sqlmock) {
+	conn, mock := startServer(t, configs.GRPCConfig{})
+	return transactionsv1.NewTransactionServiceClient(conn), mock
+}
+
+func expectUserExists(mock sqlmock.Sqlmock, userID int, exists bool) {
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE user_id = \$1\)`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+func fieldViolations(t *testing.T, err error) map[string]string {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code(), err)
+	fields := map[string]string{}
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields[v.GetField()] = v.GetDescription()
+			}
+		}
+	}
+	return fields
+}
+
+func TestCreateTransaction(t *testing.T) {
+	client, mock := newClient(t)
+
+	mock.ExpectBegin()
+	expectUserExists(mock, 1, true)
+	mock.ExpectQuery(`^INSERT INTO transactions`).
+		WithArgs(1, 100.0, "USD", "перевод", "test", "test transaction", nil, models.StatusCompleted, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`^INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO webhook_deliveries`).WithArgs(sqlmock.AnyArg(), models.EventTransactionCreated, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO commissions`).
+		WithArgs(7, 100.0, "USD", "перевод", 2.0, time.Now().Format("2006-01-02"), "Комиссия 2.00% от суммы").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO webhook_deliveries`).WithArgs(sqlmock.AnyArg(), models.EventCommissionCharged, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	resp, err := client.CreateTransaction(context.Background(), &transactionsv1.CreateTransactionRequest{
+		Transaction: &transactionsv1.TransactionInput{
+			UserId:          1,
+			Amount:          100,
+			Currency:        "USD",
+			TransactionType: "перевод",
+			Category:        "test",
+			Description:     "test transaction",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), resp.GetTransaction().GetId())
+	assert.Equal(t, 2.0, resp.GetCommission().GetCommission())
+}
+
+func TestCreateTransactionInvalid(t *testing.T) {
+	client, _ := newClient(t)
+
+	_, err := client.CreateTransaction(context.Background(), &transactionsv1.CreateTransactionRequest{
+		Transaction: &transactionsv1.TransactionInput{
+			UserId:          1,
+			Amount:          -5,
+			Currency:        "usd",
+			TransactionType: "перевод",
+		},
+	})
+	fields := fieldViolations(t, err)
+	assert.Contains(t, fields, "amount")
+	assert.Contains(t, fields, "currency")
+}
+
+func TestCreateTransactionUnknownUser(t *testing.T) {
+	client, mock := newClient(t)
+	mock.ExpectBegin()
+	expectUserExists(mock, 42, false)
+	mock.ExpectRollback()
+
+	_, err := client.CreateTransaction(context.Background(), &transactionsv1.CreateTransactionRequest{
+		Transaction: &transactionsv1.TransactionInput{UserId: 42, Amount: 10, Currency: "RUB", TransactionType: "покупка"},
+	})
+	assert.Equal(t, "user does not exist", fieldViolations(t, err)["user_id"])
+}
+
+func TestGetTransaction(t *testing.T) {
+	client, mock := newClient(t)
+
+	originalFetch := service.FetchCurrencyRates
+	defer func() { service.FetchCurrencyRates = originalFetch }()
+	service.FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+		return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.5}}, nil
+	}
+
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	accountID := 5
+	mock.ExpectQuery(`^SELECT (.+) FROM transactions WHERE transaction_id = \$1`).
+		WithArgs(int64(3)).
+		WillReturnRows(repotest.TransactionRows(models.Transaction{ID: 3, UserID: 1, Amount: 100, Currency: "USD", TransactionType: "покупка", Category: "food", Date: date, Description: "lunch", AccountID: &accountID}))
+
+	resp, err := client.GetTransaction(context.Background(), &transactionsv1.GetTransactionRequest{Id: 3, Currency: "EUR"})
+	require.NoError(t, err)
+	got := resp.GetTransaction()
+	assert.Equal(t, int64(5), got.GetAccountId())
+	assert.Equal(t, date, got.GetDate().AsTime())
+	assert.Equal(t, 50.0, got.GetConvertedAmount())
+	assert.Equal(t, "EUR", got.GetConvertedCurrency())
+}
+
+func TestGetTransactionNotFound(t *testing.T) {
+	client, mock := newClient(t)
+	mock.ExpectQuery(`^SELECT (.+) FROM transactions WHERE transaction_id = \$1`).
+		WithArgs(int64(9)).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := client.GetTransaction(context.Background(), &transactionsv1.GetTransactionRequest{Id: 9})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestListTransactionsStreams(t *testing.T) {
+	client, mock := newClient(t)
+	date := time.Now().UTC().Truncate(time.Second)
+	mock.ExpectQuery(`^SELECT (.+) FROM transactions$`).
+		WillReturnRows(repotest.TransactionRows(
+			models.Transaction{ID: 1, UserID: 1, Amount: 10, Currency: "USD", TransactionType: "покупка", Date: date},
+			models.Transaction{ID: 2, UserID: 1, Amount: 20, Currency: "RUB", TransactionType: "пополнение", Date: date},
+		))
+
+	stream, err := client.ListTransactions(context.Background(), &transactionsv1.ListTransactionsRequest{})
+	require.NoError(t, err)
+
+	var ids []int64
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, msg.GetTransaction().GetId())
+	}
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+func TestUpdateTransactionNotFound(t *testing.T) {
+	client, mock := newClient(t)
+	mock.ExpectBegin()
+	expectUserExists(mock, 1, true)
+	mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(int64(11)).WillReturnRows(repotest.TransactionRows())
+	mock.ExpectRollback()
+
+	_, err := client.UpdateTransaction(context.Background(), &transactionsv1.UpdateTransactionRequest{
+		Id:          11,
+		Transaction: &transactionsv1.TransactionInput{UserId: 1, Amount: 10, Currency: "USD", TransactionType: "покупка"},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDeleteTransaction(t *testing.T) {
+	client, mock := newClient(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^DELETE FROM transactions WHERE transaction_id = \$1 RETURNING user_id`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(`^INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO webhook_deliveries`).WithArgs(sqlmock.AnyArg(), models.EventTransactionDeleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	_, err := client.DeleteTransaction(context.Background(), &transactionsv1.DeleteTransactionRequest{Id: 4})
+	assert.NoError(t, err)
+}
+
+func TestConvertAmountUnknownCurrency(t *testing.T) {
+	client, _ := newClient(t)
+
+	originalFetch := service.FetchCurrencyRates
+	defer func() { service.FetchCurrencyRates = originalFetch }()
+	service.FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+		return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.9}}, nil
+	}
+
+	_, err := client.ConvertAmount(context.Background(), &transactionsv1.ConvertAmountRequest{Amount: 10, FromCurrency: "USD", ToCurrency: "JPY"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestQuoteCommission(t *testing.T) {
+	client, _ := newClient(t)
+
+	resp, err := client.QuoteCommission(context.Background(), &transactionsv1.QuoteCommissionRequest{Amount: 200, Currency: "USD", TransactionType: "перевод"})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&transactionsv1.QuoteCommissionResponse{
+		Rate:        0.02,
+		Commission:  4,
+		Description: "Комиссия 2.00% от суммы",
+	}, resp), resp.String())
+
+	resp, err = client.QuoteCommission(context.Background(), &transactionsv1.QuoteCommissionRequest{Amount: 200, Currency: "USD", TransactionType: "покупка"})
+	require.NoError(t, err)
+	assert.Zero(t, resp.GetCommission())
+
+	_, err = client.QuoteCommission(context.Background(), &transactionsv1.QuoteCommissionRequest{Amount: 200, Currency: "USD", TransactionType: "обмен"})
+	assert.Contains(t, fieldViolations(t, err), "transaction_type")
+}
+
+func TestAuthToken(t *testing.T) {
+	conn, mock := startServer(t, configs.GRPCConfig{AuthToken: "s3cret"})
+	client := transactionsv1.NewTransactionServiceClient(conn)
+
+	_, err := client.DeleteTransaction(context.Background(), &transactionsv1.DeleteTransactionRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	wrong := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+	_, err = client.DeleteTransaction(wrong, &transactionsv1.DeleteTransactionRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err, "health must not need the token")
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.GetStatus())
+
+	expectDelete(mock)
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	_, err = client.DeleteTransaction(authorized, &transactionsv1.DeleteTransactionRequest{Id: 1})
+	assert.NoError(t, err)
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	client, mock := newClient(t)
+	expectDelete(mock)
+	expectDelete(mock)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDKey, "trace-123")
+	_, err := client.DeleteTransaction(ctx, &transactionsv1.DeleteTransactionRequest{Id: 1}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"trace-123"}, header.Get(requestIDKey))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), requestIDKey, "bad id with spaces")
+	_, err = client.DeleteTransaction(ctx, &transactionsv1.DeleteTransactionRequest{Id: 1}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(requestIDKey), 1)
+	assert.Len(t, header.Get(requestIDKey)[0], 32)
+}
+
+func TestRecoveryReturnsInternal(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Panic"}
+	_, err := unaryRecovery(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+// expectDelete expects one successful DeleteTransaction.
+func expectDelete(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^DELETE FROM transactions`).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(`^INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
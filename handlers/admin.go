@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ListCommissionRules returns the commission rules in effect. They are
+// changed through the config file, which is reloaded without a restart.
+func ListCommissionRules(c *gin.Context) {
+	c.JSON(http.StatusOK, service.CommissionRules())
+}
+
+// RecalculateCommissions brings the commissions of the transactions matching
+// the report filters in line with the current rules. With ?dry_run=true it
+// only reports what would change.
+func RecalculateCommissions(c *gin.Context) {
+	filter, ok := transactionFilter(c)
+	if !ok {
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "dry_run must be true or false", Err: err})
+		return
+	}
+	changes, err := transactionService(c).RecalculateCommissions(c.Request.Context(), filter, dryRun)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !dryRun {
+		logger(c).WithFields(logrus.Fields{
+			"module":  "adminHandler",
+			"changed": len(changes),
+		}).Info("Commissions recalculated")
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": dryRun, "changes": changes})
+}
+
+// ProbeRateProviders asks every configured rate provider for the ?base=
+// rates (USD by default) and reports which of them answered.
+func ProbeRateProviders(c *gin.Context) {
+	base := strings.ToUpper(c.DefaultQuery("base", "USD"))
+	c.JSON(http.StatusOK, service.ProbeProviders(c.Request.Context(), base))
+}
+
+// RefreshRates drops the cached exchange rates.
+func RefreshRates(c *gin.Context) {
+	service.ClearRateCache()
+	logger(c).WithField("module", "adminHandler").Info("Rate cache cleared")
+	c.JSON(http.StatusOK, gin.H{"message": "Rate cache cleared"})
+}
+
+func userService(c *gin.Context) *service.UserService {
+	return service.NewUserService(c.MustGet("db").(*sql.DB))
+}
+
+// userID parses the :id parameter. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func userID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "User ID must be an integer", Err: err})
+		return 0, false
+	}
+	return id, true
+}
+
+func GetUserRoles(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+	roles, err := userService(c).Roles(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// SetUserRoles replaces the roles of a user. Every change is written to the
+// audit log.
+func SetUserRoles(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+	var input models.UserRoles
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, bindError(err))
+		return
+	}
+	input.UserID = id
+	roles, err := userService(c).SetRoles(c.Request.Context(), input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	recordAudit(c, auditEvent(c, models.AuditAllowed, "roles set to ["+strings.Join(roles.Roles, ", ")+"]"))
+	logger(c).WithFields(logrus.Fields{
+		"module":  "adminHandler",
+		"user_id": id,
+		"roles":   roles.Roles,
+	}).Info("User roles changed")
+	c.JSON(http.StatusOK, roles)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo/repotest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asRole serves requests as user 7 holding role, the way the server's
+// authentication middleware would.
+func asRole(router *gin.Engine, db interface{}, role string) {
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		SetAPIKey(c, models.APIKey{ID: 3, UserID: 7, Scopes: []string{models.ScopeAdmin}})
+		SetPrincipal(c, &policy.Principal{UserID: 7, APIKeyID: 3, Roles: []string{role}, Permissions: models.DefaultRolePermissions[role]})
+	})
+}
+
+func TestTransactionHandlersApplyPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	stored := func() *sqlmock.Rows {
+		return repotest.TransactionRows(models.Transaction{ID: 1, UserID: 8, Amount: 100, Currency: "USD", TransactionType: "перевод", Date: time.Now()})
+	}
+	expectDenial := func() {
+		mock.ExpectExec(`INSERT INTO audit_log`).
+			WithArgs(7, 3, sqlmock.AnyArg(), sqlmock.AnyArg(), models.AuditDenied, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	serve := func(role, method, path, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(ErrorHandler())
+		asRole(router, db, role)
+		router.GET("/transactions", GetAllTransactions)
+		router.GET("/transactions/:id", GetTransactionByID)
+		router.PUT("/transactions/:id", UpdateTransaction)
+		router.DELETE("/transactions/:id", DeleteTransaction(nil))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("customer lists own transactions", func(t *testing.T) {
+		mock.ExpectQuery(`FROM transactions WHERE user_id = \$1`).WithArgs(7).WillReturnRows(repotest.TransactionRows())
+		assert.Equal(t, http.StatusOK, serve(models.RoleCustomer, http.MethodGet, "/transactions", "").Code)
+	})
+
+	t.Run("customer reads another user's transaction", func(t *testing.T) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(stored())
+		expectDenial()
+		w := serve(models.RoleCustomer, http.MethodGet, "/transactions/1", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"forbidden"`)
+	})
+
+	t.Run("support changes an amount", func(t *testing.T) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(stored())
+		expectDenial()
+		w := serve(models.RoleSupport, http.MethodPut, "/transactions/1",
+			`{"user_id":8,"amount":150,"currency":"USD","transaction_type":"перевод"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), models.PermissionChangeAmounts)
+	})
+
+	t.Run("support deletes", func(t *testing.T) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(stored())
+		expectDenial()
+		assert.Equal(t, http.StatusForbidden, serve(models.RoleSupport, http.MethodDelete, "/transactions/1", "").Code)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserRolesIsAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleAdmin)
+	router.PUT("/admin/users/:id/roles", SetUserRoles)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`DELETE FROM user_roles`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO user_roles`).WithArgs(5, `{"admin","support"}`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(7, 3, "PUT /admin/users/:id/roles", "/admin/users/5/roles", models.AuditAllowed, "roles set to [admin, support]", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/5/roles", strings.NewReader(`{"roles":["support","admin","support"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"user_id":5,"roles":["admin","support"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/admin/users/5/roles", strings.NewReader(`{"roles":["owner"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// apiKeyService returns the service bound to the request's database.
+func apiKeyService(c *gin.Context) *service.APIKeyService {
+	return service.NewAPIKeyService(c.MustGet("db").(*sql.DB))
+}
+
+// apiKeyID parses the :id parameter. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func apiKeyID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "API key ID must be an integer", Err: err})
+		return 0, false
+	}
+	return id, true
+}
+
+func bindAPIKey(c *gin.Context) (models.APIKeyInput, bool) {
+	var input models.APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, bindError(err))
+		return input, false
+	}
+	return input, true
+}
+
+// ListAPIKeys lists the caller's keys, or with ?user_id= the keys of that
+// user, which needs the admin scope for anyone else.
+func ListAPIKeys(c *gin.Context) {
+	var userID *int
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "user_id must be an integer", Err: err})
+			return
+		}
+		userID = &id
+	}
+	keys, err := apiKeyService(c).List(c.Request.Context(), apiKey(c), userID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func CreateAPIKey(c *gin.Context) {
+	input, ok := bindAPIKey(c)
+	if !ok {
+		return
+	}
+	key, err := apiKeyService(c).Create(c.Request.Context(), apiKey(c), input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":     "apiKeyHandler",
+		"api_key_id": key.ID,
+		"owner":      key.UserID,
+		"scopes":     key.Scopes,
+	}).Info("API key created")
+	c.JSON(http.StatusCreated, key)
+}
+
+func GetAPIKey(c *gin.Context) {
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+	key, err := apiKeyService(c).Get(c.Request.Context(), apiKey(c), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+func UpdateAPIKey(c *gin.Context) {
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+	input, ok := bindAPIKey(c)
+	if !ok {
+		return
+	}
+	key, err := apiKeyService(c).Update(c.Request.Context(), apiKey(c), id, input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeAPIKey serves DELETE: the key stops working at once but stays
+// listed, with revoked_at set.
+func RevokeAPIKey(c *gin.Context) {
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+	if err := apiKeyService(c).Revoke(c.Request.Context(), apiKey(c), id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":     "apiKeyHandler",
+		"api_key_id": id,
+	}).Info("API key revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// RotateAPIKey issues a replacement key. The old key keeps working for
+// ?grace= (a duration such as 1h; 0s revokes it at once), defaulting to
+// defaultGrace.
+func RotateAPIKey(defaultGrace time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := apiKeyID(c)
+		if !ok {
+			return
+		}
+		grace := defaultGrace
+		if value := c.Query("grace"); value != "" {
+			var err error
+			if grace, err = time.ParseDuration(value); err != nil {
+				abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "grace must be a duration such as 30m or 24h", Err: err})
+				return
+			}
+		}
+		key, err := apiKeyService(c).Rotate(c.Request.Context(), apiKey(c), id, grace)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		logger(c).WithFields(logrus.Fields{
+			"module":     "apiKeyHandler",
+			"api_key_id": id,
+			"new_id":     key.ID,
+			"grace":      grace.String(),
+		}).Info("API key rotated")
+		c.JSON(http.StatusCreated, key)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/service"
+	"database/sql"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead is how much a multipart body may exceed the largest file
+// it carries, for the part headers and boundaries.
+const multipartOverhead = 64 << 10
+
+func attachmentService(c *gin.Context, store blob.Store, config configs.AttachmentConfig) *service.AttachmentService {
+	return service.NewAttachmentService(c.MustGet("db").(*sql.DB), store, config)
+}
+
+// attachmentID parses :attachment_id. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func attachmentID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("attachment_id"), 10, 64)
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "Attachment ID must be an integer", Err: err})
+		return 0, false
+	}
+	return id, true
+}
+
+// UploadAttachment attaches the file sent as the "file" field of a
+// multipart/form-data body to a transaction the caller may change, and
+// answers 201 with its metadata.
+func UploadAttachment(store blob.Store, config configs.AttachmentConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transaction, ok := accessTransaction(c, true)
+		if !ok {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxSize+multipartOverhead)
+		header, err := c.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortWithError(c, service.TooLarge(config.MaxSize))
+				return
+			}
+			abortWithError(c, &APIError{Code: CodeMalformedRequest, Detail: "expected a multipart/form-data body with a file field", Err: err})
+			return
+		}
+		if header.Size > config.MaxSize {
+			abortWithError(c, service.TooLarge(config.MaxSize))
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		defer file.Close()
+
+		var uploader *int
+		if p := principal(c); p != nil {
+			uploader = &p.UserID
+		}
+		attachment, err := attachmentService(c, store, config).Upload(c.Request.Context(), int64(transaction.ID), header.Filename, file, uploader)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, attachment)
+	}
+}
+
+// ListAttachments returns the attachments of a transaction the caller may
+// read, oldest first.
+func ListAttachments(store blob.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transaction, ok := accessTransaction(c, false)
+		if !ok {
+			return
+		}
+		attachments, err := attachmentService(c, store, configs.AttachmentConfig{}).List(c.Request.Context(), int64(transaction.ID))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// DownloadAttachment serves the content of an attachment of a transaction
+// the caller may read. It is always sent as a download, and browsers are told
+// not to guess another type, so an attachment cannot run as a page of the
+// API's origin.
+func DownloadAttachment(store blob.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transaction, ok := accessTransaction(c, false)
+		if !ok {
+			return
+		}
+		id, ok := attachmentID(c)
+		if !ok {
+			return
+		}
+		attachment, content, err := attachmentService(c, store, configs.AttachmentConfig{}).Open(c.Request.Context(), int64(transaction.ID), id)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		defer content.Close()
+		c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+			"Content-Disposition":     mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+			"X-Content-Type-Options":  "nosniff",
+			"Content-Security-Policy": "default-src 'none'; sandbox",
+			"Cache-Control":           "private, no-store",
+		})
+	}
+}
+
+// DeleteAttachment removes an attachment of a transaction the caller may
+// change.
+func DeleteAttachment(store blob.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transaction, ok := accessTransaction(c, true)
+		if !ok {
+			return
+		}
+		id, ok := attachmentID(c)
+		if !ok {
+			return
+		}
+		if err := attachmentService(c, store, configs.AttachmentConfig{}).Delete(c.Request.Context(), int64(transaction.ID), id); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"bytes"
+	"database/sql/driver"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureString matches any string argument and keeps it.
+type captureString struct{ value *string }
+
+func (c captureString) Match(v driver.Value) bool {
+	*c.value, _ = v.(string)
+	return true
+}
+
+func TestAttachmentHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := blob.NewMemoryStore()
+	config := configs.AttachmentConfig{MaxSize: 64, Types: []string{"image/png", "application/pdf"}}
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleCustomer)
+	router.POST("/transactions/:id/attachments", UploadAttachment(store, config))
+	router.GET("/transactions/:id/attachments/:attachment_id", DownloadAttachment(store))
+
+	owned := func(owner int) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1`).WithArgs(2).WillReturnRows(
+			repotest.TransactionRows(models.Transaction{ID: 2, UserID: owner, Amount: 30, Currency: "USD", TransactionType: "покупка", Date: time.Now()}))
+	}
+	upload := func(name string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/transactions/2/attachments", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		router.ServeHTTP(w, req)
+		return w
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), "receipt"...)
+
+	var key string
+	t.Run("upload sniffs the type and keeps the content", func(t *testing.T) {
+		owned(7)
+		mock.ExpectQuery(`INSERT INTO attachments`).WithArgs(2, "receipt.png", "image/png", int64(len(png)), captureString{&key}, 7).
+			WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "created_at"}).AddRow(4, time.Now()))
+
+		w := upload(`C:\scans\receipt.png`, png)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"content_type":"image/png"`)
+		assert.NotContains(t, w.Body.String(), key)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("download is served as an attachment", func(t *testing.T) {
+		owned(7)
+		mock.ExpectQuery(`FROM attachments WHERE transaction_id = \$1 AND attachment_id = \$2`).WithArgs(2, 4).WillReturnRows(
+			sqlmock.NewRows([]string{"attachment_id", "transaction_id", "file_name", "content_type", "size", "uploaded_by", "created_at", "storage_key"}).
+				AddRow(4, 2, "receipt.png", "image/png", len(png), 7, time.Now(), key))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/2/attachments/4", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, png, w.Body.Bytes())
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=receipt.png`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("other types and large files are refused", func(t *testing.T) {
+		owned(7)
+		w := upload("notes.html", []byte("<html><script>alert(1)</script></html>"))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"file"`)
+		assert.Contains(t, w.Body.String(), "text/html")
+
+		owned(7)
+		w = upload("scan.png", append(png, bytes.Repeat([]byte{0}, 64)...))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "must be at most 64 bytes")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("attachments of other users are not served", func(t *testing.T) {
+		owned(8)
+		mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/2/attachments/4", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
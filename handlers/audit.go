@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// auditDenied records a rejected request in the audit log. A failed write is
+// only logged: the caller gets its 401 or 403 either way.
+func auditDenied(c *gin.Context, problem models.Problem) {
+	event := auditEvent(c, models.AuditDenied, problem.Detail)
+	if event.Reason == "" {
+		event.Reason = problem.Title
+	}
+	recordAudit(c, event)
+}
+
+// auditEvent describes the current request as performed by its caller.
+func auditEvent(c *gin.Context, outcome, reason string) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:    c.Request.Method + " " + c.FullPath(),
+		Resource:  c.Request.URL.Path,
+		Outcome:   outcome,
+		Reason:    reason,
+		RequestID: c.GetString("request_id"),
+		ClientIP:  c.ClientIP(),
+	}
+	if event.Action == c.Request.Method+" " {
+		event.Action += c.Request.URL.Path
+	}
+	if key := apiKey(c); key != nil {
+		event.UserID, event.APIKeyID = &key.UserID, &key.ID
+	}
+	return event
+}
+
+func recordAudit(c *gin.Context, event models.AuditEvent) {
+	value, ok := c.Get("db")
+	if !ok {
+		return
+	}
+	if err := repo.CreateAuditEvent(c.Request.Context(), event, value.(*sql.DB)); err != nil {
+		logger(c).WithFields(logrus.Fields{
+			"module":  "audit",
+			"action":  event.Action,
+			"outcome": event.Outcome,
+		}).WithError(err).Error("Writing audit event failed")
+	}
+}
+
+// ListAuditEvents serves the audit log, newest first, filtered by ?user_id=,
+// ?outcome= and ?since= (RFC 3339) and capped by ?limit= (default 100).
+func ListAuditEvents(c *gin.Context) {
+	filter := repo.AuditFilter{Outcome: c.Query("outcome"), Limit: 100}
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "user_id must be an integer", Err: err})
+			return
+		}
+		filter.UserID = &id
+	}
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "since must be an RFC 3339 timestamp", Err: err})
+			return
+		}
+		filter.Since = &since
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "limit must be an integer between 1 and 1000", Err: err})
+			return
+		}
+		filter.Limit = limit
+	}
+	events, err := repo.ListAuditEvents(c.Request.Context(), filter, c.MustGet("db").(*sql.DB))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
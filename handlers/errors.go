@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"DZ_ITOG/validation"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Error codes are part of the API contract: they are documented in
+// docs/errors.md and must not be renamed once released.
+const (
+	CodeMalformedRequest    = "malformed-request"
+	CodeInvalidParameter    = "invalid-parameter"
+	CodeValidation          = "validation-error"
+	CodeNotFound            = "not-found"
+	CodeConflict            = "conflict"
+	CodeConstraintViolation = "constraint-violation"
+	CodeRiskRejected        = "risk-rejected"
+	CodeUnknownCurrency     = "unknown-currency"
+	CodeRateLimited         = "rate-limited"
+	CodeUnauthenticated     = "unauthenticated"
+	CodeForbidden           = "forbidden"
+	CodeRateUnavailable     = "rate-unavailable"
+	CodeTimeout             = "timeout"
+	CodeInternal            = "internal-error"
+)
+
+type errorSpec struct {
+	status int
+	title  string
+}
+
+var errorCatalogue = map[string]errorSpec{
+	CodeMalformedRequest:    {http.StatusBadRequest, "Malformed request body"},
+	CodeInvalidParameter:    {http.StatusBadRequest, "Invalid request parameter"},
+	CodeValidation:          {http.StatusUnprocessableEntity, "Request validation failed"},
+	CodeNotFound:            {http.StatusNotFound, "Resource not found"},
+	CodeConflict:            {http.StatusConflict, "Conflicting change"},
+	CodeConstraintViolation: {http.StatusUnprocessableEntity, "Data constraint violated"},
+	CodeRiskRejected:        {http.StatusUnprocessableEntity, "Rejected by risk rules"},
+	CodeUnknownCurrency:     {http.StatusBadRequest, "Unknown currency"},
+	CodeRateLimited:         {http.StatusTooManyRequests, "Too many requests"},
+	CodeUnauthenticated:     {http.StatusUnauthorized, "Authentication required"},
+	CodeForbidden:           {http.StatusForbidden, "Operation not permitted"},
+	CodeRateUnavailable:     {http.StatusServiceUnavailable, "Currency rates unavailable"},
+	CodeTimeout:             {http.StatusGatewayTimeout, "Request timed out"},
+	CodeInternal:            {http.StatusInternalServerError, "Internal server error"},
+}
+
+// errorCodes maps typed errors from the lower layers to catalogue codes. The
+// first match wins; anything unmatched is an internal error.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{validation.ErrInvalid, CodeValidation},
+	{repo.ErrNotFound, CodeNotFound},
+	{repo.ErrConflict, CodeConflict},
+	{repo.ErrConstraint, CodeConstraintViolation},
+	{service.ErrUnknownCurrency, CodeUnknownCurrency},
+	{service.ErrRateUnavailable, CodeRateUnavailable},
+	{service.ErrInvalidAPIKey, CodeUnauthenticated},
+	{service.ErrForbidden, CodeForbidden},
+	{policy.ErrDenied, CodeForbidden},
+	{context.DeadlineExceeded, CodeTimeout},
+}
+
+// APIError carries a catalogue code and a client-facing detail. Handlers use
+// it for failures they detect themselves; Err, if set, is only logged.
+type APIError struct {
+	Code   string
+	Detail string
+	Err    error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Detail + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// abortWithError hands err to ErrorHandler and stops the handler chain.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// ProblemFor builds the problem describing err; GraphQL uses it too so both
+// APIs report the same codes. Details of unclassified errors are never
+// exposed, since they may contain SQL or upstream responses.
+func ProblemFor(err error) models.Problem {
+	code, detail := CodeInternal, ""
+	var fields []models.FieldError
+
+	var apiErr *APIError
+	var invalid *validation.Error
+	var riskErr *service.RiskError
+	switch {
+	case errors.As(err, &apiErr):
+		code, detail = apiErr.Code, apiErr.Detail
+	case errors.As(err, &invalid):
+		code, detail, fields = CodeValidation, "One or more fields are invalid.", invalid.Fields
+	case errors.As(err, &riskErr) && riskErr.Review == nil:
+		code, detail = CodeRiskRejected, riskErr.Error()
+	case errors.Is(err, policy.ErrDenied):
+		code, detail = CodeForbidden, err.Error()
+	default:
+		for _, m := range errorCodes {
+			if errors.Is(err, m.err) {
+				code = m.code
+				break
+			}
+		}
+	}
+
+	spec, ok := errorCatalogue[code]
+	if !ok {
+		code, spec = CodeInternal, errorCatalogue[CodeInternal]
+	}
+	return models.Problem{
+		Type:   "/problems/" + code,
+		Code:   code,
+		Title:  spec.title,
+		Status: spec.status,
+		Detail: detail,
+		Errors: fields,
+	}
+}
+
+// ErrorHandler renders the last error attached with c.Error as an
+// application/problem+json response, unless the handler already wrote one.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		problem := ProblemFor(err)
+
+		entry := logger(c).WithFields(logrus.Fields{
+			"module": "errorHandler",
+			"code":   problem.Code,
+			"status": problem.Status,
+			"error":  err,
+		})
+		if problem.Status >= http.StatusInternalServerError {
+			entry.Error("Request failed")
+		} else {
+			entry.Debug("Request rejected")
+		}
+		if problem.Status == http.StatusUnauthorized || problem.Status == http.StatusForbidden {
+			auditDenied(c, problem)
+		}
+		writeProblem(c, problem)
+	}
+}
+
+const problemContentType = "application/problem+json"
+
+// writeProblem aborts the request with an RFC 7807 body.
+func writeProblem(c *gin.Context, problem models.Problem) {
+	if problem.Instance == "" {
+		problem.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
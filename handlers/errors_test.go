@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{fmt.Errorf("reading: %w", repo.ErrNotFound), CodeNotFound, http.StatusNotFound},
+		{repo.ErrConflict, CodeConflict, http.StatusConflict},
+		{repo.ErrConstraint, CodeConstraintViolation, http.StatusUnprocessableEntity},
+		{service.ErrUnknownCurrency, CodeUnknownCurrency, http.StatusBadRequest},
+		{service.ErrRateUnavailable, CodeRateUnavailable, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, CodeTimeout, http.StatusGatewayTimeout},
+		{&APIError{Code: CodeInvalidParameter, Detail: "bad id"}, CodeInvalidParameter, http.StatusBadRequest},
+		{&APIError{Code: "no-such-code"}, CodeInternal, http.StatusInternalServerError},
+		{errors.New("pq: password authentication failed"), CodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			problem := ProblemFor(test.err)
+			assert.Equal(t, test.code, problem.Code)
+			assert.Equal(t, test.status, problem.Status)
+			assert.Equal(t, "/problems/"+test.code, problem.Type)
+			assert.NotEmpty(t, problem.Title)
+		})
+	}
+
+	assert.Empty(t, ProblemFor(errors.New("pq: password authentication failed")).Detail, "internal errors must not leak details")
+}
+
+func TestErrorCatalogueIsComplete(t *testing.T) {
+	for _, m := range errorCodes {
+		assert.Contains(t, errorCatalogue, m.code)
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.GET("/written", func(c *gin.Context) {
+		c.Error(errors.New("logged only"))
+		c.JSON(http.StatusAccepted, gin.H{"ok": true})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+}
@@ -1,27 +1,34 @@
 package handlers
 
 import (
+	"DZ_ITOG/blob"
+	"DZ_ITOG/logging"
 	"DZ_ITOG/models"
 	"DZ_ITOG/repo"
 	"DZ_ITOG/service"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	//"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/gin-gonic/gin"
 )
 
-var log = logrus.New()
+// logger returns the request-scoped log entry, tagged with the request ID.
+func logger(c *gin.Context) *logrus.Entry {
+	return logging.FromContext(c.Request.Context())
+}
 
 func Item(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// http.Error replaces this with text/plain for error responses.
+		w.Header().Set("Content-Type", "application/json")
 		switch r.Method {
 		case "POST":
 			var item models.Item
@@ -30,7 +37,7 @@ func Item(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			if err := repo.Create(item, db); err != nil {
+			if err := repo.Create(r.Context(), item, db); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -40,91 +47,98 @@ func Item(db *sql.DB) http.HandlerFunc {
 		case "GET":
 			id := r.URL.Query().Get("id")
 			if id != "" {
-				item := repo.Read(id, db)
-				if item != nil {
-					json.NewEncoder(w).Encode(models.ItemResponse{Item: *item, Ok: true})
-				} else {
+				item, err := repo.Read(r.Context(), id, db)
+				switch {
+				case errors.Is(err, repo.ErrNotFound):
 					http.NotFound(w, r)
+				case err != nil:
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				default:
+					json.NewEncoder(w).Encode(models.ItemResponse{Item: *item, Ok: true})
 				}
 			} else {
-				json.NewEncoder(w).Encode(models.ItemResponse{Item: models.Item{}, Ok: false})
+				items, err := repo.ListItems(r.Context(), db)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				json.NewEncoder(w).Encode(models.ListResponse{Item: items, Ok: true})
 			}
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		}
 	}
 }
 
 func CreateTransaction(c *gin.Context) {
-	var transaction models.Transaction
-	if err := c.BindJSON(&transaction); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	transaction, ok := bindTransaction(c)
+	if !ok {
+		return
+	}
+	if err := principal(c).WriteTransaction(nil, &transaction); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	transactionID, err := repo.CreateTransaction(transaction, c.MustGet("db").(*sql.DB))
+	resp, err := transactionService(c).Create(c.Request.Context(), transaction)
+	var riskErr *service.RiskError
+	if errors.As(err, &riskErr) && riskErr.Review != nil {
+		c.JSON(http.StatusAccepted, riskErr.Review)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
+		abortWithError(c, err)
 		return
 	}
-	transaction.ID = transactionID
-	var commissionRate float64
+	c.JSON(http.StatusCreated, resp)
+}
 
-	if transaction.TransactionType == "перевод" {
-		switch transaction.Currency {
-		case "USD":
-			commissionRate = 0.02
-		case "RUB":
-			commissionRate = 0.05
-		}
-	} else if transaction.TransactionType == "покупка" || transaction.TransactionType == "пополнение" {
-		commissionRate = 0
-	}
+// transactionService returns the service bound to the request's database.
+func transactionService(c *gin.Context) *service.TransactionService {
+	return service.NewTransactionService(c.MustGet("db").(*sql.DB))
+}
 
-	if commissionRate > 0 {
-		commission := models.Commission{
-			TransactionID:   transactionID,
-			Amount:          transaction.Amount,
-			Currency:        transaction.Currency,
-			TransactionType: transaction.TransactionType,
-			Commission:      transaction.Amount * commissionRate,
-			Date:            time.Now().Format("2006-01-02"),
-			Description:     fmt.Sprintf("Комиссия %.2f%% от суммы", commissionRate*100),
-		}
-		log.WithFields(logrus.Fields{
-			"module":     "transactionHandler",
-			"operation":  "CreateTransaction",
-			"commission": commission,
-		}).Debug("Commission calculated")
-		if err := repo.CreateCommission(c.MustGet("db").(*sql.DB), commission); err != nil {
-			log.Printf("Error saving commission: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save commission"})
-			return
-		}
+func invalidTransactionID(err error) *APIError {
+	return &APIError{Code: CodeInvalidParameter, Detail: "Transaction ID must be an integer", Err: err}
+}
 
-		c.JSON(http.StatusCreated, gin.H{"transaction": transaction, "commission": commission})
-	} else {
-		c.JSON(http.StatusCreated, gin.H{"transaction": transaction, "commission": nil})
+// authorizeWrite checks that the caller may replace transaction id with next,
+// or delete it when next is nil. Anonymous callers skip the lookup. On
+// failure it has already passed the error to ErrorHandler and returns false.
+func authorizeWrite(c *gin.Context, id int64, next *models.Transaction) bool {
+	p := principal(c)
+	if p == nil {
+		return true
 	}
+	old, err := transactionService(c).Get(c.Request.Context(), id, "")
+	if err == nil {
+		err = p.WriteTransaction(old, next)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return false
+	}
+	return true
 }
 
+// GetAllTransactions lists every transaction, or only the caller's own when
+// it may not read other users' transactions. Each ?tag= narrows the list to
+// the transactions carrying that tag.
 func GetAllTransactions(c *gin.Context) {
-	dbInterface, ok := c.Get("db")
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection not available"})
-		return
+	var transactions []models.Transaction
+	var err error
+	filter := models.TransactionFilter{Tags: c.QueryArray("tag")}
+	if p := principal(c); p.Can(models.PermissionReadAnyTransaction) && len(filter.Tags) == 0 {
+		transactions, err = transactionService(c).List(c.Request.Context())
+	} else if err = p.ScopeTransactions(&filter); err == nil {
+		transactions, err = transactionService(c).Find(c.Request.Context(), filter)
 	}
-
-	db, ok := dbInterface.(*sql.DB)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid database connection type"})
-		return
-	}
-
-	transactions, err := repo.GetAllTransactions(db)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving transactions"})
+		abortWithError(c, err)
 		return
 	}
-
 	c.JSON(http.StatusOK, transactions)
 }
 
@@ -132,7 +146,7 @@ func GetTransactionByID(c *gin.Context) {
 	idStr := c.Param("id")
 	targetCurrency := c.Query("currency")
 
-	log.WithFields(logrus.Fields{
+	logger(c).WithFields(logrus.Fields{
 		"module":    "transactionHandler",
 		"operation": "GetTransactionByID",
 		"id":        idStr,
@@ -141,193 +155,109 @@ func GetTransactionByID(c *gin.Context) {
 
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger(c).WithFields(logrus.Fields{
 			"module":    "transactionHandler",
 			"operation": "GetTransactionByID",
 			"id":        idStr,
-		}).Error("Invalid transaction ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID format"})
+		}).Warn("Invalid transaction ID format")
+		abortWithError(c, invalidTransactionID(err))
 		return
 	}
 
-	db, ok := c.MustGet("db").(*sql.DB)
-	if !ok {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "GetTransactionByID",
-		}).Error("Database connection not available")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection not available"})
+	transaction, err := transactionService(c).Get(c.Request.Context(), id, targetCurrency)
+	if errors.Is(err, service.ErrUnknownCurrency) {
+		abortWithError(c, &APIError{Code: CodeUnknownCurrency, Detail: fmt.Sprintf("No exchange rate for %s", targetCurrency), Err: err})
 		return
 	}
-
-	log.WithFields(logrus.Fields{
-		"module":    "transactionHandler",
-		"operation": "GetTransactionByID",
-		"id":        id,
-	}).Debug("Attempting to fetch transaction from database")
-
-	transaction, err := repo.GetTransactionByID(id, db)
+	if err == nil {
+		err = principal(c).ReadTransaction(*transaction)
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "GetTransactionByID",
-			"id":        id,
-		}).Error("Transaction not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		abortWithError(c, err)
 		return
 	}
 
-	response := gin.H{
-		"id":               transaction.ID,
-		"user_id":          transaction.UserID,
-		"amount":           transaction.Amount,
-		"currency":         transaction.Currency,
-		"transaction_type": transaction.TransactionType,
-		"category":         transaction.Category,
-		"date":             transaction.Date,
-		"description":      transaction.Description,
-	}
-
-	if targetCurrency != "" && targetCurrency != transaction.Currency {
-		log.WithFields(logrus.Fields{
-			"module":       "transactionHandler",
-			"operation":    "ConvertAmount",
-			"fromCurrency": transaction.Currency,
-			"toCurrency":   targetCurrency,
-			"amount":       transaction.Amount,
-		}).Debug("Attempting to convert currency")
-
-		convertedAmount, err := service.ConvertAmount(transaction.Amount, transaction.Currency, targetCurrency)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"module":    "transactionHandler",
-				"operation": "ConvertAmount",
-				"error":     err,
-			}).Error("Failed to convert amount")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to convert amount: %s", err.Error())})
-			return
-		}
-		response["converted_amount"] = convertedAmount
-		response["converted_currency"] = targetCurrency
-	}
-
-	log.WithFields(logrus.Fields{
+	logger(c).WithFields(logrus.Fields{
 		"module":    "transactionHandler",
 		"operation": "GetTransactionByID",
 		"id":        id,
 	}).Info("Successfully retrieved and processed transaction")
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, transaction)
 }
 
-func DeleteTransaction(c *gin.Context) {
-	idStr := c.Param("id")
-
-	log.WithFields(logrus.Fields{
-		"module":    "transactionHandler",
-		"operation": "DeleteTransaction",
-		"id":        idStr,
-	}).Info("Request to delete transaction")
+// DeleteTransaction removes a transaction, and its attachment contents from
+// store unless store is nil.
+func DeleteTransaction(store blob.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger(c).WithFields(logrus.Fields{
 			"module":    "transactionHandler",
 			"operation": "DeleteTransaction",
 			"id":        idStr,
-			"error":     err.Error(),
-		}).Error("Invalid transaction ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
-		return
-	}
+		}).Info("Request to delete transaction")
 
-	dbInterface, ok := c.Get("db")
-	if !ok {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "DeleteTransaction",
-		}).Error("Database connection not available")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection not available"})
-		return
-	}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			logger(c).WithFields(logrus.Fields{
+				"module":    "transactionHandler",
+				"operation": "DeleteTransaction",
+				"id":        idStr,
+				"error":     err.Error(),
+			}).Warn("Invalid transaction ID format")
+			abortWithError(c, invalidTransactionID(err))
+			return
+		}
 
-	db, ok := dbInterface.(*sql.DB)
-	if !ok {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "DeleteTransaction",
-		}).Error("Invalid database connection type")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid database connection type"})
-		return
-	}
+		if !authorizeWrite(c, id, nil) {
+			return
+		}
+		if err := transactionService(c).WithStore(store).Delete(c.Request.Context(), id); err != nil {
+			abortWithError(c, err)
+			return
+		}
 
-	err = repo.DeleteTransaction(id, db)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger(c).WithFields(logrus.Fields{
 			"module":    "transactionHandler",
 			"operation": "DeleteTransaction",
 			"id":        id,
-			"error":     err.Error(),
-		}).Error("Error deleting transaction")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting transaction"})
-		return
-	}
+		}).Info("Transaction successfully deleted")
 
-	log.WithFields(logrus.Fields{
-		"module":    "transactionHandler",
-		"operation": "DeleteTransaction",
-		"id":        id,
-	}).Info("Transaction successfully deleted")
-
-	c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted"})
+		c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted"})
+	}
 }
 func UpdateTransaction(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger(c).WithFields(logrus.Fields{
 			"module":    "transactionHandler",
 			"operation": "UpdateTransaction",
 			"id":        idStr,
-		}).Error("Invalid transaction ID format")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID format"})
+		}).Warn("Invalid transaction ID format")
+		abortWithError(c, invalidTransactionID(err))
 		return
 	}
 
-	db, ok := c.MustGet("db").(*sql.DB)
+	transaction, ok := bindTransaction(c)
 	if !ok {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "UpdateTransaction",
-		}).Error("Database connection not available")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection not available"})
 		return
 	}
-
-	var transaction models.Transaction
-	if err := c.BindJSON(&transaction); err != nil {
-		log.WithFields(logrus.Fields{
-			"module":    "transactionHandler",
-			"operation": "UpdateTransaction",
-		}).Error("Error binding JSON to transaction model")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !authorizeWrite(c, id, &transaction) {
 		return
 	}
 
-	query := `UPDATE transactions SET user_id = $1, amount = $2, currency = $3, transaction_type = $4, category = $5, description = $6 WHERE transaction_id = $7`
-	_, err = db.Exec(query, transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, id)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+	if err := transactionService(c).Update(c.Request.Context(), id, transaction); err != nil {
+		logger(c).WithFields(logrus.Fields{
 			"module":    "transactionHandler",
 			"operation": "UpdateTransaction",
 			"id":        id,
-			"error":     err,
-		}).Error("Error updating transaction in the database")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating transaction"})
+		}).WithError(err).Warn("Transaction update failed")
+		abortWithError(c, err)
 		return
 	}
-
-	log.WithFields(logrus.Fields{
+	logger(c).WithFields(logrus.Fields{
 		"module":    "transactionHandler",
 		"operation": "UpdateTransaction",
 		"id":        id,
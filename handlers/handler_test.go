@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"DZ_ITOG/blob"
 	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/service"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,12 +32,10 @@ func TestGetAllTransactions(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{
-		"transaction_id", "user_id", "amount", "currency", "transaction_type", "category", "date", "description",
-	}).AddRow(
-		1, 10, 100.0, "USD", "перевод", "category1", time.Now(), "description1",
-	).AddRow(
-		2, 11, 200.0, "EUR", "покупка", "category2", time.Now(), "description2",
+	accountID := 3
+	rows := repotest.TransactionRows(
+		models.Transaction{ID: 1, UserID: 10, Amount: 100, Currency: "USD", TransactionType: "перевод", Category: "category1", Date: time.Now(), Description: "description1"},
+		models.Transaction{ID: 2, UserID: 11, Amount: 200, Currency: "EUR", TransactionType: "покупка", Category: "category2", Date: time.Now(), Description: "description2", AccountID: &accountID},
 	)
 
 	mock.ExpectQuery("^SELECT (.+) FROM transactions$").WillReturnRows(rows)
@@ -62,6 +66,7 @@ func TestCreateTransaction(t *testing.T) {
 	defer db.Close()
 
 	r := gin.Default()
+	r.Use(ErrorHandler())
 	r.POST("/transaction", func(c *gin.Context) {
 		c.Set("db", db)
 		CreateTransaction(c)
@@ -85,9 +90,12 @@ func TestCreateTransaction(t *testing.T) {
 	ctx.Request = req
 	ctx.Set("db", db)
 
-	mock.ExpectQuery(`^INSERT INTO transactions`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	expectUserExists(mock, transaction.UserID, true)
+	mock.ExpectQuery(`^INSERT INTO transactions`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, nil, models.StatusCompleted, nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectEvent(mock)
 
-	commissionDescription := fmt.Sprintf("Комиссия 2.00%% от суммы %.2f", transaction.Amount*0.02)
+	commissionDescription := fmt.Sprintf("Комиссия %.2f%% от суммы", 0.02*100)
 
 	commission := models.Commission{
 		TransactionID:   1,
@@ -99,7 +107,7 @@ func TestCreateTransaction(t *testing.T) {
 		Description:     commissionDescription,
 	}
 
-	mock.ExpectQuery(`^INSERT INTO commissions`).WithArgs(
+	mock.ExpectExec(`^INSERT INTO commissions`).WithArgs(
 		commission.TransactionID,
 		commission.Amount,
 		commission.Currency,
@@ -107,7 +115,9 @@ func TestCreateTransaction(t *testing.T) {
 		commission.Commission,
 		commission.Date,
 		commission.Description,
-	).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEvent(mock)
+	mock.ExpectCommit()
 
 	r.ServeHTTP(w, req)
 
@@ -123,48 +133,100 @@ func TestCreateTransaction(t *testing.T) {
 func TestGetTransactionByID(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	r := gin.Default()
-	r.GET("/transaction/:id", GetTransactionByID)
-
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
 
+	r := gin.Default()
+	r.Use(ErrorHandler(), func(c *gin.Context) {
+		c.Set("db", db)
+		c.Next()
+	})
+	r.GET("/transaction/:id", GetTransactionByID)
+
+	originalFetch := service.FetchCurrencyRates
+	defer func() { service.FetchCurrencyRates = originalFetch }()
+	service.FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+		if baseCurrency == "GBP" {
+			return models.CurrencyRates{}, errors.New("provider down")
+		}
+		return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.5}}, nil
+	}
+
+	const query = `SELECT transaction_id, user_id, amount, currency, transaction_type, category, date, description, account_id, status, refund_of, refunded,.+ FROM transactions WHERE transaction_id = \$1`
+	row := func(currency string) *sqlmock.Rows {
+		return repotest.TransactionRows(models.Transaction{ID: 1, UserID: 10, Amount: 100.50, Currency: currency, TransactionType: "перевод", Category: "business", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Description: "Test transaction"})
+	}
+
 	tests := []struct {
 		description        string
-		ID                 string
+		path               string
 		setupMock          func()
 		expectedStatusCode int
 		expectedResponse   string
 	}{
 		{
 			description: "Correct ID",
-			ID:          "1",
+			path:        "/transaction/1",
 			setupMock: func() {
-				rows := sqlmock.NewRows([]string{"id", "user_id", "amount", "currency", "transaction_type", "category", "date", "description"}).
-					AddRow(1, 10, 100.50, "USD", "transfer", "business", "2024-01-01", "Test transaction")
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE transaction_id = \?`).WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery(query).WithArgs(1).WillReturnRows(row("USD"))
 			},
 			expectedStatusCode: http.StatusOK,
-			expectedResponse:   "{\"id\":1,\"user_id\":10,\"amount\":100.50,\"currency\":\"USD\",\"transaction_type\":\"transfer\",\"category\":\"business\",\"date\":\"2024-01-01\",\"description\":\"Test transaction\"}",
+			expectedResponse:   `"amount":100.5`,
+		},
+		{
+			description: "Converted amount",
+			path:        "/transaction/1?currency=EUR",
+			setupMock: func() {
+				mock.ExpectQuery(query).WithArgs(1).WillReturnRows(row("USD"))
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   `"converted_amount":50.25`,
 		},
 		{
 			description:        "Invalid ID format",
-			ID:                 "abc",
+			path:               "/transaction/abc",
 			setupMock:          func() {},
 			expectedStatusCode: http.StatusBadRequest,
-			expectedResponse:   "{\"error\":\"Invalid transaction ID format\"}",
+			expectedResponse:   `"code":"invalid-parameter"`,
 		},
 		{
 			description: "Transaction not found",
-			ID:          "999",
+			path:        "/transaction/999",
 			setupMock: func() {
-				mock.ExpectQuery(`SELECT \* FROM transactions WHERE transaction_id = \?`).WithArgs(999).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(query).WithArgs(999).WillReturnError(sql.ErrNoRows)
 			},
 			expectedStatusCode: http.StatusNotFound,
-			expectedResponse:   "{\"error\":\"Transaction not found\"}",
+			expectedResponse:   `"code":"not-found"`,
+		},
+		{
+			description: "Database failure is not a 404",
+			path:        "/transaction/2",
+			setupMock: func() {
+				mock.ExpectQuery(query).WithArgs(2).WillReturnError(sql.ErrConnDone)
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedResponse:   `"code":"internal-error"`,
+		},
+		{
+			description: "Unknown target currency",
+			path:        "/transaction/1?currency=XYZ",
+			setupMock: func() {
+				mock.ExpectQuery(query).WithArgs(1).WillReturnRows(row("USD"))
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse:   `"code":"unknown-currency"`,
+		},
+		{
+			description: "Rates unavailable",
+			path:        "/transaction/1?currency=EUR",
+			setupMock: func() {
+				mock.ExpectQuery(query).WithArgs(1).WillReturnRows(row("GBP"))
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedResponse:   `"code":"rate-unavailable"`,
 		},
 	}
 
@@ -172,17 +234,12 @@ func TestGetTransactionByID(t *testing.T) {
 		t.Run(test.description, func(t *testing.T) {
 			test.setupMock()
 
-			req, _ := http.NewRequest(http.MethodGet, "/transaction/"+test.ID, nil)
+			req, _ := http.NewRequest(http.MethodGet, test.path, nil)
 			w := httptest.NewRecorder()
-
-			ctx, _ := gin.CreateTestContext(w)
-			ctx.Request = req
-			ctx.Set("db", db)
-
 			r.ServeHTTP(w, req)
 
 			assert.Equal(t, test.expectedStatusCode, w.Code)
-			assert.JSONEq(t, test.expectedResponse, w.Body.String())
+			assert.Contains(t, w.Body.String(), test.expectedResponse)
 
 			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Errorf("there were unfulfilled expectations: %s", err)
@@ -197,10 +254,15 @@ func TestDeleteTransaction(t *testing.T) {
 	require.NoError(t, err)
 	defer db.Close()
 
+	store := blob.NewMemoryStore()
+	require.NoError(t, store.Put(context.Background(), "receipt", strings.NewReader("%PDF-1.4")))
+
 	router := gin.Default()
+	router.Use(ErrorHandler())
+	deleteTransaction := DeleteTransaction(store)
 	router.DELETE("/transaction/:id", func(c *gin.Context) {
 		c.Set("db", db)
-		DeleteTransaction(c)
+		deleteTransaction(c)
 	})
 
 	tests := []struct {
@@ -214,7 +276,11 @@ func TestDeleteTransaction(t *testing.T) {
 			description:   "Successful Deletion",
 			transactionID: "1",
 			mockBehavior: func() {
-				mock.ExpectExec("DELETE FROM transactions WHERE").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM attachments WHERE").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("receipt"))
+				mock.ExpectQuery("DELETE FROM transactions WHERE").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+				expectEvent(mock)
+				mock.ExpectCommit()
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"message":"Transaction deleted"}`,
@@ -224,16 +290,31 @@ func TestDeleteTransaction(t *testing.T) {
 			transactionID:  "abc",
 			mockBehavior:   func() {},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"error":"Invalid ID format"}`,
+			expectedBody:   `"code":"invalid-parameter"`,
+		},
+		{
+			description:   "Missing transaction",
+			transactionID: "3",
+			mockBehavior: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM attachments WHERE").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+				mock.ExpectQuery("DELETE FROM transactions WHERE").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectRollback()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `"code":"not-found"`,
 		},
 		{
 			description:   "DB Error on Deletion",
 			transactionID: "2",
 			mockBehavior: func() {
-				mock.ExpectExec("DELETE FROM transactions WHERE").WithArgs(2).WillReturnError(sqlmock.ErrCancelled)
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM attachments WHERE").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+				mock.ExpectQuery("DELETE FROM transactions WHERE").WithArgs(2).WillReturnError(sqlmock.ErrCancelled)
+				mock.ExpectRollback()
 			},
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   `{"error":"Error deleting transaction"}`,
+			expectedBody:   `"code":"internal-error"`,
 		},
 	}
 
@@ -254,6 +335,9 @@ func TestDeleteTransaction(t *testing.T) {
 			}
 		})
 	}
+
+	_, err = store.Open(context.Background(), "receipt")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
 }
 func TestUpdateTransaction(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -263,6 +347,7 @@ func TestUpdateTransaction(t *testing.T) {
 	defer db.Close()
 
 	router := gin.Default()
+	router.Use(ErrorHandler())
 	router.PUT("/transaction/:id", func(c *gin.Context) {
 		c.Set("db", db)
 		UpdateTransaction(c)
@@ -291,7 +376,13 @@ func TestUpdateTransaction(t *testing.T) {
 			transactionID: "1",
 			requestBody:   jsonValue,
 			setupMock: func() {
-				mock.ExpectExec(`UPDATE transactions SET`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				expectUserExists(mock, transaction.UserID, true)
+				mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(1).WillReturnRows(
+					repotest.TransactionRows(models.Transaction{ID: 1, UserID: transaction.UserID, Amount: transaction.Amount, Currency: transaction.Currency, TransactionType: transaction.TransactionType, Category: transaction.Category, Date: time.Now(), Description: transaction.Description, Tags: []string{"travel"}}))
+				mock.ExpectExec(`UPDATE transactions SET`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, nil, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectEvent(mock)
+				mock.ExpectCommit()
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"message":"Transaction updated successfully"}`,
@@ -302,17 +393,22 @@ func TestUpdateTransaction(t *testing.T) {
 			requestBody:    jsonValue,
 			setupMock:      func() {},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"error":"Invalid transaction ID format"}`,
+			expectedBody:   `"code":"invalid-parameter"`,
 		},
 		{
 			description:   "DB Update Error",
 			transactionID: "1",
 			requestBody:   jsonValue,
 			setupMock: func() {
-				mock.ExpectExec(`UPDATE transactions SET`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, 1).WillReturnError(sqlmock.ErrCancelled)
+				mock.ExpectBegin()
+				expectUserExists(mock, transaction.UserID, true)
+				mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(1).WillReturnRows(
+					repotest.TransactionRows(models.Transaction{ID: 1, UserID: transaction.UserID, Amount: transaction.Amount, Currency: transaction.Currency, TransactionType: transaction.TransactionType, Date: time.Now()}))
+				mock.ExpectExec(`UPDATE transactions SET`).WithArgs(transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, nil, 1).WillReturnError(sqlmock.ErrCancelled)
+				mock.ExpectRollback()
 			},
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   `{"error":"Error updating transaction"}`,
+			expectedBody:   `"code":"internal-error"`,
 		},
 	}
 
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const readinessTimeout = 5 * time.Second
+
+// Healthz is the liveness probe: it answers as long as the process can serve
+// HTTP and never touches external dependencies.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz is the readiness probe. It reports each dependency separately and
+// answers 503 when any of them is not usable.
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+	fail := func(name string, err error) {
+		ready = false
+		checks[name] = err.Error()
+		logger(c).WithFields(logrus.Fields{
+			"module":    "healthHandler",
+			"operation": "Readyz",
+			"check":     name,
+			"error":     err,
+		}).Warn("Readiness check failed")
+	}
+
+	db, _ := c.MustGet("db").(*sql.DB)
+	if err := db.PingContext(ctx); err != nil {
+		fail("database", err)
+	} else {
+		checks["database"] = "ok"
+		if err := repo.CheckSchema(ctx, db); err != nil {
+			fail("migrations", err)
+		} else {
+			checks["migrations"] = "ok"
+		}
+	}
+
+	if err := service.CheckRateProvider(ctx); err != nil {
+		fail("rates", err)
+	} else {
+		checks["rates"] = "ok"
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// ConfigVersion reports which configuration revision is in effect, so a
+// reload can be confirmed without reading logs.
+func ConfigVersion(reloader *configs.Reloader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, reloader.Version())
+	}
+}
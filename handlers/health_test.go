@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/healthz", Healthz)
+
+	req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	originalCheck := service.CheckRateProvider
+	defer func() { service.CheckRateProvider = originalCheck }()
+
+	tests := []struct {
+		description    string
+		setupMock      func(mock sqlmock.Sqlmock)
+		ratesErr       error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description: "All dependencies ready",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing()
+				for _, table := range repo.RequiredTables() {
+					mock.ExpectQuery(`SELECT to_regclass`).WithArgs(table).
+						WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(table))
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ready","checks":{"database":"ok","migrations":"ok","rates":"ok"}}`,
+		},
+		{
+			description: "Missing table",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing()
+				mock.ExpectQuery(`SELECT to_regclass`).WithArgs("items").
+					WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"database":"ok","migrations":"table items is missing","rates":"ok"}}`,
+		},
+		{
+			description: "Database and rates down",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+			},
+			ratesErr:       errors.New("no currency rate provider reachable"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"database":"connection refused","rates":"no currency rate provider reachable"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			require.NoError(t, err)
+			defer db.Close()
+
+			test.setupMock(mock)
+			service.CheckRateProvider = func(ctx context.Context) error { return test.ratesErr }
+
+			router := gin.New()
+			router.GET("/readyz", func(c *gin.Context) {
+				c.Set("db", db)
+				Readyz(c)
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.JSONEq(t, test.expectedBody, w.Body.String())
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
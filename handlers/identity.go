@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys under which authentication stores the caller, so that later
+// middleware such as rate limiting can tell callers apart. Requests without
+// them are anonymous and identified by client IP.
+const (
+	ContextUserID   = "user_id"
+	ContextAPIKeyID = "api_key_id"
+	// ContextAPIKey holds the models.APIKey the request authenticated with.
+	ContextAPIKey = "api_key"
+)
+
+// SetPrincipal records the roles and permissions of the caller in the request
+// context, where both handlers and GraphQL resolvers find it.
+func SetPrincipal(c *gin.Context, p *policy.Principal) {
+	c.Request = c.Request.WithContext(policy.WithPrincipal(c.Request.Context(), p))
+}
+
+// principal returns the caller's principal, or nil for an anonymous request.
+func principal(c *gin.Context) *policy.Principal {
+	return policy.FromContext(c.Request.Context())
+}
+
+// SetAPIKey records key as the caller of the request.
+func SetAPIKey(c *gin.Context, key models.APIKey) {
+	c.Set(ContextAPIKey, key)
+	c.Set(ContextAPIKeyID, key.ID)
+	c.Set(ContextUserID, key.UserID)
+}
+
+// apiKey returns the key the request authenticated with, or nil for an
+// anonymous request.
+func apiKey(c *gin.Context) *models.APIKey {
+	value, ok := c.Get(ContextAPIKey)
+	if !ok {
+		return nil
+	}
+	key := value.(models.APIKey)
+	return &key
+}
+
+// RequireScope rejects requests whose API key lacks scope. Anonymous
+// requests pass: whether they are allowed at all is decided by the
+// authentication middleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := apiKey(c); key != nil && !key.HasScope(scope) {
+			abortWithError(c, &APIError{Code: CodeForbidden, Detail: fmt.Sprintf("The API key lacks the %s scope.", scope)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAPIKey rejects anonymous requests.
+func RequireAPIKey(c *gin.Context) {
+	if apiKey(c) == nil {
+		c.Header("WWW-Authenticate", `Bearer realm="api"`)
+		abortWithError(c, &APIError{Code: CodeUnauthenticated, Detail: "An API key is required."})
+		return
+	}
+	c.Next()
+}
+
+// RequireRole rejects requests whose user lacks role, anonymous ones
+// included.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !principal(c).HasRole(role) {
+			abortWithError(c, &APIError{Code: CodeForbidden, Detail: fmt.Sprintf("The %s role is required.", role)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission rejects requests whose user lacks permission. Like
+// RequireScope it lets anonymous requests through.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := principal(c).Require(permission); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
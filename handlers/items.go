@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllItems(c *gin.Context) {
+	items, err := repo.ListItems(c.Request.Context(), c.MustGet("db").(*sql.DB))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ListResponse{Item: items, Ok: true})
+}
+
+func GetItemByID(c *gin.Context) {
+	item, err := repo.Read(c.Request.Context(), c.Param("id"), c.MustGet("db").(*sql.DB))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ItemResponse{Item: *item, Ok: true})
+}
+
+func CreateItem(c *gin.Context) {
+	var item models.Item
+	if err := c.ShouldBindJSON(&item); err != nil {
+		abortWithError(c, bindError(err))
+		return
+	}
+	if item.ID == "" {
+		abortWithError(c, validation.Fields(models.FieldError{Field: "id", Message: "is required"}))
+		return
+	}
+
+	if err := repo.Create(c.Request.Context(), item, c.MustGet("db").(*sql.DB)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ItemResponse{Item: item, Ok: true})
+}
+
+func UpdateItem(c *gin.Context) {
+	var item models.Item
+	if err := c.ShouldBindJSON(&item); err != nil {
+		abortWithError(c, bindError(err))
+		return
+	}
+	item.ID = c.Param("id")
+
+	if err := repo.UpdateItem(c.Request.Context(), item, c.MustGet("db").(*sql.DB)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ItemResponse{Item: item, Ok: true})
+}
+
+func DeleteItem(c *gin.Context) {
+	if err := repo.DeleteItem(c.Request.Context(), c.Param("id"), c.MustGet("db").(*sql.DB)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item deleted"})
+}
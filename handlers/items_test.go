@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemsCRUD(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.Use(ErrorHandler(), func(c *gin.Context) {
+		c.Set("db", db)
+		c.Next()
+	})
+	router.GET("/items", GetAllItems)
+	router.POST("/items", CreateItem)
+	router.GET("/items/:id", GetItemByID)
+	router.PUT("/items/:id", UpdateItem)
+	router.DELETE("/items/:id", DeleteItem)
+
+	tests := []struct {
+		description    string
+		method         string
+		path           string
+		body           string
+		setupMock      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description: "List items",
+			method:      http.MethodGet,
+			path:        "/items",
+			setupMock: func() {
+				mock.ExpectQuery("SELECT item_id, value FROM items").
+					WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}).AddRow("1", "one").AddRow("2", "two"))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"items":[{"id":"1","value":"one"},{"id":"2","value":"two"}],"ok":true}`,
+		},
+		{
+			description: "Create item",
+			method:      http.MethodPost,
+			path:        "/items",
+			body:        `{"id":"3","value":"three"}`,
+			setupMock: func() {
+				mock.ExpectExec("INSERT INTO items").WithArgs("3", "three").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"item":{"id":"3","value":"three"},"ok":true}`,
+		},
+		{
+			description:    "Create item without ID",
+			method:         http.MethodPost,
+			path:           "/items",
+			body:           `{"value":"three"}`,
+			setupMock:      func() {},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"type":"/problems/validation-error","code":"validation-error","title":"Request validation failed","status":422,"detail":"One or more fields are invalid.","instance":"/items","errors":[{"field":"id","message":"is required"}]}`,
+		},
+		{
+			description: "Create duplicate item",
+			method:      http.MethodPost,
+			path:        "/items",
+			body:        `{"id":"1","value":"again"}`,
+			setupMock: func() {
+				mock.ExpectExec("INSERT INTO items").WithArgs("1", "again").WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint \"items_pkey\""})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"type":"/problems/conflict","code":"conflict","title":"Conflicting change","status":409,"instance":"/items"}`,
+		},
+		{
+			description: "Get missing item",
+			method:      http.MethodGet,
+			path:        "/items/404",
+			setupMock: func() {
+				mock.ExpectQuery("SELECT item_id, value FROM items WHERE item_id =").WithArgs("404").WillReturnError(sql.ErrNoRows)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"type":"/problems/not-found","code":"not-found","title":"Resource not found","status":404,"instance":"/items/404"}`,
+		},
+		{
+			description: "Update item",
+			method:      http.MethodPut,
+			path:        "/items/1",
+			body:        `{"value":"uno"}`,
+			setupMock: func() {
+				mock.ExpectExec("UPDATE items SET value").WithArgs("uno", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"item":{"id":"1","value":"uno"},"ok":true}`,
+		},
+		{
+			description: "Delete missing item",
+			method:      http.MethodDelete,
+			path:        "/items/404",
+			setupMock: func() {
+				mock.ExpectExec("DELETE FROM items WHERE item_id =").WithArgs("404").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"type":"/problems/not-found","code":"not-found","title":"Resource not found","status":404,"instance":"/items/404"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.setupMock()
+
+			req, _ := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.JSONEq(t, test.expectedBody, w.Body.String())
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
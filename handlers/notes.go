@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// accessTransaction returns transaction :id once the caller may read it, or
+// also change it when write is set. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func accessTransaction(c *gin.Context, write bool) (*models.Transaction, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, invalidTransactionID(err))
+		return nil, false
+	}
+	transaction, err := transactionService(c).Get(c.Request.Context(), id, "")
+	if err == nil {
+		if write {
+			err = principal(c).WriteTransaction(transaction, transaction)
+		} else {
+			err = principal(c).ReadTransaction(*transaction)
+		}
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return nil, false
+	}
+	return transaction, true
+}
+
+// GetTransactionNotes returns the notes on a transaction the caller may read,
+// oldest first.
+func GetTransactionNotes(c *gin.Context) {
+	transaction, ok := accessTransaction(c, false)
+	if !ok {
+		return
+	}
+	notes, err := transactionService(c).Notes(c.Request.Context(), int64(transaction.ID))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// AddTransactionNote leaves a note on a transaction the caller may change,
+// signed with the caller's user.
+func AddTransactionNote(c *gin.Context) {
+	transaction, ok := accessTransaction(c, true)
+	if !ok {
+		return
+	}
+	var note models.Note
+	if err := c.ShouldBindJSON(&note); err != nil {
+		abortWithError(c, bindError(err))
+		return
+	}
+	note.Author = nil
+	if p := principal(c); p != nil {
+		note.Author = &p.UserID
+	}
+	note, err := transactionService(c).AddNote(c.Request.Context(), int64(transaction.ID), note)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":         "transactionHandler",
+		"operation":      "AddNote",
+		"transaction_id": transaction.ID,
+		"note_id":        note.ID,
+	}).Info("Note added")
+	c.JSON(http.StatusCreated, note)
+}
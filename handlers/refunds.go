@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RefundTransaction refunds all of purchase :id, or the amount in the
+// optional body, and answers with the refund.
+func RefundTransaction(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, invalidTransactionID(err))
+		return
+	}
+	var request models.RefundRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		abortWithError(c, bindError(err))
+		return
+	}
+	resp, err := transactionService(c).Refund(c.Request.Context(), id, request)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":         "transactionHandler",
+		"operation":      "RefundTransaction",
+		"transaction_id": id,
+		"refund_id":      resp.Transaction.ID,
+	}).Info("Transaction refunded")
+	c.JSON(http.StatusCreated, resp)
+}
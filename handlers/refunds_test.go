@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundTransaction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleSupport)
+	router.POST("/transactions/:id/refund", RefundTransaction)
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/transactions/2/refund", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("full refund", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs(2).WillReturnRows(
+			repotest.TransactionRows(models.Transaction{ID: 2, UserID: 8, Amount: 30, Currency: "USD", TransactionType: "покупка", Date: time.Now(), Refunded: 10}))
+		mock.ExpectQuery(`INSERT INTO transactions`).WithArgs(8, 20.0, "USD", "пополнение", "", "Чарджбэк по транзакции 2", nil, models.StatusCompleted, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(5))
+		expectEvent(mock)
+		mock.ExpectExec(`UPDATE transactions SET refunded`).WithArgs(20.0, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w := serve(`{"chargeback":true}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"refund_of":2`)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("negative amount", func(t *testing.T) {
+		w := serve(`{"amount":-5}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"amount"`)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTransactionReport totals transactions per currency and type, with the
+// commission charged, filtered as described at transactionFilter. Callers
+// who may only read their own transactions get their own totals.
+func GetTransactionReport(c *gin.Context) {
+	filter, ok := transactionFilter(c)
+	if !ok {
+		return
+	}
+	if err := principal(c).ScopeTransactions(&filter); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	summaries, err := transactionService(c).Summarize(c.Request.Context(), filter)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetCategoryReport totals transactions per currency and category, counting
+// each split in its own category. It takes the filters of
+// GetTransactionReport and an optional category. Callers who may only read
+// their own transactions get their own totals.
+func GetCategoryReport(c *gin.Context) {
+	filter, ok := transactionFilter(c)
+	if !ok {
+		return
+	}
+	filter.Category = c.Query("category")
+	if err := principal(c).ScopeTransactions(&filter); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	summaries, err := transactionService(c).SummarizeCategories(c.Request.Context(), filter)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+// transactionFilter reads the optional query filters user_id, currency,
+// transaction_type, and from (inclusive) / to (exclusive) as YYYY-MM-DD or
+// RFC 3339. On failure it has already passed the error to ErrorHandler and
+// returns false.
+func transactionFilter(c *gin.Context) (models.TransactionFilter, bool) {
+	filter := models.TransactionFilter{
+		Currency:        c.Query("currency"),
+		TransactionType: c.Query("transaction_type"),
+	}
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "user_id must be an integer", Err: err})
+			return filter, false
+		}
+		filter.UserID = &id
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(p.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseDate(value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: p.name + " must be a date such as 2024-01-31 or 2024-01-31T15:04:05Z", Err: err})
+			return filter, false
+		}
+		*p.dst = &t
+	}
+	return filter, true
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// reviewService returns the service bound to the request's database.
+func reviewService(c *gin.Context) *service.ReviewService {
+	return service.NewReviewService(c.MustGet("db").(*sql.DB))
+}
+
+// reviewID parses the :id parameter. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func reviewID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "Review ID must be an integer", Err: err})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListReviews returns the review queue: the pending reviews, oldest first,
+// or those with ?status, optionally of one ?user_id.
+func ListReviews(c *gin.Context) {
+	filter := repo.ReviewFilter{Status: c.DefaultQuery("status", models.ReviewPending), Limit: 100}
+	switch filter.Status {
+	case models.ReviewFlagged, models.ReviewPending, models.ReviewApproved, models.ReviewDeclined:
+	default:
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "status must be flagged, pending, approved or declined"})
+		return
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "user_id must be an integer", Err: err})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "limit must be an integer between 1 and 1000", Err: err})
+			return
+		}
+		filter.Limit = limit
+	}
+	reviews, err := reviewService(c).List(c.Request.Context(), filter)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, reviews)
+}
+
+func GetReview(c *gin.Context) {
+	id, ok := reviewID(c)
+	if !ok {
+		return
+	}
+	review, err := reviewService(c).Get(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
+
+// ApproveReview stores the transaction of a pending review.
+func ApproveReview(c *gin.Context) {
+	decideReview(c, models.ReviewApproved, (*service.ReviewService).Approve)
+}
+
+// DeclineReview discards the transaction of a pending review.
+func DeclineReview(c *gin.Context) {
+	decideReview(c, models.ReviewDeclined, (*service.ReviewService).Decline)
+}
+
+type reviewDecider func(s *service.ReviewService, ctx context.Context, id int64, reviewer *int, note string) (models.RiskReview, error)
+
+// decideReview reads the optional decision body and records the decision of
+// the caller.
+func decideReview(c *gin.Context, status string, decide reviewDecider) {
+	id, ok := reviewID(c)
+	if !ok {
+		return
+	}
+	var decision models.ReviewDecision
+	if err := c.ShouldBindJSON(&decision); err != nil && !errors.Is(err, io.EOF) {
+		abortWithError(c, bindError(err))
+		return
+	}
+	var reviewer *int
+	if p := principal(c); p != nil {
+		reviewer = &p.UserID
+	}
+	review, err := decide(reviewService(c), c.Request.Context(), id, reviewer, decision.Note)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":    "reviewHandler",
+		"review_id": id,
+		"status":    status,
+	}).Info("Risk review decided")
+	c.JSON(http.StatusOK, review)
+}
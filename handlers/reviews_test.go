@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskReviewHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	config := configs.Default()
+	config.Risk.Velocity = configs.VelocityRule{Action: configs.RiskHold, Window: time.Hour, MaxCount: 1}
+	config.Risk.LargeAmount = configs.LargeAmountRule{Action: configs.RiskReject, Factor: 10, Lookback: time.Hour, MinHistory: 1}
+	service.Configure(config)
+	defer service.Configure(configs.Default())
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleAdmin)
+	router.POST("/transactions", CreateTransaction)
+	router.GET("/reviews", ListReviews)
+	router.POST("/reviews/:id/decline", DeclineReview)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expectHistory := func(recent int, average float64) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"amount", "currency", "transaction_type", "age"})
+		for i := 0; i < recent; i++ {
+			rows.AddRow(20, "USD", "покупка", 60.0)
+		}
+		mock.ExpectQuery(`FROM transactions WHERE user_id = \$1 AND date >=`).WillReturnRows(rows)
+		mock.ExpectQuery(`SELECT count\(\*\), COALESCE\(avg\(amount\), 0\)`).WillReturnRows(sqlmock.NewRows([]string{"count", "avg"}).AddRow(recent, average))
+	}
+	const body = `{"user_id":7,"amount":250,"currency":"USD","transaction_type":"покупка"}`
+
+	t.Run("held transaction is accepted with its review", func(t *testing.T) {
+		expectHistory(1, 100)
+		mock.ExpectQuery(`INSERT INTO risk_reviews`).WillReturnRows(sqlmock.NewRows([]string{"review_id", "created_at"}).AddRow(5, time.Now()))
+		mock.ExpectCommit()
+
+		w := serve(http.MethodPost, "/transactions", body)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		var review models.RiskReview
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &review))
+		assert.Equal(t, int64(5), review.ID)
+		assert.Equal(t, models.ReviewPending, review.Status)
+		assert.Equal(t, 250.0, review.Transaction.Amount)
+	})
+
+	t.Run("rejected transaction", func(t *testing.T) {
+		expectHistory(1, 20)
+		mock.ExpectRollback()
+
+		w := serve(http.MethodPost, "/transactions", body)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+		var problem models.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, CodeRiskRejected, problem.Code)
+		assert.Contains(t, problem.Detail, "large_amount")
+	})
+
+	t.Run("decline without a body", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM risk_reviews WHERE review_id = \$1 FOR UPDATE`).WithArgs(5).WillReturnRows(
+			sqlmock.NewRows([]string{"review_id", "status", "user_id", "transaction_id", "transaction", "findings", "created_at", "decided_at", "decided_by", "note"}).
+				AddRow(5, models.ReviewPending, 7, nil, `{"user_id":7,"amount":250}`, `[]`, time.Now(), nil, nil, ""))
+		mock.ExpectQuery(`UPDATE risk_reviews SET status = \$1`).WithArgs(models.ReviewDeclined, nil, 7, "", int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"decided_at"}).AddRow(time.Now()))
+		mock.ExpectCommit()
+
+		req := httptest.NewRequest(http.MethodPost, "/reviews/5/decline", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"status":"declined"`)
+		assert.Contains(t, w.Body.String(), `"decided_by":7`)
+	})
+
+	t.Run("list with an unknown status", func(t *testing.T) {
+		w := serve(http.MethodGet, "/reviews?status=lost", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
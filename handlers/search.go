@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"DZ_ITOG/search"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSearchLength caps ?q, in characters.
+const maxSearchLength = 200
+
+// SearchTransactions finds transactions by ?q in their description, category
+// and tags, best match first. It takes the filters of transactionFilter plus
+// ?category, ?status and repeated ?tag, and pages with ?limit (default 20, at
+// most 100) and ?offset. Callers who may only read their own transactions
+// search their own.
+func SearchTransactions(searcher search.Searcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		if text == "" || utf8.RuneCountInString(text) > maxSearchLength {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "q must be 1 to " + strconv.Itoa(maxSearchLength) + " characters"})
+			return
+		}
+		filter, ok := transactionFilter(c)
+		if !ok {
+			return
+		}
+		filter.Category = c.Query("category")
+		filter.Status = c.Query("status")
+		filter.Tags = c.QueryArray("tag")
+		filter.Limit = 20
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 100 {
+				abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "limit must be an integer between 1 and 100", Err: err})
+				return
+			}
+			filter.Limit = limit
+		}
+		if value := c.Query("offset"); value != "" {
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "offset must be a non-negative integer", Err: err})
+				return
+			}
+			filter.Offset = offset
+		}
+		if err := principal(c).ScopeTransactions(&filter); err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		results, err := searcher.Search(c.Request.Context(), text, filter)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
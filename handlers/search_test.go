@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSearcher answers every search with results and keeps what it was
+// asked.
+type recordingSearcher struct {
+	text    string
+	filter  models.TransactionFilter
+	results []models.SearchResult
+}
+
+func (s *recordingSearcher) Search(ctx context.Context, text string, filter models.TransactionFilter) ([]models.SearchResult, error) {
+	s.text, s.filter = text, filter
+	return s.results, nil
+}
+
+func TestSearchTransactions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	serve := func(role, path string, searcher *recordingSearcher) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(ErrorHandler())
+		asRole(router, db, role)
+		router.GET("/transactions/search", SearchTransactions(searcher))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("customers search their own transactions", func(t *testing.T) {
+		searcher := &recordingSearcher{results: []models.SearchResult{{Transaction: models.Transaction{ID: 5, UserID: 7, Description: "Такси"}, Rank: 0.7}}}
+		w := serve(models.RoleCustomer, "/transactions/search?q=+%D1%82%D0%B0%D0%BA%D1%81%D0%B8+&tag=trip&status=completed&offset=10", searcher)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"rank":0.7`)
+		assert.Equal(t, "такси", searcher.text)
+		require.NotNil(t, searcher.filter.UserID)
+		assert.Equal(t, 7, *searcher.filter.UserID)
+		assert.Equal(t, []string{"trip"}, searcher.filter.Tags)
+		assert.Equal(t, models.StatusCompleted, searcher.filter.Status)
+		assert.Equal(t, 20, searcher.filter.Limit)
+		assert.Equal(t, 10, searcher.filter.Offset)
+	})
+
+	t.Run("support searches everyone's", func(t *testing.T) {
+		searcher := &recordingSearcher{results: []models.SearchResult{}}
+		w := serve(models.RoleSupport, "/transactions/search?q=taxi&limit=100", searcher)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `[]`, w.Body.String())
+		assert.Nil(t, searcher.filter.UserID)
+		assert.Equal(t, 100, searcher.filter.Limit)
+	})
+
+	for _, path := range []string{
+		"/transactions/search",
+		"/transactions/search?q=taxi&limit=101",
+		"/transactions/search?q=taxi&offset=-1",
+		"/transactions/search?q=taxi&from=march",
+	} {
+		t.Run("bad request "+path, func(t *testing.T) {
+			w := serve(models.RoleSupport, path, &recordingSearcher{})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "invalid-parameter")
+		})
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
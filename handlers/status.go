@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// CompleteTransaction confirms a pending transaction and charges its
+// commission.
+func CompleteTransaction(c *gin.Context) {
+	transitionTransaction(c, models.StatusCompleted)
+}
+
+// FailTransaction marks a pending transaction failed; no commission is
+// charged.
+func FailTransaction(c *gin.Context) {
+	transitionTransaction(c, models.StatusFailed)
+}
+
+// ReverseTransaction reverses a completed transaction and cancels its
+// commission.
+func ReverseTransaction(c *gin.Context) {
+	transitionTransaction(c, models.StatusReversed)
+}
+
+// transitionTransaction reads the optional body with the reason and moves
+// transaction :id to status on behalf of the caller.
+func transitionTransaction(c *gin.Context, status string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, invalidTransactionID(err))
+		return
+	}
+	var change models.StatusChange
+	if err := c.ShouldBindJSON(&change); err != nil && !errors.Is(err, io.EOF) {
+		abortWithError(c, bindError(err))
+		return
+	}
+	var actor *int
+	if p := principal(c); p != nil {
+		actor = &p.UserID
+	}
+	transition, err := transactionService(c).Transition(c.Request.Context(), id, status, change.Reason, actor)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":         "transactionHandler",
+		"operation":      "Transition",
+		"transaction_id": id,
+		"from":           transition.From,
+		"to":             transition.To,
+	}).Info("Transaction status changed")
+	c.JSON(http.StatusOK, transition)
+}
+
+// GetTransactionTransitions returns the status history of a transaction the
+// caller may read, oldest first.
+func GetTransactionTransitions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithError(c, invalidTransactionID(err))
+		return
+	}
+	transactions := transactionService(c)
+	transaction, err := transactions.Get(c.Request.Context(), id, "")
+	if err == nil {
+		err = principal(c).ReadTransaction(*transaction)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	transitions, err := transactions.Transitions(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transitions)
+}
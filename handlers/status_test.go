@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleSupport)
+	router.POST("/transactions/:id/fail", FailTransaction)
+	router.POST("/transactions/:id/reverse", ReverseTransaction)
+	serve := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	locked := func(status string) {
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs(2).
+			WillReturnRows(repotest.TransactionRows(models.Transaction{ID: 2, UserID: 8, Amount: 30, Currency: "USD", TransactionType: "покупка", Date: time.Now(), Status: status}))
+	}
+
+	t.Run("fail records the reason and the actor", func(t *testing.T) {
+		mock.ExpectBegin()
+		locked(models.StatusPending)
+		mock.ExpectExec(`UPDATE transactions SET status`).WithArgs(models.StatusFailed, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO transaction_transitions`).WithArgs(2, models.StatusPending, models.StatusFailed, "card declined", 7).
+			WillReturnRows(sqlmock.NewRows([]string{"transition_id", "occurred_at"}).AddRow(1, time.Now()))
+		expectEvent(mock)
+		mock.ExpectCommit()
+
+		w := serve("/transactions/2/fail", `{"reason":"card declined"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"to":"failed"`)
+		assert.Contains(t, w.Body.String(), `"actor":7`)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reversing a pending transaction is a conflict", func(t *testing.T) {
+		mock.ExpectBegin()
+		locked(models.StatusPending)
+		mock.ExpectRollback()
+
+		w := serve("/transactions/2/reverse", "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"conflict"`)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
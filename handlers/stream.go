@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/stream"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// streamRetry is how long clients wait before reconnecting a stream that
+// ended.
+const streamRetry = time.Second
+
+// StreamTransactions serves the changes to transactions as server-sent
+// events: each event is named after the event type, carries the webhook
+// event as data and the hub sequence as id. Callers who may only read their
+// own transactions get their own changes.
+//
+// A client resumes with the Last-Event-ID header, or ?last_event_id= where
+// headers cannot be set, and first gets the events it missed. When those are
+// no longer buffered it gets a "reset" event and should reload.
+func StreamTransactions(hub *stream.Hub, config configs.StreamConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.TransactionFilter
+		if err := principal(c).ScopeTransactions(&filter); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		lastSeq, ok := lastEventID(c)
+		if !ok {
+			return
+		}
+
+		sub, replay, resumed := hub.Subscribe(lastSeq, func(e stream.Event) bool {
+			return filter.UserID == nil || e.UserID == *filter.UserID
+		})
+		defer sub.Close()
+		log := logger(c).WithFields(logrus.Fields{
+			"module":   "streamHandler",
+			"last_seq": lastSeq,
+			"replayed": len(replay),
+			"resumed":  resumed,
+		})
+		log.Debug("Transaction stream opened")
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry.Milliseconds())
+		if !resumed {
+			fmt.Fprint(c.Writer, "event: reset\ndata: {}\n\n")
+		}
+		for _, e := range replay {
+			if err := writeStreamEvent(c.Writer, e); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(config.Heartbeat)
+		defer heartbeat.Stop()
+		deadline := time.NewTimer(config.MaxDuration)
+		defer deadline.Stop()
+		for {
+			var err error
+			select {
+			case <-c.Request.Context().Done():
+				log.Debug("Transaction stream closed by the client")
+				return
+			case <-deadline.C:
+				// The client reconnects after streamRetry and resumes.
+				return
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			case e, ok := <-sub.Events():
+				if !ok {
+					if sub.Lagged() {
+						log.Warn("Transaction stream fell behind and was dropped")
+					}
+					return
+				}
+				err = writeStreamEvent(c.Writer, e)
+			}
+			if err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// lastEventID reads the sequence to resume after, zero for none. On failure
+// it has already passed the error to ErrorHandler and returns false.
+func lastEventID(c *gin.Context) (int64, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, true
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "Last-Event-ID must be an event id from this stream", Err: err})
+		return 0, false
+	}
+	return seq, true
+}
+
+func writeStreamEvent(w io.Writer, e stream.Event) error {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+	return err
+}
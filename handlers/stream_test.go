@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/stream"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTransactions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := stream.NewHub(stream.DefaultBufferSize)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, nil, models.RoleCustomer)
+	router.GET("/transactions/stream", StreamTransactions(hub, configs.StreamConfig{Heartbeat: 40 * time.Millisecond, MaxDuration: 150 * time.Millisecond}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	publish := func(userID int, id string) {
+		hub.Publish(stream.Event{UserID: userID, Event: models.Event{ID: id, Type: models.EventTransactionCreated, Data: []byte(`{}`)}})
+	}
+	watch, _, _ := hub.Subscribe(0, func(stream.Event) bool { return true })
+	publish(7, "evt_1")
+	publish(8, "evt_2")
+	publish(7, "evt_3")
+	first := <-watch.Events()
+	second := <-watch.Events()
+	third := <-watch.Events()
+	watch.Close()
+
+	get := func(lastEventID string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/transactions/stream", nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		// Published once the headers are in, so it arrives live.
+		publish(7, "evt_live")
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	t.Run("resumes with the caller's events, then follows and ends", func(t *testing.T) {
+		resp, body := get(fmt.Sprint(first.Seq))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Contains(t, body, "retry: 1000\n\n")
+		assert.Contains(t, body, fmt.Sprintf("id: %d\nevent: transaction.created\ndata: {\"id\":\"evt_3\",", third.Seq))
+		assert.NotContains(t, body, fmt.Sprintf("id: %d\n", second.Seq), "another user's transaction")
+		assert.Contains(t, body, `"id":"evt_live"`)
+		assert.Contains(t, body, ": heartbeat\n\n")
+		assert.NotContains(t, body, "event: reset")
+	})
+
+	t.Run("unknown id resets", func(t *testing.T) {
+		_, body := get("12")
+		assert.Contains(t, body, "event: reset\ndata: {}\n\n")
+		assert.NotContains(t, body, `"id":"evt_3"`)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/transactions/stream?last_event_id=yesterday")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
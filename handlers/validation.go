@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/validation"
+	"encoding/json"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindError turns a ShouldBindJSON failure into a validation error or, for
+// bodies that are not JSON at all, a malformed-request error.
+func bindError(err error) error {
+	if fields, ok := validation.FromValidator(err); ok {
+		return validation.Fields(fields...)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return validation.Fields(models.FieldError{
+			Field:   typeErr.Field,
+			Message: "must be a " + typeErr.Type.String(),
+		})
+	}
+	return &APIError{Code: CodeMalformedRequest, Detail: err.Error(), Err: err}
+}
+
+// bindTransaction binds the body. On failure it has already passed the error
+// to ErrorHandler and returns false. Reference checks are left to the
+// service, which runs them in the same database transaction as the write.
+func bindTransaction(c *gin.Context) (models.Transaction, bool) {
+	var transaction models.Transaction
+	if err := c.ShouldBindJSON(&transaction); err != nil {
+		abortWithError(c, bindError(err))
+		return transaction, false
+	}
+	return transaction, true
+}
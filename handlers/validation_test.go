@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"DZ_ITOG/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectUserExists(mock sqlmock.Sqlmock, userID int, exists bool) {
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE user_id = \$1\)`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+// expectEvent expects one event written to the outbox and queued for webhooks.
+func expectEvent(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`^INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func postTransaction(t *testing.T, body string, setupMock func(sqlmock.Sqlmock)) (*httptest.ResponseRecorder, models.Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	if setupMock != nil {
+		setupMock(mock)
+	}
+
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.POST("/transactions", func(c *gin.Context) {
+		c.Set("db", db)
+		CreateTransaction(c)
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/transactions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	var problem models.Problem
+	if w.Code >= 400 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), w.Body.String())
+	}
+	return w, problem
+}
+
+func problemFields(problem models.Problem) map[string]string {
+	fields := map[string]string{}
+	for _, fe := range problem.Errors {
+		fields[fe.Field] = fe.Message
+	}
+	return fields
+}
+
+func TestCreateTransactionValidation(t *testing.T) {
+	tests := []struct {
+		description string
+		body        string
+		fields      []string
+	}{
+		{"missing fields", `{}`, []string{"user_id", "amount", "currency", "transaction_type"}},
+		{"negative amount", `{"user_id":1,"amount":-5,"currency":"USD","transaction_type":"перевод"}`, []string{"amount"}},
+		{"zero amount", `{"user_id":1,"amount":0,"currency":"USD","transaction_type":"перевод"}`, []string{"amount"}},
+		{"too many decimals", `{"user_id":1,"amount":10.001,"currency":"USD","transaction_type":"перевод"}`, []string{"amount"}},
+		{"amount over column precision", `{"user_id":1,"amount":100000000,"currency":"USD","transaction_type":"перевод"}`, []string{"amount"}},
+		{"unknown currency", `{"user_id":1,"amount":10,"currency":"XYZ","transaction_type":"перевод"}`, []string{"currency"}},
+		{"lowercase currency", `{"user_id":1,"amount":10,"currency":"usd","transaction_type":"перевод"}`, []string{"currency"}},
+		{"unknown transaction type", `{"user_id":1,"amount":10,"currency":"USD","transaction_type":"кража"}`, []string{"transaction_type"}},
+		{"non-positive user", `{"user_id":-1,"amount":10,"currency":"USD","transaction_type":"перевод"}`, []string{"user_id"}},
+		{"non-positive account", `{"user_id":1,"account_id":0,"amount":10,"currency":"USD","transaction_type":"перевод"}`, []string{"account_id"}},
+		{"wrong JSON type", `{"user_id":"one","amount":10,"currency":"USD","transaction_type":"перевод"}`, []string{"user_id"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			w, problem := postTransaction(t, test.body, nil)
+
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal(t, http.StatusUnprocessableEntity, problem.Status)
+			assert.Equal(t, CodeValidation, problem.Code)
+			assert.Equal(t, "/transactions", problem.Instance)
+			fields := problemFields(problem)
+			assert.Len(t, fields, len(test.fields), w.Body.String())
+			for _, field := range test.fields {
+				assert.Contains(t, fields, field)
+			}
+		})
+	}
+}
+
+func TestCreateTransactionMalformedJSON(t *testing.T) {
+	w, problem := postTransaction(t, `{"user_id":`, nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "/problems/malformed-request", problem.Type)
+	assert.Equal(t, CodeMalformedRequest, problem.Code)
+}
+
+func TestCreateTransactionReferences(t *testing.T) {
+	valid := `{"user_id":1,"account_id":7,"amount":10.5,"currency":"USD","transaction_type":"покупка"}`
+
+	t.Run("unknown user", func(t *testing.T) {
+		w, problem := postTransaction(t, valid, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectUserExists(mock, 1, false)
+			mock.ExpectQuery(`SELECT user_id FROM accounts WHERE account_id = \$1`).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			mock.ExpectRollback()
+		})
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, map[string]string{"user_id": "user does not exist"}, problemFields(problem))
+	})
+
+	t.Run("unknown account", func(t *testing.T) {
+		w, problem := postTransaction(t, valid, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectUserExists(mock, 1, true)
+			mock.ExpectQuery(`SELECT user_id FROM accounts WHERE account_id = \$1`).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			mock.ExpectRollback()
+		})
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, map[string]string{"account_id": "account does not exist"}, problemFields(problem))
+	})
+
+	t.Run("account of another user", func(t *testing.T) {
+		w, problem := postTransaction(t, valid, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectUserExists(mock, 1, true)
+			mock.ExpectQuery(`SELECT user_id FROM accounts WHERE account_id = \$1`).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+			mock.ExpectRollback()
+		})
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, map[string]string{"account_id": "account does not belong to the user"}, problemFields(problem))
+	})
+
+	t.Run("owned account", func(t *testing.T) {
+		w, _ := postTransaction(t, valid, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectUserExists(mock, 1, true)
+			mock.ExpectQuery(`SELECT user_id FROM accounts WHERE account_id = \$1`).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			mock.ExpectQuery(`^INSERT INTO transactions`).
+				WithArgs(1, 10.5, "USD", "покупка", "", "", 7, models.StatusCompleted, nil).
+				WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(3))
+			expectEvent(mock)
+			mock.ExpectCommit()
+		})
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"account_id":7`)
+	})
+}
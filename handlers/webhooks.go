@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookService returns the service bound to the request's database.
+func webhookService(c *gin.Context) *service.WebhookService {
+	return service.NewWebhookService(c.MustGet("db").(*sql.DB))
+}
+
+// webhookID parses the :id parameter. On failure it has already passed the
+// error to ErrorHandler and returns false.
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "Webhook ID must be an integer", Err: err})
+		return 0, false
+	}
+	return id, true
+}
+
+// deliveryID parses the :id and :delivery_id parameters. On failure it has
+// already passed the error to ErrorHandler and returns false.
+func deliveryID(c *gin.Context) (int, int64, bool) {
+	webhook, ok := webhookID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "Delivery ID must be an integer", Err: err})
+		return 0, 0, false
+	}
+	return webhook, id, true
+}
+
+func bindWebhook(c *gin.Context) (models.WebhookInput, bool) {
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, bindError(err))
+		return input, false
+	}
+	return input, true
+}
+
+func ListWebhooks(c *gin.Context) {
+	webhooks, err := webhookService(c).List(c.Request.Context())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook subscribes a URL to events. The response carries the signing
+// secret, which is not shown again.
+func CreateWebhook(c *gin.Context) {
+	input, ok := bindWebhook(c)
+	if !ok {
+		return
+	}
+	webhook, err := webhookService(c).Create(c.Request.Context(), input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":     "webhookHandler",
+		"webhook_id": webhook.ID,
+		"events":     webhook.Events,
+	}).Info("Webhook created")
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	webhook, err := webhookService(c).Get(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	input, ok := bindWebhook(c)
+	if !ok {
+		return
+	}
+	webhook, err := webhookService(c).Update(c.Request.Context(), id, input)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	if err := webhookService(c).Delete(c.Request.Context(), id); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":     "webhookHandler",
+		"webhook_id": id,
+	}).Info("Webhook deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveries serves the delivery log of a webhook, newest first,
+// filtered by ?status= and capped by ?limit= (default 100).
+func ListWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	filter := repo.DeliveryFilter{WebhookID: id, Status: c.Query("status"), Limit: 100}
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "status must be pending, delivered or dead"})
+		return
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			abortWithError(c, &APIError{Code: CodeInvalidParameter, Detail: "limit must be an integer between 1 and 1000", Err: err})
+			return
+		}
+		filter.Limit = limit
+	}
+	deliveries, err := webhookService(c).Deliveries(c.Request.Context(), filter)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// GetWebhookDelivery returns a delivery with the log of its attempts.
+func GetWebhookDelivery(c *gin.Context) {
+	webhook, id, ok := deliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, err := webhookService(c).Delivery(c.Request.Context(), webhook, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// RedeliverWebhookDelivery queues a delivery to be sent again, typically one
+// that is dead after the receiver was fixed.
+func RedeliverWebhookDelivery(c *gin.Context) {
+	webhook, id, ok := deliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, err := webhookService(c).Redeliver(c.Request.Context(), webhook, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	logger(c).WithFields(logrus.Fields{
+		"module":      "webhookHandler",
+		"webhook_id":  webhook,
+		"delivery_id": id,
+	}).Info("Webhook delivery queued again")
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"DZ_ITOG/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	asRole(router, db, models.RoleAdmin)
+	router.POST("/admin/webhooks", CreateWebhook)
+	router.GET("/admin/webhooks/:id/deliveries", ListWebhookDeliveries)
+	router.POST("/admin/webhooks/:id/deliveries/:delivery_id/redeliver", RedeliverWebhookDelivery)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("create returns the secret once", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO webhooks`).
+			WillReturnRows(sqlmock.NewRows([]string{"webhook_id", "created_at"}).AddRow(3, time.Now()))
+		w := serve(http.MethodPost, "/admin/webhooks", `{"url":"https://partner.example.com/hooks","events":["transaction.created"]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created models.NewWebhook
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, 3, created.ID)
+		assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+	})
+
+	t.Run("create with an unknown event", func(t *testing.T) {
+		w := serve(http.MethodPost, "/admin/webhooks", `{"url":"https://partner.example.com/hooks","events":["transaction.exploded"]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"events[0]"`)
+	})
+
+	t.Run("deliveries with an unknown status", func(t *testing.T) {
+		w := serve(http.MethodGet, "/admin/webhooks/3/deliveries?status=lost", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("redeliver a missing delivery", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'pending'`).WithArgs(int64(9), 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		w := serve(http.MethodPost, "/admin/webhooks/3/deliveries/9/redeliver", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	configs "DZ_ITOG/config"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Logger returns the process-wide logger. Every package logs through it so a
+// single Configure call controls level, format and sink everywhere.
+func Logger() *logrus.Logger {
+	return logrus.StandardLogger()
+}
+
+var (
+	sinkMu sync.Mutex
+	sink   io.Closer
+)
+
+// Configure applies level, format and output to the shared logger. It is
+// safe to call again on config reload; a previous log file is closed after
+// the switch.
+func Configure(config configs.LoggerConfig) error {
+	level, err := logrus.ParseLevel(config.Level)
+	if err != nil {
+		return err
+	}
+
+	var formatter logrus.Formatter = &logrus.JSONFormatter{}
+	if config.Format == "text" {
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	}
+
+	var out io.Writer
+	var closer io.Closer
+	switch config.Output {
+	case "stderr":
+		out = os.Stderr
+	case "file":
+		file := &lumberjack.Logger{
+			Filename:   config.LogFile,
+			MaxSize:    config.MaxSizeMB,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     config.MaxAgeDays,
+			Compress:   config.Compress,
+		}
+		out, closer = file, file
+	default:
+		out = os.Stdout
+	}
+
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+
+	logger := Logger()
+	logger.SetFormatter(&redactingFormatter{inner: formatter})
+	logger.SetOutput(out)
+	logger.SetLevel(level)
+
+	if sink != nil {
+		sink.Close()
+	}
+	sink = closer
+	return nil
+}
+
+type requestIDKey struct{}
+
+// validRequestID limits accepted client IDs so they are safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// ValidRequestID reports whether a caller-supplied request ID can be reused.
+func ValidRequestID(id string) bool {
+	return validRequestID.MatchString(id)
+}
+
+// NewRequestID returns a random 32-character hex request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a context whose log entries carry the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns a log entry bound to ctx, tagged with its request ID
+// when there is one.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry := Logger().WithContext(ctx)
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
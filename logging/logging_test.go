@@ -0,0 +1,74 @@
+package logging
+
+import (
+	configs "DZ_ITOG/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureJSON(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	require.NoError(t, Configure(configs.Default().Logger))
+	var buf bytes.Buffer
+	Logger().SetOutput(&buf)
+	t.Cleanup(func() { Configure(configs.Default().Logger) })
+	return &buf
+}
+
+func TestFromContextAddsRequestID(t *testing.T) {
+	buf := captureJSON(t)
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	FromContext(ctx).Info("hello")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "req-123", line["request_id"])
+	assert.Equal(t, "hello", line["msg"])
+}
+
+func TestRedaction(t *testing.T) {
+	buf := captureJSON(t)
+
+	FromContext(context.Background()).WithFields(logrus.Fields{
+		"password": "hunter2",
+		"api_key":  "k-1",
+		"user":     "alice",
+		"error":    errors.New(`Get "https://rates.example/latest?apikey=k-2&base=USD": timeout`),
+	}).Infof("calling https://rates.example/latest?apikey=%s&base=USD", "k-3")
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "k-1", "k-2", "k-3"} {
+		assert.NotContains(t, out, secret)
+	}
+	assert.Contains(t, out, "alice")
+	assert.Contains(t, out, "apikey=******")
+}
+
+func TestConfigureFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	config := configs.Default().Logger
+	config.Output = "file"
+	config.LogFile = path
+	config.Format = "text"
+	config.Level = "warn"
+	require.NoError(t, Configure(config))
+	defer Configure(configs.Default().Logger)
+
+	Logger().Info("dropped")
+	Logger().Warn("kept")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "dropped")
+	assert.Contains(t, string(data), "kept")
+}
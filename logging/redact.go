@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "******"
+
+// sensitiveKeys are field names, compared case-insensitively after removing
+// "_" and "-", whose values never reach the log sink.
+var sensitiveKeys = []string{"password", "secret", "token", "apikey", "authorization"}
+
+// sensitiveParams matches key=value pairs in free text, such as query strings
+// of provider URLs quoted in error messages.
+var sensitiveParams = regexp.MustCompile(`(?i)((?:api[_-]?key|password|secret|token)=)[^&\s"']+`)
+
+func isSensitive(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, s := range sensitiveKeys {
+		if strings.Contains(normalized, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks secrets in free text.
+func Redact(s string) string {
+	return sensitiveParams.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redactingFormatter masks sensitive fields and key=value secrets in the
+// message before handing the entry to the real formatter.
+type redactingFormatter struct {
+	inner logrus.Formatter
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	clean := *entry
+	clean.Message = Redact(entry.Message)
+	clean.Data = make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch {
+		case isSensitive(key):
+			clean.Data[key] = redacted
+		case key == logrus.ErrorKey:
+			if err, ok := value.(error); ok {
+				clean.Data[key] = Redact(err.Error())
+			} else {
+				clean.Data[key] = Redact(fmt.Sprint(value))
+			}
+		default:
+			if s, ok := value.(string); ok {
+				clean.Data[key] = Redact(s)
+			} else {
+				clean.Data[key] = value
+			}
+		}
+	}
+	return f.inner.Format(&clean)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -19,18 +20,472 @@ type ListResponse struct {
 	Ok   bool   `json:"ok"`
 }
 
+const (
+	TransactionTypeTransfer = "перевод"
+	TransactionTypePurchase = "покупка"
+	TransactionTypeTopUp    = "пополнение"
+)
+
+// TransactionTypes lists every accepted transaction_type value.
+var TransactionTypes = []string{TransactionTypeTransfer, TransactionTypePurchase, TransactionTypeTopUp}
+
+// MaxTransactionAmount is the largest amount the DECIMAL(10, 2) column holds.
+const MaxTransactionAmount = 99999999.99
+
+// Transaction statuses. A transaction is created pending or completed;
+// StatusTransitions lists the moves allowed afterwards.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusReversed  = "reversed"
+)
+
+// StatusTransitions maps each status to the statuses it can move to. Failed
+// and reversed transactions are final.
+var StatusTransitions = map[string][]string{
+	StatusPending:   {StatusCompleted, StatusFailed},
+	StatusCompleted: {StatusReversed},
+}
+
+// CanTransition reports whether a transaction can move from one status to
+// another.
+func CanTransition(from, to string) bool {
+	for _, s := range StatusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transaction binding tags are checked on create and update; see the custom
+// amount and transaction_type rules in the validation package. Status is only
+// read on create and defaults to completed; updates never change it.
+// Splits, when given, divide the amount between categories and must add up
+// to it; Category stays the category of the whole transaction. Tags are
+// lowercase labels such as "vacation-2026"; see the tag rule.
+// RefundOf and Refunded are never read: RefundOf links a refund to the
+// purchase it returns, and Refunded is how much of a purchase was returned.
 type Transaction struct {
 	ID                int       `json:"id"`
-	UserID            int       `json:"user_id"`
-	Amount            float64   `json:"amount"`
-	Currency          string    `json:"currency"`
-	TransactionType   string    `json:"transaction_type"`
-	Category          string    `json:"category"`
+	UserID            int       `json:"user_id" binding:"required,gt=0"`
+	AccountID         *int      `json:"account_id,omitempty" binding:"omitempty,gt=0"`
+	Amount            float64   `json:"amount" binding:"amount"`
+	Currency          string    `json:"currency" binding:"required,iso4217"`
+	TransactionType   string    `json:"transaction_type" binding:"required,transaction_type"`
+	Category          string    `json:"category" binding:"max=50"`
 	Date              time.Time `json:"date"`
-	Description       string    `json:"description"`
+	Description       string    `json:"description" binding:"max=1000"`
+	Status            string    `json:"status,omitempty" binding:"omitempty,oneof=pending completed"`
+	Splits            []Split   `json:"splits,omitempty" binding:"omitempty,max=20,dive"`
+	Tags              []string  `json:"tags,omitempty" binding:"omitempty,max=20,dive,tag"`
+	RefundOf          *int      `json:"refund_of,omitempty"`
+	Refunded          float64   `json:"refunded,omitempty"`
 	ConvertedAmount   float64   `json:"converted_amount,omitempty"`
 	ConvertedCurrency string    `json:"converted_currency,omitempty"`
 }
+
+// User is the public part of a users row; the password is never read.
+type User struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// TransactionFilter narrows a transaction listing. Unset fields match every
+// transaction; From is inclusive and To exclusive. A transaction matches
+// Tags when it carries every one of them.
+type TransactionFilter struct {
+	UserID          *int
+	AccountID       *int
+	Currency        string
+	TransactionType string
+	Category        string
+	Status          string
+	Tags            []string
+	From            *time.Time
+	To              *time.Time
+	Limit           int
+	Offset          int
+}
+
+// SearchResult is a transaction found by a search, with how well it matched:
+// the higher Rank, the better. Ranks compare within one search only.
+type SearchResult struct {
+	Transaction
+	Rank float64 `json:"rank"`
+}
+
+// StatusTransition records one change of a transaction's status, who made
+// it and when. Actor is nil for changes made outside a request.
+type StatusTransition struct {
+	ID            int64     `json:"id"`
+	TransactionID int       `json:"transaction_id"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Reason        string    `json:"reason,omitempty"`
+	Actor         *int      `json:"actor,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+// StatusChange is the body of a status transition request.
+type StatusChange struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// Note is a remark left on a transaction. Author is nil for notes left
+// without an API key.
+type Note struct {
+	ID            int64     `json:"id"`
+	TransactionID int       `json:"transaction_id"`
+	Author        *int      `json:"author,omitempty"`
+	Body          string    `json:"body" binding:"required,max=2000"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Attachment describes a file attached to a transaction, such as a receipt.
+// The content lives in blob storage under StorageKey, which is never
+// exposed. ContentType is sniffed from the content, not taken from the
+// upload.
+type Attachment struct {
+	ID            int64     `json:"id"`
+	TransactionID int       `json:"transaction_id"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	UploadedBy    *int      `json:"uploaded_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	StorageKey    string    `json:"-"`
+}
+
+// Split is the part of a transaction's amount spent in one category.
+type Split struct {
+	Category string  `json:"category" binding:"required,max=50"`
+	Amount   float64 `json:"amount" binding:"amount"`
+	Note     string  `json:"note,omitempty" binding:"max=255"`
+}
+
+// RefundRequest is the body of a refund. A zero Amount refunds whatever is
+// left of the purchase. A chargeback is a refund forced by the card issuer;
+// it only differs in how it is described.
+type RefundRequest struct {
+	Amount     float64 `json:"amount" binding:"omitempty,amount"`
+	Reason     string  `json:"reason" binding:"max=1000"`
+	Chargeback bool    `json:"chargeback"`
+}
+
+// TransactionSummary totals the transactions of one currency and type.
+type TransactionSummary struct {
+	Currency        string  `json:"currency"`
+	TransactionType string  `json:"transaction_type"`
+	Count           int     `json:"count"`
+	Amount          float64 `json:"amount"`
+	Commission      float64 `json:"commission"`
+}
+
+// CategorySummary totals the transactions of one currency per category,
+// counting each split in its own category.
+type CategorySummary struct {
+	Currency string  `json:"currency"`
+	Category string  `json:"category"`
+	Count    int     `json:"count"`
+	Amount   float64 `json:"amount"`
+}
+
+// API key scopes. ScopeAdmin implies every other scope.
+const (
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeReportsRead       = "reports:read"
+	ScopeAdmin             = "admin"
+)
+
+// Scopes lists every scope an API key can be granted.
+var Scopes = []string{ScopeTransactionsRead, ScopeTransactionsWrite, ScopeReportsRead, ScopeAdmin}
+
+// APIKey is a long-lived credential of a machine client, acting on behalf of
+// its owner UserID. Only a hash of the key is stored; Prefix is the readable
+// start of the key, so owners can tell their keys apart.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can authenticate at now.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyInput creates or updates an API key. UserID is only honoured on
+// create, and only for admin callers; it defaults to the caller.
+type APIKeyInput struct {
+	UserID    int        `json:"user_id" binding:"omitempty,gt=0"`
+	Name      string     `json:"name" binding:"required,max=255"`
+	Scopes    []string   `json:"scopes" binding:"min=1,dive,scope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// NewAPIKey is an API key together with its secret, which is shown once on
+// create and rotate and cannot be retrieved later.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Roles. A user without any role is treated as a customer.
+const (
+	RoleAdmin    = "admin"
+	RoleSupport  = "support"
+	RoleCustomer = "customer"
+)
+
+// Roles lists every role a user can be given.
+var Roles = []string{RoleAdmin, RoleSupport, RoleCustomer}
+
+// Permissions checked by the policy package. Own transactions are those
+// whose user_id is the caller's user.
+const (
+	PermissionReadOwnTransactions  = "transactions.read.own"
+	PermissionReadAnyTransaction   = "transactions.read.any"
+	PermissionWriteOwnTransactions = "transactions.write.own"
+	PermissionWriteAnyTransaction  = "transactions.write.any"
+	// PermissionChangeAmounts allows creating and deleting transactions and
+	// changing their amount, currency or type.
+	PermissionChangeAmounts     = "transactions.amounts"
+	PermissionManageCommissions = "commissions.manage"
+	PermissionManageRates       = "rates.manage"
+	PermissionManageUsers       = "users.manage"
+	PermissionReadAudit         = "audit.read"
+	PermissionManageWebhooks    = "webhooks.manage"
+	// PermissionReviewTransactions allows working the risk review queue.
+	PermissionReviewTransactions = "transactions.review"
+	// PermissionChangeStatus allows completing, failing and reversing
+	// transactions.
+	PermissionChangeStatus = "transactions.status"
+	// PermissionRefund allows refunding purchases.
+	PermissionRefund = "transactions.refund"
+)
+
+// DefaultRolePermissions is what migrations grant each role. The role_permissions
+// table is the source of truth afterwards.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionReadAnyTransaction, PermissionWriteAnyTransaction, PermissionChangeAmounts,
+		PermissionManageCommissions, PermissionManageRates, PermissionManageUsers, PermissionReadAudit,
+		PermissionManageWebhooks, PermissionReviewTransactions, PermissionChangeStatus, PermissionRefund,
+	},
+	RoleSupport: {
+		PermissionReadAnyTransaction, PermissionWriteAnyTransaction, PermissionReviewTransactions,
+		PermissionChangeStatus, PermissionRefund,
+	},
+	RoleCustomer: {
+		PermissionReadOwnTransactions, PermissionWriteOwnTransactions, PermissionChangeAmounts,
+	},
+}
+
+// UserRoles lists the roles of a user. An empty list makes the user a
+// customer.
+type UserRoles struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles" binding:"dive,role"`
+}
+
+// Audit outcomes.
+const (
+	AuditAllowed = "allowed"
+	AuditDenied  = "denied"
+)
+
+// AuditEvent records a security-relevant decision: every denied access and
+// every change of roles.
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	UserID     *int      `json:"user_id,omitempty"`
+	APIKeyID   *int      `json:"api_key_id,omitempty"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+}
+
+// Event types published to webhooks.
+const (
+	EventTransactionCreated = "transaction.created"
+	EventTransactionUpdated = "transaction.updated"
+	EventTransactionDeleted = "transaction.deleted"
+	EventCommissionCharged  = "commission.charged"
+	EventCommissionRemoved  = "commission.removed"
+	// EventTransactionStatusChanged carries the StatusTransition.
+	EventTransactionStatusChanged = "transaction.status_changed"
+	// EventCommissionReversed carries the compensating commission written
+	// when a transaction is reversed.
+	EventCommissionReversed = "commission.reversed"
+	// EventCommissionRefunded carries the commission record returning part
+	// of a purchase's commission with a refund.
+	EventCommissionRefunded = "commission.refunded"
+	// EventBudgetExceeded can be subscribed to but is not emitted yet.
+	EventBudgetExceeded = "budget.exceeded"
+)
+
+// EventTypes lists every event type a webhook can subscribe to.
+var EventTypes = []string{
+	EventTransactionCreated, EventTransactionUpdated, EventTransactionDeleted,
+	EventCommissionCharged, EventCommissionRemoved, EventBudgetExceeded,
+	EventTransactionStatusChanged, EventCommissionReversed, EventCommissionRefunded,
+}
+
+// Event is a change to a transaction or commission, as sent to webhooks.
+// Data holds the transaction or commission after the change; for a deleted
+// transaction its id and user_id, for a removed commission its
+// transaction_id, and for a status change the StatusTransition.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// AggregateTransaction is the aggregate type of every event about a
+// transaction or its commission, so that they are ordered together.
+const AggregateTransaction = "transaction"
+
+// OutboxMessage is an event written to the outbox with the change it is
+// about. Sequence orders the messages of one aggregate.
+type OutboxMessage struct {
+	Event
+	Sequence      int64  `json:"sequence"`
+	AggregateType string `json:"aggregate_type"`
+	AggregateID   string `json:"aggregate_id"`
+}
+
+// Webhook is a subscription: events of the listed types are posted to URL,
+// signed with a secret that is only shown when it is set.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookInput creates or replaces a subscription. Without a Secret, one is
+// generated on create and kept on update; Active defaults to true.
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=255"`
+	Events []string `json:"events" binding:"min=1,dive,event_type"`
+	Active *bool    `json:"active"`
+}
+
+// NewWebhook is a subscription together with its signing secret.
+type NewWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Webhook delivery statuses. A pending delivery is retried until it is
+// delivered or has failed webhooks.maxAttempts times and is dead.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event queued for one subscription.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	// Log lists the attempts, oldest first, when a single delivery is shown.
+	Log []WebhookAttempt `json:"log,omitempty"`
+}
+
+// WebhookAttempt is the outcome of one try to deliver an event. StatusCode
+// is nil when no response arrived.
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+}
+
+// Risk review statuses. Flagged transactions were stored and are only listed;
+// pending ones wait for a reviewer to approve or decline them.
+const (
+	ReviewFlagged  = "flagged"
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewDeclined = "declined"
+)
+
+// ReviewStatuses lists every review status.
+var ReviewStatuses = []string{ReviewFlagged, ReviewPending, ReviewApproved, ReviewDeclined}
+
+// RiskFinding is a risk rule that fired on a transaction and the action it
+// asked for.
+type RiskFinding struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// RiskReview is a transaction a risk rule flagged or held. Transaction is the
+// transaction as submitted; TransactionID is set once it is stored, which a
+// held transaction only is when approved.
+type RiskReview struct {
+	ID            int64         `json:"id"`
+	Status        string        `json:"status"`
+	UserID        int           `json:"user_id"`
+	TransactionID *int          `json:"transaction_id,omitempty"`
+	Transaction   Transaction   `json:"transaction"`
+	Findings      []RiskFinding `json:"findings"`
+	CreatedAt     time.Time     `json:"created_at"`
+	DecidedAt     *time.Time    `json:"decided_at,omitempty"`
+	DecidedBy     *int          `json:"decided_by,omitempty"`
+	Note          string        `json:"note,omitempty"`
+}
+
+// ReviewDecision is the body of an approval or a decline.
+type ReviewDecision struct {
+	Note string `json:"note" binding:"max=1000"`
+}
+
+type Account struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
 type Commission struct {
 	TransactionID   int     `json:"transaction_id"`
 	Amount          float64 `json:"amount"`
@@ -53,3 +508,22 @@ type TransactionResponse struct {
 	Transaction Transaction `json:"transaction"`
 	Commission  *Commission `json:"commission,omitempty"`
 }
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details body, served as
+// application/problem+json. Code is the stable error code from the catalogue
+// in docs/errors.md; clients should branch on it rather than on Title.
+type Problem struct {
+	Type     string       `json:"type"`
+	Code     string       `json:"code"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
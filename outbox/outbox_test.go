@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sequences(messages []models.OutboxMessage) []int64 {
+	var seqs []int64
+	for _, msg := range messages {
+		seqs = append(seqs, msg.Sequence)
+	}
+	return seqs
+}
+
+func TestPublishPendingKeepsAggregateOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	broker := NewBroker()
+	relay := NewRelay(configs.OutboxConfig{BatchSize: 10}, db, broker)
+	now := time.Now()
+	pending := func(seqs ...int64) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"outbox_id", "event_id", "aggregate_type", "aggregate_id", "event_type", "data", "occurred_at"})
+		for _, seq := range seqs {
+			// Odd sequences are about transaction 1, even ones about transaction 2.
+			rows.AddRow(seq, fmt.Sprintf("evt_%d", seq), models.AggregateTransaction, fmt.Sprint(2-seq%2), models.EventTransactionUpdated, `{}`, now)
+		}
+		return rows
+	}
+
+	t.Run("another relay holds the lock", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		mock.ExpectCommit()
+
+		n, err := relay.PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("a failure holds back its aggregate only", func(t *testing.T) {
+		broker.FailWith(func(msg models.OutboxMessage) error {
+			if msg.Sequence == 1 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		})
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(`FROM outbox WHERE published_at IS NULL`).WithArgs(10).WillReturnRows(pending(1, 2, 3, 4))
+		mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error`).WithArgs("broker unavailable", int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE outbox SET published_at = now\(\)`).WithArgs("{2,4}").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		n, err := relay.PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []int64{2, 4}, sequences(broker.Messages()), "3 must not overtake 1")
+	})
+
+	t.Run("the held back events follow once it recovers", func(t *testing.T) {
+		broker.FailWith(nil)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(`FROM outbox WHERE published_at IS NULL`).WithArgs(10).WillReturnRows(pending(1, 3))
+		mock.ExpectExec(`UPDATE outbox SET published_at = now\(\)`).WithArgs("{1,3}").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		_, err := relay.PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2, 4, 1, 3}, sequences(broker.Messages()))
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewSink(configs.OutboxConfig{Sink: "file", File: path})
+	require.NoError(t, err)
+
+	msg := models.OutboxMessage{
+		Event:         models.Event{ID: "evt_1", Type: models.EventTransactionDeleted, Data: json.RawMessage(`{"id":4}`)},
+		Sequence:      9,
+		AggregateType: models.AggregateTransaction,
+		AggregateID:   "4",
+	}
+	require.NoError(t, sink.Publish(context.Background(), msg))
+	require.NoError(t, sink.Publish(context.Background(), msg))
+	require.NoError(t, sink.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	var got models.OutboxMessage
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.Equal(t, int64(9), got.Sequence)
+	assert.Equal(t, "4", got.AggregateID)
+	assert.JSONEq(t, `{"id":4}`, string(got.Data))
+
+	_, err = NewSink(configs.OutboxConfig{Sink: "carrier-pigeon"})
+	assert.ErrorContains(t, err, `unknown outbox sink "carrier-pigeon"`)
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pruneInterval is how often published events past their retention are
+// deleted.
+const pruneInterval = time.Hour
+
+// Relay publishes the outbox to a sink.
+type Relay struct {
+	config configs.OutboxConfig
+	db     *sql.DB
+	sink   Sink
+}
+
+func NewRelay(config configs.OutboxConfig, db *sql.DB, sink Sink) *Relay {
+	return &Relay{config: config, db: db, sink: sink}
+}
+
+// Run publishes the outbox every poll interval until ctx is cancelled, then
+// closes the sink.
+func (r *Relay) Run(ctx context.Context) {
+	log := logrus.WithField("module", "outbox")
+	log.Infof("Outbox relay started, publishing to %s every %s", r.config.Sink, r.config.PollInterval)
+	defer func() {
+		if err := r.sink.Close(); err != nil {
+			log.WithError(err).Error("Closing outbox sink failed")
+		}
+		log.Info("Outbox relay stopped")
+	}()
+
+	poll := time.NewTicker(r.config.PollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prune.C:
+			if n, err := repo.PruneOutbox(ctx, r.db, r.config.Retention); err == nil && n > 0 {
+				log.WithField("deleted", n).Info("Outbox pruned")
+			}
+		case <-poll.C:
+			// A full batch means more may be waiting.
+			for {
+				n, err := r.PublishPending(ctx)
+				if err != nil {
+					log.WithError(err).Error("Publishing outbox failed")
+				}
+				if err != nil || n < r.config.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// PublishPending publishes the oldest batch of unpublished events and
+// returns how many were published. Only one relay publishes at a time; the
+// others find the outbox locked and return 0.
+//
+// When an event fails, later events of the same aggregate in the batch are
+// held back so that they never overtake it; other aggregates carry on. The
+// failed event and those held back are retried on the next call. Events are
+// marked published only when the batch commits, so a crash in between
+// publishes them again.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	log := logging.FromContext(ctx).WithField("module", "outbox")
+	var count int
+	err := repo.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		locked, err := repo.LockOutbox(ctx, tx)
+		if err != nil || !locked {
+			return err
+		}
+		pending, err := repo.PendingOutbox(ctx, tx, r.config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		blocked := map[string]bool{}
+		var published []int64
+		for _, msg := range pending {
+			aggregate := msg.AggregateType + ":" + msg.AggregateID
+			if blocked[aggregate] {
+				continue
+			}
+			if err := r.sink.Publish(ctx, msg); err != nil {
+				blocked[aggregate] = true
+				log.WithError(err).WithFields(logrus.Fields{
+					"sequence":  msg.Sequence,
+					"event_id":  msg.ID,
+					"aggregate": aggregate,
+				}).Warn("Publishing outbox event failed, holding back its aggregate")
+				if err := repo.RecordOutboxFailure(ctx, tx, msg.Sequence, err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			published = append(published, msg.Sequence)
+		}
+		count = len(published)
+		return repo.MarkOutboxPublished(ctx, tx, published)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
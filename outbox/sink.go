@@ -0,0 +1,154 @@
+// Package outbox publishes the events written to the outbox table to an
+// external sink. Events are written in the same database transaction as the
+// change they describe, so none is lost or invented; the relay then delivers
+// each at least once, in order per aggregate.
+package outbox
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Sink receives published events. Publish returns once msg is durably
+// handed over; on error the relay retries it later, so a sink may see the
+// same message more than once and consumers should drop duplicates by the
+// event id.
+type Sink interface {
+	Publish(ctx context.Context, msg models.OutboxMessage) error
+	Close() error
+}
+
+// SinkFactory builds a sink from the outbox settings.
+type SinkFactory func(config configs.OutboxConfig) (Sink, error)
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]SinkFactory{
+		"stdout": func(configs.OutboxConfig) (Sink, error) { return NewWriterSink(os.Stdout), nil },
+		"file": func(config configs.OutboxConfig) (Sink, error) {
+			return NewFileSink(config.File)
+		},
+		"memory": func(configs.OutboxConfig) (Sink, error) { return NewBroker(), nil },
+	}
+)
+
+// RegisterSink makes a sink available as outbox.sink: name, typically from
+// the init function of a package wrapping a NATS or Kafka client.
+func RegisterSink(name string, factory SinkFactory) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[name] = factory
+}
+
+// NewSink builds the sink named by config.Sink.
+func NewSink(config configs.OutboxConfig) (Sink, error) {
+	sinksMu.RLock()
+	factory, ok := sinks[config.Sink]
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sinksMu.RUnlock()
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown outbox sink %q, registered: %v", config.Sink, names)
+	}
+	return factory(config)
+}
+
+// WriterSink writes every message as a line of JSON.
+type WriterSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// NewWriterSink writes to w, which it does not close.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink appends to the file at path, creating it if needed, and syncs
+// it after every message.
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{w: f, file: f}, nil
+}
+
+func (s *WriterSink) Publish(ctx context.Context, msg models.OutboxMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
+
+// Broker is an in-memory sink for tests and local runs: it keeps every
+// message it is given.
+type Broker struct {
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+	// fail, when set, is returned for the messages it is called with.
+	fail func(models.OutboxMessage) error
+}
+
+func NewBroker() *Broker {
+	return &Broker{}
+}
+
+// FailWith makes Publish return the error fail gives for a message, or
+// accept it when that is nil, to test redelivery. A nil fail accepts every
+// message again.
+func (b *Broker) FailWith(fail func(models.OutboxMessage) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fail = fail
+}
+
+func (b *Broker) Publish(ctx context.Context, msg models.OutboxMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail != nil {
+		if err := b.fail(msg); err != nil {
+			return err
+		}
+	}
+	b.messages = append(b.messages, msg)
+	return nil
+}
+
+// Messages returns the messages published so far, in order.
+func (b *Broker) Messages() []models.OutboxMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]models.OutboxMessage(nil), b.messages...)
+}
+
+func (b *Broker) Close() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package policy decides what an authenticated caller may do with
+// transactions and admin operations, from the permissions its user's roles
+// grant. The REST and GraphQL APIs ask it rather than checking roles
+// themselves. The gRPC API does not: it is a trusted channel for internal
+// services holding the shared grpc.authToken, which act as an admin.
+//
+// A nil *Principal is an anonymous request on a server that does not require
+// API keys; it passes every check, as it did before roles existed.
+package policy
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrDenied is returned when the caller lacks a permission.
+var ErrDenied = errors.New("permission denied")
+
+// Principal is the caller of a request: the user behind its API key and the
+// roles and permissions that user holds.
+type Principal struct {
+	UserID      int
+	APIKeyID    int
+	Roles       []string
+	Permissions []string
+}
+
+// Load builds the principal of key. A user without roles gets the customer
+// permissions.
+func Load(ctx context.Context, db repo.DBTX, key models.APIKey) (*Principal, error) {
+	roles, permissions, err := repo.UserRoles(ctx, key.UserID, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		roles = []string{models.RoleCustomer}
+		if permissions, err = repo.RolePermissions(ctx, models.RoleCustomer, db); err != nil {
+			return nil, err
+		}
+	}
+	return &Principal{UserID: key.UserID, APIKeyID: key.ID, Roles: roles, Permissions: permissions}, nil
+}
+
+// Can reports whether p holds permission.
+func (p *Principal) Can(permission string) bool {
+	if p == nil {
+		return true
+	}
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether p holds role. Anonymous callers hold none.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, held := range p.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Require fails with ErrDenied unless p holds permission.
+func (p *Principal) Require(permission string) error {
+	if !p.Can(permission) {
+		return fmt.Errorf("%w: requires %s", ErrDenied, permission)
+	}
+	return nil
+}
+
+// ReadTransaction checks that p may see t.
+func (p *Principal) ReadTransaction(t models.Transaction) error {
+	if p.Can(models.PermissionReadAnyTransaction) || (p.Can(models.PermissionReadOwnTransactions) && t.UserID == p.UserID) {
+		return nil
+	}
+	return fmt.Errorf("%w: transaction %d belongs to another user", ErrDenied, t.ID)
+}
+
+// ScopeTransactions restricts filter to the transactions p may see: callers
+// who may only read their own get filter.UserID set to their user, and asking
+// for another user's is denied.
+func (p *Principal) ScopeTransactions(filter *models.TransactionFilter) error {
+	if p.Can(models.PermissionReadAnyTransaction) {
+		return nil
+	}
+	if !p.Can(models.PermissionReadOwnTransactions) {
+		return fmt.Errorf("%w: requires %s", ErrDenied, models.PermissionReadOwnTransactions)
+	}
+	if filter.UserID != nil && *filter.UserID != p.UserID {
+		return fmt.Errorf("%w: transactions of another user", ErrDenied)
+	}
+	filter.UserID = &p.UserID
+	return nil
+}
+
+// WriteTransaction checks that p may turn old into next. old is nil for a
+// create and next nil for a delete. Both need PermissionChangeAmounts, as
+// does changing the amount, currency or type of an existing transaction.
+func (p *Principal) WriteTransaction(old, next *models.Transaction) error {
+	for _, t := range []*models.Transaction{old, next} {
+		if t == nil || p.Can(models.PermissionWriteAnyTransaction) {
+			continue
+		}
+		if !p.Can(models.PermissionWriteOwnTransactions) || t.UserID != p.UserID {
+			return fmt.Errorf("%w: transactions of another user", ErrDenied)
+		}
+	}
+	if amountsChange(old, next) {
+		return p.Require(models.PermissionChangeAmounts)
+	}
+	return nil
+}
+
+func amountsChange(old, next *models.Transaction) bool {
+	if old == nil || next == nil {
+		return true
+	}
+	return old.Amount != next.Amount || old.Currency != next.Currency || old.TransactionType != next.TransactionType
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying p, for code that only sees the
+// request context, such as GraphQL resolvers.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored by WithPrincipal, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
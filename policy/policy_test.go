@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"DZ_ITOG/models"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func principalWith(role string) *Principal {
+	return &Principal{UserID: 7, Roles: []string{role}, Permissions: models.DefaultRolePermissions[role]}
+}
+
+func TestWriteTransaction(t *testing.T) {
+	own := models.Transaction{ID: 1, UserID: 7, Amount: 100, Currency: "USD", TransactionType: "перевод", Description: "old"}
+	other := own
+	other.UserID = 8
+	relabelled := other
+	relabelled.Description = "new"
+	repriced := other
+	repriced.Amount = 150
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		old, next *models.Transaction
+		allowed   bool
+	}{
+		{"customer creates own", principalWith(models.RoleCustomer), nil, &own, true},
+		{"customer creates for another user", principalWith(models.RoleCustomer), nil, &other, false},
+		{"customer moves a transaction to another user", principalWith(models.RoleCustomer), &own, &other, false},
+		{"customer deletes another user's", principalWith(models.RoleCustomer), &other, nil, false},
+		{"support edits the description", principalWith(models.RoleSupport), &other, &relabelled, true},
+		{"support changes the amount", principalWith(models.RoleSupport), &other, &repriced, false},
+		{"support deletes", principalWith(models.RoleSupport), &other, nil, false},
+		{"admin changes the amount", principalWith(models.RoleAdmin), &other, &repriced, true},
+		{"anonymous", nil, &other, &repriced, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.principal.WriteTransaction(test.old, test.next)
+			if test.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, ErrDenied), "got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadAndScopeTransactions(t *testing.T) {
+	customer, support := principalWith(models.RoleCustomer), principalWith(models.RoleSupport)
+
+	assert.NoError(t, customer.ReadTransaction(models.Transaction{UserID: 7}))
+	assert.ErrorIs(t, customer.ReadTransaction(models.Transaction{UserID: 8}), ErrDenied)
+	assert.NoError(t, support.ReadTransaction(models.Transaction{UserID: 8}))
+
+	var filter models.TransactionFilter
+	require.NoError(t, customer.ScopeTransactions(&filter))
+	require.NotNil(t, filter.UserID)
+	assert.Equal(t, 7, *filter.UserID)
+
+	other := 8
+	assert.ErrorIs(t, customer.ScopeTransactions(&models.TransactionFilter{UserID: &other}), ErrDenied)
+
+	filter = models.TransactionFilter{}
+	require.NoError(t, support.ScopeTransactions(&filter))
+	assert.Nil(t, filter.UserID)
+
+	assert.ErrorIs(t, (&Principal{UserID: 7}).ScopeTransactions(&models.TransactionFilter{}), ErrDenied)
+}
+
+func TestLoad(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM user_roles`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"roles", "permissions"}).AddRow("{support}", "{transactions.read.any,transactions.write.any}"))
+	p, err := Load(context.Background(), db, models.APIKey{ID: 3, UserID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.RoleSupport}, p.Roles)
+	assert.True(t, p.Can(models.PermissionReadAnyTransaction))
+	assert.False(t, p.Can(models.PermissionChangeAmounts))
+	assert.Equal(t, 3, p.APIKeyID)
+
+	mock.ExpectQuery(`FROM user_roles`).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"roles", "permissions"}).AddRow("{}", "{}"))
+	mock.ExpectQuery(`FROM role_permissions`).WithArgs(models.RoleCustomer).
+		WillReturnRows(sqlmock.NewRows([]string{"permissions"}).AddRow("{transactions.read.own}"))
+	p, err = Load(context.Background(), db, models.APIKey{ID: 4, UserID: 9})
+	require.NoError(t, err)
+	assert.True(t, p.HasRole(models.RoleCustomer))
+	assert.True(t, p.Can(models.PermissionReadOwnTransactions))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,143 @@
+// Package ratelimit implements token-bucket limits over a pluggable bucket
+// store. Buckets are named by class and caller, e.g. "ip:10.0.0.1" or
+// "conversion:user:12", and every class has its own Limit.
+package ratelimit
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Class selects the limit a bucket is refilled at.
+type Class string
+
+const (
+	ClassIP         Class = "ip"
+	ClassUser       Class = "user"
+	ClassAPIKey     Class = "key"
+	ClassConversion Class = "conversion"
+)
+
+// Limit refills Requests tokens every Per, holding at most Burst.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func limitFrom(c configs.LimitConfig) Limit {
+	return Limit{Requests: c.Requests, Per: c.Per, Burst: c.Burst}
+}
+
+// perSecond is the refill rate.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Decision is the outcome of one Take, with what a client needs to pace
+// itself.
+type Decision struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// RetryAfter is how long until the next token, zero when one is left.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+func decide(limit Limit, tokens float64, allowed bool) Decision {
+	rate := limit.perSecond()
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((float64(limit.Burst) - tokens) / rate),
+	}
+	if tokens < 1 {
+		d.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return d
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps the buckets. Take must refill and take atomically, so that
+// concurrent requests never spend the same token twice.
+type Store interface {
+	// Take refills bucket for the time since it was last used, then takes one
+	// token if a whole one is left. It returns the tokens left and whether
+	// one was taken. A bucket seen for the first time starts full.
+	Take(ctx context.Context, bucket string, limit Limit) (tokens float64, allowed bool, err error)
+	// Peek returns the tokens bucket holds after refilling, without taking
+	// one or storing anything.
+	Peek(ctx context.Context, bucket string, limit Limit) (tokens float64, err error)
+}
+
+// Limiter applies the configured limit of each class.
+type Limiter struct {
+	store  Store
+	limits map[Class]Limit
+}
+
+// New builds a limiter from config. The postgres store needs db.
+func New(config configs.RateLimitConfig, db *sql.DB) (*Limiter, error) {
+	var store Store
+	switch config.Store {
+	case "memory", "":
+		store = NewMemoryStore()
+	case "postgres":
+		if db == nil {
+			return nil, fmt.Errorf("the postgres rate limit store needs a database")
+		}
+		store = NewPostgresStore(db)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.Store)
+	}
+	return NewLimiter(store, map[Class]Limit{
+		ClassIP:         limitFrom(config.PerIP),
+		ClassUser:       limitFrom(config.PerUser),
+		ClassAPIKey:     limitFrom(config.PerAPIKey),
+		ClassConversion: limitFrom(config.Conversion),
+	}), nil
+}
+
+// NewLimiter builds a limiter over store with a limit per class.
+func NewLimiter(store Store, limits map[Class]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Take spends a token of the caller's bucket in class. When the store fails
+// the request is allowed: an unavailable store must not take the API down.
+func (l *Limiter) Take(ctx context.Context, class Class, caller string) Decision {
+	limit := l.limits[class]
+	tokens, allowed, err := l.store.Take(ctx, string(class)+":"+caller, limit)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("module", "ratelimit").Warn("Rate limit store failed, allowing the request")
+		return Decision{Allowed: true, Limit: limit, Remaining: limit.Burst}
+	}
+	return decide(limit, tokens, allowed)
+}
+
+// Peek tells whether the caller's bucket in class has a token left, without
+// spending it. When the store fails the request is allowed, as with Take.
+func (l *Limiter) Peek(ctx context.Context, class Class, caller string) Decision {
+	limit := l.limits[class]
+	tokens, err := l.store.Peek(ctx, string(class)+":"+caller, limit)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("module", "ratelimit").Warn("Rate limit store failed, allowing the request")
+		return Decision{Allowed: true, Limit: limit, Remaining: limit.Burst}
+	}
+	return decide(limit, tokens, tokens >= 1)
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestMemoryStoreRefills(t *testing.T) {
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = c.now
+	limiter := NewLimiter(store, map[Class]Limit{ClassIP: {Requests: 60, Per: time.Minute, Burst: 3}})
+	ctx := context.Background()
+
+	for want := 2; want >= 0; want-- {
+		d := limiter.Take(ctx, ClassIP, "10.0.0.1")
+		require.True(t, d.Allowed)
+		assert.Equal(t, want, d.Remaining)
+	}
+	d := limiter.Take(ctx, ClassIP, "10.0.0.1")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, 3*time.Second, d.Reset)
+
+	assert.True(t, limiter.Take(ctx, ClassIP, "10.0.0.2").Allowed, "buckets are per caller")
+
+	c.t = c.t.Add(1500 * time.Millisecond)
+	d = limiter.Take(ctx, ClassIP, "10.0.0.1")
+	require.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	c.t = c.t.Add(time.Hour)
+	d = limiter.Take(ctx, ClassIP, "10.0.0.1")
+	assert.Equal(t, 2, d.Remaining, "refill is capped at the burst")
+}
+
+func TestPeek(t *testing.T) {
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = c.now
+	limiter := NewLimiter(store, map[Class]Limit{ClassIP: {Requests: 60, Per: time.Minute, Burst: 1}})
+	ctx := context.Background()
+
+	assert.True(t, limiter.Peek(ctx, ClassIP, "10.0.0.1").Allowed, "an unused bucket is full")
+	require.True(t, limiter.Take(ctx, ClassIP, "10.0.0.1").Allowed)
+	d := limiter.Peek(ctx, ClassIP, "10.0.0.1")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.False(t, limiter.Peek(ctx, ClassIP, "10.0.0.1").Allowed, "peeking spends nothing and refills nothing")
+
+	c.t = c.t.Add(time.Second)
+	assert.True(t, limiter.Peek(ctx, ClassIP, "10.0.0.1").Allowed)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	limiter = NewLimiter(NewPostgresStore(db), map[Class]Limit{ClassIP: {Requests: 120, Per: time.Minute, Burst: 10}})
+	mock.ExpectQuery(`SELECT LEAST\(\$2::float8, tokens .+ FROM rate_limit_buckets WHERE bucket = \$1`).
+		WithArgs("ip:10.0.0.1", 10, 2.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.5))
+	mock.ExpectQuery(`FROM rate_limit_buckets WHERE bucket = \$1`).
+		WithArgs("ip:10.0.0.2", 10, 2.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}))
+
+	assert.False(t, limiter.Peek(ctx, ClassIP, "10.0.0.1").Allowed)
+	d = limiter.Peek(ctx, ClassIP, "10.0.0.2")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 10, d.Remaining, "a missing row is a full bucket")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = c.now
+	limit := Limit{Requests: 1, Per: time.Second, Burst: 5}
+
+	_, _, err := store.Take(context.Background(), "ip:a", limit)
+	require.NoError(t, err)
+	c.t = c.t.Add(2 * sweepInterval)
+	_, _, err = store.Take(context.Background(), "ip:b", limit)
+	require.NoError(t, err)
+
+	assert.NotContains(t, store.buckets, "ip:a")
+	assert.Contains(t, store.buckets, "ip:b")
+}
+
+func TestPostgresStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	limiter := NewLimiter(NewPostgresStore(db), map[Class]Limit{ClassAPIKey: {Requests: 120, Per: time.Minute, Burst: 10}})
+	mock.ExpectQuery(`INSERT INTO rate_limit_buckets`).
+		WithArgs("key:7", 10, 2.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(0.25, false))
+
+	d := limiter.Take(context.Background(), ClassAPIKey, "7")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 375*time.Millisecond, d.RetryAfter)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLimiterFailsOpen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	limiter := NewLimiter(NewPostgresStore(db), map[Class]Limit{ClassIP: {Requests: 60, Per: time.Minute, Burst: 5}})
+	mock.ExpectQuery(`INSERT INTO rate_limit_buckets`).WillReturnError(errors.New("connection refused"))
+
+	d := limiter.Take(context.Background(), ClassIP, "10.0.0.1")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 5, d.Remaining)
+}
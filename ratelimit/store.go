@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often stores drop buckets that have refilled.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled; after that it is no
+	// different from a missing one and can be dropped.
+	full time.Time
+}
+
+// MemoryStore keeps buckets in process memory. Each instance counts on its
+// own, so with N instances a client effectively gets N times the limit.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(_ context.Context, name string, limit Limit) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for key, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	rate := limit.perSecond()
+	b, ok := s.buckets[name]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[name] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(seconds((float64(limit.Burst) - b.tokens) / rate))
+	return b.tokens, allowed, nil
+}
+
+func (s *MemoryStore) Peek(_ context.Context, name string, limit Limit) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return float64(limit.Burst), nil
+	}
+	return math.Min(float64(limit.Burst), b.tokens+s.now().Sub(b.updated).Seconds()*limit.perSecond()), nil
+}
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every
+// instance sharing the database shares the limits. It costs one round trip
+// per request.
+type PostgresStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+	// longestRefill is the longest time any bucket seen needs to refill.
+	longestRefill time.Duration
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, lastSweep: time.Now()}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, name string, limit Limit) (float64, bool, error) {
+	s.prune(ctx, limit)
+	return repo.TakeRateLimitToken(ctx, s.db, name, limit.Burst, limit.perSecond())
+}
+
+func (s *PostgresStore) Peek(ctx context.Context, name string, limit Limit) (float64, error) {
+	return repo.PeekRateLimitTokens(ctx, s.db, name, limit.Burst, limit.perSecond())
+}
+
+// prune deletes refilled buckets at most once per sweepInterval. Failures are
+// only logged; stale rows cost space, not correctness.
+func (s *PostgresStore) prune(ctx context.Context, limit Limit) {
+	s.mu.Lock()
+	if refill := seconds(float64(limit.Burst) / limit.perSecond()); refill > s.longestRefill {
+		s.longestRefill = refill
+	}
+	due := time.Since(s.lastSweep) > sweepInterval
+	if due {
+		s.lastSweep = time.Now()
+	}
+	idle := s.longestRefill
+	s.mu.Unlock()
+
+	if !due {
+		return
+	}
+	if _, err := repo.PruneRateLimitBuckets(ctx, s.db, idle); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("module", "ratelimit").Warn("Pruning rate limit buckets failed")
+	}
+}
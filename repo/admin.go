@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"strings"
+)
+
+// CreateUser inserts a user with an already hashed password and returns its
+// id. A taken email is reported as ErrConflict.
+func CreateUser(ctx context.Context, user models.User, passwordHash string, db DBTX) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, `INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING user_id`,
+		user.Name, user.Email, passwordHash).Scan(&id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting user")
+		return 0, mapError(err)
+	}
+	return id, nil
+}
+
+// SetUserPassword replaces the password hash of the user with email, or
+// returns ErrNotFound.
+func SetUserPassword(ctx context.Context, email, passwordHash string, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE email = $2`, passwordHash, email)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating user password")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// CreateAccount inserts an account and returns its id.
+func CreateAccount(ctx context.Context, account models.Account, db DBTX) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, `INSERT INTO accounts (user_id, name, currency) VALUES ($1, $2, $3) RETURNING account_id`,
+		account.UserID, account.Name, account.Currency).Scan(&id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting account")
+		return 0, mapError(err)
+	}
+	return id, nil
+}
+
+// DeleteCommissions removes every commission charged on a transaction.
+func DeleteCommissions(ctx context.Context, transactionID int, db DBTX) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM commissions WHERE transaction_id = $1`, transactionID); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error deleting commissions")
+		return mapError(err)
+	}
+	return nil
+}
+
+// SummarizeTransactions counts and totals the transactions matching filter
+// per currency and type, together with the commission charged on them net of
+// reversals. Limit and Offset are ignored.
+func SummarizeTransactions(ctx context.Context, filter models.TransactionFilter, db DBTX) ([]models.TransactionSummary, error) {
+	log := logging.FromContext(ctx)
+
+	conditions, args := filterConditions(filter)
+	query := `SELECT currency, transaction_type, COUNT(*), COALESCE(SUM(amount), 0), COALESCE(SUM(c.commission), 0)
+		FROM transactions
+		LEFT JOIN (SELECT transaction_id, SUM(commission) AS commission FROM commissions GROUP BY transaction_id) c
+		USING (transaction_id)`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " GROUP BY currency, transaction_type ORDER BY currency, transaction_type"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Error summarizing transactions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	summaries := []models.TransactionSummary{}
+	for rows.Next() {
+		var summary models.TransactionSummary
+		if err := rows.Scan(&summary.Currency, &summary.TransactionType, &summary.Count, &summary.Amount, &summary.Commission); err != nil {
+			log.WithError(err).Error("Error scanning transaction summary")
+			return nil, mapError(err)
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("Error during rows iteration")
+		return nil, mapError(err)
+	}
+	return summaries, nil
+}
+
+// CreateDatedTransaction inserts a transaction keeping its Date, which
+// CreateTransaction leaves to the database. It is meant for generated and
+// historical data; API writes always get the current time.
+func CreateDatedTransaction(ctx context.Context, transaction models.Transaction, db DBTX) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, `INSERT INTO transactions (user_id, amount, currency, transaction_type, category, date, description, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING transaction_id`,
+		transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Date, transaction.Description, transaction.AccountID).Scan(&id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting transaction")
+		return 0, mapError(err)
+	}
+	return id, nil
+}
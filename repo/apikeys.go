@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `api_key_id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	return key, err
+}
+
+// CreateAPIKey stores key under the hash of its secret and returns it with
+// its id and creation time filled in.
+func CreateAPIKey(ctx context.Context, key models.APIKey, hash string, db DBTX) (models.APIKey, error) {
+	err := db.QueryRowContext(ctx, `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING api_key_id, created_at`,
+		key.UserID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting API key")
+		return models.APIKey{}, mapError(err)
+	}
+	return key, nil
+}
+
+// GetAPIKey returns the key with id, or ErrNotFound.
+func GetAPIKey(ctx context.Context, id int, db DBTX) (models.APIKey, error) {
+	key, err := scanAPIKey(db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE api_key_id = $1`, id))
+	if err != nil {
+		return models.APIKey{}, mapError(err)
+	}
+	return key, nil
+}
+
+// GetAPIKeyByHash returns the key whose secret hashes to hash, or
+// ErrNotFound. Revoked and expired keys are returned too.
+func GetAPIKeyByHash(ctx context.Context, hash string, db DBTX) (models.APIKey, error) {
+	key, err := scanAPIKey(db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash))
+	if err != nil {
+		return models.APIKey{}, mapError(err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of userID, or every key when userID is nil,
+// newest first.
+func ListAPIKeys(ctx context.Context, userID *int, db DBTX) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys`
+	var args []interface{}
+	if userID != nil {
+		query += ` WHERE user_id = $1`
+		args = append(args, *userID)
+	}
+	rows, err := db.QueryContext(ctx, query+` ORDER BY api_key_id DESC`, args...)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing API keys")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, mapError(rows.Err())
+}
+
+// UpdateAPIKey replaces the name, scopes and expiry of the key, or returns
+// ErrNotFound.
+func UpdateAPIKey(ctx context.Context, key models.APIKey, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE api_keys SET name = $1, scopes = $2, expires_at = $3 WHERE api_key_id = $4`,
+		key.Name, pq.Array(key.Scopes), key.ExpiresAt, key.ID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating API key")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// RevokeAPIKey revokes the key at once. Revoking a revoked or missing key
+// returns ErrNotFound.
+func RevokeAPIKey(ctx context.Context, id int, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = now() WHERE api_key_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error revoking API key")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// ExpireAPIKey brings the expiry of the key forward to at, leaving an earlier
+// expiry alone.
+func ExpireAPIKey(ctx context.Context, id int, at time.Time, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $1), $1) WHERE api_key_id = $2`, at, id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error expiring API key")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// TouchAPIKey records that the key was used. It writes at most once a
+// minute per key, so busy clients do not turn every request into a write.
+func TouchAPIKey(ctx context.Context, id int, db DBTX) error {
+	_, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = now()
+		WHERE api_key_id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')`, id)
+	return mapError(err)
+}
@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const attachmentColumns = `attachment_id, transaction_id, file_name, content_type, size, uploaded_by, created_at, storage_key`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (models.Attachment, error) {
+	var attachment models.Attachment
+	var uploadedBy sql.NullInt64
+	err := row.Scan(&attachment.ID, &attachment.TransactionID, &attachment.FileName, &attachment.ContentType,
+		&attachment.Size, &uploadedBy, &attachment.CreatedAt, &attachment.StorageKey)
+	if uploadedBy.Valid {
+		id := int(uploadedBy.Int64)
+		attachment.UploadedBy = &id
+	}
+	return attachment, err
+}
+
+// CreateAttachment stores the metadata of an attachment whose content is
+// already in blob storage, and returns it with its id and time filled in.
+func CreateAttachment(ctx context.Context, attachment models.Attachment, db DBTX) (models.Attachment, error) {
+	err := db.QueryRowContext(ctx, `INSERT INTO attachments (transaction_id, file_name, content_type, size, storage_key, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING attachment_id, created_at`,
+		attachment.TransactionID, attachment.FileName, attachment.ContentType, attachment.Size, attachment.StorageKey, attachment.UploadedBy).
+		Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting attachment")
+		return models.Attachment{}, mapError(err)
+	}
+	return attachment, nil
+}
+
+// GetAttachment returns attachment id of a transaction, or ErrNotFound.
+func GetAttachment(ctx context.Context, transactionID, id int64, db DBTX) (models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE transaction_id = $1 AND attachment_id = $2`
+	attachment, err := scanAttachment(db.QueryRowContext(ctx, query, transactionID, id))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(ctx).WithError(err).Error("Error getting attachment")
+		}
+		return models.Attachment{}, mapError(err)
+	}
+	return attachment, nil
+}
+
+// ListAttachments returns the attachments of a transaction, oldest first.
+func ListAttachments(ctx context.Context, transactionID int64, db DBTX) ([]models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE transaction_id = $1 ORDER BY attachment_id`
+	rows, err := db.QueryContext(ctx, query, transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing attachments")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, mapError(rows.Err())
+}
+
+// DeleteAttachment removes the metadata of attachment id of a transaction and
+// returns its storage key, or ErrNotFound.
+func DeleteAttachment(ctx context.Context, transactionID, id int64, db DBTX) (string, error) {
+	var key string
+	err := db.QueryRowContext(ctx, `DELETE FROM attachments WHERE transaction_id = $1 AND attachment_id = $2 RETURNING storage_key`,
+		transactionID, id).Scan(&key)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(ctx).WithError(err).Error("Error deleting attachment")
+		}
+		return "", mapError(err)
+	}
+	return key, nil
+}
+
+// DeleteAttachments removes the metadata of every attachment of a transaction
+// and returns their storage keys. The transaction row is locked first, so no
+// attachment can be added before the transaction itself is deleted in the same
+// database transaction.
+func DeleteAttachments(ctx context.Context, transactionID int64, db DBTX) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `DELETE FROM attachments WHERE transaction_id = (SELECT transaction_id FROM transactions WHERE transaction_id = $1 FOR UPDATE) RETURNING storage_key`,
+		transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error deleting attachments")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, mapError(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, mapError(rows.Err())
+}
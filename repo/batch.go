@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+
+	"github.com/lib/pq"
+)
+
+// The lookups below fetch many rows in one query so callers such as the
+// GraphQL loaders can batch per-item lookups. Missing IDs are simply absent
+// from the result.
+
+func int64s(ids []int) pq.Int64Array {
+	out := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
+
+// UsersByIDs returns the users with the given IDs.
+func UsersByIDs(ctx context.Context, ids []int, db DBTX) ([]models.User, error) {
+	rows, err := db.QueryContext(ctx, `SELECT user_id, name, email FROM users WHERE user_id = ANY($1)`, int64s(ids))
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading users")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+			return nil, mapError(err)
+		}
+		users = append(users, user)
+	}
+	return users, mapError(rows.Err())
+}
+
+// AccountsByIDs returns the accounts with the given IDs.
+func AccountsByIDs(ctx context.Context, ids []int, db DBTX) ([]models.Account, error) {
+	return queryAccounts(ctx, db, `SELECT account_id, user_id, name, currency FROM accounts WHERE account_id = ANY($1)`, int64s(ids))
+}
+
+// AccountsByUserIDs returns every account owned by the given users.
+func AccountsByUserIDs(ctx context.Context, userIDs []int, db DBTX) ([]models.Account, error) {
+	return queryAccounts(ctx, db, `SELECT account_id, user_id, name, currency FROM accounts WHERE user_id = ANY($1) ORDER BY account_id`, int64s(userIDs))
+}
+
+func queryAccounts(ctx context.Context, db DBTX, query string, args ...interface{}) ([]models.Account, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading accounts")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var accounts []models.Account
+	for rows.Next() {
+		var account models.Account
+		if err := rows.Scan(&account.ID, &account.UserID, &account.Name, &account.Currency); err != nil {
+			return nil, mapError(err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, mapError(rows.Err())
+}
+
+// CommissionsByTransactionIDs returns the latest commission charged on each
+// of the given transactions.
+func CommissionsByTransactionIDs(ctx context.Context, transactionIDs []int, db DBTX) ([]models.Commission, error) {
+	query := `
+        SELECT DISTINCT ON (transaction_id) transaction_id, amount, currency, transaction_type, commission, date, description
+        FROM commissions WHERE transaction_id = ANY($1)
+        ORDER BY transaction_id, commission_id DESC`
+	rows, err := db.QueryContext(ctx, query, int64s(transactionIDs))
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading commissions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var commissions []models.Commission
+	for rows.Next() {
+		var c models.Commission
+		if err := rows.Scan(&c.TransactionID, &c.Amount, &c.Currency, &c.TransactionType, &c.Commission, &c.Date, &c.Description); err != nil {
+			return nil, mapError(err)
+		}
+		commissions = append(commissions, c)
+	}
+	return commissions, mapError(rows.Err())
+}
@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with existing data, such as
+	// a duplicate key, or with a concurrent transaction.
+	ErrConflict = errors.New("conflict")
+	// ErrConstraint is returned when a write breaks a foreign key, NOT NULL or
+	// CHECK constraint, or a value does not fit its column.
+	ErrConstraint = errors.New("constraint violation")
+)
+
+// dbError ties a driver error to one of the sentinels above. errors.Is matches
+// the sentinel, while the message and Unwrap keep the driver detail for logs.
+type dbError struct {
+	kind error
+	err  error
+}
+
+func (e *dbError) Error() string        { return e.kind.Error() + ": " + e.err.Error() }
+func (e *dbError) Is(target error) bool { return target == e.kind }
+func (e *dbError) Unwrap() error        { return e.err }
+
+// pqErrorKinds maps PostgreSQL SQLSTATE codes to repo errors. See
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+var pqErrorKinds = map[pq.ErrorCode]error{
+	"23505": ErrConflict,   // unique_violation
+	"40001": ErrConflict,   // serialization_failure
+	"40P01": ErrConflict,   // deadlock_detected
+	"23503": ErrConstraint, // foreign_key_violation
+	"23502": ErrConstraint, // not_null_violation
+	"23514": ErrConstraint, // check_violation
+	"22001": ErrConstraint, // string_data_right_truncation
+	"22003": ErrConstraint, // numeric_value_out_of_range
+}
+
+// mapError translates driver errors into repo errors. Errors without a mapping
+// are returned unchanged and surface as internal errors.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if kind, ok := pqErrorKinds[pqErr.Code]; ok {
+			return &dbError{kind: kind, err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestMapError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		description string
+		err         error
+		want        error
+	}{
+		{"no rows", sql.ErrNoRows, ErrNotFound},
+		{"unique violation", &pq.Error{Code: "23505"}, ErrConflict},
+		{"serialization failure", &pq.Error{Code: "40001"}, ErrConflict},
+		{"foreign key violation", &pq.Error{Code: "23503"}, ErrConstraint},
+		{"value too long", &pq.Error{Code: "22001"}, ErrConstraint},
+		{"unmapped driver error", &pq.Error{Code: "57P01"}, nil},
+		{"other error", other, other},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := mapError(test.err)
+			if test.want == nil {
+				if got != test.err {
+					t.Errorf("expected the error unchanged, got %v", got)
+				}
+				return
+			}
+			if !errors.Is(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(mapError(&pq.Error{Code: "23505", Constraint: "items_pkey"}), &pqErr) || pqErr.Constraint != "items_pkey" {
+		t.Error("mapped error should keep the driver error")
+	}
+}
@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+)
+
+// CreateNote stores note and returns it with its id and time filled in.
+func CreateNote(ctx context.Context, note models.Note, db DBTX) (models.Note, error) {
+	err := db.QueryRowContext(ctx, `INSERT INTO transaction_notes (transaction_id, author, body)
+		VALUES ($1, $2, $3) RETURNING note_id, created_at`,
+		note.TransactionID, note.Author, note.Body).Scan(&note.ID, &note.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting transaction note")
+		return models.Note{}, mapError(err)
+	}
+	return note, nil
+}
+
+// ListNotes returns the notes on a transaction, oldest first.
+func ListNotes(ctx context.Context, transactionID int64, db DBTX) ([]models.Note, error) {
+	rows, err := db.QueryContext(ctx, `SELECT note_id, transaction_id, author, body, created_at
+		FROM transaction_notes WHERE transaction_id = $1 ORDER BY note_id`, transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing transaction notes")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	notes := []models.Note{}
+	for rows.Next() {
+		var note models.Note
+		var author sql.NullInt64
+		if err := rows.Scan(&note.ID, &note.TransactionID, &author, &note.Body, &note.CreatedAt); err != nil {
+			return nil, mapError(err)
+		}
+		if author.Valid {
+			a := int(author.Int64)
+			note.Author = &a
+		}
+		notes = append(notes, note)
+	}
+	return notes, mapError(rows.Err())
+}
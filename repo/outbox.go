@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// outboxLock is the advisory lock key held by the relay publishing the
+// outbox, so that only one relay publishes at a time and messages leave in
+// order.
+const outboxLock = 0x6f7574626f78 // "outbox"
+
+// AppendOutbox writes msg to the outbox. Called with the transaction that
+// made the change, the message is published if and only if the change
+// commits.
+func AppendOutbox(ctx context.Context, msg models.OutboxMessage, db DBTX) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO outbox (event_id, aggregate_type, aggregate_id, event_type, data, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		msg.ID, msg.AggregateType, msg.AggregateID, msg.Type, []byte(msg.Data), msg.OccurredAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event_type", msg.Type).Error("Error appending to outbox")
+		return mapError(err)
+	}
+	return nil
+}
+
+// LockOutbox takes the relay lock for the rest of tx and reports whether it
+// was free.
+func LockOutbox(ctx context.Context, tx *sql.Tx) (bool, error) {
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLock).Scan(&locked); err != nil {
+		return false, mapError(err)
+	}
+	return locked, nil
+}
+
+// PendingOutbox returns up to limit unpublished messages in the order they
+// were written.
+func PendingOutbox(ctx context.Context, tx *sql.Tx, limit int) ([]models.OutboxMessage, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT outbox_id, event_id, aggregate_type, aggregate_id, event_type, data, occurred_at
+		FROM outbox WHERE published_at IS NULL ORDER BY outbox_id LIMIT $1`, limit)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading outbox")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var pending []models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var data []byte
+		if err := rows.Scan(&msg.Sequence, &msg.ID, &msg.AggregateType, &msg.AggregateID, &msg.Type, &data, &msg.OccurredAt); err != nil {
+			return nil, mapError(err)
+		}
+		msg.Data = data
+		pending = append(pending, msg)
+	}
+	return pending, mapError(rows.Err())
+}
+
+// MarkOutboxPublished records that the messages with the given sequence
+// numbers reached the sink.
+func MarkOutboxPublished(ctx context.Context, tx *sql.Tx, sequences []int64) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = now(), attempts = attempts + 1, last_error = ''
+		WHERE outbox_id = ANY($1)`, pq.Array(sequences))
+	return mapError(err)
+}
+
+// RecordOutboxFailure records a failed attempt to publish a message.
+func RecordOutboxFailure(ctx context.Context, tx *sql.Tx, sequence int64, failure string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE outbox_id = $2`, failure, sequence)
+	return mapError(err)
+}
+
+// PruneOutbox deletes the messages published more than retention ago and
+// returns how many there were.
+func PruneOutbox(ctx context.Context, db DBTX, retention time.Duration) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < now() - $1 * interval '1 millisecond'`, retention.Milliseconds())
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error pruning outbox")
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// takeTokenQuery refills a bucket for the time since its last use, capped at
+// the burst, then takes one token if a whole one is left. SET expressions see
+// the old row, so the refill is computed from the previous state. now() is the
+// database clock, which every instance shares.
+const takeTokenQuery = `
+	INSERT INTO rate_limit_buckets AS b (bucket, tokens, allowed, updated_at)
+	VALUES ($1, $2::float8 - 1, true, now())
+	ON CONFLICT (bucket) DO UPDATE SET
+		allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1,
+		tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8)
+			- CASE WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1 THEN 1 ELSE 0 END,
+		updated_at = now()
+	RETURNING tokens, allowed`
+
+// TakeRateLimitToken takes a token from bucket, which holds up to burst
+// tokens and refills perSecond tokens a second. It returns the tokens left
+// and whether one was taken.
+func TakeRateLimitToken(ctx context.Context, db *sql.DB, bucket string, burst int, perSecond float64) (float64, bool, error) {
+	var tokens float64
+	var allowed bool
+	if err := db.QueryRowContext(ctx, takeTokenQuery, bucket, burst, perSecond).Scan(&tokens, &allowed); err != nil {
+		return 0, false, mapError(err)
+	}
+	return tokens, allowed, nil
+}
+
+// PeekRateLimitTokens returns the tokens bucket holds now, without taking
+// one. A bucket never used is full.
+func PeekRateLimitTokens(ctx context.Context, db *sql.DB, bucket string, burst int, perSecond float64) (float64, error) {
+	var tokens float64
+	err := db.QueryRowContext(ctx, `SELECT LEAST($2::float8, tokens + EXTRACT(EPOCH FROM now() - updated_at) * $3::float8)
+		FROM rate_limit_buckets WHERE bucket = $1`, bucket, burst, perSecond).Scan(&tokens)
+	if errors.Is(err, sql.ErrNoRows) {
+		return float64(burst), nil
+	}
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return tokens, nil
+}
+
+// PruneRateLimitBuckets deletes buckets unused for longer than idle. A bucket
+// that has had time to refill completely is the same as a missing one.
+func PruneRateLimitBuckets(ctx context.Context, db *sql.DB, idle time.Duration) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)`, idle.Seconds())
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return result.RowsAffected()
+}
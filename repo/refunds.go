@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+)
+
+// AddRefunded adds amount to the refunded total of a purchase. A total above
+// the purchase amount breaks a check constraint and is reported as
+// ErrConstraint.
+func AddRefunded(ctx context.Context, transactionID int, amount float64, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE transactions SET refunded = refunded + $1 WHERE transaction_id = $2`, amount, transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating refunded amount")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// TransactionCommissions returns every commission record of a transaction:
+// the charge and any reversals or refunds of it, oldest first.
+func TransactionCommissions(ctx context.Context, transactionID int, db DBTX) ([]models.Commission, error) {
+	rows, err := db.QueryContext(ctx, `SELECT transaction_id, amount, currency, transaction_type, commission, date, description
+		FROM commissions WHERE transaction_id = $1 ORDER BY commission_id`, transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading commissions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var commissions []models.Commission
+	for rows.Next() {
+		var c models.Commission
+		if err := rows.Scan(&c.TransactionID, &c.Amount, &c.Currency, &c.TransactionType, &c.Commission, &c.Date, &c.Description); err != nil {
+			return nil, mapError(err)
+		}
+		commissions = append(commissions, c)
+	}
+	return commissions, mapError(rows.Err())
+}
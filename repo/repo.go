@@ -2,26 +2,42 @@ package repo
 
 import (
 	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
 	"DZ_ITOG/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	//"time"
 
 	//"log"
 	"github.com/sirupsen/logrus"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-var log = logrus.New()
+var log = logging.Logger()
 
-func init() {
-	log.Formatter = &logrus.JSONFormatter{}
-	log.Level = logrus.TraceLevel
+// InitDB opens the database and brings its schema up to date, as the server
+// does on startup.
+func InitDB(config *configs.Config) (*sql.DB, error) {
+	db, err := Open(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func InitDB(config *configs.Config) (*sql.DB, error) {
+// Open connects to the database with the configured pool limits and checks
+// that it answers. It does not touch the schema; see Migrate.
+func Open(config *configs.Config) (*sql.DB, error) {
 	log.WithFields(logrus.Fields{
 		"host":     config.Database.Host,
 		"port":     config.Database.Port,
@@ -39,18 +55,52 @@ func InitDB(config *configs.Config) (*sql.DB, error) {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(config.Database.MaxOpenConns)
+	db.SetMaxIdleConns(config.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(config.Database.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.Database.ConnMaxIdleTime)
+
 	log.Trace("Database connection opened successfully")
 
-	createDB := `DROP TABLE IF EXISTS items;
+	err = db.Ping()
+	if err != nil {
+		log.WithError(err).Error("Ping err")
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate creates missing tables and columns. Every statement is idempotent,
+// so it is safe to run against an up-to-date database.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	createDB := `
 	CREATE TABLE IF NOT EXISTS items (
-		item_id VARCHAR(255),
+		item_id VARCHAR(255) PRIMARY KEY,
 		value VARCHAR(255)
 	);
 	`
-	_, err = db.Exec(createDB)
+	_, err := db.ExecContext(ctx, createDB)
 	if err != nil {
-		fmt.Println("Exec err on creating items table:", err)
-		return nil, err
+		log.WithError(err).Errorf("Exec err on creating items table")
+		return err
+	}
+	// Tables created before item_id became the primary key may hold
+	// duplicates; the first stored copy of each item is kept.
+	addItemsPrimaryKey := `
+	DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'items'::regclass AND contype = 'p') THEN
+			DELETE FROM items WHERE item_id IS NULL;
+			DELETE FROM items a USING items b WHERE a.item_id = b.item_id AND a.ctid > b.ctid;
+			ALTER TABLE items ADD PRIMARY KEY (item_id);
+		END IF;
+	END $$;
+	`
+	_, err = db.ExecContext(ctx, addItemsPrimaryKey)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on adding the items primary key")
+		return err
 	}
 	createUsersTable := `
 	CREATE TABLE IF NOT EXISTS users (
@@ -60,10 +110,10 @@ func InitDB(config *configs.Config) (*sql.DB, error) {
 		password VARCHAR(255) NOT NULL
 	);
 	`
-	_, err = db.Exec(createUsersTable)
+	_, err = db.ExecContext(ctx, createUsersTable)
 	if err != nil {
-		fmt.Println("Exec err on creating users table:", err)
-		return nil, err
+		log.WithError(err).Errorf("Exec err on creating users table")
+		return err
 	}
 	createCommissionsTable := `--DROP TABLE IF EXISTS  transactions, commissions; 
 	CREATE TABLE IF NOT EXISTS commissions (
@@ -77,11 +127,11 @@ func InitDB(config *configs.Config) (*sql.DB, error) {
 		description TEXT
 	);
 	`
-	_, err = db.Exec(createCommissionsTable)
+	_, err = db.ExecContext(ctx, createCommissionsTable)
 
 	if err != nil {
-		fmt.Println("Exec err on creating commissions table:", err)
-		return nil, err
+		log.WithError(err).Errorf("Exec err on creating commissions table")
+		return err
 	}
 	createTransactionsTable := `
 	CREATE TABLE IF NOT EXISTS transactions (
@@ -98,116 +148,612 @@ func InitDB(config *configs.Config) (*sql.DB, error) {
 		FOREIGN KEY (commission_id) REFERENCES commissions(commission_id) 
 	);
 	`
-	_, err = db.Exec(createTransactionsTable)
+	_, err = db.ExecContext(ctx, createTransactionsTable)
 	if err != nil {
-		fmt.Println("Exec err on creating transactions table:", err)
-		return nil, err
+		log.WithError(err).Errorf("Exec err on creating transactions table")
+		return err
+	}
+	createAccountsTable := `
+	CREATE TABLE IF NOT EXISTS accounts (
+		account_id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(user_id),
+		name VARCHAR(255) NOT NULL,
+		currency VARCHAR(3) NOT NULL
+	);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS account_id INT REFERENCES accounts(account_id);
+	`
+	_, err = db.ExecContext(ctx, createAccountsTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating accounts table")
+		return err
+	}
+	createRateLimitTable := `
+	CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+		bucket VARCHAR(255) PRIMARY KEY,
+		tokens DOUBLE PRECISION NOT NULL,
+		allowed BOOLEAN NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);
+	`
+	_, err = db.ExecContext(ctx, createRateLimitTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating rate_limit_buckets table")
+		return err
+	}
+	createAPIKeysTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		api_key_id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(user_id),
+		name VARCHAR(255) NOT NULL,
+		prefix VARCHAR(16) NOT NULL,
+		key_hash CHAR(64) UNIQUE NOT NULL,
+		scopes TEXT[] NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ,
+		last_used_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
+	`
+	_, err = db.ExecContext(ctx, createAPIKeysTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating api_keys table")
+		return err
+	}
+	createRolesTables := `
+	CREATE TABLE IF NOT EXISTS roles (
+		role VARCHAR(50) PRIMARY KEY
+	);
+	CREATE TABLE IF NOT EXISTS permissions (
+		permission VARCHAR(100) PRIMARY KEY
+	);
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		role VARCHAR(50) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+		permission VARCHAR(100) NOT NULL REFERENCES permissions(permission) ON DELETE CASCADE,
+		PRIMARY KEY (role, permission)
+	);
+	CREATE TABLE IF NOT EXISTS user_roles (
+		user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		role VARCHAR(50) NOT NULL REFERENCES roles(role) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, role)
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		audit_id BIGSERIAL PRIMARY KEY,
+		occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		user_id INT,
+		api_key_id INT,
+		action VARCHAR(100) NOT NULL,
+		resource VARCHAR(255) NOT NULL,
+		outcome VARCHAR(20) NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		request_id VARCHAR(128),
+		client_ip VARCHAR(64)
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_occurred_at ON audit_log (occurred_at);
+	`
+	_, err = db.ExecContext(ctx, createRolesTables)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating role and audit tables")
+		return err
+	}
+	if err := seedRoles(ctx, db); err != nil {
+		log.WithError(err).Errorf("Exec err on seeding roles")
+		return err
+	}
+	createWebhookTables := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		webhook_id SERIAL PRIMARY KEY,
+		url VARCHAR(2048) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		events TEXT[] NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		delivery_id BIGSERIAL PRIMARY KEY,
+		webhook_id INT NOT NULL REFERENCES webhooks(webhook_id) ON DELETE CASCADE,
+		event_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(50) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMPTZ DEFAULT now(),
+		last_status_code INT,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		delivered_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, delivery_id);
+	CREATE TABLE IF NOT EXISTS webhook_attempts (
+		attempt_id BIGSERIAL PRIMARY KEY,
+		delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(delivery_id) ON DELETE CASCADE,
+		attempted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		status_code INT,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ms BIGINT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_id ON webhook_attempts (delivery_id);
+	`
+	_, err = db.ExecContext(ctx, createWebhookTables)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating webhook tables")
+		return err
 	}
 
-	err = db.Ping()
+	createOutboxTable := `
+	CREATE TABLE IF NOT EXISTS outbox (
+		outbox_id BIGSERIAL PRIMARY KEY,
+		event_id VARCHAR(64) NOT NULL UNIQUE,
+		aggregate_type VARCHAR(50) NOT NULL,
+		aggregate_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(50) NOT NULL,
+		data JSONB NOT NULL,
+		occurred_at TIMESTAMPTZ NOT NULL,
+		published_at TIMESTAMPTZ,
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (outbox_id) WHERE published_at IS NULL;
+	CREATE INDEX IF NOT EXISTS outbox_published_at ON outbox (published_at);
+	`
+	_, err = db.ExecContext(ctx, createOutboxTable)
 	if err != nil {
-		fmt.Println("Ping err")
-		return nil, err
+		log.WithError(err).Errorf("Exec err on creating outbox table")
+		return err
 	}
 
-	return db, nil
-}
+	createRiskReviewsTable := `
+	CREATE TABLE IF NOT EXISTS risk_reviews (
+		review_id BIGSERIAL PRIMARY KEY,
+		status VARCHAR(20) NOT NULL,
+		user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		transaction_id INT REFERENCES transactions(transaction_id) ON DELETE SET NULL,
+		transaction JSONB NOT NULL,
+		findings JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		decided_at TIMESTAMPTZ,
+		decided_by INT,
+		note TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS risk_reviews_status ON risk_reviews (status, review_id);
+	CREATE INDEX IF NOT EXISTS risk_reviews_pending_user ON risk_reviews (user_id, created_at) WHERE status = 'pending';
+	`
+	_, err = db.ExecContext(ctx, createRiskReviewsTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating risk reviews table")
+		return err
+	}
+
+	createTransitionsTable := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'completed';
+	CREATE TABLE IF NOT EXISTS transaction_transitions (
+		transition_id BIGSERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+		from_status VARCHAR(20) NOT NULL,
+		to_status VARCHAR(20) NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		actor INT,
+		occurred_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS transaction_transitions_transaction ON transaction_transitions (transaction_id, transition_id);
+	`
+	_, err = db.ExecContext(ctx, createTransitionsTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating transaction transitions table")
+		return err
+	}
+
+	addRefundColumns := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refund_of INT REFERENCES transactions(transaction_id);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded DECIMAL(10, 2) NOT NULL DEFAULT 0;
+	DO $$ BEGIN
+		ALTER TABLE transactions ADD CONSTRAINT transactions_refunded_check CHECK (refunded >= 0 AND refunded <= amount);
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$;
+	CREATE INDEX IF NOT EXISTS transactions_refund_of ON transactions (refund_of) WHERE refund_of IS NOT NULL;
+	`
+	_, err = db.ExecContext(ctx, addRefundColumns)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on adding refund columns")
+		return err
+	}
+
+	createSplitsTable := `
+	CREATE TABLE IF NOT EXISTS transaction_splits (
+		split_id BIGSERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+		category VARCHAR(50) NOT NULL,
+		amount DECIMAL(10, 2) NOT NULL,
+		note TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS transaction_splits_transaction ON transaction_splits (transaction_id, split_id);
+	CREATE INDEX IF NOT EXISTS transaction_splits_category ON transaction_splits (category);
+	`
+	_, err = db.ExecContext(ctx, createSplitsTable)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating transaction splits table")
+		return err
+	}
+
+	createAnnotationTables := `
+	CREATE TABLE IF NOT EXISTS tags (
+		tag_id SERIAL PRIMARY KEY,
+		name VARCHAR(50) NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS transaction_tags (
+		transaction_id INT NOT NULL REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+		tag_id INT NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE,
+		PRIMARY KEY (transaction_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS transaction_tags_tag ON transaction_tags (tag_id);
+	CREATE TABLE IF NOT EXISTS transaction_notes (
+		note_id BIGSERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+		author INT REFERENCES users(user_id) ON DELETE SET NULL,
+		body TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS transaction_notes_transaction ON transaction_notes (transaction_id, note_id);
+	CREATE TABLE IF NOT EXISTS attachments (
+		attachment_id BIGSERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+		file_name VARCHAR(255) NOT NULL,
+		content_type VARCHAR(100) NOT NULL,
+		size BIGINT NOT NULL,
+		storage_key VARCHAR(128) NOT NULL UNIQUE,
+		uploaded_by INT REFERENCES users(user_id) ON DELETE SET NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS attachments_transaction ON attachments (transaction_id, attachment_id);
+	`
+	_, err = db.ExecContext(ctx, createAnnotationTables)
+	if err != nil {
+		log.WithError(err).Errorf("Exec err on creating tag, note and attachment tables")
+		return err
+	}
 
-func Create(item models.Item, db *sql.DB) error {
-	_, err := db.Exec("INSERT INTO items (item_id, value) VALUES ($1, $2)", item.ID, item.Value)
+	// search_vector holds the words of the description in Russian and in
+	// English and the category as is; search_text the same text for trigram
+	// matching of misspelt words.
+	addSearchColumns := `
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', COALESCE(description, '')), 'A') ||
+		setweight(to_tsvector('english', COALESCE(description, '')), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(category, '')), 'B')
+	) STORED;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+		COALESCE(description, '') || ' ' || COALESCE(category, '')
+	) STORED;
+	CREATE INDEX IF NOT EXISTS transactions_search_vector ON transactions USING GIN (search_vector);
+	CREATE INDEX IF NOT EXISTS transactions_search_text ON transactions USING GIN (search_text gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS tags_name_trgm ON tags USING GIN (name gin_trgm_ops);
+	`
+	_, err = db.ExecContext(ctx, addSearchColumns)
 	if err != nil {
-		fmt.Println("Exec INSERT")
+		log.WithError(err).Errorf("Exec err on adding search columns")
 		return err
 	}
 
 	return nil
 }
 
-func Read(id string, db *sql.DB) *models.Item {
+func Create(ctx context.Context, item models.Item, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO items (item_id, value) VALUES ($1, $2)", item.ID, item.Value)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting item")
+		return mapError(err)
+	}
+
+	return nil
+}
+
+func Read(ctx context.Context, id string, db *sql.DB) (*models.Item, error) {
 	var result models.Item
-	db.QueryRow("SELECT item_id, value FROM items WHERE item_id = $1", id).Scan(&result)
+	err := db.QueryRowContext(ctx, "SELECT item_id, value FROM items WHERE item_id = $1", id).Scan(&result.ID, &result.Value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading item")
+		return nil, mapError(err)
+	}
 
-	return &result
+	return &result, nil
 }
-func CreateCommission(db *sql.DB, commission models.Commission) error {
-	query := `INSERT INTO commissions (transaction_id, amount, currency, transaction_type, commission, date, description) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := db.Exec(query, commission.TransactionID, commission.Amount, commission.Currency, commission.TransactionType, commission.Commission, commission.Date, commission.Description)
+
+func ListItems(ctx context.Context, db *sql.DB) ([]models.Item, error) {
+	items := []models.Item{}
+	rows, err := db.QueryContext(ctx, "SELECT item_id, value FROM items ORDER BY item_id")
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing items")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.Item
+		if err := rows.Scan(&item.ID, &item.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func UpdateItem(ctx context.Context, item models.Item, db *sql.DB) error {
+	result, err := db.ExecContext(ctx, "UPDATE items SET value = $1 WHERE item_id = $2", item.Value, item.ID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating item")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+func DeleteItem(ctx context.Context, id string, db *sql.DB) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM items WHERE item_id = $1", id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error deleting item")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// expectAffected turns an UPDATE or DELETE that matched nothing into ErrNotFound.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
 	if err != nil {
-		log.Println("Error inserting commission:", err)
 		return err
 	}
+	if affected == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
-func CreateTransaction(transaction models.Transaction, db *sql.DB) (int, error) {
+func CreateCommission(ctx context.Context, db DBTX, commission models.Commission) error {
+	query := `INSERT INTO commissions (transaction_id, amount, currency, transaction_type, commission, date, description) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := db.ExecContext(ctx, query, commission.TransactionID, commission.Amount, commission.Currency, commission.TransactionType, commission.Commission, commission.Date, commission.Description)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting commission")
+		return mapError(err)
+	}
+	return nil
+}
+func CreateTransaction(ctx context.Context, transaction models.Transaction, db DBTX) (int, error) {
+	log := logging.FromContext(ctx)
 	log.Info("Inserting transaction into database.")
 
 	var transactionID int
 	query := `
-        INSERT INTO transactions (user_id, amount, currency, transaction_type, category, description)
-        VALUES ($1, $2, $3, $4, $5, $6)
+        INSERT INTO transactions (user_id, amount, currency, transaction_type, category, description, account_id, status, refund_of)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
         RETURNING transaction_id;`
-	err := db.QueryRow(query, transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description).Scan(&transactionID)
+	err := db.QueryRowContext(ctx, query, transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, transaction.AccountID, transaction.Status, transaction.RefundOf).Scan(&transactionID)
 	if err != nil {
-		log.Printf("Error inserting transaction: %v", err)
-		return 0, err
+		log.WithError(err).Error("Error inserting transaction")
+		return 0, mapError(err)
 	}
-	log.Printf("Transaction inserted with ID: %d", transactionID)
+	log.WithField("transaction_id", transactionID).Info("Transaction inserted")
 	return transactionID, nil
 }
 
-func GetAllTransactions(db *sql.DB) ([]models.Transaction, error) {
-	var transactions []models.Transaction
-	query := `SELECT transaction_id, user_id, amount, currency, transaction_type, category, date, description FROM transactions`
-	rows, err := db.Query(query)
+// transactionColumns are the columns read into a models.Transaction, the
+// splits gathered into a JSON array and the tags into an array. Queries using
+// them select FROM transactions without an alias.
+const transactionColumns = `transaction_id, user_id, amount, currency, transaction_type, category, date, description, account_id, status, refund_of, refunded, ` +
+	`(SELECT json_agg(json_build_object('category', s.category, 'amount', s.amount, 'note', s.note) ORDER BY s.split_id) ` +
+	`FROM transaction_splits s WHERE s.transaction_id = transactions.transaction_id) AS splits, ` +
+	`ARRAY(SELECT g.name FROM transaction_tags tt JOIN tags g USING (tag_id) ` +
+	`WHERE tt.transaction_id = transactions.transaction_id ORDER BY g.name) AS tags`
+
+// scanTransaction reads a row of transactionColumns.
+func scanTransaction(row interface{ Scan(...interface{}) error }) (models.Transaction, error) {
+	var transaction models.Transaction
+	var refundOf sql.NullInt64
+	var splits []byte
+	err := row.Scan(&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Currency, &transaction.TransactionType,
+		&transaction.Category, &transaction.Date, &transaction.Description, &transaction.AccountID, &transaction.Status, &refundOf, &transaction.Refunded, &splits, pq.Array(&transaction.Tags))
 	if err != nil {
-		fmt.Println("Error reading transactions:", err)
-		return nil, err
+		return transaction, err
+	}
+	if refundOf.Valid {
+		id := int(refundOf.Int64)
+		transaction.RefundOf = &id
+	}
+	if splits != nil {
+		err = json.Unmarshal(splits, &transaction.Splits)
+	}
+	return transaction, err
+}
+
+func GetAllTransactions(ctx context.Context, db DBTX) ([]models.Transaction, error) {
+	log := logging.FromContext(ctx)
+	transactions := []models.Transaction{}
+	query := `SELECT ` + transactionColumns + ` FROM transactions`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		log.WithError(err).Error("Error reading transactions")
+		return nil, mapError(err)
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var transaction models.Transaction
-		if err := rows.Scan(&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Currency, &transaction.TransactionType, &transaction.Category, &transaction.Date, &transaction.Description); err != nil {
-			fmt.Println("Error scanning transaction:", err)
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			log.WithError(err).Error("Error scanning transaction")
 			continue
 		}
 		transactions = append(transactions, transaction)
 	}
 	if err = rows.Err(); err != nil {
-		fmt.Println("Error during rows iteration:", err)
-		return nil, err
+		log.WithError(err).Error("Error during rows iteration")
+		return nil, mapError(err)
 	}
 	return transactions, nil
 }
 
-func GetTransactionByID(id int64, db *sql.DB) (*models.Transaction, error) {
-	var transaction models.Transaction
-	query := `SELECT transaction_id, user_id, amount, currency, transaction_type, category, date, description FROM transactions WHERE transaction_id = $1`
-	err := db.QueryRow(query, id).Scan(&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Currency, &transaction.TransactionType, &transaction.Category, &transaction.Date, &transaction.Description)
+// ListTransactions returns the transactions matching filter, newest first.
+// A zero Limit returns every match.
+func ListTransactions(ctx context.Context, filter models.TransactionFilter, db DBTX) ([]models.Transaction, error) {
+	log := logging.FromContext(ctx)
+
+	conditions, args := filterConditions(filter)
+	query := `SELECT ` + transactionColumns + ` FROM transactions`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY date DESC, transaction_id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		fmt.Println("Error getting transaction:", err)
-		return nil, err
+		log.WithError(err).Error("Error listing transactions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			log.WithError(err).Error("Error scanning transaction")
+			return nil, mapError(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	if err = rows.Err(); err != nil {
+		log.WithError(err).Error("Error during rows iteration")
+		return nil, mapError(err)
+	}
+	return transactions, nil
+}
+
+// filterConditions turns the matching part of filter into WHERE conditions on
+// the transactions columns, numbering the placeholders from $1.
+func filterConditions(filter models.TransactionFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != nil {
+		where("user_id = $%d", *filter.UserID)
+	}
+	if filter.AccountID != nil {
+		where("account_id = $%d", *filter.AccountID)
+	}
+	if filter.Currency != "" {
+		where("currency = $%d", filter.Currency)
+	}
+	if filter.TransactionType != "" {
+		where("transaction_type = $%d", filter.TransactionType)
+	}
+	if filter.Category != "" {
+		where("(category = $%[1]d OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.transaction_id AND s.category = $%[1]d))", filter.Category)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	for _, tag := range filter.Tags {
+		where("EXISTS (SELECT 1 FROM transaction_tags tt JOIN tags g USING (tag_id) WHERE tt.transaction_id = transactions.transaction_id AND g.name = $%d)", tag)
+	}
+	if filter.From != nil {
+		where("date >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where("date < $%d", *filter.To)
+	}
+
+	return conditions, args
+}
+
+func GetTransactionByID(ctx context.Context, id int64, db DBTX) (*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE transaction_id = $1`
+	transaction, err := scanTransaction(db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error getting transaction")
+		return nil, mapError(err)
 	}
 	return &transaction, nil
 }
 
-func UpdateTransaction(id int64, transaction models.Transaction, db *sql.DB) error {
-	query := `UPDATE transactions SET user_id = $1, amount = $2, currency = $3, transaction_type = $4, category = $5, description = $6 WHERE transaction_id = $7`
-	_, err := db.Exec(query, transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, id)
+func UpdateTransaction(ctx context.Context, id int64, transaction models.Transaction, db DBTX) error {
+	query := `UPDATE transactions SET user_id = $1, amount = $2, currency = $3, transaction_type = $4, category = $5, description = $6, account_id = $7 WHERE transaction_id = $8`
+	result, err := db.ExecContext(ctx, query, transaction.UserID, transaction.Amount, transaction.Currency, transaction.TransactionType, transaction.Category, transaction.Description, transaction.AccountID, id)
 	if err != nil {
-		fmt.Println("Error updating transaction:", err)
-		return err
+		logging.FromContext(ctx).WithError(err).Error("Error updating transaction")
+		return mapError(err)
 	}
-	return nil
+	return expectAffected(result)
 }
 
-func DeleteTransaction(id int64, db *sql.DB) error {
+// DeleteTransaction removes a transaction and returns the user it belonged
+// to, or ErrNotFound.
+func DeleteTransaction(ctx context.Context, id int64, db DBTX) (int, error) {
+	log := logging.FromContext(ctx)
 	log.Info("Deleting transaction from database.")
 
-	query := `DELETE FROM transactions WHERE transaction_id = $1`
-	_, err := db.Exec(query, id)
-	if err != nil {
-		fmt.Println("Error deleting transaction:", err)
-		return err
+	var userID int
+	query := `DELETE FROM transactions WHERE transaction_id = $1 RETURNING user_id`
+	if err := db.QueryRowContext(ctx, query, id).Scan(&userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.WithError(err).Error("Error deleting transaction")
+		}
+		return 0, mapError(err)
+	}
+	return userID, nil
+}
+
+var requiredTables = []string{"items", "users", "commissions", "transactions", "accounts", "rate_limit_buckets", "api_keys", "roles", "permissions", "role_permissions", "user_roles", "audit_log", "webhooks", "webhook_deliveries", "webhook_attempts", "outbox", "risk_reviews", "transaction_transitions", "transaction_splits", "tags", "transaction_tags", "transaction_notes", "attachments"}
+
+// RequiredTables lists the tables CheckSchema looks for, in the order it
+// checks them.
+func RequiredTables() []string {
+	return append([]string(nil), requiredTables...)
+}
+
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	for _, table := range requiredTables {
+		var found sql.NullString
+		if err := db.QueryRowContext(ctx, `SELECT to_regclass($1)`, table).Scan(&found); err != nil {
+			return fmt.Errorf("checking table %s: %w", table, err)
+		}
+		if !found.Valid {
+			return fmt.Errorf("table %s is missing", table)
+		}
 	}
 	return nil
 }
+
+func UserExists(ctx context.Context, id int, db DBTX) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`, id).Scan(&exists)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error checking user")
+		return false, mapError(err)
+	}
+	return exists, nil
+}
+
+// AccountOwner returns the user owning the account, or ErrNotFound.
+func AccountOwner(ctx context.Context, accountID int, db DBTX) (int, error) {
+	var userID int
+	err := db.QueryRowContext(ctx, `SELECT user_id FROM accounts WHERE account_id = $1`, accountID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error checking account")
+		return 0, mapError(err)
+	}
+	return userID, nil
+}
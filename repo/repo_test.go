@@ -3,11 +3,16 @@ package repo
 import (
 	//configs "DZ_ITOG/config"
 	"DZ_ITOG/models"
+	"DZ_ITOG/repo/repotest"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	//"github.com/stretchr/testify/assert"
 
 	//"strconv"
+	"reflect"
 	"testing"
 	"time"
 
@@ -25,7 +30,7 @@ func TestCreate(t *testing.T) {
 		WithArgs("1", "value").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	if err := Create(models.Item{ID: "1", Value: "value"}, db); err != nil {
+	if err := Create(context.Background(), models.Item{ID: "1", Value: "value"}, db); err != nil {
 		t.Errorf("error was not expected while creating item: %s", err)
 	}
 
@@ -43,14 +48,13 @@ func TestGetTransactionByID(t *testing.T) {
 
 	testDate, _ := time.Parse(time.RFC3339, "2024-04-14T00:00:00Z")
 
-	rows := sqlmock.NewRows([]string{"transaction_id", "user_id", "amount", "currency", "transaction_type", "category", "date", "description"}).
-		AddRow(1, 4, 500.00, "USD", "перевод", "перевод", testDate, "Оплата услуг")
+	rows := repotest.TransactionRows(models.Transaction{ID: 1, UserID: 4, Amount: 500, Currency: "USD", TransactionType: "перевод", Category: "перевод", Date: testDate, Description: "Оплата услуг"})
 
 	mock.ExpectQuery("SELECT .* FROM transactions WHERE transaction_id =").
 		WithArgs(1).
 		WillReturnRows(rows)
 
-	transaction, err := GetTransactionByID(1, db)
+	transaction, err := GetTransactionByID(context.Background(), 1, db)
 	if err != nil {
 		t.Errorf("error was not expected while fetching transaction: %s", err)
 	}
@@ -76,19 +80,21 @@ func TestDeleteTransaction(t *testing.T) {
 	transactionID1 := int64(1)
 	transactionID2 := int64(2)
 
-	mock.ExpectExec("DELETE FROM transactions WHERE transaction_id =").
+	mock.ExpectQuery("DELETE FROM transactions WHERE transaction_id =").
 		WithArgs(transactionID1).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
 
-	if err := DeleteTransaction(transactionID1, db); err != nil {
+	if userID, err := DeleteTransaction(context.Background(), transactionID1, db); err != nil {
 		t.Errorf("error was not expected while deleting transaction: %s", err)
+	} else if userID != 7 {
+		t.Errorf("expected the owner 7, got %d", userID)
 	}
 
-	mock.ExpectExec("DELETE FROM transactions WHERE transaction_id =").
+	mock.ExpectQuery("DELETE FROM transactions WHERE transaction_id =").
 		WithArgs(transactionID2).
 		WillReturnError(fmt.Errorf("delete error"))
 
-	if err := DeleteTransaction(transactionID2, db); err == nil {
+	if _, err := DeleteTransaction(context.Background(), transactionID2, db); err == nil {
 		t.Errorf("expected error, got none")
 	}
 
@@ -118,7 +124,7 @@ func TestCreateCommission(t *testing.T) {
 		WithArgs(mockCommission.TransactionID, mockCommission.Amount, mockCommission.Currency, mockCommission.TransactionType, mockCommission.Commission, mockCommission.Date, mockCommission.Description).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	if err := CreateCommission(db, mockCommission); err != nil {
+	if err := CreateCommission(context.Background(), db, mockCommission); err != nil {
 		t.Errorf("error was not expected while creating commission: %s", err)
 	}
 
@@ -145,10 +151,10 @@ func TestUpdateTransaction(t *testing.T) {
 	}
 
 	mock.ExpectExec("UPDATE transactions").
-		WithArgs(mockTransaction.UserID, mockTransaction.Amount, mockTransaction.Currency, mockTransaction.TransactionType, mockTransaction.Category, mockTransaction.Description, int64(mockTransaction.ID)).
+		WithArgs(mockTransaction.UserID, mockTransaction.Amount, mockTransaction.Currency, mockTransaction.TransactionType, mockTransaction.Category, mockTransaction.Description, nil, int64(mockTransaction.ID)).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	if err := UpdateTransaction(int64(mockTransaction.ID), mockTransaction, db); err != nil {
+	if err := UpdateTransaction(context.Background(), int64(mockTransaction.ID), mockTransaction, db); err != nil {
 		t.Errorf("error was not expected while updating transaction: %s", err)
 	}
 
@@ -178,7 +184,7 @@ func TestCreateCommissionSuccess(t *testing.T) {
 		WithArgs(newCommission.TransactionID, newCommission.Amount, newCommission.Currency, newCommission.TransactionType, newCommission.Commission, newCommission.Date, newCommission.Description).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = CreateCommission(db, newCommission)
+	err = CreateCommission(context.Background(), db, newCommission)
 
 	if err != nil {
 		t.Errorf("unexpected error while creating commission: %s", err)
@@ -210,7 +216,7 @@ func TestCreateCommissionWithInvalidData(t *testing.T) {
 		WithArgs(invalidCommission.TransactionID, invalidCommission.Amount, invalidCommission.Currency, invalidCommission.TransactionType, invalidCommission.Commission, invalidCommission.Date, invalidCommission.Description).
 		WillReturnError(fmt.Errorf("commission exceeds maximum allowed amount"))
 
-	err = CreateCommission(db, invalidCommission)
+	err = CreateCommission(context.Background(), db, invalidCommission)
 
 	if err == nil {
 		t.Error("expected error, got none")
@@ -242,7 +248,7 @@ func TestCreateCommissionWithSQLConstraintError(t *testing.T) {
 		WithArgs(duplicateCommission.TransactionID, duplicateCommission.Amount, duplicateCommission.Currency, duplicateCommission.TransactionType, duplicateCommission.Commission, duplicateCommission.Date, duplicateCommission.Description).
 		WillReturnError(fmt.Errorf("duplicate key violation"))
 
-	err = CreateCommission(db, duplicateCommission)
+	err = CreateCommission(context.Background(), db, duplicateCommission)
 
 	if err == nil {
 		t.Error("expected error, got none")
@@ -259,14 +265,16 @@ func TestGetAllTransactions(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"transaction_id", "user_id", "amount", "currency", "transaction_type", "category", "date", "description"}).
-		AddRow(1, 1, 100.00, "USD", "expense", "food", time.Now(), "Dinner out").
-		AddRow(2, 1, 200.00, "USD", "income", "salary", time.Now(), "Monthly salary")
+	accountID := 5
+	rows := repotest.TransactionRows(
+		models.Transaction{ID: 1, UserID: 1, Amount: 100, Currency: "USD", TransactionType: "expense", Category: "food", Date: time.Now(), Description: "Dinner out"},
+		models.Transaction{ID: 2, UserID: 1, Amount: 200, Currency: "USD", TransactionType: "income", Category: "salary", Date: time.Now(), Description: "Monthly salary", AccountID: &accountID},
+	)
 
-	mock.ExpectQuery(`SELECT transaction_id, user_id, amount, currency, transaction_type, category, date, description FROM transactions`).
+	mock.ExpectQuery(`SELECT transaction_id, user_id, amount, currency, transaction_type, category, date, description, account_id, status, refund_of, refunded,.+ FROM transactions`).
 		WillReturnRows(rows)
 
-	transactions, err := GetAllTransactions(db)
+	transactions, err := GetAllTransactions(context.Background(), db)
 	if err != nil {
 		t.Errorf("error was not expected while fetching transactions: %s", err)
 	}
@@ -279,6 +287,10 @@ func TestGetAllTransactions(t *testing.T) {
 		t.Errorf("expected amount of first transaction to be 100.00, got %f", transactions[0].Amount)
 	}
 
+	if transactions[0].AccountID != nil || transactions[1].AccountID == nil || *transactions[1].AccountID != 5 {
+		t.Errorf("expected account IDs nil and 5, got %v and %v", transactions[0].AccountID, transactions[1].AccountID)
+	}
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -293,7 +305,7 @@ func TestCreateTransaction(t *testing.T) {
 	expectedID := 1
 
 	mock.ExpectQuery("INSERT INTO transactions").
-		WithArgs(1, 500.0, "USD", "transfer", "transfer", "Test transaction").
+		WithArgs(1, 500.0, "USD", "transfer", "transfer", "Test transaction", nil, "", nil).
 		WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(expectedID))
 
 	testTransaction := models.Transaction{
@@ -305,7 +317,7 @@ func TestCreateTransaction(t *testing.T) {
 		Description:     "Test transaction",
 	}
 
-	id, err := CreateTransaction(testTransaction, db)
+	id, err := CreateTransaction(context.Background(), testTransaction, db)
 	if err != nil {
 		t.Errorf("error was not expected while inserting transaction: %s", err)
 		return
@@ -319,3 +331,214 @@ func TestCreateTransaction(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT item_id, value FROM items WHERE item_id =").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}).AddRow("1", "value"))
+
+	item, err := Read(context.Background(), "1", db)
+	if err != nil {
+		t.Fatalf("error was not expected while reading item: %s", err)
+	}
+	if item.ID != "1" || item.Value != "value" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	mock.ExpectQuery("SELECT item_id, value FROM items WHERE item_id =").
+		WithArgs("2").
+		WillReturnError(sql.ErrNoRows)
+
+	if _, err := Read(context.Background(), "2", db); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateAndDeleteItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE items SET value").
+		WithArgs("new", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := UpdateItem(context.Background(), models.Item{ID: "1", Value: "new"}, db); err != nil {
+		t.Errorf("error was not expected while updating item: %s", err)
+	}
+
+	mock.ExpectExec("UPDATE items SET value").
+		WithArgs("new", "missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := UpdateItem(context.Background(), models.Item{ID: "missing", Value: "new"}, db); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	mock.ExpectExec("DELETE FROM items WHERE item_id =").
+		WithArgs("missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := DeleteItem(context.Background(), "missing", db); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListTransactionsFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	userID := 4
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := repotest.TransactionRows(models.Transaction{ID: 1, UserID: 4, Amount: 500, Currency: "USD", TransactionType: "перевод", Date: from})
+
+	mock.ExpectQuery(`FROM transactions WHERE user_id = \$1 AND transaction_type = \$2 AND date >= \$3 ORDER BY date DESC, transaction_id DESC LIMIT \$4 OFFSET \$5$`).
+		WithArgs(4, "перевод", from, 10, 20).
+		WillReturnRows(rows)
+
+	transactions, err := ListTransactions(context.Background(), models.TransactionFilter{
+		UserID:          &userID,
+		TransactionType: "перевод",
+		From:            &from,
+		Limit:           10,
+		Offset:          20,
+	}, db)
+	if err != nil {
+		t.Errorf("error was not expected while listing transactions: %s", err)
+	}
+	if len(transactions) != 1 {
+		t.Errorf("expected 1 transaction, got %d", len(transactions))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSummarizeTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	userID := 4
+	mock.ExpectQuery(`USING \(transaction_id\) WHERE user_id = \$1 GROUP BY currency, transaction_type ORDER BY currency, transaction_type$`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "transaction_type", "count", "amount", "commission"}).
+			AddRow("RUB", "перевод", 3, 900.0, 45.0).
+			AddRow("USD", "покупка", 1, 20.0, 0.0))
+
+	summaries, err := SummarizeTransactions(context.Background(), models.TransactionFilter{UserID: &userID, Limit: 10}, db)
+	if err != nil {
+		t.Errorf("error was not expected while summarizing transactions: %s", err)
+	}
+	want := []models.TransactionSummary{
+		{Currency: "RUB", TransactionType: "перевод", Count: 3, Amount: 900, Commission: 45},
+		{Currency: "USD", TransactionType: "покупка", Count: 1, Amount: 20},
+	}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("unexpected summaries: got %+v want %+v", summaries, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTransactionSplits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := repotest.TransactionRows(models.Transaction{ID: 1, UserID: 4, Amount: 60, Currency: "RUB", TransactionType: "покупка", Category: "supermarket", Date: time.Now(), Splits: []models.Split{{Category: "groceries", Amount: 45}, {Category: "household", Amount: 15, Note: "detergent"}}})
+	mock.ExpectQuery(`FROM transaction_splits s WHERE s.transaction_id = transactions.transaction_id\) AS splits, .+ AS tags FROM transactions WHERE transaction_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	transaction, err := GetTransactionByID(context.Background(), 1, db)
+	if err != nil {
+		t.Fatalf("error was not expected while getting transaction: %s", err)
+	}
+	want := []models.Split{{Category: "groceries", Amount: 45}, {Category: "household", Amount: 15, Note: "detergent"}}
+	if !reflect.DeepEqual(transaction.Splits, want) {
+		t.Errorf("unexpected splits: got %+v want %+v", transaction.Splits, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSummarizeCategories(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	userID := 4
+	mock.ExpectQuery(`FROM \(SELECT \* FROM transactions WHERE user_id = \$1\) t LEFT JOIN transaction_splits s ON s.transaction_id = t.transaction_id WHERE COALESCE\(s.category, t.category\) = \$2 GROUP BY 1, 2 ORDER BY 1, 2$`).
+		WithArgs(4, "groceries").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "category", "count", "amount"}).
+			AddRow("RUB", "groceries", 2, 75.0))
+
+	summaries, err := SummarizeCategories(context.Background(), models.TransactionFilter{UserID: &userID, Category: "groceries"}, db)
+	if err != nil {
+		t.Errorf("error was not expected while summarizing categories: %s", err)
+	}
+	want := []models.CategorySummary{{Currency: "RUB", Category: "groceries", Count: 2, Amount: 75}}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("unexpected summaries: got %+v want %+v", summaries, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSearchTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	userID := 4
+	date := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`websearch_to_tsquery\('russian', \$3\) \|\| websearch_to_tsquery\('english', \$3\).+WHERE user_id = \$1 AND EXISTS .+g.name = \$2\) AND \(search_vector @@ q.words OR \$3 <% search_text .+ ORDER BY r.rank DESC, date DESC, transaction_id DESC LIMIT \$4 OFFSET \$5$`).
+		WithArgs(4, "trip", "такси март", 10, 20).
+		WillReturnRows(sqlmock.NewRows(append(repotest.TransactionColumns, "rank")).
+			AddRow(append(repotest.TransactionValues(models.Transaction{ID: 9, UserID: 4, Amount: 450, Currency: "RUB", TransactionType: "покупка",
+				Category: "transport", Date: date, Description: "Такси из аэропорта", Tags: []string{"trip"}}), 0.35)...))
+
+	results, err := SearchTransactions(context.Background(), "такси март", models.TransactionFilter{UserID: &userID, Tags: []string{"trip"}, Limit: 10, Offset: 20}, db)
+	if err != nil {
+		t.Errorf("error was not expected while searching transactions: %s", err)
+	}
+	if len(results) != 1 || results[0].ID != 9 || results[0].Rank != 0.35 || !reflect.DeepEqual(results[0].Tags, []string{"trip"}) {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Package repotest helps tests mock the database behind repo with sqlmock.
+// It knows the columns repo reads a transaction from, so that a change to
+// them is made here rather than in the tests of every package.
+package repotest
+
+import (
+	"DZ_ITOG/models"
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// TransactionColumns are the columns of a transaction row, in the order repo
+// selects them.
+var TransactionColumns = []string{"transaction_id", "user_id", "amount", "currency", "transaction_type", "category", "date", "description", "account_id", "status", "refund_of", "refunded", "splits", "tags"}
+
+// TransactionRows returns rows of TransactionColumns holding transactions.
+func TransactionRows(transactions ...models.Transaction) *sqlmock.Rows {
+	rows := sqlmock.NewRows(TransactionColumns)
+	for _, t := range transactions {
+		rows.AddRow(TransactionValues(t)...)
+	}
+	return rows
+}
+
+// TransactionValues returns the values of t as the database returns them,
+// for rows with more columns than TransactionColumns. Like the database, it
+// takes an empty Status as completed.
+func TransactionValues(t models.Transaction) []driver.Value {
+	status := t.Status
+	if status == "" {
+		status = models.StatusCompleted
+	}
+	var accountID, refundOf, splits, tags driver.Value
+	if t.AccountID != nil {
+		accountID = *t.AccountID
+	}
+	if t.RefundOf != nil {
+		refundOf = *t.RefundOf
+	}
+	if t.Splits != nil {
+		splits, _ = json.Marshal(t.Splits)
+	}
+	if t.Tags != nil {
+		tags, _ = pq.Array(t.Tags).Value()
+	}
+	return []driver.Value{t.ID, t.UserID, t.Amount, t.Currency, t.TransactionType, t.Category, t.Date, t.Description, accountID, status, refundOf, t.Refunded, splits, tags}
+}
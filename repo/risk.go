@@ -0,0 +1,198 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// riskLock is the class of the advisory locks that serialize the risk checks
+// of one user, so that concurrent requests cannot slip past a limit together.
+const riskLock = 0x7269736b // "risk"
+
+// LockUserRisk holds the risk lock of userID for the rest of tx.
+func LockUserRisk(ctx context.Context, tx *sql.Tx, userID int) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, riskLock, userID)
+	return mapError(err)
+}
+
+// RecentTransaction is a transaction of a user made Age ago, as seen by the
+// risk rules.
+type RecentTransaction struct {
+	Amount          float64
+	Currency        string
+	TransactionType string
+	Age             time.Duration
+}
+
+// RecentTransactions returns the transactions of userID made within window,
+// including those held for review, newest first. Ages are measured on the
+// database clock.
+func RecentTransactions(ctx context.Context, userID int, window time.Duration, db DBTX) ([]RecentTransaction, error) {
+	rows, err := db.QueryContext(ctx, `SELECT amount, currency, transaction_type, EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - date) AS age
+		FROM transactions WHERE user_id = $1 AND date >= CURRENT_TIMESTAMP - make_interval(secs => $2)
+		UNION ALL
+		SELECT (transaction->>'amount')::numeric, transaction->>'currency', transaction->>'transaction_type', EXTRACT(EPOCH FROM now() - created_at)
+		FROM risk_reviews WHERE user_id = $1 AND status = 'pending' AND created_at >= now() - make_interval(secs => $2)
+		ORDER BY age`, userID, window.Seconds())
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading recent transactions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	var recent []RecentTransaction
+	for rows.Next() {
+		var t RecentTransaction
+		var age float64
+		if err := rows.Scan(&t.Amount, &t.Currency, &t.TransactionType, &age); err != nil {
+			return nil, mapError(err)
+		}
+		t.Age = time.Duration(age * float64(time.Second))
+		recent = append(recent, t)
+	}
+	return recent, mapError(rows.Err())
+}
+
+// AmountHistory returns how many transactions userID made in currency within
+// lookback and their average amount.
+func AmountHistory(ctx context.Context, userID int, currency string, lookback time.Duration, db DBTX) (int, float64, error) {
+	var count int
+	var average float64
+	err := db.QueryRowContext(ctx, `SELECT count(*), COALESCE(avg(amount), 0) FROM transactions
+		WHERE user_id = $1 AND currency = $2 AND date >= CURRENT_TIMESTAMP - make_interval(secs => $3)`,
+		userID, currency, lookback.Seconds()).Scan(&count, &average)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error reading amount history")
+		return 0, 0, mapError(err)
+	}
+	return count, average, nil
+}
+
+const reviewColumns = `review_id, status, user_id, transaction_id, transaction, findings, created_at, decided_at, decided_by, note`
+
+func scanReview(row interface{ Scan(...interface{}) error }) (models.RiskReview, error) {
+	var r models.RiskReview
+	var transactionID, decidedBy sql.NullInt64
+	var decidedAt sql.NullTime
+	var transaction, findings []byte
+	err := row.Scan(&r.ID, &r.Status, &r.UserID, &transactionID, &transaction, &findings, &r.CreatedAt, &decidedAt, &decidedBy, &r.Note)
+	if err != nil {
+		return r, err
+	}
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		r.TransactionID = &id
+	}
+	if decidedAt.Valid {
+		r.DecidedAt = &decidedAt.Time
+	}
+	if decidedBy.Valid {
+		by := int(decidedBy.Int64)
+		r.DecidedBy = &by
+	}
+	if err := json.Unmarshal(transaction, &r.Transaction); err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(findings, &r.Findings)
+}
+
+// CreateRiskReview stores a review and returns it with its id and creation
+// time filled in.
+func CreateRiskReview(ctx context.Context, review models.RiskReview, db DBTX) (models.RiskReview, error) {
+	transaction, err := json.Marshal(review.Transaction)
+	if err != nil {
+		return models.RiskReview{}, err
+	}
+	findings, err := json.Marshal(review.Findings)
+	if err != nil {
+		return models.RiskReview{}, err
+	}
+	err = db.QueryRowContext(ctx, `INSERT INTO risk_reviews (status, user_id, transaction_id, transaction, findings)
+		VALUES ($1, $2, $3, $4, $5) RETURNING review_id, created_at`,
+		review.Status, review.UserID, review.TransactionID, transaction, findings).Scan(&review.ID, &review.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting risk review")
+		return models.RiskReview{}, mapError(err)
+	}
+	return review, nil
+}
+
+// GetRiskReview returns the review with id, or ErrNotFound. With forUpdate
+// the row stays locked until tx ends.
+func GetRiskReview(ctx context.Context, id int64, forUpdate bool, db DBTX) (models.RiskReview, error) {
+	query := `SELECT ` + reviewColumns + ` FROM risk_reviews WHERE review_id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	r, err := scanReview(db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return models.RiskReview{}, mapError(err)
+	}
+	return r, nil
+}
+
+// ReviewFilter narrows a review listing. Unset fields match every review.
+type ReviewFilter struct {
+	Status string
+	UserID *int
+	Limit  int
+}
+
+// ListRiskReviews returns the reviews matching filter, oldest first.
+func ListRiskReviews(ctx context.Context, filter ReviewFilter, db DBTX) ([]models.RiskReview, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	query := `SELECT ` + reviewColumns + ` FROM risk_reviews`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY review_id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing risk reviews")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	reviews := []models.RiskReview{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, mapError(rows.Err())
+}
+
+// DecideRiskReview records the decision on a review: its new status, the
+// transaction it created if any, who decided and why. It returns ErrNotFound
+// for a missing review.
+func DecideRiskReview(ctx context.Context, review models.RiskReview, db DBTX) (models.RiskReview, error) {
+	var decidedAt time.Time
+	err := db.QueryRowContext(ctx, `UPDATE risk_reviews SET status = $1, transaction_id = $2, decided_at = now(), decided_by = $3, note = $4
+		WHERE review_id = $5 RETURNING decided_at`,
+		review.Status, review.TransactionID, review.DecidedBy, review.Note, review.ID).Scan(&decidedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error deciding risk review")
+		return models.RiskReview{}, mapError(err)
+	}
+	review.DecidedAt = &decidedAt
+	return review, nil
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// seedRoles inserts the built-in roles and permissions and grants each role
+// its defaults. Existing grants are left alone, so permissions revoked by hand
+// are not put back, but a permission added to a role in a release is.
+func seedRoles(ctx context.Context, db *sql.DB) error {
+	var permissions []string
+	for _, granted := range models.DefaultRolePermissions {
+		permissions = append(permissions, granted...)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO roles (role) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`, pq.Array(models.Roles)); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO permissions (permission) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`, pq.Array(permissions)); err != nil {
+		return err
+	}
+	roles := make([]string, 0, len(models.DefaultRolePermissions))
+	for role := range models.DefaultRolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if _, err := db.ExecContext(ctx, `INSERT INTO role_permissions (role, permission) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+			role, pq.Array(models.DefaultRolePermissions[role])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserRoles returns the roles of the user and the permissions they grant,
+// both sorted.
+func UserRoles(ctx context.Context, userID int, db DBTX) (roles, permissions []string, err error) {
+	err = db.QueryRowContext(ctx, `SELECT
+			COALESCE(ARRAY(SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role), '{}'),
+			COALESCE(ARRAY(SELECT DISTINCT rp.permission FROM user_roles ur JOIN role_permissions rp USING (role) WHERE ur.user_id = $1 ORDER BY 1), '{}')`,
+		userID).Scan(pq.Array(&roles), pq.Array(&permissions))
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error loading user roles")
+		return nil, nil, mapError(err)
+	}
+	return roles, permissions, nil
+}
+
+// RolePermissions returns the permissions granted to role.
+func RolePermissions(ctx context.Context, role string, db DBTX) ([]string, error) {
+	permissions := []string{}
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(ARRAY(SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission), '{}')`,
+		role).Scan(pq.Array(&permissions))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return permissions, nil
+}
+
+// SetUserRoles replaces the roles of the user. Unknown roles and users are
+// reported as ErrConstraint.
+func SetUserRoles(ctx context.Context, userID int, roles []string, db DBTX) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, userID); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error clearing user roles")
+		return mapError(err)
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO user_roles (user_id, role) SELECT $1, unnest($2::text[])`, userID, pq.Array(roles)); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error assigning user roles")
+		return mapError(err)
+	}
+	return nil
+}
+
+// CreateAuditEvent appends event to the audit log.
+func CreateAuditEvent(ctx context.Context, event models.AuditEvent, db DBTX) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO audit_log (user_id, api_key_id, action, resource, outcome, reason, request_id, client_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		event.UserID, event.APIKeyID, event.Action, event.Resource, event.Outcome, event.Reason, event.RequestID, event.ClientIP)
+	return mapError(err)
+}
+
+// AuditFilter narrows an audit log listing. Unset fields match every event.
+type AuditFilter struct {
+	UserID  *int
+	Outcome string
+	Since   *time.Time
+	Limit   int
+}
+
+// ListAuditEvents returns the events matching filter, newest first.
+func ListAuditEvents(ctx context.Context, filter AuditFilter, db DBTX) ([]models.AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != nil {
+		where("user_id = $%d", *filter.UserID)
+	}
+	if filter.Outcome != "" {
+		where("outcome = $%d", filter.Outcome)
+	}
+	if filter.Since != nil {
+		where("occurred_at >= $%d", *filter.Since)
+	}
+
+	query := `SELECT audit_id, occurred_at, user_id, api_key_id, action, resource, outcome, reason,
+		COALESCE(request_id, ''), COALESCE(client_ip, '') FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY audit_id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing audit events")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.UserID, &e.APIKeyID, &e.Action, &e.Resource, &e.Outcome, &e.Reason, &e.RequestID, &e.ClientIP); err != nil {
+			return nil, mapError(err)
+		}
+		events = append(events, e)
+	}
+	return events, mapError(rows.Err())
+}
@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetSimilarityThreshold sets how alike, from 0 to 1, a word must be to a
+// searched one for SearchTransactions to count it as a typo. It lasts until
+// the end of the database transaction tx.
+func SetSimilarityThreshold(ctx context.Context, threshold float64, tx DBTX) error {
+	_, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		strconv.FormatFloat(threshold, 'f', -1, 64))
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error setting the similarity threshold")
+		return mapError(err)
+	}
+	return nil
+}
+
+// SearchTransactions returns the transactions matching filter whose
+// description or category contain the words of text, stemmed as Russian or
+// English, or whose description, category or tags resemble text, best match
+// first. Exact words weigh most, then resemblance to the description and
+// category, then to a tag. A zero Limit returns every match.
+func SearchTransactions(ctx context.Context, text string, filter models.TransactionFilter, db DBTX) ([]models.SearchResult, error) {
+	log := logging.FromContext(ctx)
+
+	conditions, args := filterConditions(filter)
+	args = append(args, text)
+	conditions = append(conditions, fmt.Sprintf(`(search_vector @@ q.words OR $%[1]d <%% search_text OR EXISTS (
+		SELECT 1 FROM transaction_tags tt JOIN tags g USING (tag_id) WHERE tt.transaction_id = transactions.transaction_id AND g.name <%% $%[1]d))`, len(args)))
+	query := fmt.Sprintf(`SELECT `+transactionColumns+`, r.rank FROM transactions,
+		LATERAL (SELECT websearch_to_tsquery('russian', $%[1]d) || websearch_to_tsquery('english', $%[1]d) AS words) q,
+		LATERAL (SELECT ts_rank(search_vector, q.words) + 0.5 * word_similarity($%[1]d, search_text) + 0.25 * COALESCE((
+			SELECT MAX(word_similarity(g.name, $%[1]d)) FROM transaction_tags tt JOIN tags g USING (tag_id)
+			WHERE tt.transaction_id = transactions.transaction_id), 0) AS rank) r
+		WHERE `, len(args)) + strings.Join(conditions, " AND ") + " ORDER BY r.rank DESC, date DESC, transaction_id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Error searching transactions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		result.Transaction, err = scanTransaction(scanWith{rows, &result.Rank})
+		if err != nil {
+			log.WithError(err).Error("Error scanning search result")
+			return nil, mapError(err)
+		}
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		log.WithError(err).Error("Error during rows iteration")
+		return nil, mapError(err)
+	}
+	return results, nil
+}
+
+// scanWith scans a row of transactionColumns followed by more columns.
+type scanWith struct {
+	row  interface{ Scan(...interface{}) error }
+	more *float64
+}
+
+func (s scanWith) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.more)...)
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ReplaceSplits replaces the splits of a transaction with splits, in order.
+// No splits leaves the transaction in its own category only.
+func ReplaceSplits(ctx context.Context, transactionID int, splits []models.Split, db DBTX) error {
+	log := logging.FromContext(ctx)
+	if _, err := db.ExecContext(ctx, `DELETE FROM transaction_splits WHERE transaction_id = $1`, transactionID); err != nil {
+		log.WithError(err).Error("Error deleting transaction splits")
+		return mapError(err)
+	}
+	for _, split := range splits {
+		_, err := db.ExecContext(ctx, `INSERT INTO transaction_splits (transaction_id, category, amount, note) VALUES ($1, $2, $3, $4)`,
+			transactionID, split.Category, split.Amount, split.Note)
+		if err != nil {
+			log.WithError(err).Error("Error inserting transaction split")
+			return mapError(err)
+		}
+	}
+	return nil
+}
+
+// SummarizeCategories counts and totals the transactions matching filter per
+// currency and category. A split transaction counts in the category of each
+// of its splits with the split's amount, and Category then matches a split's
+// category rather than the transaction's. Limit and Offset are ignored.
+func SummarizeCategories(ctx context.Context, filter models.TransactionFilter, db DBTX) ([]models.CategorySummary, error) {
+	log := logging.FromContext(ctx)
+
+	category := filter.Category
+	filter.Category = ""
+	conditions, args := filterConditions(filter)
+	query := `SELECT t.currency, COALESCE(s.category, t.category), COUNT(DISTINCT t.transaction_id), COALESCE(SUM(COALESCE(s.amount, t.amount)), 0)
+		FROM (SELECT * FROM transactions`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += `) t
+		LEFT JOIN transaction_splits s ON s.transaction_id = t.transaction_id`
+	if category != "" {
+		args = append(args, category)
+		query += fmt.Sprintf(" WHERE COALESCE(s.category, t.category) = $%d", len(args))
+	}
+	query += " GROUP BY 1, 2 ORDER BY 1, 2"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Error summarizing categories")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	summaries := []models.CategorySummary{}
+	for rows.Next() {
+		var summary models.CategorySummary
+		if err := rows.Scan(&summary.Currency, &summary.Category, &summary.Count, &summary.Amount); err != nil {
+			log.WithError(err).Error("Error scanning category summary")
+			return nil, mapError(err)
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("Error during rows iteration")
+		return nil, mapError(err)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// LockTransaction returns the transaction with id and keeps its row locked
+// until tx ends, or returns ErrNotFound.
+func LockTransaction(ctx context.Context, tx *sql.Tx, id int64) (models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE transaction_id = $1 FOR UPDATE`
+	transaction, err := scanTransaction(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(ctx).WithError(err).Error("Error locking transaction")
+		}
+		return models.Transaction{}, mapError(err)
+	}
+	return transaction, nil
+}
+
+// RecordTransition sets the status of the transaction to transition.To and
+// records the transition. It returns the transition with its id and time
+// filled in.
+func RecordTransition(ctx context.Context, transition models.StatusTransition, db DBTX) (models.StatusTransition, error) {
+	result, err := db.ExecContext(ctx, `UPDATE transactions SET status = $1 WHERE transaction_id = $2`, transition.To, transition.TransactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating transaction status")
+		return models.StatusTransition{}, mapError(err)
+	}
+	if err := expectAffected(result); err != nil {
+		return models.StatusTransition{}, err
+	}
+	err = db.QueryRowContext(ctx, `INSERT INTO transaction_transitions (transaction_id, from_status, to_status, reason, actor)
+		VALUES ($1, $2, $3, $4, $5) RETURNING transition_id, occurred_at`,
+		transition.TransactionID, transition.From, transition.To, transition.Reason, transition.Actor).Scan(&transition.ID, &transition.OccurredAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting transaction transition")
+		return models.StatusTransition{}, mapError(err)
+	}
+	return transition, nil
+}
+
+// ListTransitions returns the status transitions of a transaction, oldest
+// first.
+func ListTransitions(ctx context.Context, transactionID int64, db DBTX) ([]models.StatusTransition, error) {
+	rows, err := db.QueryContext(ctx, `SELECT transition_id, transaction_id, from_status, to_status, reason, actor, occurred_at
+		FROM transaction_transitions WHERE transaction_id = $1 ORDER BY transition_id`, transactionID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing transaction transitions")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	transitions := []models.StatusTransition{}
+	for rows.Next() {
+		var t models.StatusTransition
+		var actor sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.TransactionID, &t.From, &t.To, &t.Reason, &actor, &t.OccurredAt); err != nil {
+			return nil, mapError(err)
+		}
+		if actor.Valid {
+			a := int(actor.Int64)
+			t.Actor = &a
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, mapError(rows.Err())
+}
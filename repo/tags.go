@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"context"
+)
+
+// ReplaceTags replaces the tags of a transaction with tags, creating the
+// tags that do not exist yet. Repeated tags are stored once.
+func ReplaceTags(ctx context.Context, transactionID int, tags []string, db DBTX) error {
+	log := logging.FromContext(ctx)
+	if _, err := db.ExecContext(ctx, `DELETE FROM transaction_tags WHERE transaction_id = $1`, transactionID); err != nil {
+		log.WithError(err).Error("Error deleting transaction tags")
+		return mapError(err)
+	}
+	for _, tag := range tags {
+		_, err := db.ExecContext(ctx, `WITH tag AS (
+				INSERT INTO tags (name) VALUES ($2) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING tag_id
+			)
+			INSERT INTO transaction_tags (transaction_id, tag_id) SELECT $1, tag_id FROM tag ON CONFLICT DO NOTHING`,
+			transactionID, tag)
+		if err != nil {
+			log.WithError(err).Error("Error inserting transaction tag")
+			return mapError(err)
+		}
+	}
+	return nil
+}
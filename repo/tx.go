@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"context"
+	"database/sql"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so the transaction
+// functions can run on their own or as part of a larger unit of work.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InTx runs fn in a database transaction. It commits when fn returns nil and
+// rolls back otherwise, returning fn's error unchanged.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error starting database transaction")
+		return mapError(err)
+	}
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logging.FromContext(ctx).WithError(rollbackErr).Error("Error rolling back database transaction")
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error committing database transaction")
+		return mapError(err)
+	}
+	return nil
+}
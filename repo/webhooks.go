@@ -0,0 +1,269 @@
+package repo
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `webhook_id, url, events, active, created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (models.Webhook, error) {
+	var w models.Webhook
+	err := row.Scan(&w.ID, &w.URL, pq.Array(&w.Events), &w.Active, &w.CreatedAt)
+	return w, err
+}
+
+// CreateWebhook stores a subscription and returns it with its id and
+// creation time filled in.
+func CreateWebhook(ctx context.Context, webhook models.Webhook, secret string, db DBTX) (models.Webhook, error) {
+	err := db.QueryRowContext(ctx, `INSERT INTO webhooks (url, secret, events, active) VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id, created_at`,
+		webhook.URL, secret, pq.Array(webhook.Events), webhook.Active).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error inserting webhook")
+		return models.Webhook{}, mapError(err)
+	}
+	return webhook, nil
+}
+
+// GetWebhook returns the subscription with id, or ErrNotFound.
+func GetWebhook(ctx context.Context, id int, db DBTX) (models.Webhook, error) {
+	w, err := scanWebhook(db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE webhook_id = $1`, id))
+	if err != nil {
+		return models.Webhook{}, mapError(err)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns every subscription, oldest first.
+func ListWebhooks(ctx context.Context, db DBTX) ([]models.Webhook, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY webhook_id`)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing webhooks")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, mapError(rows.Err())
+}
+
+// UpdateWebhook replaces the URL, events and active flag of a subscription,
+// and its secret unless secret is empty, or returns ErrNotFound.
+func UpdateWebhook(ctx context.Context, webhook models.Webhook, secret string, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE webhooks SET url = $1, events = $2, active = $3, secret = COALESCE(NULLIF($4, ''), secret)
+		WHERE webhook_id = $5`,
+		webhook.URL, pq.Array(webhook.Events), webhook.Active, secret, webhook.ID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error updating webhook")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// DeleteWebhook removes a subscription and its delivery log, or returns
+// ErrNotFound.
+func DeleteWebhook(ctx context.Context, id int, db DBTX) error {
+	result, err := db.ExecContext(ctx, `DELETE FROM webhooks WHERE webhook_id = $1`, id)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error deleting webhook")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
+
+// EnqueueWebhookEvent queues event for every active subscription to its
+// type. Called with the transaction that made the change, the event is
+// queued if and only if the change commits.
+func EnqueueWebhookEvent(ctx context.Context, event models.Event, db DBTX) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT webhook_id, $1, $2, $3 FROM webhooks WHERE active AND $2 = ANY(events)`,
+		event.ID, event.Type, payload)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event_type", event.Type).Error("Error queueing webhook deliveries")
+		return mapError(err)
+	}
+	return nil
+}
+
+// DueWebhookDelivery is a delivery claimed for sending, with where to send
+// it and the secret to sign it with.
+type DueWebhookDelivery struct {
+	models.WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due,
+// oldest first, and pushes their next attempt lease into the future so that
+// other dispatchers skip them while they are being sent. A claim that is not
+// followed by RecordWebhookAttempt is retried once the lease runs out.
+func ClaimWebhookDeliveries(ctx context.Context, db *sql.DB, limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	var due []DueWebhookDelivery
+	err := InTx(ctx, db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT d.delivery_id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret
+			FROM webhook_deliveries d JOIN webhooks w USING (webhook_id)
+			WHERE d.status = 'pending' AND d.next_attempt_at <= now()
+			ORDER BY d.delivery_id LIMIT $1 FOR UPDATE OF d SKIP LOCKED`, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var ids []int64
+		for rows.Next() {
+			d := DueWebhookDelivery{WebhookDelivery: models.WebhookDelivery{Status: models.DeliveryPending}}
+			var payload []byte
+			if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+				return err
+			}
+			d.Payload = payload
+			due = append(due, d)
+			ids = append(ids, d.ID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = now() + $1 * interval '1 millisecond'
+			WHERE delivery_id = ANY($2)`, lease.Milliseconds(), pq.Array(ids))
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error claiming webhook deliveries")
+		return nil, mapError(err)
+	}
+	return due, nil
+}
+
+// RecordWebhookAttempt logs attempt and moves the delivery to status. A
+// pending delivery is retried at next.
+func RecordWebhookAttempt(ctx context.Context, db *sql.DB, deliveryID int64, attempt models.WebhookAttempt, status string, next *time.Time) error {
+	err := InTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+			VALUES ($1, $2, $3, $4, $5)`,
+			deliveryID, attempt.AttemptedAt, attempt.StatusCode, attempt.Error, attempt.DurationMS); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET attempts = attempts + 1, status = $1, next_attempt_at = $2,
+				last_status_code = $3, last_error = $4, delivered_at = CASE WHEN $1 = 'delivered' THEN $5 END
+			WHERE delivery_id = $6`,
+			status, next, attempt.StatusCode, attempt.Error, attempt.AttemptedAt, deliveryID)
+		if err != nil {
+			return err
+		}
+		return expectAffected(result)
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("delivery_id", deliveryID).Error("Error recording webhook attempt")
+	}
+	return mapError(err)
+}
+
+const deliveryColumns = `delivery_id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload []byte
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	d.Payload = payload
+	return d, err
+}
+
+// DeliveryFilter narrows a delivery log listing. Unset fields match every
+// delivery of the webhook.
+type DeliveryFilter struct {
+	WebhookID int
+	Status    string
+	Limit     int
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first,
+// without their attempt logs.
+func ListWebhookDeliveries(ctx context.Context, filter DeliveryFilter, db DBTX) ([]models.WebhookDelivery, error) {
+	conditions := []string{"webhook_id = $1"}
+	args := []interface{}{filter.WebhookID}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY delivery_id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error listing webhook deliveries")
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, mapError(rows.Err())
+}
+
+// GetWebhookDelivery returns a delivery of the webhook with its attempt log,
+// or ErrNotFound.
+func GetWebhookDelivery(ctx context.Context, webhookID int, id int64, db DBTX) (models.WebhookDelivery, error) {
+	d, err := scanDelivery(db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE delivery_id = $1 AND webhook_id = $2`, id, webhookID))
+	if err != nil {
+		return models.WebhookDelivery{}, mapError(err)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT attempted_at, status_code, error, duration_ms FROM webhook_attempts
+		WHERE delivery_id = $1 ORDER BY attempt_id`, id)
+	if err != nil {
+		return models.WebhookDelivery{}, mapError(err)
+	}
+	defer rows.Close()
+	d.Log = []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			return models.WebhookDelivery{}, mapError(err)
+		}
+		d.Log = append(d.Log, a)
+	}
+	return d, mapError(rows.Err())
+}
+
+// RedeliverWebhookDelivery queues a delivery of the webhook to be sent again
+// at once with a fresh set of attempts, whatever its status, or returns
+// ErrNotFound.
+func RedeliverWebhookDelivery(ctx context.Context, webhookID int, id int64, db DBTX) error {
+	result, err := db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now(), delivered_at = NULL
+		WHERE delivery_id = $1 AND webhook_id = $2`, id, webhookID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Error requeueing webhook delivery")
+		return mapError(err)
+	}
+	return expectAffected(result)
+}
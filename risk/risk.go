@@ -0,0 +1,153 @@
+// Package risk checks new transactions against the fraud and anomaly rules
+// in the risk config before they are stored. Each rule that fires is a
+// finding carrying the rule's action; the strictest one decides whether the
+// transaction is stored, held for review or rejected.
+package risk
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Rule names, as reported in findings.
+const (
+	RuleVelocity          = "velocity"
+	RuleLargeAmount       = "large_amount"
+	RuleCurrencySwitching = "currency_switching"
+	RuleSmallTransfers    = "small_transfers"
+)
+
+// severity orders the actions; a higher one wins.
+var severity = map[string]int{configs.RiskFlag: 1, configs.RiskHold: 2, configs.RiskReject: 3}
+
+func active(action string) bool {
+	return severity[action] > 0
+}
+
+// Check runs the active rules against transaction, reading the user's
+// history through tx. It holds the user's risk lock until tx ends, so the
+// checks of concurrent transactions of one user see each other.
+func Check(ctx context.Context, tx *sql.Tx, config configs.RiskConfig, transaction models.Transaction) ([]models.RiskFinding, error) {
+	window := longestWindow(config)
+	large := active(config.LargeAmount.Action)
+	if window == 0 && !large {
+		return nil, nil
+	}
+	if err := repo.LockUserRisk(ctx, tx, transaction.UserID); err != nil {
+		return nil, err
+	}
+	var h history
+	var err error
+	if window > 0 {
+		if h.recent, err = repo.RecentTransactions(ctx, transaction.UserID, window, tx); err != nil {
+			return nil, err
+		}
+	}
+	if large {
+		h.count, h.average, err = repo.AmountHistory(ctx, transaction.UserID, transaction.Currency, config.LargeAmount.Lookback, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return evaluate(config, transaction, h), nil
+}
+
+// Strictest returns the strictest action of findings, or "" when there are
+// none.
+func Strictest(findings []models.RiskFinding) string {
+	strictest := ""
+	for _, f := range findings {
+		if severity[f.Action] > severity[strictest] {
+			strictest = f.Action
+		}
+	}
+	return strictest
+}
+
+// history is what the rules know about the user: their transactions within
+// the longest active window, and the count and average amount of those in
+// the transaction's currency over the large amount lookback.
+type history struct {
+	recent  []repo.RecentTransaction
+	count   int
+	average float64
+}
+
+func longestWindow(config configs.RiskConfig) time.Duration {
+	var longest time.Duration
+	for _, rule := range []struct {
+		action string
+		window time.Duration
+	}{
+		{config.Velocity.Action, config.Velocity.Window},
+		{config.CurrencySwitching.Action, config.CurrencySwitching.Window},
+		{config.SmallTransfers.Action, config.SmallTransfers.Window},
+	} {
+		if active(rule.action) && rule.window > longest {
+			longest = rule.window
+		}
+	}
+	return longest
+}
+
+// evaluate applies the active rules to transaction. Counts include the
+// transaction itself.
+func evaluate(config configs.RiskConfig, transaction models.Transaction, h history) []models.RiskFinding {
+	var findings []models.RiskFinding
+	fire := func(rule, action, format string, args ...interface{}) {
+		findings = append(findings, models.RiskFinding{Rule: rule, Action: action, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if r := config.Velocity; active(r.Action) {
+		n := 1
+		for _, t := range h.recent {
+			if t.Age <= r.Window {
+				n++
+			}
+		}
+		if n > r.MaxCount {
+			fire(RuleVelocity, r.Action, "%d transactions within %s, more than %d", n, r.Window, r.MaxCount)
+		}
+	}
+
+	if r := config.LargeAmount; active(r.Action) && h.count >= r.MinHistory && h.average > 0 {
+		if transaction.Amount > r.Factor*h.average {
+			fire(RuleLargeAmount, r.Action, "%.2f %s is %.1f times the average of %.2f",
+				transaction.Amount, transaction.Currency, transaction.Amount/h.average, h.average)
+		}
+	}
+
+	if r := config.CurrencySwitching; active(r.Action) {
+		currencies := map[string]bool{transaction.Currency: true}
+		for _, t := range h.recent {
+			if t.Age <= r.Window {
+				currencies[t.Currency] = true
+			}
+		}
+		if len(currencies) > r.MaxCurrencies {
+			fire(RuleCurrencySwitching, r.Action, "%d currencies within %s, more than %d", len(currencies), r.Window, r.MaxCurrencies)
+		}
+	}
+
+	if r := config.SmallTransfers; active(r.Action) && isSmallTransfer(transaction.TransactionType, transaction.Amount, r.MaxAmount) {
+		n := 1
+		for _, t := range h.recent {
+			if t.Age <= r.Window && isSmallTransfer(t.TransactionType, t.Amount, r.MaxAmount) {
+				n++
+			}
+		}
+		if n > r.MaxCount {
+			fire(RuleSmallTransfers, r.Action, "%d transfers of at most %v within %s, more than %d", n, r.MaxAmount, r.Window, r.MaxCount)
+		}
+	}
+	return findings
+}
+
+func isSmallTransfer(transactionType string, amount, maxAmount float64) bool {
+	return transactionType == models.TransactionTypeTransfer && amount <= maxAmount
+}
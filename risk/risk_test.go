@@ -0,0 +1,91 @@
+package risk
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(findings []models.RiskFinding) []string {
+	var names []string
+	for _, f := range findings {
+		names = append(names, f.Rule)
+	}
+	return names
+}
+
+func TestEvaluate(t *testing.T) {
+	config := configs.Default().Risk
+	config.Velocity = configs.VelocityRule{Action: configs.RiskFlag, Window: time.Hour, MaxCount: 3}
+	config.LargeAmount.Action = configs.RiskHold
+	config.CurrencySwitching = configs.CurrencySwitchingRule{Action: configs.RiskFlag, Window: time.Hour, MaxCurrencies: 2}
+	config.SmallTransfers = configs.SmallTransfersRule{Action: configs.RiskReject, Window: 10 * time.Minute, MaxAmount: 50, MaxCount: 2}
+
+	transfer := func(amount float64, currency string, age time.Duration) repo.RecentTransaction {
+		return repo.RecentTransaction{Amount: amount, Currency: currency, TransactionType: models.TransactionTypeTransfer, Age: age}
+	}
+	purchase := models.Transaction{UserID: 1, Amount: 40, Currency: "USD", TransactionType: models.TransactionTypePurchase}
+	small := models.Transaction{UserID: 1, Amount: 40, Currency: "USD", TransactionType: models.TransactionTypeTransfer}
+
+	tests := []struct {
+		name        string
+		transaction models.Transaction
+		history     history
+		fired       []string
+		action      string
+	}{
+		{"quiet user", purchase, history{}, nil, ""},
+		{
+			"velocity counts the new transaction",
+			purchase,
+			history{recent: []repo.RecentTransaction{transfer(500, "USD", time.Minute), transfer(500, "USD", 2*time.Minute), transfer(500, "USD", 3*time.Minute)}},
+			[]string{RuleVelocity}, configs.RiskFlag,
+		},
+		{
+			"velocity ignores transactions outside the window",
+			purchase,
+			history{recent: []repo.RecentTransaction{transfer(500, "USD", time.Minute), transfer(500, "USD", 2*time.Minute), transfer(500, "USD", 2*time.Hour)}},
+			nil, "",
+		},
+		{"large amount", models.Transaction{Amount: 1100, Currency: "USD"}, history{count: 5, average: 100}, []string{RuleLargeAmount}, configs.RiskHold},
+		{"large amount without enough history", models.Transaction{Amount: 1100, Currency: "USD"}, history{count: 4, average: 100}, nil, ""},
+		{
+			"currency switching",
+			purchase,
+			history{recent: []repo.RecentTransaction{transfer(500, "EUR", time.Minute), transfer(500, "RUB", time.Minute)}},
+			[]string{RuleCurrencySwitching}, configs.RiskFlag,
+		},
+		{
+			"small transfers, strictest action wins",
+			small,
+			history{recent: []repo.RecentTransaction{transfer(10, "EUR", time.Minute), transfer(20, "RUB", 2*time.Minute)}},
+			[]string{RuleCurrencySwitching, RuleSmallTransfers}, configs.RiskReject,
+		},
+		{
+			"large transfers are not small",
+			small,
+			history{recent: []repo.RecentTransaction{transfer(60, "USD", time.Minute), transfer(70, "USD", 2*time.Minute)}},
+			nil, "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings := evaluate(config, test.transaction, test.history)
+			assert.Equal(t, test.fired, rules(findings))
+			assert.Equal(t, test.action, Strictest(findings))
+		})
+	}
+}
+
+func TestLongestWindowSkipsRulesThatAreOff(t *testing.T) {
+	config := configs.Default().Risk
+	assert.Zero(t, longestWindow(config))
+	config.Velocity.Action = configs.RiskFlag
+	config.SmallTransfers.Action = configs.RiskOff
+	config.SmallTransfers.Window = 24 * time.Hour
+	assert.Equal(t, config.Velocity.Window, longestWindow(config))
+}
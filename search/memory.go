@@ -0,0 +1,342 @@
+package search
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/stream"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// loadRetry is how long Follow waits before loading again after a failure.
+const loadRetry = 10 * time.Second
+
+// Weights of a searched word found as is, as the start of a longer word, or
+// resembling a word. Resemblance is further scaled by the similarity.
+const (
+	exactWeight   = 1
+	prefixWeight  = 0.75
+	similarWeight = 0.5
+)
+
+// MemoryIndex is an inverted index of the words of the description,
+// category and tags of transactions, kept in the process. Words are matched
+// as they are, without stemming: a searched word also finds the words it
+// starts, and words resembling it with at least the similarity given to
+// NewMemoryIndex. A transaction matches when any searched word does, and
+// ranks by how many do and how closely.
+type MemoryIndex struct {
+	mu         sync.RWMutex
+	similarity float64
+	docs       map[int]*document
+	// postings lists the transactions containing each word.
+	postings map[string]map[int]struct{}
+}
+
+type document struct {
+	transaction models.Transaction
+	words       []string
+}
+
+func NewMemoryIndex(similarity float64) *MemoryIndex {
+	return &MemoryIndex{
+		similarity: similarity,
+		docs:       map[int]*document{},
+		postings:   map[string]map[int]struct{}{},
+	}
+}
+
+// Load replaces the content of the index with transactions.
+func (x *MemoryIndex) Load(transactions []models.Transaction) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.docs = map[int]*document{}
+	x.postings = map[string]map[int]struct{}{}
+	for _, t := range transactions {
+		x.put(t)
+	}
+}
+
+// Put adds transaction to the index, or replaces the one with its ID.
+func (x *MemoryIndex) Put(transaction models.Transaction) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.put(transaction)
+}
+
+// Remove drops the transaction with id from the index.
+func (x *MemoryIndex) Remove(id int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *MemoryIndex) put(t models.Transaction) {
+	x.remove(t.ID)
+	doc := &document{transaction: t, words: documentWords(t)}
+	x.docs[t.ID] = doc
+	for _, word := range doc.words {
+		if x.postings[word] == nil {
+			x.postings[word] = map[int]struct{}{}
+		}
+		x.postings[word][t.ID] = struct{}{}
+	}
+}
+
+func (x *MemoryIndex) remove(id int) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	delete(x.docs, id)
+	for _, word := range doc.words {
+		delete(x.postings[word], id)
+		if len(x.postings[word]) == 0 {
+			delete(x.postings, word)
+		}
+	}
+}
+
+func (x *MemoryIndex) Search(ctx context.Context, text string, filter models.TransactionFilter) ([]models.SearchResult, error) {
+	terms := uniqueWords(text)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// scores holds, per transaction, the best score of each searched word.
+	scores := map[int][]float64{}
+	for i, term := range terms {
+		grams := trigrams(term)
+		for word, ids := range x.postings {
+			score := x.score(term, grams, word)
+			if score == 0 {
+				continue
+			}
+			for id := range ids {
+				if !matches(filter, x.docs[id].transaction) {
+					continue
+				}
+				if scores[id] == nil {
+					scores[id] = make([]float64, len(terms))
+				}
+				if score > scores[id][i] {
+					scores[id][i] = score
+				}
+			}
+		}
+	}
+
+	results := make([]models.SearchResult, 0, len(scores))
+	for id, best := range scores {
+		var rank float64
+		for _, score := range best {
+			rank += score
+		}
+		results = append(results, models.SearchResult{Transaction: x.docs[id].transaction, Rank: rank / float64(len(terms))})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.After(b.Date)
+		}
+		return a.ID > b.ID
+	})
+
+	if filter.Offset >= len(results) {
+		return []models.SearchResult{}, nil
+	}
+	results = results[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(results) {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+// score tells how well word matches the searched term, 0 for not at all.
+func (x *MemoryIndex) score(term string, grams map[string]struct{}, word string) float64 {
+	switch {
+	case word == term:
+		return exactWeight
+	case len([]rune(term)) >= 3 && strings.HasPrefix(word, term):
+		return prefixWeight
+	}
+	if similarity := similarity(grams, trigrams(word)); similarity >= x.similarity {
+		return similarWeight * similarity
+	}
+	return 0
+}
+
+// Follow loads every transaction from db into the index, then applies the
+// transaction events published to hub until the hub is closed. When it falls
+// behind the hub it loads everything again. Only changes made by this
+// process are published to hub: those of other instances or of CLI imports
+// show up after the next load.
+func (x *MemoryIndex) Follow(hub *stream.Hub, db *sql.DB) {
+	log := logging.Logger().WithField("module", "search")
+	for {
+		sub, _, _ := hub.Subscribe(0, func(e stream.Event) bool {
+			return strings.HasPrefix(e.Type, "transaction.")
+		})
+		if x.load(sub, db) {
+			for e := range sub.Events() {
+				x.apply(e.Event)
+			}
+		}
+		if !sub.Lagged() {
+			return
+		}
+		log.Warn("Search index fell behind the transaction events, loading it again")
+	}
+}
+
+// load loads the index from db, retrying until it succeeds. It returns false
+// if sub ends first. Events received while retrying are dropped, since the
+// load that follows includes them.
+func (x *MemoryIndex) load(sub *stream.Subscription, db *sql.DB) bool {
+	log := logging.Logger().WithField("module", "search")
+	for {
+		transactions, err := repo.GetAllTransactions(context.Background(), db)
+		if err == nil {
+			x.Load(transactions)
+			log.WithField("transactions", len(transactions)).Info("Search index loaded")
+			return true
+		}
+		log.WithError(err).Errorf("Error loading the search index, retrying in %s", loadRetry)
+		retry := time.NewTimer(loadRetry)
+		for waiting := true; waiting; {
+			select {
+			case _, ok := <-sub.Events():
+				if !ok {
+					retry.Stop()
+					return false
+				}
+			case <-retry.C:
+				waiting = false
+			}
+		}
+	}
+}
+
+// apply updates the index with a transaction event. Update events carry
+// neither the date, status nor refunds, which are kept from the indexed
+// transaction.
+func (x *MemoryIndex) apply(e models.Event) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	switch e.Type {
+	case models.EventTransactionCreated, models.EventTransactionUpdated:
+		var t models.Transaction
+		if err := json.Unmarshal(e.Data, &t); err != nil {
+			return
+		}
+		if old, ok := x.docs[t.ID]; ok && e.Type == models.EventTransactionUpdated {
+			t.Date, t.Status, t.RefundOf, t.Refunded = old.transaction.Date, old.transaction.Status, old.transaction.RefundOf, old.transaction.Refunded
+		}
+		if t.Date.IsZero() {
+			t.Date = e.OccurredAt
+		}
+		x.put(t)
+	case models.EventTransactionStatusChanged:
+		var transition models.StatusTransition
+		if err := json.Unmarshal(e.Data, &transition); err != nil {
+			return
+		}
+		if doc, ok := x.docs[transition.TransactionID]; ok {
+			doc.transaction.Status = transition.To
+		}
+	case models.EventTransactionDeleted:
+		var deleted struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(e.Data, &deleted); err != nil {
+			return
+		}
+		x.remove(deleted.ID)
+	}
+}
+
+// matches applies filter to t as filterConditions does in SQL.
+func matches(filter models.TransactionFilter, t models.Transaction) bool {
+	switch {
+	case filter.UserID != nil && t.UserID != *filter.UserID,
+		filter.AccountID != nil && (t.AccountID == nil || *t.AccountID != *filter.AccountID),
+		filter.Currency != "" && t.Currency != filter.Currency,
+		filter.TransactionType != "" && t.TransactionType != filter.TransactionType,
+		filter.Status != "" && t.Status != filter.Status,
+		filter.From != nil && t.Date.Before(*filter.From),
+		filter.To != nil && !t.Date.Before(*filter.To):
+		return false
+	}
+	if filter.Category != "" && t.Category != filter.Category {
+		found := false
+		for _, split := range t.Splits {
+			found = found || split.Category == filter.Category
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, tag := range filter.Tags {
+		found := false
+		for _, have := range t.Tags {
+			found = found || have == tag
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// documentWords lists the distinct words of the description, category and
+// tags of t.
+func documentWords(t models.Transaction) []string {
+	return uniqueWords(strings.Join(append([]string{t.Description, t.Category}, t.Tags...), " "))
+}
+
+// uniqueWords splits text into distinct lowercase words of letters and
+// digits, in order.
+func uniqueWords(text string) []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// trigrams returns the trigrams of word padded as pg_trgm does, with two
+// spaces before and one after.
+func trigrams(word string) map[string]struct{} {
+	runes := []rune("  " + word + " ")
+	grams := make(map[string]struct{}, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = struct{}{}
+	}
+	return grams
+}
+
+// similarity is the share of trigrams two words have in common.
+func similarity(a, b map[string]struct{}) float64 {
+	shared := 0
+	for gram := range a {
+		if _, ok := b[gram]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/stream"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(results []models.SearchResult) []int {
+	out := []int{}
+	for _, r := range results {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	ctx := context.Background()
+	march := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	index := NewMemoryIndex(0.4)
+	index.Load([]models.Transaction{
+		{ID: 1, UserID: 1, Currency: "RUB", Description: "Такси в аэропорт", Category: "transport", Date: march},
+		{ID: 2, UserID: 1, Currency: "RUB", Description: "Ужин", Category: "food", Tags: []string{"business-trip"}, Date: march.AddDate(0, 0, 1)},
+		{ID: 3, UserID: 2, Currency: "USD", Description: "Taxi ride downtown", Category: "transport", Date: march.AddDate(0, 0, 2)},
+		{ID: 4, UserID: 1, Currency: "RUB", Description: "Продукты", Category: "groceries",
+			Splits: []models.Split{{Category: "household", Amount: 5}}, Date: march.AddDate(0, 1, 0)},
+	})
+
+	t.Run("words, prefixes and typos", func(t *testing.T) {
+		results, err := index.Search(ctx, "такси", models.TransactionFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, ids(results))
+
+		results, err = index.Search(ctx, "taxy", models.TransactionFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []int{3}, ids(results))
+
+		results, err = index.Search(ctx, "busin", models.TransactionFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []int{2}, ids(results))
+	})
+
+	t.Run("ranked by how many words match and how well", func(t *testing.T) {
+		results, err := index.Search(ctx, "taxi transport", models.TransactionFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 1}, ids(results))
+		assert.Greater(t, results[0].Rank, results[1].Rank)
+	})
+
+	t.Run("filters and pages", func(t *testing.T) {
+		userID := 1
+		results, err := index.Search(ctx, "transport", models.TransactionFilter{UserID: &userID})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, ids(results))
+
+		results, err = index.Search(ctx, "продукты", models.TransactionFilter{Category: "household"})
+		require.NoError(t, err)
+		assert.Equal(t, []int{4}, ids(results))
+
+		results, err = index.Search(ctx, "transport", models.TransactionFilter{Limit: 1, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, ids(results), "ties go newest first")
+
+		results, err = index.Search(ctx, "transport", models.TransactionFilter{Offset: 5})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+}
+
+func TestMemoryIndexFollowsEvents(t *testing.T) {
+	index := NewMemoryIndex(0.4)
+	index.Load([]models.Transaction{{ID: 1, UserID: 1, Description: "Coffee", Status: models.StatusPending, Tags: []string{"office"}}})
+
+	event := func(eventType string, data interface{}) models.Event {
+		payload, err := json.Marshal(data)
+		require.NoError(t, err)
+		return models.Event{Type: eventType, OccurredAt: time.Now(), Data: payload}
+	}
+	index.apply(event(models.EventTransactionCreated, models.Transaction{ID: 2, UserID: 1, Description: "Taxi"}))
+	index.apply(event(models.EventTransactionUpdated, models.Transaction{ID: 1, UserID: 1, Description: "Coffee beans", Tags: []string{"office"}}))
+	index.apply(event(models.EventTransactionStatusChanged, models.StatusTransition{TransactionID: 1, From: models.StatusPending, To: models.StatusCompleted}))
+
+	results, err := index.Search(context.Background(), "beans", models.TransactionFilter{Status: models.StatusCompleted, Tags: []string{"office"}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, ids(results))
+	results, err = index.Search(context.Background(), "taxi", models.TransactionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, ids(results))
+	assert.False(t, results[0].Date.IsZero(), "a created transaction is dated by its event")
+
+	index.apply(event(models.EventTransactionDeleted, map[string]int64{"id": 2, "user_id": 1}))
+	results, err = index.Search(context.Background(), "taxi", models.TransactionFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestNew(t *testing.T) {
+	hub := stream.NewHub(stream.DefaultBufferSize)
+	defer hub.Close()
+
+	searcher, err := New(configs.SearchConfig{Backend: "postgres", Similarity: 0.4}, nil, hub)
+	require.NoError(t, err)
+	assert.IsType(t, &Postgres{}, searcher)
+
+	_, err = New(configs.SearchConfig{Backend: "elastic"}, nil, hub)
+	assert.ErrorContains(t, err, `unknown search backend "elastic"`)
+}
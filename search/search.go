@@ -0,0 +1,60 @@
+// Package search finds transactions by free text in their description,
+// category and tags, behind GET /transactions/search. The postgres searcher
+// runs in the database; the memory index keeps its own copy of the
+// transactions for databases without full-text search or pg_trgm.
+package search
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/stream"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Searcher finds the transactions matching filter that text describes, best
+// match first, honouring the Limit and Offset of filter.
+type Searcher interface {
+	Search(ctx context.Context, text string, filter models.TransactionFilter) ([]models.SearchResult, error)
+}
+
+// New builds the searcher of config.Backend. The memory index is loaded from
+// db and then kept current from hub until the hub is closed.
+func New(config configs.SearchConfig, db *sql.DB, hub *stream.Hub) (Searcher, error) {
+	switch config.Backend {
+	case "postgres", "":
+		return NewPostgres(db, config.Similarity), nil
+	case "memory":
+		index := NewMemoryIndex(config.Similarity)
+		go index.Follow(hub, db)
+		return index, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", config.Backend)
+	}
+}
+
+// Postgres searches with the tsvector and trigram indexes of the
+// transactions table.
+type Postgres struct {
+	db         *sql.DB
+	similarity float64
+}
+
+func NewPostgres(db *sql.DB, similarity float64) *Postgres {
+	return &Postgres{db: db, similarity: similarity}
+}
+
+func (p *Postgres) Search(ctx context.Context, text string, filter models.TransactionFilter) ([]models.SearchResult, error) {
+	var results []models.SearchResult
+	err := repo.InTx(ctx, p.db, func(tx *sql.Tx) error {
+		if err := repo.SetSimilarityThreshold(ctx, p.similarity, tx); err != nil {
+			return err
+		}
+		var err error
+		results, err = repo.SearchTransactions(ctx, text, filter, tx)
+		return err
+	})
+	return results, err
+}
@@ -0,0 +1,299 @@
+// Package seed generates reproducible demo data: users, accounts and
+// transactions with realistic mixes of types, currencies, amounts and dates,
+// plus the commissions the current rules charge on them. The same Options
+// always produce the same Dataset, and Dataset.Totals holds the figures a
+// report over the loaded data must show.
+package seed
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options controls what Generate produces.
+type Options struct {
+	Seed         int64
+	Users        int
+	Transactions int
+	// From is inclusive and To exclusive. They default to calendar 2024 rather
+	// than to the current date so that a seed means the same data every day.
+	From time.Time
+	To   time.Time
+}
+
+// DefaultOptions is a small dataset that still exercises pagination and every
+// commission rule.
+func DefaultOptions() Options {
+	return Options{
+		Seed:         1,
+		Users:        20,
+		Transactions: 1000,
+		From:         time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:           time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (o Options) validate() error {
+	switch {
+	case o.Users < 1:
+		return errors.New("at least one user is needed")
+	case o.Transactions < 0:
+		return errors.New("the transaction count cannot be negative")
+	case !o.From.Before(o.To):
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// Dataset is generated data before it is stored. IDs are positions: User.ID
+// 1 is Users[0], and every UserID, AccountID and TransactionID refers to those
+// positions until Load maps them to database IDs. Transactions are ordered by
+// date, so database IDs grow with time like real traffic.
+type Dataset struct {
+	Users        []models.User
+	Accounts     []models.Account
+	Transactions []models.Transaction
+	Commissions  []models.Commission
+	// Totals per currency and type, ordered like the report command.
+	Totals []models.TransactionSummary
+}
+
+type weighted[T any] struct {
+	value  T
+	weight int
+}
+
+func pick[T any](r *rand.Rand, choices []weighted[T]) T {
+	total := 0
+	for _, c := range choices {
+		total += c.weight
+	}
+	n := r.Intn(total)
+	for _, c := range choices {
+		if n < c.weight {
+			return c.value
+		}
+		n -= c.weight
+	}
+	return choices[len(choices)-1].value
+}
+
+var (
+	typeWeights = []weighted[string]{
+		{models.TransactionTypePurchase, 60},
+		{models.TransactionTypeTransfer, 25},
+		{models.TransactionTypeTopUp, 15},
+	}
+	currencyWeights = []weighted[string]{
+		{"RUB", 50},
+		{"USD", 30},
+		{"EUR", 20},
+	}
+
+	// Typical amount per type in USD; actual amounts are log-normally spread
+	// around it, so most are modest and a few are large.
+	medianUSD = map[string]float64{
+		models.TransactionTypePurchase: 25,
+		models.TransactionTypeTransfer: 150,
+		models.TransactionTypeTopUp:    500,
+	}
+	// Rough units per USD, fixed so generation never depends on live rates.
+	unitsPerUSD = map[string]float64{"USD": 1, "EUR": 0.9, "RUB": 90}
+
+	categories = map[string][]string{
+		models.TransactionTypePurchase: {"groceries", "restaurants", "transport", "entertainment", "utilities", "health", "clothing"},
+		models.TransactionTypeTransfer: {"family", "friends", "rent", "savings"},
+		models.TransactionTypeTopUp:    {"salary", "cashback", "refund", "gift"},
+	}
+	accountNames = []string{"Main", "Savings", "Travel"}
+
+	firstNames = []string{"Anna", "Boris", "Daria", "Egor", "Irina", "Kirill", "Maria", "Nikita", "Olga", "Pavel", "Sofia", "Timur"}
+	lastNames  = []string{"Ivanov", "Smirnov", "Kuznetsov", "Popov", "Volkov", "Sokolov", "Lebedev", "Kozlov"}
+)
+
+// Generate builds the dataset for o. Commissions follow the rules currently
+// applied by service.Configure.
+func Generate(o Options) (*Dataset, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(o.Seed))
+	data := &Dataset{}
+
+	// Some users are far busier than others.
+	var activity []weighted[int]
+	accountsOf := make([][]models.Account, o.Users)
+	for i := 0; i < o.Users; i++ {
+		first, last := firstNames[r.Intn(len(firstNames))], lastNames[r.Intn(len(lastNames))]
+		user := models.User{
+			ID:    i + 1,
+			Name:  first + " " + last,
+			Email: fmt.Sprintf("%s.%s.%d@seed%d.example", strings.ToLower(first), strings.ToLower(last), i+1, o.Seed),
+		}
+		data.Users = append(data.Users, user)
+		activity = append(activity, weighted[int]{i, 1 + r.Intn(10)})
+
+		for j, n := 0, 1+r.Intn(len(accountNames)); j < n; j++ {
+			account := models.Account{
+				ID:       len(data.Accounts) + 1,
+				UserID:   user.ID,
+				Name:     accountNames[j],
+				Currency: pick(r, currencyWeights),
+			}
+			data.Accounts = append(data.Accounts, account)
+			accountsOf[i] = append(accountsOf[i], account)
+		}
+	}
+
+	days := int(o.To.Sub(o.From) / (24 * time.Hour))
+	for i := 0; i < o.Transactions; i++ {
+		user := pick(r, activity)
+		transactionType := pick(r, typeWeights)
+		transaction := models.Transaction{
+			UserID:          user + 1,
+			TransactionType: transactionType,
+			Category:        categories[transactionType][r.Intn(len(categories[transactionType]))],
+			Description:     fmt.Sprintf("seed %d", o.Seed),
+			Date:            randomTime(r, o.From, o.To, days),
+		}
+		// Most payments go through an account; the rest are ad hoc.
+		if r.Intn(10) < 9 {
+			account := accountsOf[user][r.Intn(len(accountsOf[user]))]
+			accountID := account.ID
+			transaction.AccountID = &accountID
+			transaction.Currency = account.Currency
+		} else {
+			transaction.Currency = pick(r, currencyWeights)
+		}
+		transaction.Amount = randomAmount(r, transactionType, transaction.Currency)
+		data.Transactions = append(data.Transactions, transaction)
+	}
+
+	sort.SliceStable(data.Transactions, func(i, j int) bool {
+		return data.Transactions[i].Date.Before(data.Transactions[j].Date)
+	})
+	for i := range data.Transactions {
+		data.Transactions[i].ID = i + 1
+		if commission, ok := service.CommissionFor(data.Transactions[i]); ok {
+			commission.Date = data.Transactions[i].Date.Format("2006-01-02")
+			data.Commissions = append(data.Commissions, commission)
+		}
+	}
+	data.Totals = totals(data)
+	return data, nil
+}
+
+// randomTime returns a daytime moment on a uniformly chosen day.
+func randomTime(r *rand.Rand, from, to time.Time, days int) time.Time {
+	if days < 1 {
+		return from.Add(time.Duration(r.Int63n(int64(to.Sub(from)))))
+	}
+	t := from.AddDate(0, 0, r.Intn(days)).
+		Add(time.Duration(8+r.Intn(14))*time.Hour + time.Duration(r.Intn(60))*time.Minute + time.Duration(r.Intn(60))*time.Second)
+	if !t.Before(to) {
+		t = to.Add(-time.Second)
+	}
+	return t
+}
+
+func randomAmount(r *rand.Rand, transactionType, currency string) float64 {
+	amount := medianUSD[transactionType] * unitsPerUSD[currency] * math.Exp(0.9*r.NormFloat64())
+	if transactionType == models.TransactionTypeTopUp {
+		amount = math.Round(amount)
+	} else {
+		amount = math.Round(amount*100) / 100
+	}
+	return math.Min(math.Max(amount, 1), models.MaxTransactionAmount)
+}
+
+func totals(data *Dataset) []models.TransactionSummary {
+	type key struct{ currency, transactionType string }
+	sums := map[key]*models.TransactionSummary{}
+	byTransaction := map[int]float64{}
+	for _, c := range data.Commissions {
+		byTransaction[c.TransactionID] = c.Commission
+	}
+	for _, t := range data.Transactions {
+		k := key{t.Currency, t.TransactionType}
+		s, ok := sums[k]
+		if !ok {
+			s = &models.TransactionSummary{Currency: t.Currency, TransactionType: t.TransactionType}
+			sums[k] = s
+		}
+		s.Count++
+		s.Amount += t.Amount
+		s.Commission += byTransaction[t.ID]
+	}
+
+	list := make([]models.TransactionSummary, 0, len(sums))
+	for _, s := range sums {
+		s.Amount = math.Round(s.Amount*100) / 100
+		s.Commission = math.Round(s.Commission*100) / 100
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Currency != list[j].Currency {
+			return list[i].Currency < list[j].Currency
+		}
+		return list[i].TransactionType < list[j].TransactionType
+	})
+	return list
+}
+
+// Load stores data in one database transaction, so a failed seed leaves
+// nothing behind. Every user gets passwordHash. Seeding the same seed twice
+// fails with repo.ErrConflict on the user emails.
+func Load(ctx context.Context, db *sql.DB, data *Dataset, passwordHash string) error {
+	return repo.InTx(ctx, db, func(tx *sql.Tx) error {
+		userIDs := make([]int, len(data.Users)+1)
+		for _, user := range data.Users {
+			id, err := repo.CreateUser(ctx, user, passwordHash, tx)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", user.Email, err)
+			}
+			userIDs[user.ID] = id
+		}
+
+		accountIDs := make([]int, len(data.Accounts)+1)
+		for _, account := range data.Accounts {
+			account.UserID = userIDs[account.UserID]
+			id, err := repo.CreateAccount(ctx, account, tx)
+			if err != nil {
+				return err
+			}
+			accountIDs[account.ID] = id
+		}
+
+		transactionIDs := make([]int, len(data.Transactions)+1)
+		for _, transaction := range data.Transactions {
+			transaction.UserID = userIDs[transaction.UserID]
+			if transaction.AccountID != nil {
+				accountID := accountIDs[*transaction.AccountID]
+				transaction.AccountID = &accountID
+			}
+			id, err := repo.CreateDatedTransaction(ctx, transaction, tx)
+			if err != nil {
+				return err
+			}
+			transactionIDs[transaction.ID] = id
+		}
+
+		for _, commission := range data.Commissions {
+			commission.TransactionID = transactionIDs[commission.TransactionID]
+			if err := repo.CreateCommission(ctx, tx, commission); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package seed
+
+import (
+	"DZ_ITOG/models"
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	options := DefaultOptions()
+	first, err := Generate(options)
+	require.NoError(t, err)
+	second, err := Generate(options)
+	require.NoError(t, err)
+	assert.True(t, reflect.DeepEqual(first, second), "the same options must give the same data")
+
+	options.Seed = 2
+	other, err := Generate(options)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Transactions, other.Transactions)
+	assert.NotEqual(t, first.Users[0].Email, other.Users[0].Email, "seeds must not collide on email")
+}
+
+func TestGenerateDistributions(t *testing.T) {
+	options := DefaultOptions()
+	options.Transactions = 5000
+	data, err := Generate(options)
+	require.NoError(t, err)
+	require.Len(t, data.Transactions, 5000)
+
+	types := map[string]int{}
+	for i, transaction := range data.Transactions {
+		types[transaction.TransactionType]++
+		assert.Equal(t, i+1, transaction.ID)
+		assert.False(t, transaction.Date.Before(options.From) || !transaction.Date.Before(options.To), "date %s out of range", transaction.Date)
+		if i > 0 {
+			assert.False(t, transaction.Date.Before(data.Transactions[i-1].Date), "transactions must be ordered by date")
+		}
+		assert.GreaterOrEqual(t, transaction.Amount, 1.0)
+		assert.Equal(t, transaction.Amount, math.Round(transaction.Amount*100)/100)
+		if transaction.AccountID != nil {
+			account := data.Accounts[*transaction.AccountID-1]
+			assert.Equal(t, transaction.UserID, account.UserID)
+			assert.Equal(t, transaction.Currency, account.Currency)
+		}
+	}
+	assert.InDelta(t, 0.60, float64(types[models.TransactionTypePurchase])/5000, 0.03)
+	assert.InDelta(t, 0.25, float64(types[models.TransactionTypeTransfer])/5000, 0.03)
+	assert.InDelta(t, 0.15, float64(types[models.TransactionTypeTopUp])/5000, 0.03)
+}
+
+func TestGenerateCommissionsAndTotals(t *testing.T) {
+	data, err := Generate(DefaultOptions())
+	require.NoError(t, err)
+
+	// The default rules charge transfers in USD and RUB only.
+	charged := map[int]bool{}
+	for _, commission := range data.Commissions {
+		transaction := data.Transactions[commission.TransactionID-1]
+		assert.Equal(t, models.TransactionTypeTransfer, transaction.TransactionType)
+		assert.Contains(t, []string{"USD", "RUB"}, transaction.Currency)
+		assert.Equal(t, transaction.Date.Format("2006-01-02"), commission.Date)
+		charged[transaction.ID] = true
+	}
+	for _, transaction := range data.Transactions {
+		if transaction.TransactionType == models.TransactionTypeTransfer && transaction.Currency != "EUR" {
+			assert.True(t, charged[transaction.ID], "transaction %d should be charged", transaction.ID)
+		}
+	}
+
+	count, commission := 0, 0.0
+	for _, total := range data.Totals {
+		count += total.Count
+		commission += total.Commission
+	}
+	assert.Equal(t, len(data.Transactions), count)
+	sum := 0.0
+	for _, c := range data.Commissions {
+		sum += c.Commission
+	}
+	assert.InDelta(t, sum, commission, 0.01*float64(len(data.Totals)))
+}
+
+func TestGenerateRejectsBadOptions(t *testing.T) {
+	options := DefaultOptions()
+	options.Users = 0
+	_, err := Generate(options)
+	assert.Error(t, err)
+
+	options = DefaultOptions()
+	options.To = options.From
+	_, err = Generate(options)
+	assert.Error(t, err)
+}
+
+func TestLoadMapsIDs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	accountID := 1
+	data := &Dataset{
+		Users:    []models.User{{ID: 1, Name: "Anna Popov", Email: "anna@seed1.example"}},
+		Accounts: []models.Account{{ID: 1, UserID: 1, Name: "Main", Currency: "USD"}},
+		Transactions: []models.Transaction{
+			{ID: 1, UserID: 1, AccountID: &accountID, Amount: 100, Currency: "USD", TransactionType: models.TransactionTypeTransfer},
+		},
+		Commissions: []models.Commission{{TransactionID: 1, Amount: 100, Currency: "USD", TransactionType: models.TransactionTypeTransfer, Commission: 2}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO users`).WithArgs("Anna Popov", "anna@seed1.example", "hash").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(40))
+	mock.ExpectQuery(`INSERT INTO accounts`).WithArgs(40, "Main", "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"account_id"}).AddRow(70))
+	mock.ExpectQuery(`INSERT INTO transactions`).WithArgs(40, 100.0, "USD", models.TransactionTypeTransfer, "", sqlmock.AnyArg(), "", 70).
+		WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(900))
+	mock.ExpectExec(`INSERT INTO commissions`).WithArgs(900, 100.0, "USD", models.TransactionTypeTransfer, 2.0, "", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, Load(context.Background(), db, data, "hash"))
+	require.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, *data.Transactions[0].AccountID, "the dataset itself is left untouched")
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/ratelimit"
+	"DZ_ITOG/service"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the alternative to "Authorization: Bearer <key>" for
+// clients that reserve the Authorization header for something else.
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware authenticates the API key sent with the request, if any,
+// and records it and its user's roles as the caller. Requests without a key pass as anonymous;
+// handlers.RequireAPIKey turns them away where a key is needed. An invalid
+// key is always rejected, so a client with a revoked key notices instead of
+// silently falling back to anonymous access.
+// With a limiter, every invalid key spends a token of the client IP's
+// bucket, and keys sent from an IP whose bucket is empty are answered 429
+// without being looked up, so keys cannot be guessed faster than the per-IP
+// limit.
+func AuthMiddleware(db *sql.DB, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	keys := service.NewAPIKeyService(db)
+	return func(c *gin.Context) {
+		secret := requestAPIKey(c)
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		if limiter != nil {
+			if decision := limiter.Peek(c.Request.Context(), ratelimit.ClassIP, c.ClientIP()); !decision.Allowed {
+				abortRateLimited(c, decision)
+				return
+			}
+		}
+		key, err := keys.Authenticate(c.Request.Context(), secret)
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			if limiter != nil {
+				limiter.Take(c.Request.Context(), ratelimit.ClassIP, c.ClientIP())
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			_ = c.Error(&handlers.APIError{Code: handlers.CodeUnauthenticated, Detail: "The API key is unknown, expired or revoked.", Err: err})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		principal, err := policy.Load(c.Request.Context(), db, key)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		handlers.SetAPIKey(c, key)
+		handlers.SetPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	const bearer = "Bearer "
+	if header := c.GetHeader("Authorization"); len(header) > len(bearer) && strings.EqualFold(header[:len(bearer)], bearer) {
+		return strings.TrimSpace(header[len(bearer):])
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/models"
+	"DZ_ITOG/ratelimit"
+	"DZ_ITOG/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := newEngine(nil)
+	router.Use(AuthMiddleware(db, nil))
+	router.GET("/read", handlers.RequireScope(models.ScopeTransactionsRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": c.GetInt(handlers.ContextUserID), "key": c.GetInt(handlers.ContextAPIKeyID)})
+	})
+	router.POST("/write", handlers.RequireScope(models.ScopeTransactionsWrite), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/keyed", handlers.RequireAPIKey, func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin", handlers.RequireRole(models.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const secret = "dzk_00000000_secret"
+	expectKeyWithRoles := func(scopes, roles, permissions string) {
+		mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WithArgs(service.HashAPIKey(secret)).
+			WillReturnRows(sqlmock.NewRows([]string{"api_key_id", "user_id", "name", "prefix", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}).
+				AddRow(3, 7, "batch", "dzk_00000000", scopes, time.Now(), nil, nil, nil))
+		mock.ExpectExec(`UPDATE api_keys SET last_used_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM user_roles`).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"roles", "permissions"}).AddRow(roles, permissions))
+	}
+	expectKey := func(scopes string) {
+		expectKeyWithRoles(scopes, "{customer}", "{transactions.amounts,transactions.read.own,transactions.write.own}")
+	}
+	serve := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		for name, values := range header {
+			req.Header.Set(name, values[0])
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("bearer key with scope", func(t *testing.T) {
+		expectKey("{transactions:read}")
+		w := serve(http.MethodGet, "/read", http.Header{"Authorization": {"Bearer " + secret}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"user":7,"key":3}`, w.Body.String())
+	})
+
+	t.Run("header key without scope", func(t *testing.T) {
+		expectKey("{transactions:read}")
+		w := serve(http.MethodPost, "/write", http.Header{APIKeyHeader: {secret}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"forbidden"`)
+	})
+
+	t.Run("admin implies every scope", func(t *testing.T) {
+		expectKey("{admin}")
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/write", http.Header{APIKeyHeader: {secret}}).Code)
+	})
+
+	t.Run("role required", func(t *testing.T) {
+		expectKey("{admin}")
+		w := serve(http.MethodGet, "/admin", http.Header{APIKeyHeader: {secret}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "admin role")
+
+		expectKeyWithRoles("{admin}", "{admin}", "{audit.read}")
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/admin", http.Header{APIKeyHeader: {secret}}).Code)
+	})
+
+	t.Run("user without roles is a customer", func(t *testing.T) {
+		expectKeyWithRoles("{transactions:read}", "{}", "{}")
+		mock.ExpectQuery(`FROM role_permissions WHERE role`).WithArgs(models.RoleCustomer).
+			WillReturnRows(sqlmock.NewRows([]string{"permissions"}).AddRow("{transactions.read.own}"))
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/read", http.Header{APIKeyHeader: {secret}}).Code)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WillReturnRows(sqlmock.NewRows(nil))
+		w := serve(http.MethodGet, "/read", http.Header{"Authorization": {"Bearer " + secret}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+		assert.Contains(t, w.Body.String(), `"code":"unauthenticated"`)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/read", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/keyed", nil).Code)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvalidKeysAreRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassIP: {Requests: 60, Per: time.Minute, Burst: 2},
+	})
+	router := newEngine(nil)
+	router.Use(AuthMiddleware(db, limiter))
+	router.GET("/read", func(c *gin.Context) { c.Status(http.StatusOK) })
+	guess := func(secret, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/read", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set(APIKeyHeader, secret)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WillReturnRows(sqlmock.NewRows([]string{"api_key_id"}))
+		assert.Equal(t, http.StatusUnauthorized, guess("dzk_00000000_guess", "192.0.2.1").Code)
+	}
+	w := guess("dzk_00000000_guess", "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the key is not looked up once the IP's bucket is empty")
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"rate-limited"`)
+	assert.Equal(t, http.StatusOK, guess("", "192.0.2.1").Code, "the IP's anonymous requests are limited by RateLimitMiddleware, not here")
+
+	mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WillReturnRows(sqlmock.NewRows([]string{"api_key_id"}))
+	assert.Equal(t, http.StatusUnauthorized, guess("dzk_00000000_guess", "192.0.2.2").Code, "other IPs keep their own bucket")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeniedRequestsAreAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	router := newEngine(nil)
+	router.Use(DatabaseMiddleware(db), AuthMiddleware(db, nil))
+	router.GET("/admin/audit", handlers.RequireAPIKey, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(nil, nil, "GET /admin/audit", "/admin/audit", models.AuditDenied, "An API key is required.", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/audit", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"DZ_ITOG/api"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/service"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+func init() {
+	// The GraphiQL page is the only HTML response; check it as an opaque string.
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+}
+
+// TestSpecCoversEveryRoute fails when a route is added without documenting it.
+func TestSpecCoversEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spec, err := api.Spec()
+	require.NoError(t, err)
+
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, route := range NewRouter(db, testReloader(t), true).Routes() {
+		if strings.HasPrefix(route.Path, "/docs") {
+			continue // Swagger UI assets
+		}
+		if route.Path == "/item" && route.Method != http.MethodGet && route.Method != http.MethodPost {
+			continue // the legacy handler answers 405 to every other method
+		}
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+		item := spec.Paths.Find(path)
+		if !assert.NotNil(t, item, "route %s %s is not in the spec", route.Method, route.Path) {
+			continue
+		}
+		assert.NotNil(t, item.GetOperation(route.Method), "route %s %s is not in the spec", route.Method, route.Path)
+	}
+}
+
+// TestHandlersMatchSpec replays representative requests against the real
+// router and validates both request and response against the spec.
+func TestHandlersMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spec, err := api.Spec()
+	require.NoError(t, err)
+	specRouter, err := legacy.NewRouter(spec)
+	require.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	originalFetch, originalCheck := service.FetchCurrencyRates, service.CheckRateProvider
+	defer func() { service.FetchCurrencyRates, service.CheckRateProvider = originalFetch, originalCheck }()
+	service.FetchCurrencyRates = func(ctx context.Context, base string) (models.CurrencyRates, error) {
+		if base == "GBP" {
+			return models.CurrencyRates{}, errors.New("provider down")
+		}
+		return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.5}}, nil
+	}
+	service.CheckRateProvider = func(ctx context.Context) error { return nil }
+
+	router := NewRouter(db, testReloader(t), true)
+
+	accountID := 4
+	transaction := func(currency string) models.Transaction {
+		return models.Transaction{ID: 1, UserID: 10, Amount: 100.5, Currency: currency, TransactionType: "перевод", Category: "business",
+			Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Description: "Test", AccountID: &accountID}
+	}
+	transactionRow := func(currency string) *sqlmock.Rows {
+		return repotest.TransactionRows(transaction(currency))
+	}
+	userExists := func() {
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	}
+	expectAudit := func() {
+		mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	validTransaction := `{"user_id":1,"amount":100,"currency":"USD","transaction_type":"перевод","category":"test"}`
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		body        string
+		setupMock   func()
+		status      int
+	}{
+		{"list transactions", http.MethodGet, "/transactions", "", func() {
+			mock.ExpectQuery(`FROM transactions`).WillReturnRows(transactionRow("USD"))
+		}, http.StatusOK},
+		{"list no transactions", http.MethodGet, "/transactions", "", func() {
+			mock.ExpectQuery(`FROM transactions`).WillReturnRows(repotest.TransactionRows())
+		}, http.StatusOK},
+		{"create transaction with commission", http.MethodPost, "/transactions", validTransaction, func() {
+			mock.ExpectBegin()
+			userExists()
+			mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(1))
+			mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`INSERT INTO commissions`).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		}, http.StatusCreated},
+		{"create transaction without commission", http.MethodPost, "/transactions", `{"user_id":1,"amount":100,"currency":"EUR","transaction_type":"покупка"}`, func() {
+			mock.ExpectBegin()
+			userExists()
+			mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(2))
+			mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		}, http.StatusCreated},
+		{"create invalid transaction", http.MethodPost, "/transactions", `{"user_id":1,"amount":-1,"currency":"USD","transaction_type":"перевод"}`, func() {}, http.StatusUnprocessableEntity},
+		{"get transaction", http.MethodGet, "/transactions/1", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+		}, http.StatusOK},
+		{"get converted transaction", http.MethodGet, "/transactions/1?currency=EUR", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+		}, http.StatusOK},
+		{"get transaction with unknown currency", http.MethodGet, "/transactions/1?currency=XYZ", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+		}, http.StatusBadRequest},
+		{"get transaction while rates are down", http.MethodGet, "/transactions/1?currency=EUR", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("GBP"))
+		}, http.StatusServiceUnavailable},
+		{"get missing transaction", http.MethodGet, "/transactions/9", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(9).WillReturnError(sql.ErrNoRows)
+		}, http.StatusNotFound},
+		{"update transaction", http.MethodPut, "/transactions/1", validTransaction, func() {
+			mock.ExpectBegin()
+			userExists()
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectExec(`UPDATE transactions`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		}, http.StatusOK},
+		{"delete transaction", http.MethodDelete, "/transactions/1", "", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(`DELETE FROM attachments`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+			mock.ExpectQuery(`DELETE FROM transactions`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		}, http.StatusOK},
+		{"delete missing transaction", http.MethodDelete, "/transactions/9", "", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery(`DELETE FROM attachments`).WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+			mock.ExpectQuery(`DELETE FROM transactions`).WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			mock.ExpectRollback()
+		}, http.StatusNotFound},
+		{"transaction transitions", http.MethodGet, "/transactions/1/transitions", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectQuery(`FROM transaction_transitions`).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"transition_id", "transaction_id", "from_status", "to_status", "reason", "actor", "occurred_at"}).
+					AddRow(1, 1, "pending", "completed", "", 7, time.Now()))
+		}, http.StatusOK},
+		{"transaction notes", http.MethodGet, "/transactions/1/notes", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectQuery(`FROM transaction_notes`).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"note_id", "transaction_id", "author", "body", "created_at"}).
+					AddRow(1, 1, nil, "Receipt is in the mail", time.Now()))
+		}, http.StatusOK},
+		{"add a note", http.MethodPost, "/transactions/1/notes", `{"body":"Reimbursed by work"}`, func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectQuery(`INSERT INTO transaction_notes`).WithArgs(1, nil, "Reimbursed by work").
+				WillReturnRows(sqlmock.NewRows([]string{"note_id", "created_at"}).AddRow(2, time.Now()))
+		}, http.StatusCreated},
+		{"transaction attachments", http.MethodGet, "/transactions/1/attachments", "", func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectQuery(`FROM attachments WHERE transaction_id`).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"attachment_id", "transaction_id", "file_name", "content_type", "size", "uploaded_by", "created_at", "storage_key"}).
+					AddRow(3, 1, "receipt.pdf", "application/pdf", 2048, 7, time.Now(), "0123abcd"))
+		}, http.StatusOK},
+		{"transactions by tag", http.MethodGet, "/transactions?tag=tax-deductible", "", func() {
+			mock.ExpectQuery(`g.name = \$1`).WithArgs("tax-deductible").WillReturnRows(transactionRow("USD"))
+		}, http.StatusOK},
+		{"search transactions", http.MethodGet, "/transactions/search?q=такси&currency=USD&limit=5", "", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec(`set_config\('pg_trgm.word_similarity_threshold'`).WithArgs("0.4").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`websearch_to_tsquery`).WithArgs("USD", "такси", 5).WillReturnRows(
+				sqlmock.NewRows(append(repotest.TransactionColumns, "rank")).
+					AddRow(append(repotest.TransactionValues(transaction("USD")), 0.6)...))
+			mock.ExpectCommit()
+		}, http.StatusOK},
+		{"search without text", http.MethodGet, "/transactions/search?q=+", "", func() {}, http.StatusBadRequest},
+		{"graphql query", http.MethodPost, "/graphql", `{"query":"{ transaction(id: 1) { id amount user { name } } }"}`, func() {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id`).WithArgs(1).WillReturnRows(transactionRow("USD"))
+			mock.ExpectQuery(`FROM users WHERE user_id = ANY`).WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email"}).AddRow(10, "Ann", "ann@example.com"))
+		}, http.StatusOK},
+		{"graphql invalid query", http.MethodPost, "/graphql", `{"query":"{ transaction(id: 1) { nope } }"}`, func() {}, http.StatusUnprocessableEntity},
+		{"graphql playground", http.MethodGet, "/graphql", "", func() {}, http.StatusOK},
+		{"list items", http.MethodGet, "/items", "", func() {
+			mock.ExpectQuery(`FROM items`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}).AddRow("1", "one"))
+		}, http.StatusOK},
+		{"create item", http.MethodPost, "/items", `{"id":"2","value":"two"}`, func() {
+			mock.ExpectExec(`INSERT INTO items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, http.StatusCreated},
+		{"create duplicate item", http.MethodPost, "/items", `{"id":"2","value":"two"}`, func() {
+			mock.ExpectExec(`INSERT INTO items`).WillReturnError(&pq.Error{Code: "23505"})
+		}, http.StatusConflict},
+		{"get item", http.MethodGet, "/items/1", "", func() {
+			mock.ExpectQuery(`FROM items WHERE item_id`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}).AddRow("1", "one"))
+		}, http.StatusOK},
+		{"update item", http.MethodPut, "/items/1", `{"id":"1","value":"uno"}`, func() {
+			mock.ExpectExec(`UPDATE items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, http.StatusOK},
+		{"delete item", http.MethodDelete, "/items/1", "", func() {
+			mock.ExpectExec(`DELETE FROM items`).WillReturnResult(sqlmock.NewResult(0, 1))
+		}, http.StatusOK},
+		{"legacy item lookup", http.MethodGet, "/item?id=1", "", func() {
+			mock.ExpectQuery(`FROM items WHERE item_id`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}).AddRow("1", "one"))
+		}, http.StatusOK},
+		{"legacy item list", http.MethodGet, "/item", "", func() {
+			mock.ExpectQuery(`FROM items`).WillReturnRows(sqlmock.NewRows([]string{"item_id", "value"}))
+		}, http.StatusOK},
+		{"healthz", http.MethodGet, "/healthz", "", func() {}, http.StatusOK},
+		{"readyz", http.MethodGet, "/readyz", "", func() {
+			mock.ExpectPing()
+			for range repo.RequiredTables() {
+				mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("t"))
+			}
+		}, http.StatusOK},
+		{"readyz without database", http.MethodGet, "/readyz", "", func() {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}, http.StatusServiceUnavailable},
+		{"transaction report", http.MethodGet, "/reports/transactions?currency=USD&from=2024-01-01", "", func() {
+			mock.ExpectQuery(`GROUP BY currency, transaction_type`).
+				WillReturnRows(sqlmock.NewRows([]string{"currency", "transaction_type", "count", "amount", "commission"}).AddRow("USD", "перевод", 2, 150.0, 3.0))
+		}, http.StatusOK},
+		{"report with a bad date", http.MethodGet, "/reports/transactions?from=yesterday", "", func() {}, http.StatusBadRequest},
+		{"category report", http.MethodGet, "/reports/categories?currency=USD&category=food", "", func() {
+			mock.ExpectQuery(`LEFT JOIN transaction_splits`).WithArgs("USD", "food").
+				WillReturnRows(sqlmock.NewRows([]string{"currency", "category", "count", "amount"}).AddRow("USD", "food", 3, 42.5))
+		}, http.StatusOK},
+		{"list API keys without a key", http.MethodGet, "/api-keys", "", expectAudit, http.StatusUnauthorized},
+		{"config version without a key", http.MethodGet, "/admin/config/version", "", expectAudit, http.StatusUnauthorized},
+		{"audit log without a key", http.MethodGet, "/admin/audit", "", expectAudit, http.StatusUnauthorized},
+		{"webhooks without a key", http.MethodGet, "/admin/webhooks", "", expectAudit, http.StatusUnauthorized},
+		{"review queue without a key", http.MethodGet, "/reviews", "", expectAudit, http.StatusUnauthorized},
+		{"reverse without a key", http.MethodPost, "/transactions/1/reverse", "", expectAudit, http.StatusUnauthorized},
+		{"refund without a key", http.MethodPost, "/transactions/1/refund", "", expectAudit, http.StatusUnauthorized},
+		{"openapi", http.MethodGet, "/openapi.json", "", func() {}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.setupMock()
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, test.status, w.Code, w.Body.String())
+			require.NoError(t, mock.ExpectationsWereMet())
+			validateAgainstSpec(t, specRouter, test.method, test.path, test.body, w)
+		})
+	}
+}
+
+func validateAgainstSpec(t *testing.T, specRouter routers.Router, method, path, body string, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	route, pathParams, err := specRouter.FindRoute(req)
+	require.NoError(t, err)
+
+	// Invalid bodies are sent on purpose, so only responses are checked for
+	// them; every request the spec accepts must still validate.
+	requestInput := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			ExcludeRequestBody: w.Code == http.StatusUnprocessableEntity,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	require.NoError(t, openapi3filter.ValidateRequest(context.Background(), requestInput))
+
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestInput,
+		Status:                 w.Code,
+		Header:                 w.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	assert.NoError(t, openapi3filter.ValidateResponse(context.Background(), responseInput), w.Body.String())
+}
+
+func testReloader(t *testing.T) *configs.Reloader {
+	t.Helper()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	configs.RegisterFlags(flags)
+	require.NoError(t, flags.Parse([]string{"--config", "../config/config.yaml"}))
+	reloader, err := configs.NewReloader(flags, logging.Logger())
+	require.NoError(t, err)
+	return reloader
+}
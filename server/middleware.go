@@ -0,0 +1,70 @@
+package server
+
+import (
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/logging"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware reuses a well-formed incoming X-Request-ID or generates
+// one, echoes it in the response and stores it in the request context so
+// every log line of the request carries it.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware writes one structured line per request through the
+// shared logger, replacing gin's plain-text logger.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := logging.FromContext(c.Request.Context()).WithFields(logrus.Fields{
+			"method":      c.Request.Method,
+			"path":        c.Request.URL.Path,
+			"status":      c.Writer.Status(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"client_ip":   c.ClientIP(),
+		})
+		switch {
+		case c.Writer.Status() >= 500:
+			entry.Error("Request completed")
+		case c.Writer.Status() >= 400:
+			entry.Warn("Request completed")
+		default:
+			entry.Info("Request completed")
+		}
+	}
+}
+
+// newEngine returns a gin engine with recovery, request IDs, access logs and
+// problem+json error responses. Only requests from trustedProxies may set
+// their client IP with forwarding headers; with none, every request is
+// attributed to the address it came from.
+func newEngine(trustedProxies []string) *gin.Engine {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		// Validate rejects malformed entries; on error gin would keep its
+		// default of trusting every address.
+		logrus.WithError(err).Error("Invalid trusted proxies, trusting none")
+		_ = router.SetTrustedProxies(nil)
+	}
+	router.Use(RequestIDMiddleware(), AccessLogMiddleware(), gin.Recovery(), handlers.ErrorHandler())
+	return router
+}
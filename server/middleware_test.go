@@ -0,0 +1,81 @@
+package server
+
+import (
+	"DZ_ITOG/logging"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := test.NewLocal(logging.Logger())
+	defer hook.Reset()
+
+	router := newEngine(nil)
+	router.GET("/ping", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("handling")
+		c.String(http.StatusOK, "pong")
+	})
+
+	t.Run("generates an ID", func(t *testing.T) {
+		hook.Reset()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		router.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		require.Len(t, id, 32)
+		require.NotEmpty(t, hook.AllEntries())
+		for _, entry := range hook.AllEntries() {
+			assert.Equal(t, id, entry.Data["request_id"], entry.Message)
+		}
+	})
+
+	t.Run("keeps a valid incoming ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set(RequestIDHeader, "client-abc.1")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "client-abc.1", w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("replaces a malformed incoming ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+		router.ServeHTTP(w, req)
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+	})
+}
+
+func TestTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clientIP := func(router *gin.Engine, remoteAddr string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	route := func(router *gin.Engine) *gin.Engine {
+		router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		return router
+	}
+
+	untrusting := route(newEngine(nil))
+	assert.Equal(t, "192.0.2.1", clientIP(untrusting, "192.0.2.1:1234"), "forwarding headers are ignored by default")
+
+	behindProxy := route(newEngine([]string{"10.0.0.0/8"}))
+	assert.Equal(t, "203.0.113.9", clientIP(behindProxy, "10.1.2.3:1234"))
+	assert.Equal(t, "192.0.2.1", clientIP(behindProxy, "192.0.2.1:1234"), "only the listed proxies may forward")
+
+	malformed := route(newEngine([]string{"not-an-ip"}))
+	assert.Equal(t, "192.0.2.1", clientIP(malformed, "192.0.2.1:1234"))
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/ratelimit"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware spends one token of each of the caller's buckets and,
+// for currency conversions, one of the conversion quota. A request with an
+// API key spends from the bucket of the key and from that of its owner, so
+// extra keys do not raise a user's limit; one with only a user spends from
+// the user's bucket, and an anonymous one from its client IP's. Every
+// response carries the RateLimit headers of the tightest bucket; exhausted
+// buckets are answered with 429 rate-limited.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		var decision ratelimit.Decision
+		buckets := callerBuckets(c)
+		for i, bucket := range buckets {
+			taken := limiter.Take(ctx, bucket.class, bucket.caller)
+			if i == 0 || tighter(taken, decision) {
+				decision = taken
+			}
+			if !decision.Allowed {
+				break
+			}
+		}
+		if widest := buckets[len(buckets)-1]; decision.Allowed && isConversion(c) {
+			if conversion := limiter.Take(ctx, ratelimit.ClassConversion, string(widest.class)+":"+widest.caller); tighter(conversion, decision) {
+				decision = conversion
+			}
+		}
+
+		setRateLimitHeaders(c, decision)
+		if !decision.Allowed {
+			abortRateLimited(c, decision)
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortRateLimited answers 429 rate-limited with the headers of decision.
+func abortRateLimited(c *gin.Context, decision ratelimit.Decision) {
+	setRateLimitHeaders(c, decision)
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+	_ = c.Error(&handlers.APIError{
+		Code:   handlers.CodeRateLimited,
+		Detail: fmt.Sprintf("Rate limit exceeded, retry in %d seconds.", ceilSeconds(decision.RetryAfter)),
+	})
+	c.Abort()
+}
+
+// bucket names the bucket of a caller within a class.
+type bucket struct {
+	class  ratelimit.Class
+	caller string
+}
+
+// callerBuckets lists the buckets a request spends from, the narrowest
+// first: the API key and then its user, or the client IP alone. A key that
+// has run out stops there, without draining its user's other keys.
+func callerBuckets(c *gin.Context) []bucket {
+	var buckets []bucket
+	if id, ok := c.Get(handlers.ContextAPIKeyID); ok {
+		buckets = append(buckets, bucket{ratelimit.ClassAPIKey, fmt.Sprint(id)})
+	}
+	if id, ok := c.Get(handlers.ContextUserID); ok {
+		buckets = append(buckets, bucket{ratelimit.ClassUser, fmt.Sprint(id)})
+	}
+	if len(buckets) == 0 {
+		buckets = append(buckets, bucket{ratelimit.ClassIP, c.ClientIP()})
+	}
+	return buckets
+}
+
+// tighter reports whether a leaves the caller less room than b.
+func tighter(a, b ratelimit.Decision) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	return a.Remaining < b.Remaining
+}
+
+// isConversion reports whether the request converts an amount, which calls
+// the external rate providers and so has its own quota.
+func isConversion(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet && c.FullPath() == "/transactions/:id" && c.Query("currency") != ""
+}
+
+func setRateLimitHeaders(c *gin.Context, d ratelimit.Decision) {
+	c.Header("RateLimit-Limit", strconv.Itoa(d.Limit.Burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", d.Limit.Requests, ceilSeconds(d.Limit.Per), d.Limit.Burst))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassIP:         {Requests: 60, Per: time.Minute, Burst: 2},
+		ratelimit.ClassUser:       {Requests: 60, Per: time.Minute, Burst: 3},
+		ratelimit.ClassAPIKey:     {Requests: 60, Per: time.Minute, Burst: 2},
+		ratelimit.ClassConversion: {Requests: 1, Per: time.Hour, Burst: 1},
+	})
+	router := newEngine(nil)
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set(handlers.ContextUserID, user)
+		}
+		if key := c.GetHeader("X-Test-Key"); key != "" {
+			c.Set(handlers.ContextAPIKeyID, key)
+		}
+		c.Next()
+	}, RateLimitMiddleware(limiter))
+	router.GET("/transactions/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func get(router http.Handler, path, user string) *httptest.ResponseRecorder {
+	return getWithKey(router, path, user, "")
+}
+
+func getWithKey(router http.Handler, path, user, key string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	if key != "" {
+		req.Header.Set("X-Test-Key", key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	router := rateLimitedRouter()
+
+	w := get(router, "/transactions/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "60;w=60;burst=2", w.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, get(router, "/transactions/1", "").Code)
+	w = get(router, "/transactions/1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"rate-limited"`)
+
+	w = get(router, "/transactions/1", "42")
+	assert.Equal(t, http.StatusOK, w.Code, "an authenticated user has their own bucket")
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitMiddlewareAPIKeys(t *testing.T) {
+	router := rateLimitedRouter()
+
+	w := getWithKey(router, "/transactions/1", "42", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"), "the key's bucket is the tighter one")
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, getWithKey(router, "/transactions/1", "42", "1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, getWithKey(router, "/transactions/1", "42", "1").Code)
+
+	w = getWithKey(router, "/transactions/1", "42", "2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"), "the user's bucket is now the tighter one")
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, getWithKey(router, "/transactions/1", "42", "2").Code, "another key does not raise the user's limit")
+	assert.Equal(t, http.StatusTooManyRequests, get(router, "/transactions/1", "42").Code)
+}
+
+func TestRateLimitMiddlewareConversionQuota(t *testing.T) {
+	router := rateLimitedRouter()
+
+	w := get(router, "/transactions/1?currency=EUR", "42")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1;w=3600;burst=1", w.Header().Get("RateLimit-Policy"))
+
+	w = get(router, "/transactions/1?currency=EUR", "42")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get(router, "/transactions/1", "42").Code, "plain reads are not converted")
+	assert.Equal(t, http.StatusOK, get(router, "/transactions/1?currency=EUR", "7").Code, "quotas are per caller")
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"DZ_ITOG/api"
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/graph"
+	"DZ_ITOG/grpcserver"
+	"DZ_ITOG/handlers"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/ratelimit"
+	"DZ_ITOG/search"
+	"DZ_ITOG/service"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+)
+
+func DatabaseMiddleware(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			logging.FromContext(c.Request.Context()).Error("Database is nil")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database instance not available"})
+			return
+		}
+		c.Set("db", db)
+		c.Next()
+	}
+}
+
+// RegisterPublic mounts the transaction, search, note, attachment, risk review,
+// report, GraphQL, item and API key endpoints, each behind the scope it needs. Key management, the
+// review queue, status changes and refunds always need an API key, so
+// anonymous callers cannot mint one, approve their own transactions, complete
+// them or refund them.
+func RegisterPublic(r gin.IRouter, db *sql.DB, config *configs.Config) {
+	read := handlers.RequireScope(models.ScopeTransactionsRead)
+	write := handlers.RequireScope(models.ScopeTransactionsWrite)
+
+	store, err := blob.NewStore(config.Attachments)
+	if err != nil {
+		logrus.WithError(err).Error("Attachments disabled")
+	}
+
+	r.POST("/transactions", write, handlers.CreateTransaction)
+	r.GET("/transactions", read, handlers.GetAllTransactions)
+	r.GET("/transactions/stream", read, handlers.StreamTransactions(service.LiveEvents(), config.Stream))
+	if searcher, err := search.New(config.Search, db, service.LiveEvents()); err != nil {
+		logrus.WithError(err).Error("Transaction search disabled")
+	} else {
+		r.GET("/transactions/search", read, handlers.SearchTransactions(searcher))
+	}
+	r.GET("/transactions/:id", read, handlers.GetTransactionByID)
+	r.PUT("/transactions/:id", write, handlers.UpdateTransaction)
+	r.DELETE("/transactions/:id", write, handlers.DeleteTransaction(store))
+	r.GET("/transactions/:id/transitions", read, handlers.GetTransactionTransitions)
+	r.GET("/transactions/:id/notes", read, handlers.GetTransactionNotes)
+	r.POST("/transactions/:id/notes", write, handlers.AddTransactionNote)
+	if store != nil {
+		r.GET("/transactions/:id/attachments", read, handlers.ListAttachments(store))
+		r.POST("/transactions/:id/attachments", write, handlers.UploadAttachment(store, config.Attachments))
+		r.GET("/transactions/:id/attachments/:attachment_id", read, handlers.DownloadAttachment(store))
+		r.DELETE("/transactions/:id/attachments/:attachment_id", write, handlers.DeleteAttachment(store))
+	}
+
+	status := r.Group("/transactions/:id", handlers.RequireAPIKey, handlers.RequirePermission(models.PermissionChangeStatus), write)
+	status.POST("/complete", handlers.CompleteTransaction)
+	status.POST("/fail", handlers.FailTransaction)
+	status.POST("/reverse", handlers.ReverseTransaction)
+	r.POST("/transactions/:id/refund", handlers.RequireAPIKey, handlers.RequirePermission(models.PermissionRefund), write, handlers.RefundTransaction)
+
+	reviews := r.Group("/reviews", handlers.RequireAPIKey, handlers.RequirePermission(models.PermissionReviewTransactions))
+	reviews.GET("", read, handlers.ListReviews)
+	reviews.GET("/:id", read, handlers.GetReview)
+	reviews.POST("/:id/approve", write, handlers.ApproveReview)
+	reviews.POST("/:id/decline", write, handlers.DeclineReview)
+
+	r.GET("/reports/transactions", handlers.RequireScope(models.ScopeReportsRead), handlers.GetTransactionReport)
+	r.GET("/reports/categories", handlers.RequireScope(models.ScopeReportsRead), handlers.GetCategoryReport)
+
+	r.POST("/graphql", read, gin.WrapH(graph.NewHandler(db, config.GraphQL)))
+	if config.GraphQL.Playground {
+		r.GET("/graphql", gin.WrapH(graph.Playground()))
+	}
+
+	r.GET("/items", read, handlers.GetAllItems)
+	r.POST("/items", write, handlers.CreateItem)
+	r.GET("/items/:id", read, handlers.GetItemByID)
+	r.PUT("/items/:id", write, handlers.UpdateItem)
+	r.DELETE("/items/:id", write, handlers.DeleteItem)
+
+	// Kept for clients of the original net/http item endpoint, which answers
+	// 405 to every method but GET and POST.
+	legacy := gin.WrapF(handlers.Item(db))
+	r.GET("/item", read, legacy)
+	r.POST("/item", write, legacy)
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions, http.MethodConnect, http.MethodTrace} {
+		r.Handle(method, "/item", legacy)
+	}
+
+	keys := r.Group("/api-keys", handlers.RequireAPIKey)
+	keys.GET("", handlers.ListAPIKeys)
+	keys.POST("", handlers.CreateAPIKey)
+	keys.GET("/:id", handlers.GetAPIKey)
+	keys.PUT("/:id", handlers.UpdateAPIKey)
+	keys.DELETE("/:id", handlers.RevokeAPIKey)
+	keys.POST("/:id/rotate", handlers.RotateAPIKey(config.Auth.RotationGrace))
+}
+
+// RegisterAdmin mounts the operational endpoints. Everything under /admin
+// needs an API key with the admin scope whose user has the admin role, plus
+// the permission of the route; the config version route is only added when a
+// reloader is given.
+func RegisterAdmin(r gin.IRouter, reloader *configs.Reloader) {
+	r.GET("/readyz", handlers.Readyz)
+
+	admin := r.Group("/admin", handlers.RequireAPIKey, handlers.RequireScope(models.ScopeAdmin), handlers.RequireRole(models.RoleAdmin))
+	if reloader != nil {
+		admin.GET("/config/version", handlers.ConfigVersion(reloader))
+	}
+	commissions := handlers.RequirePermission(models.PermissionManageCommissions)
+	admin.GET("/commission-rules", commissions, handlers.ListCommissionRules)
+	admin.POST("/commissions/recalculate", commissions, handlers.RecalculateCommissions)
+	rates := handlers.RequirePermission(models.PermissionManageRates)
+	admin.GET("/rates/providers", rates, handlers.ProbeRateProviders)
+	admin.POST("/rates/refresh", rates, handlers.RefreshRates)
+	users := handlers.RequirePermission(models.PermissionManageUsers)
+	admin.GET("/users/:id/roles", users, handlers.GetUserRoles)
+	admin.PUT("/users/:id/roles", users, handlers.SetUserRoles)
+	admin.GET("/audit", handlers.RequirePermission(models.PermissionReadAudit), handlers.ListAuditEvents)
+	webhooks := admin.Group("/webhooks", handlers.RequirePermission(models.PermissionManageWebhooks))
+	webhooks.GET("", handlers.ListWebhooks)
+	webhooks.POST("", handlers.CreateWebhook)
+	webhooks.GET("/:id", handlers.GetWebhook)
+	webhooks.PUT("/:id", handlers.UpdateWebhook)
+	webhooks.DELETE("/:id", handlers.DeleteWebhook)
+	webhooks.GET("/:id/deliveries", handlers.ListWebhookDeliveries)
+	webhooks.GET("/:id/deliveries/:delivery_id", handlers.GetWebhookDelivery)
+	webhooks.POST("/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhookDelivery)
+}
+
+// NewRouter builds a router with the public API and, when withAdmin is set,
+// the admin endpoints on the same engine. API keys are authenticated on every
+// route past /healthz and the docs, but only the public API can require one
+// and is rate limited, with the settings in effect at startup. Invalid keys
+// are limited per client IP on every route.
+func NewRouter(db *sql.DB, reloader *configs.Reloader, withAdmin bool) *gin.Engine {
+	config := configs.Default()
+	if reloader != nil {
+		config = reloader.Current()
+	}
+	limiter := newLimiter(config, db)
+	router := newEngine(config.Server.TrustedProxies)
+	router.GET("/healthz", handlers.Healthz)
+	api.Register(router)
+	router.Use(DatabaseMiddleware(db), AuthMiddleware(db, limiter))
+	public := router.Group("/")
+	if config.Auth.RequireAPIKey {
+		public.Use(handlers.RequireAPIKey)
+	}
+	if limiter != nil {
+		public.Use(RateLimitMiddleware(limiter))
+	}
+	RegisterPublic(public, db, config)
+	if withAdmin {
+		RegisterAdmin(router, reloader)
+	}
+	return router
+}
+
+// NewAdminRouter builds the router served on the separate admin listener.
+func NewAdminRouter(db *sql.DB, reloader *configs.Reloader) *gin.Engine {
+	config := configs.Default()
+	if reloader != nil {
+		config = reloader.Current()
+	}
+	router := newEngine(config.Server.TrustedProxies)
+	router.GET("/healthz", handlers.Healthz)
+	router.Use(DatabaseMiddleware(db), AuthMiddleware(db, newLimiter(config, db)))
+	RegisterAdmin(router, reloader)
+	return router
+}
+
+// newLimiter returns the limiter of config.RateLimit, or nil when rate
+// limiting is disabled or cannot be set up.
+func newLimiter(config *configs.Config, db *sql.DB) *ratelimit.Limiter {
+	if !config.RateLimit.Enabled {
+		return nil
+	}
+	limiter, err := ratelimit.New(config.RateLimit, db)
+	if err != nil {
+		logrus.WithError(err).Error("Rate limiting disabled")
+		return nil
+	}
+	return limiter
+}
+
+// Server runs the public listener, a second listener for the admin endpoints
+// if server.adminPort is set, and the gRPC listener if grpc.port is set.
+type Server struct {
+	listeners  []*http.Server
+	grpc       *grpc.Server
+	grpcHealth *health.Server
+	grpcAddr   string
+}
+
+// New builds the listeners from the server settings in effect at startup;
+// they are not hot-reloadable.
+func New(reloader *configs.Reloader, db *sql.DB) *Server {
+	config := reloader.Current()
+	separateAdmin := config.Server.AdminPort != 0
+	s := &Server{}
+	s.listeners = append(s.listeners, newHTTPServer(config.Server, config.Server.Port, NewRouter(db, reloader, !separateAdmin)))
+	if separateAdmin {
+		s.listeners = append(s.listeners, newHTTPServer(config.Server, config.Server.AdminPort, NewAdminRouter(db, reloader)))
+	}
+	if config.GRPC.Port != 0 {
+		store, _ := blob.NewStore(config.Attachments)
+		s.grpc, s.grpcHealth = grpcserver.New(config.GRPC, db, store)
+		s.grpcAddr = fmt.Sprintf(":%d", config.GRPC.Port)
+	}
+	return s
+}
+
+func newHTTPServer(config configs.ServerConfig, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// Start launches every listener. The returned channel receives the first
+// listener failure and is closed once all listeners have stopped.
+func (s *Server) Start() <-chan error {
+	errs := make(chan error, len(s.listeners)+1)
+	var wg sync.WaitGroup
+	for _, srv := range s.listeners {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			logrus.Infof("Server started on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("listener %s: %w", srv.Addr, err)
+			}
+		}(srv)
+	}
+	if s.grpc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lis, err := net.Listen("tcp", s.grpcAddr)
+			if err != nil {
+				errs <- fmt.Errorf("grpc listener %s: %w", s.grpcAddr, err)
+				return
+			}
+			logrus.Infof("gRPC server started on %s", s.grpcAddr)
+			if err := s.grpc.Serve(lis); err != nil {
+				errs <- fmt.Errorf("grpc listener %s: %w", s.grpcAddr, err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+	return errs
+}
+
+// Shutdown ends the transaction streams and drains in-flight requests on
+// every listener. gRPC calls still running when ctx expires are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	service.LiveEvents().Close()
+	var firstErr error
+	for _, srv := range s.listeners {
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if s.grpc != nil {
+		if err := s.stopGRPC(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *Server) stopGRPC(ctx context.Context) error {
+	s.grpcHealth.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func routeSet(r *gin.Engine) map[string]bool {
+	routes := map[string]bool{}
+	for _, route := range r.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	return routes
+}
+
+func TestNewRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	routes := routeSet(NewRouter(db, nil, true))
+	for _, route := range []string{
+		"GET /healthz",
+		"GET /readyz",
+		"POST /transactions",
+		"GET /transactions/:id",
+		"POST /graphql",
+		"GET /graphql",
+		"GET /items",
+		"DELETE /items/:id",
+		"GET /item",
+		"POST /item",
+	} {
+		assert.True(t, routes[route], "missing route %s", route)
+	}
+
+	public := routeSet(NewRouter(db, nil, false))
+	assert.False(t, public["GET /readyz"], "admin route mounted on public-only router")
+	assert.True(t, public["GET /healthz"])
+
+	admin := routeSet(NewAdminRouter(db, nil))
+	assert.True(t, admin["GET /readyz"])
+	assert.False(t, admin["GET /transactions"])
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every key so leaked keys are easy to spot in logs and
+// by secret scanners.
+const apiKeyPrefix = "dzk_"
+
+// APIKeyService issues, rotates and checks API keys. Keys carry 256 random
+// bits, so they are stored as a SHA-256 hash: unlike passwords they cannot be
+// guessed, and a fast hash lets every request look its key up directly.
+//
+// Methods taking a caller act on its behalf: a caller with the admin scope
+// whose user may manage users, per the policy.Principal of ctx, manages every
+// key; any other caller only the keys of its own user, and nobody grants a
+// scope it does not hold. A nil caller is the trusted CLI.
+type APIKeyService struct {
+	db *sql.DB
+}
+
+func NewAPIKeyService(db *sql.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// HashAPIKey returns the stored form of key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey returns a new key and its readable prefix.
+func generateAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// Authenticate returns the active key matching key and records its use.
+// Unknown, expired and revoked keys all fail with ErrInvalidAPIKey.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	found, err := repo.GetAPIKeyByHash(ctx, HashAPIKey(key), s.db)
+	if errors.Is(err, repo.ErrNotFound) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if !found.Active(time.Now()) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	if err := repo.TouchAPIKey(ctx, found.ID, s.db); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("api_key_id", found.ID).Warn("Recording API key use failed")
+	}
+	return found, nil
+}
+
+// Create issues a key. The secret is only ever returned here.
+func (s *APIKeyService) Create(ctx context.Context, caller *models.APIKey, input models.APIKeyInput) (models.NewAPIKey, error) {
+	if err := validation.Struct(&input); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	if input.UserID == 0 {
+		if caller == nil {
+			return models.NewAPIKey{}, validation.Fields(models.FieldError{Field: "user_id", Message: "is required"})
+		}
+		input.UserID = caller.UserID
+	}
+	if err := authorize(ctx, caller, input.UserID); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	if err := grantable(caller, input.Scopes); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	exists, err := repo.UserExists(ctx, input.UserID, s.db)
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+	if !exists {
+		return models.NewAPIKey{}, validation.Fields(models.FieldError{Field: "user_id", Message: "user does not exist"})
+	}
+	return s.issue(ctx, s.db, models.APIKey{UserID: input.UserID, Name: input.Name, Scopes: input.Scopes, ExpiresAt: input.ExpiresAt})
+}
+
+func (s *APIKeyService) issue(ctx context.Context, db repo.DBTX, key models.APIKey) (models.NewAPIKey, error) {
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+	key.Prefix = prefix
+	stored, err := repo.CreateAPIKey(ctx, key, HashAPIKey(secret), db)
+	if err != nil {
+		return models.NewAPIKey{}, err
+	}
+	return models.NewAPIKey{APIKey: stored, Key: secret}, nil
+}
+
+// List returns the keys the caller may see: those of userID, or with a nil
+// userID every key for admins and the caller's own keys for anyone else.
+func (s *APIKeyService) List(ctx context.Context, caller *models.APIKey, userID *int) ([]models.APIKey, error) {
+	if userID == nil && !managesAll(ctx, caller) {
+		userID = &caller.UserID
+	}
+	if userID != nil {
+		if err := authorize(ctx, caller, *userID); err != nil {
+			return nil, err
+		}
+	}
+	return repo.ListAPIKeys(ctx, userID, s.db)
+}
+
+// Get returns the key with id. Keys of other users are reported as
+// repo.ErrNotFound to non-admin callers.
+func (s *APIKeyService) Get(ctx context.Context, caller *models.APIKey, id int) (models.APIKey, error) {
+	return s.get(ctx, s.db, caller, id)
+}
+
+func (s *APIKeyService) get(ctx context.Context, db repo.DBTX, caller *models.APIKey, id int) (models.APIKey, error) {
+	key, err := repo.GetAPIKey(ctx, id, db)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if err := authorize(ctx, caller, key.UserID); err != nil {
+		return models.APIKey{}, repo.ErrNotFound
+	}
+	return key, nil
+}
+
+// Update replaces the name, scopes and expiry of a key. The owner cannot be
+// changed.
+func (s *APIKeyService) Update(ctx context.Context, caller *models.APIKey, id int, input models.APIKeyInput) (models.APIKey, error) {
+	if err := validation.Struct(&input); err != nil {
+		return models.APIKey{}, err
+	}
+	if err := grantable(caller, input.Scopes); err != nil {
+		return models.APIKey{}, err
+	}
+	var key models.APIKey
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if key, err = s.get(ctx, tx, caller, id); err != nil {
+			return err
+		}
+		if key.RevokedAt != nil {
+			return fmt.Errorf("%w: API key %d is revoked", repo.ErrConflict, id)
+		}
+		key.Name, key.Scopes, key.ExpiresAt = input.Name, input.Scopes, input.ExpiresAt
+		return repo.UpdateAPIKey(ctx, key, tx)
+	})
+	return key, err
+}
+
+// Revoke disables a key at once.
+func (s *APIKeyService) Revoke(ctx context.Context, caller *models.APIKey, id int) error {
+	return repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := s.get(ctx, tx, caller, id); err != nil {
+			return err
+		}
+		return repo.RevokeAPIKey(ctx, id, tx)
+	})
+}
+
+// Rotate issues a replacement with the same owner, name, scopes and expiry,
+// and lets the old key expire after grace so clients can switch over. A zero
+// grace revokes the old key at once.
+func (s *APIKeyService) Rotate(ctx context.Context, caller *models.APIKey, id int, grace time.Duration) (models.NewAPIKey, error) {
+	if grace < 0 {
+		return models.NewAPIKey{}, validation.Fields(models.FieldError{Field: "grace", Message: "must not be negative"})
+	}
+	var rotated models.NewAPIKey
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		old, err := s.get(ctx, tx, caller, id)
+		if err != nil {
+			return err
+		}
+		if !old.Active(time.Now()) {
+			return fmt.Errorf("%w: API key %d is revoked or expired", repo.ErrConflict, id)
+		}
+		if rotated, err = s.issue(ctx, tx, models.APIKey{UserID: old.UserID, Name: old.Name, Scopes: old.Scopes, ExpiresAt: old.ExpiresAt}); err != nil {
+			return err
+		}
+		if grace == 0 {
+			return repo.RevokeAPIKey(ctx, id, tx)
+		}
+		return repo.ExpireAPIKey(ctx, id, time.Now().Add(grace), tx)
+	})
+	return rotated, err
+}
+
+// authorize checks that caller may manage the keys of userID.
+func authorize(ctx context.Context, caller *models.APIKey, userID int) error {
+	if caller == nil || caller.UserID == userID || managesAll(ctx, caller) {
+		return nil
+	}
+	return fmt.Errorf("%w: API keys of another user", ErrForbidden)
+}
+
+// managesAll reports whether caller may manage the keys of every user. The
+// admin scope alone is not enough: a user who lost the admin role may still
+// hold a key with it, so the roles of the principal in ctx must also grant
+// PermissionManageUsers.
+func managesAll(ctx context.Context, caller *models.APIKey) bool {
+	if caller == nil {
+		return true
+	}
+	p := policy.FromContext(ctx)
+	return caller.HasScope(models.ScopeAdmin) && p != nil && p.Can(models.PermissionManageUsers)
+}
+
+// grantable checks that caller holds every scope it is granting.
+func grantable(caller *models.APIKey, scopes []string) error {
+	if caller == nil {
+		return nil
+	}
+	for _, scope := range scopes {
+		if !caller.HasScope(scope) {
+			return fmt.Errorf("%w: cannot grant the %s scope without holding it", ErrForbidden, scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/policy"
+	"DZ_ITOG/repo"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyColumns = []string{"api_key_id", "user_id", "name", "prefix", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}
+
+func apiKeyRow(id, userID int, scopes string, expiresAt, revokedAt interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows(apiKeyColumns).
+		AddRow(id, userID, "batch", "dzk_00000000", scopes, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), expiresAt, nil, revokedAt)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	keys := NewAPIKeyService(db)
+	ctx := context.Background()
+	const secret = "dzk_00000000_secret"
+
+	mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WithArgs(HashAPIKey(secret)).
+		WillReturnRows(apiKeyRow(3, 7, "{transactions:read,reports:read}", nil, nil))
+	mock.ExpectExec(`UPDATE api_keys SET last_used_at`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	key, err := keys.Authenticate(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, 7, key.UserID)
+	assert.Equal(t, []string{models.ScopeTransactionsRead, models.ScopeReportsRead}, key.Scopes)
+
+	past := time.Now().Add(-time.Minute)
+	for name, row := range map[string]*sqlmock.Rows{
+		"expired": apiKeyRow(3, 7, "{admin}", past, nil),
+		"revoked": apiKeyRow(3, 7, "{admin}", nil, past),
+	} {
+		mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WillReturnRows(row)
+		_, err = keys.Authenticate(ctx, secret)
+		assert.True(t, errors.Is(err, ErrInvalidAPIKey), name)
+	}
+
+	mock.ExpectQuery(`FROM api_keys WHERE key_hash`).WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	_, err = keys.Authenticate(ctx, secret)
+	assert.True(t, errors.Is(err, ErrInvalidAPIKey), "unknown")
+
+	_, err = keys.Authenticate(ctx, "not-a-key")
+	assert.True(t, errors.Is(err, ErrInvalidAPIKey), "no database lookup for foreign tokens")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	keys := NewAPIKeyService(db)
+	ctx := context.Background()
+	caller := &models.APIKey{ID: 1, UserID: 7, Scopes: []string{models.ScopeTransactionsRead, models.ScopeTransactionsWrite}}
+
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO api_keys`).
+		WithArgs(7, "reader", sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{models.ScopeTransactionsRead}), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"api_key_id", "created_at"}).AddRow(2, time.Now()))
+	created, err := keys.Create(ctx, caller, models.APIKeyInput{Name: "reader", Scopes: []string{models.ScopeTransactionsRead}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, created.ID)
+	assert.Equal(t, 7, created.UserID, "defaults to the caller's user")
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix+"_"))
+
+	_, err = keys.Create(ctx, caller, models.APIKeyInput{Name: "escalate", Scopes: []string{models.ScopeAdmin}})
+	assert.True(t, errors.Is(err, ErrForbidden), "granting an unheld scope")
+
+	_, err = keys.Create(ctx, caller, models.APIKeyInput{UserID: 8, Name: "other", Scopes: []string{models.ScopeTransactionsRead}})
+	assert.True(t, errors.Is(err, ErrForbidden), "keys for another user")
+
+	adminKey := &models.APIKey{ID: 4, UserID: 7, Scopes: []string{models.ScopeAdmin}}
+	demoted := policy.WithPrincipal(ctx, &policy.Principal{UserID: 7, APIKeyID: 4, Roles: []string{models.RoleCustomer}, Permissions: models.DefaultRolePermissions[models.RoleCustomer]})
+	_, err = keys.Create(demoted, adminKey, models.APIKeyInput{UserID: 1, Name: "takeover", Scopes: []string{models.ScopeAdmin}})
+	assert.True(t, errors.Is(err, ErrForbidden), "the admin scope without the admin role")
+
+	admin := policy.WithPrincipal(ctx, &policy.Principal{UserID: 7, APIKeyID: 4, Roles: []string{models.RoleAdmin}, Permissions: models.DefaultRolePermissions[models.RoleAdmin]})
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(8).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO api_keys`).
+		WithArgs(8, "ops", sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{models.ScopeTransactionsRead}), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"api_key_id", "created_at"}).AddRow(5, time.Now()))
+	_, err = keys.Create(admin, adminKey, models.APIKeyInput{UserID: 8, Name: "ops", Scopes: []string{models.ScopeTransactionsRead}})
+	assert.NoError(t, err, "admins manage every user's keys")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	keys := NewAPIKeyService(db)
+	caller := &models.APIKey{ID: 3, UserID: 7, Scopes: []string{models.ScopeTransactionsRead}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM api_keys WHERE api_key_id`).WithArgs(3).WillReturnRows(apiKeyRow(3, 7, "{transactions:read}", nil, nil))
+	mock.ExpectQuery(`INSERT INTO api_keys`).
+		WithArgs(7, "batch", sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{models.ScopeTransactionsRead}), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"api_key_id", "created_at"}).AddRow(4, time.Now()))
+	mock.ExpectExec(`UPDATE api_keys SET expires_at = LEAST`).WithArgs(sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rotated, err := keys.Rotate(context.Background(), caller, 3, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 4, rotated.ID)
+	assert.NotEmpty(t, rotated.Key)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM api_keys WHERE api_key_id`).WithArgs(5).WillReturnRows(apiKeyRow(5, 8, "{transactions:read}", nil, nil))
+	mock.ExpectRollback()
+	_, err = keys.Rotate(context.Background(), caller, 5, 0)
+	assert.True(t, errors.Is(err, repo.ErrNotFound), "other users' keys are hidden")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
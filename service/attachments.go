@@ -0,0 +1,196 @@
+package service
+
+import (
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sniffLength is how much of an upload http.DetectContentType looks at.
+const sniffLength = 512
+
+// AttachmentService keeps the files attached to transactions: their content
+// in a blob store, their metadata in the database.
+type AttachmentService struct {
+	db     *sql.DB
+	store  blob.Store
+	config configs.AttachmentConfig
+}
+
+func NewAttachmentService(db *sql.DB, store blob.Store, config configs.AttachmentConfig) *AttachmentService {
+	return &AttachmentService{db: db, store: store, config: config}
+}
+
+func (s *AttachmentService) log(ctx context.Context, operation string) *logrus.Entry {
+	return logging.FromContext(ctx).WithFields(logrus.Fields{
+		"module":    "attachmentService",
+		"operation": operation,
+	})
+}
+
+// Upload attaches content to the transaction with id under name, on behalf
+// of uploader. The content type is sniffed from the content and must be one
+// of the configured types; content larger than the configured size is
+// refused. Both are reported as validation errors on the file field.
+func (s *AttachmentService) Upload(ctx context.Context, id int64, name string, content io.Reader, uploader *int) (models.Attachment, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return models.Attachment{}, err
+	}
+	if n == 0 {
+		return models.Attachment{}, validation.Fields(models.FieldError{Field: "file", Message: "must not be empty"})
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !s.accepts(contentType) {
+		return models.Attachment{}, validation.Fields(models.FieldError{
+			Field:   "file",
+			Message: fmt.Sprintf("is %s; accepted types are %s", contentType, strings.Join(s.config.Types, ", ")),
+		})
+	}
+
+	key, err := newStorageKey()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	counted := &countingReader{r: io.LimitReader(io.MultiReader(bytes.NewReader(head[:n]), content), s.config.MaxSize+1)}
+	if err := s.store.Put(ctx, key, counted); err != nil {
+		s.log(ctx, "Upload").WithError(err).Error("Error storing attachment")
+		return models.Attachment{}, err
+	}
+	if counted.n > s.config.MaxSize {
+		s.discard(ctx, key)
+		return models.Attachment{}, TooLarge(s.config.MaxSize)
+	}
+
+	attachment, err := repo.CreateAttachment(ctx, models.Attachment{
+		TransactionID: int(id),
+		FileName:      cleanFileName(name),
+		ContentType:   contentType,
+		Size:          counted.n,
+		UploadedBy:    uploader,
+		StorageKey:    key,
+	}, s.db)
+	if err != nil {
+		s.discard(ctx, key)
+		return models.Attachment{}, err
+	}
+	s.log(ctx, "Upload").WithFields(logrus.Fields{
+		"transaction_id": id,
+		"attachment_id":  attachment.ID,
+		"content_type":   attachment.ContentType,
+		"size":           attachment.Size,
+	}).Info("Attachment uploaded")
+	return attachment, nil
+}
+
+// List returns the attachments of the transaction with id, oldest first.
+func (s *AttachmentService) List(ctx context.Context, id int64) ([]models.Attachment, error) {
+	return repo.ListAttachments(ctx, id, s.db)
+}
+
+// Open returns attachment attachmentID of the transaction with id and its
+// content, which the caller must close.
+func (s *AttachmentService) Open(ctx context.Context, id, attachmentID int64) (models.Attachment, io.ReadCloser, error) {
+	attachment, err := repo.GetAttachment(ctx, id, attachmentID, s.db)
+	if err != nil {
+		return models.Attachment{}, nil, err
+	}
+	content, err := s.store.Open(ctx, attachment.StorageKey)
+	if err != nil {
+		s.log(ctx, "Open").WithError(err).WithField("attachment_id", attachmentID).Error("Error opening attachment content")
+		return models.Attachment{}, nil, err
+	}
+	return attachment, content, nil
+}
+
+// Delete removes attachment attachmentID of the transaction with id. Its
+// content is removed after the metadata; if that fails it is only logged.
+func (s *AttachmentService) Delete(ctx context.Context, id, attachmentID int64) error {
+	key, err := repo.DeleteAttachment(ctx, id, attachmentID, s.db)
+	if err != nil {
+		return err
+	}
+	s.discard(ctx, key)
+	return nil
+}
+
+func (s *AttachmentService) accepts(contentType string) bool {
+	for _, t := range s.config.Types {
+		if strings.EqualFold(t, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// discard deletes content that no metadata refers to.
+func (s *AttachmentService) discard(ctx context.Context, key string) {
+	if err := s.store.Delete(ctx, key); err != nil {
+		s.log(ctx, "discard").WithError(err).WithField("storage_key", key).Warn("Error deleting attachment content")
+	}
+}
+
+// TooLarge is the error Upload returns for content larger than maxSize, for
+// transports that detect it before calling Upload.
+func TooLarge(maxSize int64) error {
+	return validation.Fields(models.FieldError{Field: "file", Message: fmt.Sprintf("must be at most %d bytes", maxSize)})
+}
+
+func newStorageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// cleanFileName keeps the last element of a client-supplied path, without
+// control characters and at most 255 bytes long.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"fmt"
+	"time"
+)
+
+// CommissionRate returns the configured commission fraction for a
+// transaction type and currency, or 0 when no rule matches. A rule without a
+// currency applies to every currency of its type.
+func CommissionRate(transactionType, currency string) float64 {
+	return commissionRule(transactionType, currency).Rate
+}
+
+// CommissionRefundable reports whether the rule for a transaction type and
+// currency returns the commission with refunds.
+func CommissionRefundable(transactionType, currency string) bool {
+	return commissionRule(transactionType, currency).Refundable
+}
+
+// commissionRule returns the rule matching a transaction type and currency,
+// preferring one for the currency over a catch-all, or the zero rule.
+func commissionRule(transactionType, currency string) configs.CommissionRule {
+	var fallback configs.CommissionRule
+	found := false
+	for _, rule := range current.Load().commissionRules {
+		if rule.TransactionType != transactionType {
+			continue
+		}
+		if rule.Currency == currency {
+			return rule
+		}
+		if rule.Currency == "" && !found {
+			fallback, found = rule, true
+		}
+	}
+	return fallback
+}
+
+// CommissionRules returns the commission rules in effect.
+func CommissionRules() []configs.CommissionRule {
+	return append([]configs.CommissionRule{}, current.Load().commissionRules...)
+}
+
+// CommissionFor builds the commission charged on transaction, or returns
+// false when no rule charges one.
+func CommissionFor(transaction models.Transaction) (models.Commission, bool) {
+	rate := CommissionRate(transaction.TransactionType, transaction.Currency)
+	if rate <= 0 {
+		return models.Commission{}, false
+	}
+	return models.Commission{
+		TransactionID:   transaction.ID,
+		Amount:          transaction.Amount,
+		Currency:        transaction.Currency,
+		TransactionType: transaction.TransactionType,
+		Commission:      transaction.Amount * rate,
+		Date:            time.Now().Format("2006-01-02"),
+		Description:     fmt.Sprintf("Комиссия %.2f%% от суммы", rate*100),
+	}, true
+}
@@ -0,0 +1,23 @@
+package service
+
+import "errors"
+
+var (
+	// ErrRateUnavailable is returned when no configured rate provider gave a
+	// usable answer.
+	ErrRateUnavailable = errors.New("currency rates unavailable")
+	// ErrUnknownCurrency is returned when the providers have no rate for the
+	// requested currency.
+	ErrUnknownCurrency = errors.New("unknown currency")
+	// ErrInvalidAPIKey is returned for an API key that does not exist, has
+	// expired or was revoked. The three are not told apart.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrForbidden is returned when the caller may see a resource but not
+	// perform the operation, such as granting a scope it does not hold.
+	ErrForbidden = errors.New("forbidden")
+	// ErrRiskRejected is returned when a risk rule rejects a transaction.
+	ErrRiskRejected = errors.New("rejected by risk rules")
+	// ErrHeldForReview is returned when a risk rule holds a transaction for
+	// review instead of storing it.
+	ErrHeldForReview = errors.New("held for review")
+)
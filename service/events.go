@@ -0,0 +1,68 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/stream"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+var liveEvents = stream.NewHub(stream.DefaultBufferSize)
+
+// LiveEvents returns the hub that changes made by this process are pushed
+// to once committed.
+func LiveEvents() *stream.Hub {
+	return liveEvents
+}
+
+// eventBatch collects the events of one database transaction. Each is written
+// to the outbox and queued for webhooks as it happens, in the transaction,
+// and pushed to live subscribers by commit once the transaction committed.
+type eventBatch struct {
+	live []stream.Event
+}
+
+// publish records an event about a change to the transaction with
+// transactionID, owned by userID. db must be the transaction making the
+// change, so the event goes out if and only if the change commits.
+func (e *eventBatch) publish(ctx context.Context, db repo.DBTX, eventType string, transactionID, userID int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	event := models.Event{
+		ID:         "evt_" + hex.EncodeToString(id),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       payload,
+	}
+	err = repo.AppendOutbox(ctx, models.OutboxMessage{
+		Event:         event,
+		AggregateType: models.AggregateTransaction,
+		AggregateID:   strconv.Itoa(transactionID),
+	}, db)
+	if err != nil {
+		return err
+	}
+	if err := repo.EnqueueWebhookEvent(ctx, event, db); err != nil {
+		return err
+	}
+	e.live = append(e.live, stream.Event{UserID: userID, Event: event})
+	return nil
+}
+
+// commit pushes the collected events to live subscribers.
+func (e *eventBatch) commit() {
+	if len(e.live) > 0 {
+		liveEvents.Publish(e.live...)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+)
+
+// AddNote validates note and leaves it on the transaction with id. The
+// author is taken from note.Author.
+func (s *TransactionService) AddNote(ctx context.Context, id int64, note models.Note) (models.Note, error) {
+	if err := validation.Struct(&note); err != nil {
+		return models.Note{}, err
+	}
+	note.TransactionID = int(id)
+	return repo.CreateNote(ctx, note, s.db)
+}
+
+// Notes returns the notes on the transaction with id, oldest first.
+func (s *TransactionService) Notes(ctx context.Context, id int64) ([]models.Note, error) {
+	return repo.ListNotes(ctx, id, s.db)
+}
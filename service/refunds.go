@@ -0,0 +1,117 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Refund returns all or part of the completed purchase with id to its user
+// as a new top-up linked to it, never more than is left of the purchase. When
+// the commission rule of the purchase is refundable, the same share of its
+// commission is returned too. The response holds the refund and, if any, the
+// commission record returning the purchase's commission.
+func (s *TransactionService) Refund(ctx context.Context, id int64, request models.RefundRequest) (models.TransactionResponse, error) {
+	var resp models.TransactionResponse
+	if err := validation.Struct(&request); err != nil {
+		return resp, err
+	}
+	var events eventBatch
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		purchase, err := repo.LockTransaction(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if purchase.TransactionType != models.TransactionTypePurchase || purchase.RefundOf != nil {
+			return fmt.Errorf("%w: transaction %d is not a purchase", repo.ErrConflict, id)
+		}
+		if purchase.Status != models.StatusCompleted {
+			return fmt.Errorf("%w: transaction %d is %s; only completed purchases can be refunded", repo.ErrConflict, id, purchase.Status)
+		}
+		left := cents(purchase.Amount - purchase.Refunded)
+		if left <= 0 {
+			return fmt.Errorf("%w: transaction %d is already fully refunded", repo.ErrConflict, id)
+		}
+		amount := request.Amount
+		if amount == 0 {
+			amount = left
+		}
+		if amount > left {
+			return validation.Fields(models.FieldError{Field: "amount", Message: fmt.Sprintf("must be at most %.2f, the amount not yet refunded", left)})
+		}
+
+		if resp, err = s.insert(ctx, tx, refundOf(purchase, amount, request), &events); err != nil {
+			return err
+		}
+		if err := repo.AddRefunded(ctx, purchase.ID, amount, tx); err != nil {
+			return err
+		}
+		if !CommissionRefundable(purchase.TransactionType, purchase.Currency) {
+			return nil
+		}
+		resp.Commission, err = s.refundCommission(ctx, tx, purchase, amount, &events)
+		return err
+	})
+	if err != nil {
+		return models.TransactionResponse{}, err
+	}
+	s.log(ctx, "Refund").WithFields(logrus.Fields{
+		"transaction_id": id,
+		"refund_id":      resp.Transaction.ID,
+		"amount":         resp.Transaction.Amount,
+	}).Info("Purchase refunded")
+	events.commit()
+	return resp, nil
+}
+
+// refundOf builds the top-up returning amount of purchase.
+func refundOf(purchase models.Transaction, amount float64, request models.RefundRequest) models.Transaction {
+	kind := "Возврат"
+	if request.Chargeback {
+		kind = "Чарджбэк"
+	}
+	description := fmt.Sprintf("%s по транзакции %d", kind, purchase.ID)
+	if request.Reason != "" {
+		description += ": " + request.Reason
+	}
+	return models.Transaction{
+		UserID:          purchase.UserID,
+		AccountID:       purchase.AccountID,
+		Amount:          amount,
+		Currency:        purchase.Currency,
+		TransactionType: models.TransactionTypeTopUp,
+		Category:        purchase.Category,
+		Description:     description,
+		Status:          models.StatusCompleted,
+		RefundOf:        &purchase.ID,
+	}
+}
+
+// refundCommission returns the share of the purchase's commission that amount
+// is of the purchase, capped at what is left of it.
+func (s *TransactionService) refundCommission(ctx context.Context, tx *sql.Tx, purchase models.Transaction, amount float64, events *eventBatch) (*models.Commission, error) {
+	charged, net, err := chargedCommission(ctx, tx, purchase.ID)
+	if err != nil || net <= 0 {
+		return nil, err
+	}
+	refund := charged
+	refund.Commission = -math.Min(charged.Commission*amount/purchase.Amount, net)
+	refund.Date = time.Now().Format("2006-01-02")
+	refund.Description = fmt.Sprintf("Возврат комиссии с %.2f %s", amount, purchase.Currency)
+	if err := repo.CreateCommission(ctx, tx, refund); err != nil {
+		return nil, err
+	}
+	return &refund, events.publish(ctx, tx, models.EventCommissionRefunded, purchase.ID, purchase.UserID, refund)
+}
+
+// cents rounds to the cent, as amounts are stored.
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
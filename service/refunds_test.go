@@ -0,0 +1,93 @@
+package service
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/validation"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefund(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	config := configs.Default()
+	config.Commission.Rules = []configs.CommissionRule{
+		{TransactionType: models.TransactionTypePurchase, Rate: 0.01, Refundable: true},
+	}
+	Configure(config)
+	defer Configure(configs.Default())
+
+	accountID := 3
+	purchase := func(transactionType, status string, refunded float64) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(4).
+			WillReturnRows(repotest.TransactionRows(models.Transaction{ID: 4, UserID: 1, Amount: 200, Currency: "USD", TransactionType: transactionType, Category: "food", Date: time.Now(), AccountID: &accountID, Status: status, Refunded: refunded}))
+	}
+
+	t.Run("partial refund returns its share of the commission", func(t *testing.T) {
+		mock.ExpectBegin()
+		purchase(models.TransactionTypePurchase, models.StatusCompleted, 50)
+		mock.ExpectQuery(`INSERT INTO transactions`).
+			WithArgs(1, 50.0, "USD", models.TransactionTypeTopUp, "food", "Возврат по транзакции 4: damaged", 3, models.StatusCompleted, 4).
+			WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(9))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "9", models.EventTransactionCreated, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`UPDATE transactions SET refunded = refunded \+ \$1`).WithArgs(50.0, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM commissions WHERE transaction_id = \$1`).WithArgs(4).WillReturnRows(
+			sqlmock.NewRows([]string{"transaction_id", "amount", "currency", "transaction_type", "commission", "date", "description"}).
+				AddRow(4, 200.0, "USD", "покупка", 2.0, "2024-01-01", "Комиссия 1.00% от суммы").
+				AddRow(4, 200.0, "USD", "покупка", -0.5, "2024-01-02", "Возврат комиссии с 50.00 USD"))
+		mock.ExpectExec(`INSERT INTO commissions`).WithArgs(4, 200.0, "USD", "покупка", -0.5, sqlmock.AnyArg(), "Возврат комиссии с 50.00 USD").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "4", models.EventCommissionRefunded, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		resp, err := NewTransactionService(db).Refund(context.Background(), 4, models.RefundRequest{Amount: 50, Reason: "damaged"})
+		require.NoError(t, err)
+		assert.Equal(t, 9, resp.Transaction.ID)
+		assert.Equal(t, 4, *resp.Transaction.RefundOf)
+		require.NotNil(t, resp.Commission)
+		assert.Equal(t, -0.5, resp.Commission.Commission)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("more than is left is invalid", func(t *testing.T) {
+		mock.ExpectBegin()
+		purchase(models.TransactionTypePurchase, models.StatusCompleted, 150)
+		mock.ExpectRollback()
+
+		_, err := NewTransactionService(db).Refund(context.Background(), 4, models.RefundRequest{Amount: 60})
+		var invalid *validation.Error
+		require.True(t, errors.As(err, &invalid))
+		assert.Equal(t, "amount", invalid.Fields[0].Field)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("only completed purchases are refunded", func(t *testing.T) {
+		for _, c := range []struct{ transactionType, status string }{
+			{models.TransactionTypeTransfer, models.StatusCompleted},
+			{models.TransactionTypePurchase, models.StatusPending},
+		} {
+			mock.ExpectBegin()
+			purchase(c.transactionType, c.status, 0)
+			mock.ExpectRollback()
+
+			_, err := NewTransactionService(db).Refund(context.Background(), 4, models.RefundRequest{})
+			assert.True(t, errors.Is(err, repo.ErrConflict), c)
+		}
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
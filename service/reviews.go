@@ -0,0 +1,124 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// RiskError is returned by TransactionService.Create when the risk rules
+// hold or reject a transaction. With Review set it was held and matches
+// ErrHeldForReview; otherwise it was rejected and matches ErrRiskRejected.
+type RiskError struct {
+	Findings []models.RiskFinding
+	Review   *models.RiskReview
+}
+
+func (e *RiskError) Error() string {
+	rules := make([]string, 0, len(e.Findings))
+	for _, f := range e.Findings {
+		rules = append(rules, f.Rule)
+	}
+	if e.Review != nil {
+		return fmt.Sprintf("%v as review %d: %s", ErrHeldForReview, e.Review.ID, strings.Join(rules, ", "))
+	}
+	return fmt.Sprintf("%v: %s", ErrRiskRejected, strings.Join(rules, ", "))
+}
+
+func (e *RiskError) Is(target error) bool {
+	if e.Review != nil {
+		return target == ErrHeldForReview
+	}
+	return target == ErrRiskRejected
+}
+
+// ReviewService works the queue of transactions the risk rules flagged or
+// held.
+type ReviewService struct {
+	db           *sql.DB
+	transactions *TransactionService
+}
+
+func NewReviewService(db *sql.DB) *ReviewService {
+	return &ReviewService{db: db, transactions: NewTransactionService(db)}
+}
+
+// List returns the reviews matching filter, oldest first.
+func (s *ReviewService) List(ctx context.Context, filter repo.ReviewFilter) ([]models.RiskReview, error) {
+	return repo.ListRiskReviews(ctx, filter, s.db)
+}
+
+// Get returns one review.
+func (s *ReviewService) Get(ctx context.Context, id int64) (models.RiskReview, error) {
+	return repo.GetRiskReview(ctx, id, false, s.db)
+}
+
+// Approve stores the transaction of a pending review as it was submitted,
+// charging its commission and publishing its events as Create would, and
+// marks the review approved by reviewer. The risk rules are not applied
+// again. Reviews already decided are a conflict.
+func (s *ReviewService) Approve(ctx context.Context, id int64, reviewer *int, note string) (models.RiskReview, error) {
+	var review models.RiskReview
+	var events eventBatch
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if review, err = pendingReview(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := validation.CheckReferences(ctx, tx, review.Transaction); err != nil {
+			return err
+		}
+		resp, err := s.transactions.insert(ctx, tx, review.Transaction, &events)
+		if err != nil {
+			return err
+		}
+		review.Status = models.ReviewApproved
+		review.TransactionID = &resp.Transaction.ID
+		review.Transaction = resp.Transaction
+		review.DecidedBy, review.Note = reviewer, note
+		review, err = repo.DecideRiskReview(ctx, review, tx)
+		return err
+	})
+	if err != nil {
+		return models.RiskReview{}, err
+	}
+	events.commit()
+	return review, nil
+}
+
+// Decline marks a pending review declined by reviewer; its transaction is
+// never stored. Reviews already decided are a conflict.
+func (s *ReviewService) Decline(ctx context.Context, id int64, reviewer *int, note string) (models.RiskReview, error) {
+	var review models.RiskReview
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if review, err = pendingReview(ctx, tx, id); err != nil {
+			return err
+		}
+		review.Status = models.ReviewDeclined
+		review.DecidedBy, review.Note = reviewer, note
+		review, err = repo.DecideRiskReview(ctx, review, tx)
+		return err
+	})
+	if err != nil {
+		return models.RiskReview{}, err
+	}
+	return review, nil
+}
+
+// pendingReview locks review id for the rest of tx and checks that it still
+// waits for a decision.
+func pendingReview(ctx context.Context, tx *sql.Tx, id int64) (models.RiskReview, error) {
+	review, err := repo.GetRiskReview(ctx, id, true, tx)
+	if err != nil {
+		return review, err
+	}
+	if review.Status != models.ReviewPending {
+		return review, fmt.Errorf("%w: review %d is %s", repo.ErrConflict, id, review.Status)
+	}
+	return review, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAppliesRiskRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	config := configs.Default()
+	config.Risk.Velocity = configs.VelocityRule{Action: configs.RiskHold, Window: time.Hour, MaxCount: 1}
+	config.Risk.CurrencySwitching = configs.CurrencySwitchingRule{Action: configs.RiskReject, Window: time.Hour, MaxCurrencies: 1}
+	Configure(config)
+	defer Configure(configs.Default())
+
+	transaction := models.Transaction{UserID: 1, Amount: 100, Currency: "USD", TransactionType: models.TransactionTypePurchase}
+	expectHistory := func(currency string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WithArgs(0x7269736b, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FROM transactions WHERE user_id = \$1 AND date >=`).WithArgs(1, 3600.0).
+			WillReturnRows(sqlmock.NewRows([]string{"amount", "currency", "transaction_type", "age"}).AddRow(50, currency, "покупка", 60.0))
+	}
+
+	t.Run("held", func(t *testing.T) {
+		expectHistory("USD")
+		mock.ExpectQuery(`INSERT INTO risk_reviews`).WithArgs(models.ReviewPending, 1, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"review_id", "created_at"}).AddRow(5, time.Now()))
+		mock.ExpectCommit()
+
+		_, err := NewTransactionService(db).Create(context.Background(), transaction)
+		require.True(t, errors.Is(err, ErrHeldForReview), err)
+		var riskErr *RiskError
+		require.True(t, errors.As(err, &riskErr))
+		assert.Equal(t, int64(5), riskErr.Review.ID)
+		assert.Equal(t, "velocity", riskErr.Review.Findings[0].Rule)
+		assert.Nil(t, riskErr.Review.TransactionID, "a held transaction is not stored")
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		expectHistory("EUR")
+		mock.ExpectRollback()
+
+		_, err := NewTransactionService(db).Create(context.Background(), transaction)
+		assert.True(t, errors.Is(err, ErrRiskRejected), err)
+		assert.EqualError(t, err, "rejected by risk rules: velocity, currency_switching")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecideReview(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"review_id", "status", "user_id", "transaction_id", "transaction", "findings", "created_at", "decided_at", "decided_by", "note"}
+	review := func(status string) *sqlmock.Rows {
+		return sqlmock.NewRows(columns).AddRow(5, status, 1, nil,
+			`{"id":0,"user_id":1,"amount":100,"currency":"USD","transaction_type":"покупка","category":"","date":"0001-01-01T00:00:00Z","description":""}`,
+			`[{"rule":"velocity","action":"hold","reason":"2 transactions within 1h0m0s, more than 1"}]`, time.Now(), nil, nil, "")
+	}
+	reviewer := 7
+
+	t.Run("approve stores the transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM risk_reviews WHERE review_id = \$1 FOR UPDATE`).WithArgs(5).WillReturnRows(review(models.ReviewPending))
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(12))
+		mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`UPDATE risk_reviews SET status = \$1`).WithArgs(models.ReviewApproved, 12, reviewer, "known customer", int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"decided_at"}).AddRow(time.Now()))
+		mock.ExpectCommit()
+
+		approved, err := NewReviewService(db).Approve(context.Background(), 5, &reviewer, "known customer")
+		require.NoError(t, err)
+		assert.Equal(t, models.ReviewApproved, approved.Status)
+		require.NotNil(t, approved.TransactionID)
+		assert.Equal(t, 12, *approved.TransactionID)
+		assert.Equal(t, 12, approved.Transaction.ID)
+		assert.NotNil(t, approved.DecidedAt)
+	})
+
+	t.Run("a decided review is a conflict", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM risk_reviews WHERE review_id = \$1 FOR UPDATE`).WithArgs(5).WillReturnRows(review(models.ReviewDeclined))
+		mock.ExpectRollback()
+
+		_, err := NewReviewService(db).Approve(context.Background(), 5, &reviewer, "")
+		assert.True(t, errors.Is(err, repo.ErrConflict), err)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
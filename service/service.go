@@ -1,17 +1,24 @@
 package service
 
 import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
 	"DZ_ITOG/models"
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	log "github.com/sirupsen/logrus"
 )
 
-func ConvertAmount(amount float64, baseCurrency string, targetCurrency string) (float64, error) {
+func ConvertAmount(ctx context.Context, amount float64, baseCurrency string, targetCurrency string) (float64, error) {
+	log := logging.FromContext(ctx)
 	log.Infof("Starting conversion: %v from %s to %s", amount, baseCurrency, targetCurrency)
 
 	if baseCurrency == targetCurrency {
@@ -19,54 +26,271 @@ func ConvertAmount(amount float64, baseCurrency string, targetCurrency string) (
 		return amount, nil
 	}
 
-	rates, err := FetchCurrencyRates(baseCurrency)
+	rates, err := Rates(ctx, baseCurrency)
 	if err != nil {
 		log.Errorf("Failed to fetch currency rates: %v", err)
 		return 0, err
 	}
 
-	if rate, ok := rates.Rates[targetCurrency]; ok {
+	if rate, ok := rates[targetCurrency]; ok {
 		convertedAmount := amount * rate
 		log.Infof("Conversion successful: %v %s is %v %s", amount, baseCurrency, convertedAmount, targetCurrency)
 		return convertedAmount, nil
 	} else {
 		log.Errorf("Rate for target currency %s not found", targetCurrency)
-		return 0, fmt.Errorf("rate for target currency %s not found", targetCurrency)
+		return 0, fmt.Errorf("%w: no rate for %s", ErrUnknownCurrency, targetCurrency)
+	}
+}
+
+// Rates returns the exchange rates from baseCurrency, keyed by currency code.
+// Failures are reported as ErrRateUnavailable.
+func Rates(ctx context.Context, baseCurrency string) (map[string]float64, error) {
+	rates, err := ratesFor(ctx, baseCurrency)
+	if err != nil {
+		if !errors.Is(err, ErrRateUnavailable) {
+			err = fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+		}
+		return nil, err
+	}
+	return rates.Rates, nil
+}
+
+// settings is the hot-reloadable part of the service configuration. It is
+// replaced as a whole so readers never see a half-applied reload.
+type settings struct {
+	providers       []configs.RateProvider
+	ratesTimeout    time.Duration
+	cacheTTL        time.Duration
+	commissionRules []configs.CommissionRule
+	risk            configs.RiskConfig
+}
+
+var current atomic.Pointer[settings]
+
+func init() {
+	Configure(configs.Default())
+}
+
+// Configure applies the rate provider, rate cache, commission and risk
+// settings.
+// Until it is called the built-in defaults are used. Cached rates are dropped
+// when the providers or the cache TTL change.
+func Configure(config *configs.Config) {
+	next := &settings{
+		providers:       append([]configs.RateProvider(nil), config.Rates.Providers...),
+		ratesTimeout:    config.Rates.Timeout,
+		cacheTTL:        config.Rates.CacheTTL,
+		commissionRules: append([]configs.CommissionRule(nil), config.Commission.Rules...),
+		risk:            config.Risk,
 	}
+	old := current.Swap(next)
+	if old == nil || old.cacheTTL != next.cacheTTL || !reflect.DeepEqual(old.providers, next.providers) {
+		rateCache.clear()
+	}
+}
+
+func providers() ([]configs.RateProvider, time.Duration) {
+	s := current.Load()
+	return s.providers, s.ratesTimeout
+}
+
+type cachedRates struct {
+	rates     models.CurrencyRates
+	fetchedAt time.Time
+}
+
+type ratesCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedRates
 }
 
-const currencyAPIURL = "https://api.freecurrencyapi.com/v2/latest"
-const apiKey = "fca_live_O0Kw1fj8ul0ZaVlBnTZxn48GBL3X0vr8TSL95HqI"
-const backupAPIURL = "https://v6.exchangerate-api.com/v6/abe4f5b30553ba88e0824fdd/latest"
-const backupAPIKey = "abe4f5b30553ba88e0824fdd"
+var rateCache = &ratesCache{entries: map[string]cachedRates{}}
+
+func (c *ratesCache) clear() {
+	c.mu.Lock()
+	c.entries = map[string]cachedRates{}
+	c.mu.Unlock()
+}
+
+// ClearRateCache drops every cached rate, so the next conversion asks the
+// providers again.
+func ClearRateCache() {
+	rateCache.clear()
+}
+
+// ratesFor returns the rates for baseCurrency, served from the cache while
+// they are younger than rates.cacheTTL.
+func ratesFor(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+	ttl := current.Load().cacheTTL
+	if ttl > 0 {
+		rateCache.mu.Lock()
+		entry, ok := rateCache.entries[baseCurrency]
+		rateCache.mu.Unlock()
+		if ok && time.Since(entry.fetchedAt) < ttl {
+			return entry.rates, nil
+		}
+	}
+
+	rates, err := FetchCurrencyRates(ctx, baseCurrency)
+	if err != nil {
+		return rates, err
+	}
+	if ttl > 0 {
+		rateCache.mu.Lock()
+		rateCache.entries[baseCurrency] = cachedRates{rates: rates, fetchedAt: time.Now()}
+		rateCache.mu.Unlock()
+	}
+	return rates, nil
+}
 
 var FetchCurrencyRates = fetchCurrencyRates
 
-func fetchCurrencyRates(baseCurrency string) (models.CurrencyRates, error) {
+// fetchCurrencyRates asks the configured providers in order and returns the
+// first usable answer.
+func fetchCurrencyRates(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+	log := logging.FromContext(ctx)
 	var rates models.CurrencyRates
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	list, timeout := providers()
+	client := &http.Client{Timeout: timeout}
+
+	lastErr := errors.New("no rate providers configured")
+	for _, provider := range list {
+		result, err := fetchFromProvider(ctx, client, provider, baseCurrency)
+		if err != nil {
+			log.Warnf("Rate provider %s failed, trying the next one: %v", provider.Name, err)
+			lastErr = fmt.Errorf("%s: %w", provider.Name, err)
+			continue
+		}
+		rates.Rates = result
+		log.Infof("API Response from %s: %+v", provider.Name, rates)
+		markRatesFetched()
+		return rates, nil
+	}
+
+	return rates, fmt.Errorf("%w: %v", ErrRateUnavailable, lastErr)
+}
+
+func providerURL(provider configs.RateProvider, baseCurrency string) string {
+	return strings.NewReplacer(
+		"{apiKey}", url.QueryEscape(provider.APIKey),
+		"{base}", url.QueryEscape(baseCurrency),
+	).Replace(provider.URL)
+}
+
+func fetchFromProvider(ctx context.Context, client *http.Client, provider configs.RateProvider, baseCurrency string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, providerURL(provider, baseCurrency), nil)
+	if err != nil {
+		return nil, errors.New("invalid provider URL")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The request URL may carry the API key, so only the cause is kept.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error decoding currency rates: %w", err)
+	}
+	raw, ok := body[provider.RatesField]
+	if !ok {
+		return nil, fmt.Errorf("response has no %q field", provider.RatesField)
+	}
+	var result map[string]float64
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error decoding currency rates: %w", err)
 	}
+	return result, nil
+}
 
-	client := &http.Client{Transport: tr, Timeout: time.Second * 10}
+// ProviderStatus is the outcome of asking one rate provider directly.
+type ProviderStatus struct {
+	Name      string `json:"name"`
+	Rates     int    `json:"rates"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
 
-	url := fmt.Sprintf("https://api.freecurrencyapi.com/v2/latest?apikey=%s&base_currency=%s", apiKey, baseCurrency)
-	resp, err := client.Get(url)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Warnf("Primary API failed, attempting backup API: %v", err)
-		url = fmt.Sprintf("https://v6.exchangerate-api.com/v6/%s/latest/%s?apikey=%s", backupAPIKey, baseCurrency, backupAPIKey)
-		resp, err = client.Get(url)
+// ProbeProviders asks every configured provider for the baseCurrency rates,
+// bypassing the cache and the fallback order, so operators can see which of
+// them currently answer.
+func ProbeProviders(ctx context.Context, baseCurrency string) []ProviderStatus {
+	list, timeout := providers()
+	client := &http.Client{Timeout: timeout}
+	statuses := make([]ProviderStatus, 0, len(list))
+	for _, provider := range list {
+		start := time.Now()
+		rates, err := fetchFromProvider(ctx, client, provider, baseCurrency)
+		status := ProviderStatus{Name: provider.Name, Rates: len(rates), LatencyMS: time.Since(start).Milliseconds()}
 		if err != nil {
-			return rates, fmt.Errorf("error fetching currency rates from backup API: %w", err)
+			status.Error = err.Error()
+		} else {
+			markRatesFetched()
 		}
+		statuses = append(statuses, status)
 	}
-	defer resp.Body.Close()
+	return statuses
+}
+
+// RatesFreshness is how long a successful rate fetch keeps the provider
+// check green without probing the provider again.
+var RatesFreshness = 10 * time.Minute
+
+var (
+	ratesMu          sync.Mutex
+	ratesLastFetched time.Time
+)
+
+func markRatesFetched() {
+	ratesMu.Lock()
+	ratesLastFetched = time.Now()
+	ratesMu.Unlock()
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
-		return rates, fmt.Errorf("error decoding currency rates: %w", err)
+var CheckRateProvider = checkRateProvider
+
+// checkRateProvider reports whether currency conversion can be served. A
+// recent successful fetch is enough; otherwise the provider hosts are probed
+// without an API key so the check does not spend the paid quota.
+func checkRateProvider(ctx context.Context) error {
+	ratesMu.Lock()
+	fresh := !ratesLastFetched.IsZero() && time.Since(ratesLastFetched) < RatesFreshness
+	ratesMu.Unlock()
+	if fresh {
+		return nil
 	}
-	log.Infof("API Response: %+v", rates)
 
-	return rates, nil
+	list, _ := providers()
+	client := &http.Client{Timeout: 3 * time.Second}
+	lastErr := errors.New("no rate providers configured")
+	for _, provider := range list {
+		u, err := url.Parse(provider.URL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.Scheme+"://"+u.Host+"/", nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return fmt.Errorf("no currency rate provider reachable: %w", lastErr)
 }
@@ -1,6 +1,8 @@
 package service
 
 import (
+	configs "DZ_ITOG/config"
+	"context"
 	"testing"
 
 	"github.com/jarcoal/httpmock"
@@ -10,14 +12,17 @@ func TestIntegrationFetchCurrencyRates(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
 
-	httpmock.RegisterResponder("GET", "https://api.freecurrencyapi.com/v2/latest?apikey=fca_live_O0Kw1fj8ul0ZaVlBnTZxn48GBL3X0vr8TSL95HqI&base_currency=USD",
-		httpmock.NewStringResponder(500, `{"error":"Internal Server Error"}`))
+	config := testConfig()
+	Configure(config)
+	defer Configure(configs.Default())
 
+	httpmock.RegisterResponder("GET", "https://primary.example/latest?apikey=primary-key&base_currency=USD",
+		httpmock.NewStringResponder(500, `{"error":"Internal Server Error"}`))
 
-	httpmock.RegisterResponder("GET", "https://v6.exchangerate-api.com/v6/abe4f5b30553ba88e0824fdd/latest/USD",
+	httpmock.RegisterResponder("GET", "https://backup.example/v6/backup-key/latest/USD",
 		httpmock.NewStringResponder(200, `{"conversion_rates":{"USD":1,"EUR":0.9}}`))
 
-	rates, err := FetchCurrencyRates("USD")
+	rates, err := FetchCurrencyRates(context.Background(), "USD")
 	if err != nil {
 		t.Fatalf("Failed to fetch currency rates: %v", err)
 	}
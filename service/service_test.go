@@ -1,15 +1,20 @@
 package service
 
 import (
+	configs "DZ_ITOG/config"
 	"DZ_ITOG/models"
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 )
 
 func TestConvertAmount(t *testing.T) {
 	t.Run("same currency conversion", func(t *testing.T) {
-		amount, err := ConvertAmount(100, "USD", "USD")
+		amount, err := ConvertAmount(context.Background(), 100, "USD", "USD")
 		if err != nil {
 			t.Errorf("ConvertAmount returned an error for same currency conversion: %v", err)
 		}
@@ -22,11 +27,11 @@ func TestConvertAmount(t *testing.T) {
 		originalFetch := FetchCurrencyRates
 		defer func() { FetchCurrencyRates = originalFetch }()
 
-		FetchCurrencyRates = func(baseCurrency string) (models.CurrencyRates, error) {
+		FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
 			return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.9}}, nil
 		}
 
-		amount, err := ConvertAmount(100, "USD", "EUR")
+		amount, err := ConvertAmount(context.Background(), 100, "USD", "EUR")
 		if err != nil {
 			t.Errorf("ConvertAmount returned an error: %v", err)
 		}
@@ -34,15 +39,65 @@ func TestConvertAmount(t *testing.T) {
 			t.Errorf("ConvertAmount returned incorrect conversion: got %v want %v", amount, 90)
 		}
 	})
+
+	t.Run("unknown target currency", func(t *testing.T) {
+		originalFetch := FetchCurrencyRates
+		defer func() { FetchCurrencyRates = originalFetch }()
+
+		FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+			return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.9}}, nil
+		}
+
+		_, err := ConvertAmount(context.Background(), 100, "GBP", "XYZ")
+		if !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("expected ErrUnknownCurrency, got %v", err)
+		}
+	})
+
+	t.Run("rates unavailable", func(t *testing.T) {
+		originalFetch := FetchCurrencyRates
+		defer func() { FetchCurrencyRates = originalFetch }()
+
+		FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+			return models.CurrencyRates{}, errors.New("connection refused")
+		}
+
+		_, err := ConvertAmount(context.Background(), 100, "JPY", "EUR")
+		if !errors.Is(err, ErrRateUnavailable) {
+			t.Errorf("expected ErrRateUnavailable, got %v", err)
+		}
+	})
+}
+func testConfig() *configs.Config {
+	config := configs.Default()
+	config.Rates.Providers = []configs.RateProvider{
+		{
+			Name:       "primary",
+			URL:        "https://primary.example/latest?apikey={apiKey}&base_currency={base}",
+			RatesField: "rates",
+			APIKey:     "primary-key",
+		},
+		{
+			Name:       "backup",
+			URL:        "https://backup.example/v6/{apiKey}/latest/{base}",
+			RatesField: "conversion_rates",
+			APIKey:     "backup-key",
+		},
+	}
+	return config
 }
+
 func TestFetchCurrencyRates(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
 
-	httpmock.RegisterResponder("GET", "https://api.freecurrencyapi.com/v2/latest?apikey=fca_live_O0Kw1fj8ul0ZaVlBnTZxn48GBL3X0vr8TSL95HqI&base_currency=USD",
+	Configure(testConfig())
+	defer Configure(configs.Default())
+
+	httpmock.RegisterResponder("GET", "https://primary.example/latest?apikey=primary-key&base_currency=USD",
 		httpmock.NewStringResponder(200, `{"rates":{"USD":1,"EUR":0.9}}`))
 
-	rates, err := FetchCurrencyRates("USD")
+	rates, err := FetchCurrencyRates(context.Background(), "USD")
 	if err != nil {
 		t.Fatalf("FetchCurrencyRates returned an error: %v", err)
 	}
@@ -52,3 +107,84 @@ func TestFetchCurrencyRates(t *testing.T) {
 		t.Errorf("Expected EUR rate of %v, got %v", expectedRate, rates.Rates["EUR"])
 	}
 }
+
+func TestFetchCurrencyRatesAllProvidersFail(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	Configure(testConfig())
+	defer Configure(configs.Default())
+
+	httpmock.RegisterResponder("GET", "https://primary.example/latest?apikey=primary-key&base_currency=USD",
+		httpmock.NewStringResponder(200, `{"data":{"EUR":0.9}}`))
+	httpmock.RegisterResponder("GET", "https://backup.example/v6/backup-key/latest/USD",
+		httpmock.NewStringResponder(403, `{"result":"error"}`))
+
+	_, err := FetchCurrencyRates(context.Background(), "USD")
+	if err == nil {
+		t.Fatal("expected an error when every provider fails")
+	}
+	if !errors.Is(err, ErrRateUnavailable) {
+		t.Errorf("expected ErrRateUnavailable, got %v", err)
+	}
+	if strings.Contains(err.Error(), "backup-key") || strings.Contains(err.Error(), "primary-key") {
+		t.Errorf("error leaks an API key: %v", err)
+	}
+}
+
+func TestCommissionRate(t *testing.T) {
+	config := configs.Default()
+	config.Commission.Rules = append(config.Commission.Rules, configs.CommissionRule{TransactionType: "перевод", Rate: 0.01})
+	Configure(config)
+	defer Configure(configs.Default())
+
+	tests := []struct {
+		transactionType string
+		currency        string
+		expected        float64
+	}{
+		{"перевод", "USD", 0.02},
+		{"перевод", "RUB", 0.05},
+		{"перевод", "EUR", 0.01},
+		{"покупка", "USD", 0},
+		{"пополнение", "RUB", 0},
+	}
+	for _, test := range tests {
+		if got := CommissionRate(test.transactionType, test.currency); got != test.expected {
+			t.Errorf("CommissionRate(%s, %s) = %v, want %v", test.transactionType, test.currency, got, test.expected)
+		}
+	}
+}
+
+func TestConvertAmountUsesRateCache(t *testing.T) {
+	originalFetch := FetchCurrencyRates
+	defer func() { FetchCurrencyRates = originalFetch }()
+
+	calls := 0
+	FetchCurrencyRates = func(ctx context.Context, baseCurrency string) (models.CurrencyRates, error) {
+		calls++
+		return models.CurrencyRates{Rates: map[string]float64{"EUR": 0.5}}, nil
+	}
+
+	config := configs.Default()
+	config.Rates.CacheTTL = time.Minute
+	Configure(config)
+	defer Configure(configs.Default())
+
+	for i := 0; i < 3; i++ {
+		if _, err := ConvertAmount(context.Background(), 10, "GBP", "EUR"); err != nil {
+			t.Fatalf("ConvertAmount returned an error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one fetch with caching enabled, got %d", calls)
+	}
+
+	config.Rates.CacheTTL = 0
+	Configure(config)
+	ConvertAmount(context.Background(), 10, "GBP", "EUR")
+	ConvertAmount(context.Background(), 10, "GBP", "EUR")
+	if calls != 3 {
+		t.Errorf("expected a fetch per conversion with caching disabled, got %d", calls)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transition moves the transaction with id to status to on behalf of actor
+// and records the transition. Completing a pending transaction charges its
+// commission; reversing a completed one writes a compensating commission
+// cancelling the charge. Moves that models.StatusTransitions does not allow
+// are a conflict.
+func (s *TransactionService) Transition(ctx context.Context, id int64, to, reason string, actor *int) (models.StatusTransition, error) {
+	var transition models.StatusTransition
+	var events eventBatch
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		transaction, err := repo.LockTransaction(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !models.CanTransition(transaction.Status, to) {
+			return fmt.Errorf("%w: transaction %d is %s and cannot become %s", repo.ErrConflict, id, transaction.Status, to)
+		}
+		if to == models.StatusReversed && transaction.RefundOf != nil {
+			return fmt.Errorf("%w: transaction %d is a refund, which cannot be reversed", repo.ErrConflict, id)
+		}
+		if to == models.StatusReversed && transaction.Refunded > 0 {
+			return fmt.Errorf("%w: transaction %d was partly refunded and cannot be reversed", repo.ErrConflict, id)
+		}
+		transition, err = repo.RecordTransition(ctx, models.StatusTransition{
+			TransactionID: transaction.ID,
+			From:          transaction.Status,
+			To:            to,
+			Reason:        reason,
+			Actor:         actor,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		transaction.Status = to
+		if err := events.publish(ctx, tx, models.EventTransactionStatusChanged, transaction.ID, transaction.UserID, transition); err != nil {
+			return err
+		}
+
+		switch to {
+		case models.StatusCompleted:
+			_, err = s.charge(ctx, tx, transaction, &events)
+		case models.StatusReversed:
+			err = s.reverseCommission(ctx, tx, transaction, &events)
+		}
+		return err
+	})
+	if err != nil {
+		return models.StatusTransition{}, err
+	}
+	s.log(ctx, "Transition").WithFields(logrus.Fields{
+		"transaction_id": id,
+		"from":           transition.From,
+		"to":             transition.To,
+	}).Info("Transaction status changed")
+	events.commit()
+	return transition, nil
+}
+
+// reverseCommission cancels the commission charged on transaction with a
+// record of the opposite amount, so the net commission becomes zero. The
+// charge itself is kept.
+func (s *TransactionService) reverseCommission(ctx context.Context, tx *sql.Tx, transaction models.Transaction, events *eventBatch) error {
+	charged, net, err := chargedCommission(ctx, tx, transaction.ID)
+	if err != nil || net <= 0 {
+		return err
+	}
+	reversal := charged
+	reversal.Commission = -net
+	reversal.Date = time.Now().Format("2006-01-02")
+	reversal.Description = "Сторно: " + charged.Description
+	if err := repo.CreateCommission(ctx, tx, reversal); err != nil {
+		return err
+	}
+	return events.publish(ctx, tx, models.EventCommissionReversed, transaction.ID, transaction.UserID, reversal)
+}
+
+// Transitions returns the status transitions of the transaction with id,
+// oldest first.
+func (s *TransactionService) Transitions(ctx context.Context, id int64) ([]models.StatusTransition, error) {
+	return repo.ListTransitions(ctx, id, s.db)
+}
+
+// chargedCommission returns the last commission charged on a transaction
+// and what is left of it after reversals and refunds. net is zero when
+// nothing was charged.
+func chargedCommission(ctx context.Context, tx *sql.Tx, transactionID int) (charged models.Commission, net float64, err error) {
+	commissions, err := repo.TransactionCommissions(ctx, transactionID, tx)
+	if err != nil {
+		return charged, 0, err
+	}
+	for _, c := range commissions {
+		if c.Commission > 0 {
+			charged = c
+		}
+		net += c.Commission
+	}
+	return charged, net, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/repo/repotest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	transaction := func(status string) *sqlmock.Rows {
+		return repotest.TransactionRows(models.Transaction{ID: 4, UserID: 1, Amount: 100, Currency: "USD", TransactionType: "перевод", Date: time.Now(), Status: status})
+	}
+	expectTransition := func(from, to string) {
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(4).WillReturnRows(transaction(from))
+		mock.ExpectExec(`UPDATE transactions SET status = \$1`).WithArgs(to, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO transaction_transitions`).WithArgs(4, from, to, "bank confirmed", 7).
+			WillReturnRows(sqlmock.NewRows([]string{"transition_id", "occurred_at"}).AddRow(9, time.Now()))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "4", models.EventTransactionStatusChanged, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	actor := 7
+
+	t.Run("completing charges the commission", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectTransition(models.StatusPending, models.StatusCompleted)
+		mock.ExpectExec(`INSERT INTO commissions`).WithArgs(4, 100.0, "USD", "перевод", 2.0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "4", models.EventCommissionCharged, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		transition, err := NewTransactionService(db).Transition(context.Background(), 4, models.StatusCompleted, "bank confirmed", &actor)
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), transition.ID)
+		assert.Equal(t, models.StatusPending, transition.From)
+		assert.Equal(t, models.StatusCompleted, transition.To)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reversing cancels the commission", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectTransition(models.StatusCompleted, models.StatusReversed)
+		mock.ExpectQuery(`FROM commissions WHERE transaction_id = \$1 ORDER BY commission_id`).WithArgs(4).WillReturnRows(
+			sqlmock.NewRows([]string{"transaction_id", "amount", "currency", "transaction_type", "commission", "date", "description"}).
+				AddRow(4, 100.0, "USD", "перевод", 2.0, "2024-01-01", "Комиссия 2.00% от суммы"))
+		mock.ExpectExec(`INSERT INTO commissions`).WithArgs(4, 100.0, "USD", "перевод", -2.0, sqlmock.AnyArg(), "Сторно: Комиссия 2.00% от суммы").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "4", models.EventCommissionReversed, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		_, err := NewTransactionService(db).Transition(context.Background(), 4, models.StatusReversed, "bank confirmed", &actor)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("final statuses cannot change", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(4).WillReturnRows(transaction(models.StatusFailed))
+		mock.ExpectRollback()
+
+		_, err := NewTransactionService(db).Transition(context.Background(), 4, models.StatusCompleted, "", &actor)
+		assert.True(t, errors.Is(err, repo.ErrConflict))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"DZ_ITOG/blob"
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/logging"
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/risk"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql"
+	"math"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TransactionService holds the transaction use cases shared by every
+// transport: REST, gRPC, the CLI and batch jobs call it rather than the repo
+// so they validate, charge commissions and convert amounts the same way.
+type TransactionService struct {
+	db    *sql.DB
+	store blob.Store
+}
+
+func NewTransactionService(db *sql.DB) *TransactionService {
+	return &TransactionService{db: db}
+}
+
+// WithStore makes Delete remove the attachment contents of a transaction from
+// store. Without one they are left behind.
+func (s *TransactionService) WithStore(store blob.Store) *TransactionService {
+	s.store = store
+	return s
+}
+
+func (s *TransactionService) log(ctx context.Context, operation string) *logrus.Entry {
+	return logging.FromContext(ctx).WithFields(logrus.Fields{
+		"module":    "transactionService",
+		"operation": operation,
+	})
+}
+
+// Create validates transaction and checks it against the risk rules. Unless
+// they hold or reject it, it then stores it, charges its commission and
+// queues the events about both in one database transaction, so a transaction
+// is never stored without the commission it owes. A held or rejected
+// transaction is reported as a *RiskError.
+func (s *TransactionService) Create(ctx context.Context, transaction models.Transaction) (models.TransactionResponse, error) {
+	var resp models.TransactionResponse
+	if err := validation.Struct(&transaction); err != nil {
+		return resp, err
+	}
+	transaction.RefundOf, transaction.Refunded = nil, 0
+	var events eventBatch
+	var riskErr *RiskError
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := validation.CheckReferences(ctx, tx, transaction); err != nil {
+			return err
+		}
+		findings, err := risk.Check(ctx, tx, current.Load().risk, transaction)
+		if err != nil {
+			return err
+		}
+		action := risk.Strictest(findings)
+		if action != "" {
+			s.log(ctx, "Create").WithFields(logrus.Fields{
+				"user_id":  transaction.UserID,
+				"action":   action,
+				"findings": findings,
+			}).Warn("Risk rules fired")
+		}
+		review := models.RiskReview{UserID: transaction.UserID, Transaction: transaction, Findings: findings}
+		switch action {
+		case configs.RiskReject:
+			return &RiskError{Findings: findings}
+		case configs.RiskHold:
+			review.Status = models.ReviewPending
+			if review, err = repo.CreateRiskReview(ctx, review, tx); err != nil {
+				return err
+			}
+			riskErr = &RiskError{Findings: findings, Review: &review}
+			return nil
+		}
+
+		if resp, err = s.insert(ctx, tx, transaction, &events); err != nil || action == "" {
+			return err
+		}
+		review.Status = models.ReviewFlagged
+		review.TransactionID = &resp.Transaction.ID
+		review.Transaction = resp.Transaction
+		_, err = repo.CreateRiskReview(ctx, review, tx)
+		return err
+	})
+	if err != nil {
+		return resp, err
+	}
+	if riskErr != nil {
+		return resp, riskErr
+	}
+	events.commit()
+	return resp, nil
+}
+
+// insert stores transaction and, unless it is pending or a refund, charges
+// its commission in tx, recording the events about both in events. A
+// transaction without a status is stored completed.
+func (s *TransactionService) insert(ctx context.Context, tx *sql.Tx, transaction models.Transaction, events *eventBatch) (models.TransactionResponse, error) {
+	if transaction.Status == "" {
+		transaction.Status = models.StatusCompleted
+	}
+	id, err := repo.CreateTransaction(ctx, transaction, tx)
+	if err != nil {
+		return models.TransactionResponse{}, err
+	}
+	transaction.ID = id
+	resp := models.TransactionResponse{Transaction: transaction}
+	if len(transaction.Splits) > 0 {
+		if err := repo.ReplaceSplits(ctx, id, transaction.Splits, tx); err != nil {
+			return resp, err
+		}
+	}
+	if len(transaction.Tags) > 0 {
+		if err := repo.ReplaceTags(ctx, id, transaction.Tags, tx); err != nil {
+			return resp, err
+		}
+	}
+	if err := events.publish(ctx, tx, models.EventTransactionCreated, id, transaction.UserID, transaction); err != nil {
+		return resp, err
+	}
+	if transaction.Status == models.StatusPending || transaction.RefundOf != nil {
+		return resp, nil
+	}
+	resp.Commission, err = s.charge(ctx, tx, transaction, events)
+	return resp, err
+}
+
+// charge stores the commission owed on transaction, if any, and records the
+// event about it in events.
+func (s *TransactionService) charge(ctx context.Context, tx *sql.Tx, transaction models.Transaction, events *eventBatch) (*models.Commission, error) {
+	commission, ok := CommissionFor(transaction)
+	if !ok {
+		return nil, nil
+	}
+	s.log(ctx, "charge").WithField("commission", commission).Debug("Commission calculated")
+	if err := repo.CreateCommission(ctx, tx, commission); err != nil {
+		return nil, err
+	}
+	return &commission, events.publish(ctx, tx, models.EventCommissionCharged, transaction.ID, transaction.UserID, commission)
+}
+
+// List returns every transaction.
+func (s *TransactionService) List(ctx context.Context) ([]models.Transaction, error) {
+	return repo.GetAllTransactions(ctx, s.db)
+}
+
+// Find returns the transactions matching filter, newest first.
+func (s *TransactionService) Find(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error) {
+	return repo.ListTransactions(ctx, filter, s.db)
+}
+
+// Summarize totals the transactions matching filter per currency and type.
+func (s *TransactionService) Summarize(ctx context.Context, filter models.TransactionFilter) ([]models.TransactionSummary, error) {
+	return repo.SummarizeTransactions(ctx, filter, s.db)
+}
+
+// SummarizeCategories totals the transactions matching filter per currency
+// and category, counting each split in its own category.
+func (s *TransactionService) SummarizeCategories(ctx context.Context, filter models.TransactionFilter) ([]models.CategorySummary, error) {
+	return repo.SummarizeCategories(ctx, filter, s.db)
+}
+
+// Validate runs the validation and reference checks of Create without storing
+// anything. The risk rules depend on what else happens meanwhile and are not
+// applied.
+func (s *TransactionService) Validate(ctx context.Context, transaction models.Transaction) error {
+	if err := validation.Struct(&transaction); err != nil {
+		return err
+	}
+	return validation.CheckReferences(ctx, s.db, transaction)
+}
+
+// Get returns one transaction. When currency is set and differs from the
+// transaction's own, ConvertedAmount and ConvertedCurrency are filled in.
+func (s *TransactionService) Get(ctx context.Context, id int64, currency string) (*models.Transaction, error) {
+	transaction, err := repo.GetTransactionByID(ctx, id, s.db)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" || currency == transaction.Currency {
+		return transaction, nil
+	}
+
+	s.log(ctx, "Get").WithFields(logrus.Fields{
+		"fromCurrency": transaction.Currency,
+		"toCurrency":   currency,
+		"amount":       transaction.Amount,
+	}).Debug("Converting transaction amount")
+	converted, err := ConvertAmount(ctx, transaction.Amount, transaction.Currency, currency)
+	if err != nil {
+		return nil, err
+	}
+	transaction.ConvertedAmount = converted
+	transaction.ConvertedCurrency = currency
+	return transaction, nil
+}
+
+// Update validates transaction and replaces the stored one, keeping its
+// status. Its splits and tags are replaced too when they are not nil: an
+// empty list removes them, while nil, as from transports that cannot express
+// them, keeps the stored ones, which must still add up to the new amount. The
+// event carries the resulting splits and tags either way.
+// References are checked in the same database transaction as the write.
+func (s *TransactionService) Update(ctx context.Context, id int64, transaction models.Transaction) error {
+	if err := validation.Struct(&transaction); err != nil {
+		return err
+	}
+	transaction.Status, transaction.RefundOf, transaction.Refunded = "", nil, 0
+	keepSplits, keepTags := transaction.Splits == nil, transaction.Tags == nil
+	var events eventBatch
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := validation.CheckReferences(ctx, tx, transaction); err != nil {
+			return err
+		}
+		if keepSplits || keepTags {
+			stored, err := repo.LockTransaction(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if keepTags {
+				transaction.Tags = stored.Tags
+			}
+			if keepSplits {
+				transaction.Splits = stored.Splits
+				if err := validation.Struct(&transaction); err != nil {
+					return err
+				}
+			}
+		}
+		if err := repo.UpdateTransaction(ctx, id, transaction, tx); err != nil {
+			return err
+		}
+		transaction.ID = int(id)
+		if !keepSplits {
+			if err := repo.ReplaceSplits(ctx, transaction.ID, transaction.Splits, tx); err != nil {
+				return err
+			}
+		}
+		if !keepTags {
+			if err := repo.ReplaceTags(ctx, transaction.ID, transaction.Tags, tx); err != nil {
+				return err
+			}
+		}
+		return events.publish(ctx, tx, models.EventTransactionUpdated, transaction.ID, transaction.UserID, transaction)
+	})
+	if err != nil {
+		return err
+	}
+	events.commit()
+	return nil
+}
+
+// Delete removes a transaction. Its attachment contents are removed from the
+// store after the commit; if that fails it is only logged.
+func (s *TransactionService) Delete(ctx context.Context, id int64) error {
+	var events eventBatch
+	var keys []string
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if s.store != nil {
+			var err error
+			if keys, err = repo.DeleteAttachments(ctx, id, tx); err != nil {
+				return err
+			}
+		}
+		userID, err := repo.DeleteTransaction(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+		return events.publish(ctx, tx, models.EventTransactionDeleted, int(id), userID, map[string]int64{"id": id, "user_id": int64(userID)})
+	})
+	if err != nil {
+		return err
+	}
+	events.commit()
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			s.log(ctx, "Delete").WithError(err).WithField("storage_key", key).Warn("Error deleting attachment content")
+		}
+	}
+	return nil
+}
+
+// CommissionChange is one commission corrected by RecalculateCommissions. Old
+// is nil when none was charged before, New when none is owed now.
+type CommissionChange struct {
+	TransactionID int      `json:"transaction_id"`
+	Old           *float64 `json:"old"`
+	New           *float64 `json:"new"`
+}
+
+// RecalculateCommissions recomputes the commission of every completed
+// transaction matching filter with the current rules and replaces the stored
+// ones that differ, all in one database transaction. Pending, failed and
+// reversed transactions are left alone, and so are refunds and refunded
+// purchases, whose commission records must stay in proportion. With dryRun
+// nothing is written.
+func (s *TransactionService) RecalculateCommissions(ctx context.Context, filter models.TransactionFilter, dryRun bool) ([]CommissionChange, error) {
+	filter.Status = models.StatusCompleted
+	changes := []CommissionChange{}
+	var events eventBatch
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		transactions, err := repo.ListTransactions(ctx, filter, tx)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, transaction := range transactions {
+			if transaction.RefundOf == nil && transaction.Refunded == 0 {
+				transactions[n] = transaction
+				n++
+			}
+		}
+		transactions = transactions[:n]
+		ids := make([]int, 0, len(transactions))
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.ID)
+		}
+		stored, err := repo.CommissionsByTransactionIDs(ctx, ids, tx)
+		if err != nil {
+			return err
+		}
+		charged := make(map[int]models.Commission, len(stored))
+		for _, commission := range stored {
+			charged[commission.TransactionID] = commission
+		}
+
+		for _, transaction := range transactions {
+			want, owed := CommissionFor(transaction)
+			have, had := charged[transaction.ID]
+			if owed == had && (!owed || sameCommission(have, want)) {
+				continue
+			}
+
+			change := CommissionChange{TransactionID: transaction.ID}
+			if had {
+				change.Old = &have.Commission
+			}
+			if owed {
+				change.New = &want.Commission
+			}
+			changes = append(changes, change)
+			if dryRun {
+				continue
+			}
+
+			if err := repo.DeleteCommissions(ctx, transaction.ID, tx); err != nil {
+				return err
+			}
+			if owed {
+				if err := repo.CreateCommission(ctx, tx, want); err != nil {
+					return err
+				}
+				if err := events.publish(ctx, tx, models.EventCommissionCharged, transaction.ID, transaction.UserID, want); err != nil {
+					return err
+				}
+			} else if err := events.publish(ctx, tx, models.EventCommissionRemoved, transaction.ID, transaction.UserID, map[string]int{"transaction_id": transaction.ID}); err != nil {
+				return err
+			}
+		}
+		s.log(ctx, "RecalculateCommissions").WithFields(logrus.Fields{
+			"checked": len(transactions),
+			"changed": len(changes),
+			"dryRun":  dryRun,
+		}).Info("Commissions recalculated")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	events.commit()
+	return changes, nil
+}
+
+// sameCommission compares to the cent, as the amounts are stored.
+func sameCommission(a, b models.Commission) bool {
+	cents := func(v float64) float64 { return math.Round(v * 100) }
+	return cents(a.Commission) == cents(b.Commission) && cents(a.Amount) == cents(b.Amount)
+}
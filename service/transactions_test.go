@@ -0,0 +1,180 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/repo/repotest"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRollsBackWithoutCommission(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(3))
+	mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO commissions`).WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	_, err = NewTransactionService(db).Create(context.Background(), models.Transaction{
+		UserID: 1, Amount: 100, Currency: "USD", TransactionType: models.TransactionTypeTransfer,
+	})
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateStoresSplits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO transactions`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id"}).AddRow(3))
+	mock.ExpectExec(`DELETE FROM transaction_splits`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO transaction_splits`).WithArgs(3, "groceries", 45.0, "").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO transaction_splits`).WithArgs(3, "household", 15.0, "detergent").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	resp, err := NewTransactionService(db).Create(context.Background(), models.Transaction{
+		UserID: 1, Amount: 60, Currency: "USD", TransactionType: models.TransactionTypePurchase, Category: "supermarket",
+		Splits: []models.Split{{Category: "groceries", Amount: 45}, {Category: "household", Amount: 15, Note: "detergent"}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, resp.Transaction.Splits, 2)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// eventData matches the data of an update event by whether it lists the
+// stored splits and tags.
+type eventData struct{ removed bool }
+
+func (e eventData) Match(v driver.Value) bool {
+	data, _ := v.([]byte)
+	kept := strings.Contains(string(data), `"tags":["lunch"]`) && strings.Contains(string(data), `"category":"food"`)
+	return kept != e.removed
+}
+
+func TestUpdateReplacesSplitsAndTagsOnlyWhenGiven(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	update := func(amount float64, splits []models.Split, tags []string) error {
+		return NewTransactionService(db).Update(context.Background(), 3, models.Transaction{
+			UserID: 1, Amount: amount, Currency: "USD", TransactionType: models.TransactionTypePurchase, Splits: splits, Tags: tags,
+		})
+	}
+	stored := func() *sqlmock.Rows {
+		return repotest.TransactionRows(models.Transaction{ID: 3, UserID: 1, Amount: 60, Currency: "USD", TransactionType: "покупка", Date: time.Now(),
+			Splits: []models.Split{{Category: "food", Amount: 60}}, Tags: []string{"lunch"}})
+	}
+	expectUpdate := func(removes bool) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		if !removes {
+			mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(3).WillReturnRows(stored())
+		}
+		mock.ExpectExec(`UPDATE transactions`).WillReturnResult(sqlmock.NewResult(0, 1))
+		if removes {
+			mock.ExpectExec(`DELETE FROM transaction_splits`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec(`DELETE FROM transaction_tags`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(`INSERT INTO outbox`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), eventData{removes}, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+
+	expectUpdate(false)
+	require.NoError(t, update(60, nil, nil), "nil keeps the stored splits and tags")
+	expectUpdate(true)
+	require.NoError(t, update(60, []models.Split{}, []string{}), "an empty list removes them")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(3).WillReturnRows(stored())
+	mock.ExpectRollback()
+	err = update(80, nil, nil)
+	var validationErr *validation.Error
+	require.ErrorAs(t, err, &validationErr, "the kept splits no longer add up to the new amount")
+	assert.Equal(t, []models.FieldError{{Field: "splits", Message: "must add up to the amount"}}, validationErr.Fields)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateNotFoundRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM transactions WHERE transaction_id = \$1 FOR UPDATE`).WithArgs(9).WillReturnRows(repotest.TransactionRows())
+	mock.ExpectRollback()
+
+	err = NewTransactionService(db).Update(context.Background(), 9, models.Transaction{
+		UserID: 1, Amount: 10, Currency: "USD", TransactionType: models.TransactionTypePurchase,
+	})
+	assert.True(t, errors.Is(err, repo.ErrNotFound))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecalculateCommissions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM transactions WHERE status = \$1`).WithArgs(models.StatusCompleted).WillReturnRows(repotest.TransactionRows(
+		models.Transaction{ID: 1, UserID: 1, Amount: 100, Currency: "USD", TransactionType: "перевод", Date: now}, // charged correctly
+		models.Transaction{ID: 2, UserID: 1, Amount: 200, Currency: "USD", TransactionType: "перевод", Date: now}, // amount was edited after charging
+		models.Transaction{ID: 3, UserID: 1, Amount: 50, Currency: "USD", TransactionType: "покупка", Date: now},  // charged, but purchases are free
+		models.Transaction{ID: 4, UserID: 1, Amount: 10, Currency: "USD", TransactionType: "покупка", Date: now},  // free and never charged
+	))
+	mock.ExpectQuery(`FROM commissions WHERE transaction_id = ANY`).WillReturnRows(
+		sqlmock.NewRows([]string{"transaction_id", "amount", "currency", "transaction_type", "commission", "date", "description"}).
+			AddRow(1, 100.0, "USD", "перевод", 2.0, "2024-01-01", "").
+			AddRow(2, 150.0, "USD", "перевод", 3.0, "2024-01-01", "").
+			AddRow(3, 50.0, "USD", "покупка", 1.0, "2024-01-01", ""))
+	mock.ExpectExec(`DELETE FROM commissions`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO commissions`).WithArgs(2, 200.0, "USD", "перевод", 4.0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "2", models.EventCommissionCharged, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).WithArgs(sqlmock.AnyArg(), models.EventCommissionCharged, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM commissions`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).WithArgs(sqlmock.AnyArg(), models.AggregateTransaction, "3", models.EventCommissionRemoved, []byte(`{"transaction_id":3}`), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).WithArgs(sqlmock.AnyArg(), models.EventCommissionRemoved, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	changes, err := NewTransactionService(db).RecalculateCommissions(context.Background(), models.TransactionFilter{}, false)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, 2, changes[0].TransactionID)
+	assert.Equal(t, 3.0, *changes[0].Old)
+	assert.Equal(t, 4.0, *changes[0].New)
+	assert.Equal(t, 3, changes[1].TransactionID)
+	assert.Nil(t, changes[1].New)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql"
+	"sort"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserService manages user records. Passwords are only ever stored as bcrypt
+// hashes.
+type UserService struct {
+	db *sql.DB
+}
+
+func NewUserService(db *sql.DB) *UserService {
+	return &UserService{db: db}
+}
+
+// userInput carries the rules for a new user; bcrypt ignores input past 72
+// bytes, so longer passwords are refused rather than silently truncated.
+type userInput struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"min=8,max=72"`
+}
+
+type passwordInput struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"min=8,max=72"`
+}
+
+// Create validates and stores a user. A taken email is reported as
+// repo.ErrConflict.
+func (s *UserService) Create(ctx context.Context, name, email, password string) (models.User, error) {
+	input := userInput{Name: name, Email: email, Password: password}
+	if err := validation.Struct(&input); err != nil {
+		return models.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{Name: name, Email: email}
+	user.ID, err = repo.CreateUser(ctx, user, string(hash), s.db)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// ResetPassword replaces the password of the user with email. An unknown
+// email is reported as repo.ErrNotFound.
+func (s *UserService) ResetPassword(ctx context.Context, email, password string) error {
+	input := passwordInput{Email: email, Password: password}
+	if err := validation.Struct(&input); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return repo.SetUserPassword(ctx, email, string(hash), s.db)
+}
+
+// Roles returns the roles of the user with id, or repo.ErrNotFound.
+func (s *UserService) Roles(ctx context.Context, id int) (models.UserRoles, error) {
+	exists, err := repo.UserExists(ctx, id, s.db)
+	if err != nil {
+		return models.UserRoles{}, err
+	}
+	if !exists {
+		return models.UserRoles{}, repo.ErrNotFound
+	}
+	roles, _, err := repo.UserRoles(ctx, id, s.db)
+	if err != nil {
+		return models.UserRoles{}, err
+	}
+	return models.UserRoles{UserID: id, Roles: roles}, nil
+}
+
+// SetRoles replaces the roles of a user. Duplicates are dropped; an unknown
+// user is reported as repo.ErrNotFound.
+func (s *UserService) SetRoles(ctx context.Context, input models.UserRoles) (models.UserRoles, error) {
+	if err := validation.Struct(&input); err != nil {
+		return models.UserRoles{}, err
+	}
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, role := range input.Roles {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		exists, err := repo.UserExists(ctx, input.UserID, tx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return repo.ErrNotFound
+		}
+		return repo.SetUserRoles(ctx, input.UserID, roles, tx)
+	})
+	if err != nil {
+		return models.UserRoles{}, err
+	}
+	return models.UserRoles{UserID: input.UserID, Roles: roles}, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptOf matches a bcrypt hash of password.
+type bcryptOf string
+
+func (b bcryptOf) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(b)) == nil
+}
+
+func TestCreateUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	users := NewUserService(db)
+
+	mock.ExpectQuery(`INSERT INTO users`).WithArgs("Ann", "ann@example.com", bcryptOf("correct horse")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+	user, err := users.Create(context.Background(), "Ann", "ann@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, 5, user.ID)
+
+	mock.ExpectQuery(`INSERT INTO users`).WillReturnError(&pq.Error{Code: "23505"})
+	_, err = users.Create(context.Background(), "Ann", "ann@example.com", "correct horse")
+	assert.True(t, errors.Is(err, repo.ErrConflict))
+
+	_, err = users.Create(context.Background(), "", "not-an-email", "short")
+	var invalid *validation.Error
+	require.True(t, errors.As(err, &invalid))
+	assert.Len(t, invalid.Fields, 3)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE users SET password`).WithArgs(bcryptOf("new password"), "bob@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = NewUserService(db).ResetPassword(context.Background(), "bob@example.com", "new password")
+	assert.True(t, errors.Is(err, repo.ErrNotFound))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
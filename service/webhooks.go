@@ -0,0 +1,124 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"net/url"
+)
+
+// webhookSecretPrefix starts every generated signing secret.
+const webhookSecretPrefix = "whsec_"
+
+// WebhookService manages webhook subscriptions and their delivery logs.
+// Deliveries themselves are queued by the services making the changes and
+// sent by webhook.Dispatcher.
+type WebhookService struct {
+	db *sql.DB
+}
+
+func NewWebhookService(db *sql.DB) *WebhookService {
+	return &WebhookService{db: db}
+}
+
+// checkWebhookInput validates input beyond its binding tags: deliveries are
+// only ever posted over HTTP.
+func checkWebhookInput(input *models.WebhookInput) error {
+	if err := validation.Struct(input); err != nil {
+		return err
+	}
+	if u, err := url.Parse(input.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.Fields(models.FieldError{Field: "url", Message: "must be an http or https URL"})
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Create subscribes input.URL to input.Events. Without a secret in input one
+// is generated. The secret is only ever returned here.
+func (s *WebhookService) Create(ctx context.Context, input models.WebhookInput) (models.NewWebhook, error) {
+	if err := checkWebhookInput(&input); err != nil {
+		return models.NewWebhook{}, err
+	}
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return models.NewWebhook{}, err
+		}
+	}
+	webhook := models.Webhook{URL: input.URL, Events: input.Events, Active: input.Active == nil || *input.Active}
+	stored, err := repo.CreateWebhook(ctx, webhook, secret, s.db)
+	if err != nil {
+		return models.NewWebhook{}, err
+	}
+	return models.NewWebhook{Webhook: stored, Secret: secret}, nil
+}
+
+// List returns every subscription.
+func (s *WebhookService) List(ctx context.Context) ([]models.Webhook, error) {
+	return repo.ListWebhooks(ctx, s.db)
+}
+
+// Get returns the subscription with id.
+func (s *WebhookService) Get(ctx context.Context, id int) (models.Webhook, error) {
+	return repo.GetWebhook(ctx, id, s.db)
+}
+
+// Update replaces a subscription. The secret is kept unless input has one;
+// deliveries already queued are sent with the new URL and secret.
+func (s *WebhookService) Update(ctx context.Context, id int, input models.WebhookInput) (models.Webhook, error) {
+	if err := checkWebhookInput(&input); err != nil {
+		return models.Webhook{}, err
+	}
+	var webhook models.Webhook
+	err := repo.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		if webhook, err = repo.GetWebhook(ctx, id, tx); err != nil {
+			return err
+		}
+		webhook.URL, webhook.Events = input.URL, input.Events
+		webhook.Active = input.Active == nil || *input.Active
+		return repo.UpdateWebhook(ctx, webhook, input.Secret, tx)
+	})
+	return webhook, err
+}
+
+// Delete removes a subscription together with its delivery log.
+func (s *WebhookService) Delete(ctx context.Context, id int) error {
+	return repo.DeleteWebhook(ctx, id, s.db)
+}
+
+// Deliveries returns the delivery log of a subscription, newest first.
+func (s *WebhookService) Deliveries(ctx context.Context, filter repo.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	if _, err := repo.GetWebhook(ctx, filter.WebhookID, s.db); err != nil {
+		return nil, err
+	}
+	return repo.ListWebhookDeliveries(ctx, filter, s.db)
+}
+
+// Delivery returns a delivery of a subscription with every attempt made.
+func (s *WebhookService) Delivery(ctx context.Context, webhookID int, id int64) (models.WebhookDelivery, error) {
+	return repo.GetWebhookDelivery(ctx, webhookID, id, s.db)
+}
+
+// Redeliver queues a delivery to be sent again on the next poll, with a
+// fresh set of attempts, and returns it. Delivered and dead deliveries can
+// be redelivered alike.
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID int, id int64) (models.WebhookDelivery, error) {
+	if err := repo.RedeliverWebhookDelivery(ctx, webhookID, id, s.db); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return repo.GetWebhookDelivery(ctx, webhookID, id, s.db)
+}
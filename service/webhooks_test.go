@@ -0,0 +1,89 @@
+package service
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"DZ_ITOG/validation"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generatedSecret matches a webhook secret made by generateWebhookSecret.
+type generatedSecret struct{}
+
+func (generatedSecret) Match(v driver.Value) bool {
+	secret, ok := v.(string)
+	return ok && strings.HasPrefix(secret, webhookSecretPrefix) && len(secret) == len(webhookSecretPrefix)+32
+}
+
+func TestCreateWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	webhooks := NewWebhookService(db)
+	events := []string{models.EventTransactionCreated, models.EventCommissionCharged}
+
+	mock.ExpectQuery(`INSERT INTO webhooks`).
+		WithArgs("https://partner.example.com/hooks", generatedSecret{}, `{"transaction.created","commission.charged"}`, true).
+		WillReturnRows(sqlmock.NewRows([]string{"webhook_id", "created_at"}).AddRow(4, time.Now()))
+	created, err := webhooks.Create(context.Background(), models.WebhookInput{URL: "https://partner.example.com/hooks", Events: events})
+	require.NoError(t, err)
+	assert.Equal(t, 4, created.ID)
+	assert.True(t, created.Active)
+	assert.True(t, generatedSecret{}.Match(created.Secret))
+
+	inactive := false
+	mock.ExpectQuery(`INSERT INTO webhooks`).
+		WithArgs("http://localhost:9000/", "a-secret-of-my-own", `{"transaction.created","commission.charged"}`, false).
+		WillReturnRows(sqlmock.NewRows([]string{"webhook_id", "created_at"}).AddRow(5, time.Now()))
+	created, err = webhooks.Create(context.Background(), models.WebhookInput{URL: "http://localhost:9000/", Secret: "a-secret-of-my-own", Events: events, Active: &inactive})
+	require.NoError(t, err)
+	assert.Equal(t, "a-secret-of-my-own", created.Secret)
+
+	var invalid *validation.Error
+	_, err = webhooks.Create(context.Background(), models.WebhookInput{URL: "ftp://partner.example.com/", Events: events})
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "url", invalid.Fields[0].Field)
+
+	_, err = webhooks.Create(context.Background(), models.WebhookInput{URL: "https://partner.example.com/", Events: []string{"transaction.exploded"}})
+	require.True(t, errors.As(err, &invalid))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	webhooks := NewWebhookService(db)
+
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'pending'`).WithArgs(int64(9), 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = webhooks.Redeliver(context.Background(), 4, 9)
+	assert.True(t, errors.Is(err, repo.ErrNotFound))
+
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'pending'`).WithArgs(int64(8), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM webhook_deliveries`).WithArgs(int64(8), 4).
+		WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts",
+			"next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}).
+			AddRow(8, 4, "evt_1", models.EventTransactionDeleted, `{"id":"evt_1"}`, models.DeliveryPending, 0, time.Now(), 500, "receiver answered 500", time.Now(), nil))
+	mock.ExpectQuery(`FROM webhook_attempts`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"attempted_at", "status_code", "error", "duration_ms"}).
+			AddRow(time.Now(), 500, "receiver answered 500", 12))
+	delivery, err := webhooks.Redeliver(context.Background(), 4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryPending, delivery.Status)
+	require.Len(t, delivery.Log, 1)
+	assert.Equal(t, int64(12), delivery.Log[0].DurationMS)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,151 @@
+// Package stream fans live transaction events out to subscribers such as
+// the SSE endpoint. It keeps the most recent events so that a client that
+// reconnects can resume where it stopped.
+package stream
+
+import (
+	"DZ_ITOG/models"
+	"sync"
+	"time"
+)
+
+// DefaultBufferSize is how many recent events a hub keeps for resuming.
+const DefaultBufferSize = 1000
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Event is a change pushed to subscribers. Seq increases with every event
+// of a hub and is the SSE event id.
+type Event struct {
+	Seq    int64
+	UserID int
+	models.Event
+}
+
+// Hub keeps the last events in a ring buffer and hands every new one to the
+// subscribers it matches.
+type Hub struct {
+	mu     sync.Mutex
+	buffer []Event
+	// next is the sequence number of the next event. It starts at the
+	// creation time in microseconds, so sequence numbers of a restarted
+	// process are never mistaken for ones a client already has.
+	next   int64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub(size int) *Hub {
+	return &Hub{
+		buffer: make([]Event, 0, size),
+		next:   time.Now().UnixMicro(),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Publish numbers events and delivers them, in order. A subscriber that is
+// too far behind is closed rather than waited for.
+func (h *Hub) Publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range events {
+		e.Seq = h.next
+		h.next++
+		if len(h.buffer) == cap(h.buffer) {
+			copy(h.buffer, h.buffer[1:])
+			h.buffer = h.buffer[:len(h.buffer)-1]
+		}
+		h.buffer = append(h.buffer, e)
+		for sub := range h.subs {
+			if !sub.match(e) {
+				continue
+			}
+			select {
+			case sub.events <- e:
+			default:
+				sub.lagged = true
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// Close ends every subscription, and those made afterwards at once, so that
+// streams finish when the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
+
+// Subscription receives the events of a hub that match its filter.
+type Subscription struct {
+	hub    *Hub
+	match  func(Event) bool
+	events chan Event
+	lagged bool
+}
+
+// Subscribe returns a subscription to the events matching match, and the
+// buffered ones after lastSeq to replay first. A zero lastSeq starts with new
+// events only. resumed is false when events after lastSeq are no longer
+// buffered, or lastSeq is from another process: the client must reload.
+func (h *Hub) Subscribe(lastSeq int64, match func(Event) bool) (sub *Subscription, replay []Event, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub = &Subscription{hub: h, match: match, events: make(chan Event, subscriberBuffer)}
+	if h.closed {
+		close(sub.events)
+	} else {
+		h.subs[sub] = struct{}{}
+	}
+	if lastSeq == 0 {
+		return sub, nil, true
+	}
+	oldest := h.next
+	if len(h.buffer) > 0 {
+		oldest = h.buffer[0].Seq
+	}
+	if lastSeq < oldest-1 || lastSeq >= h.next {
+		return sub, nil, false
+	}
+	for _, e := range h.buffer {
+		if e.Seq > lastSeq && match(e) {
+			replay = append(replay, e)
+		}
+	}
+	return sub, replay, true
+}
+
+// Events delivers the subscription's events. It is closed when the
+// subscription or the hub is, or when it fell too far behind; see Lagged.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the subscription was dropped for falling behind.
+// Valid once Events is closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
@@ -0,0 +1,98 @@
+package stream
+
+import (
+	"DZ_ITOG/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func everything(Event) bool { return true }
+
+func event(userID int, id string) Event {
+	return Event{UserID: userID, Event: models.Event{ID: id, Type: models.EventTransactionUpdated}}
+}
+
+func ids(events []Event) []string {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(3)
+	first, _, _ := hub.Subscribe(0, everything)
+	hub.Publish(event(7, "a"), event(8, "b"), event(7, "c"))
+	a := <-first.Events()
+	<-first.Events()
+	c := <-first.Events()
+	assert.Equal(t, a.Seq+2, c.Seq)
+
+	t.Run("replays what was missed, filtered", func(t *testing.T) {
+		sub, replay, resumed := hub.Subscribe(a.Seq, func(e Event) bool { return e.UserID == 7 })
+		defer sub.Close()
+		assert.True(t, resumed)
+		assert.Equal(t, []string{"c"}, ids(replay))
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		sub, replay, resumed := hub.Subscribe(c.Seq, everything)
+		defer sub.Close()
+		assert.True(t, resumed)
+		assert.Empty(t, replay)
+	})
+
+	t.Run("missed events no longer buffered", func(t *testing.T) {
+		hub.Publish(event(7, "d"))
+		sub, replay, resumed := hub.Subscribe(a.Seq-1, everything)
+		defer sub.Close()
+		assert.False(t, resumed, "a was pushed out of the buffer")
+		assert.Empty(t, replay)
+	})
+
+	t.Run("id from another process", func(t *testing.T) {
+		sub, _, resumed := hub.Subscribe(c.Seq+100, everything)
+		defer sub.Close()
+		assert.False(t, resumed)
+	})
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(DefaultBufferSize)
+	slow, _, _ := hub.Subscribe(0, everything)
+	other, _, _ := hub.Subscribe(0, func(e Event) bool { return e.UserID == 8 })
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(event(7, "x"))
+	}
+
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+	assert.Equal(t, subscriberBuffer, n)
+	assert.True(t, slow.Lagged())
+
+	hub.Publish(event(8, "y"))
+	require.Equal(t, "y", (<-other.Events()).ID, "subscribers that keep up are unaffected")
+	other.Close()
+	other.Close()
+	_, open := <-other.Events()
+	assert.False(t, open)
+	assert.False(t, other.Lagged())
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(DefaultBufferSize)
+	before, _, _ := hub.Subscribe(0, everything)
+	hub.Close()
+	after, _, _ := hub.Subscribe(0, everything)
+	for _, sub := range []*Subscription{before, after} {
+		_, open := <-sub.Events()
+		assert.False(t, open)
+		assert.False(t, sub.Lagged())
+		sub.Close()
+	}
+}
@@ -0,0 +1,245 @@
+// Package validation holds the input rules shared by every transport: the
+// struct tag rules on models (checked with gin's validator so REST binding and
+// other callers agree) and the database-backed reference checks.
+package validation
+
+import (
+	"DZ_ITOG/models"
+	"DZ_ITOG/repo"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrInvalid matches every *Error with errors.Is.
+var ErrInvalid = errors.New("invalid input")
+
+// Error lists the invalid fields of one input.
+type Error struct {
+	Fields []models.FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, fe := range e.Fields {
+		parts = append(parts, fe.Field+" "+fe.Message)
+	}
+	return ErrInvalid.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e *Error) Is(target error) bool { return target == ErrInvalid }
+
+// Fields returns an *Error for the given field problems.
+func Fields(fields ...models.FieldError) *Error {
+	return &Error{Fields: fields}
+}
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(jsonFieldName)
+	v.RegisterValidation("amount", validAmount)
+	v.RegisterValidation("transaction_type", validTransactionType)
+	v.RegisterValidation("scope", validScope)
+	v.RegisterValidation("role", validRole)
+	v.RegisterValidation("event_type", validEventType)
+	v.RegisterValidation("tag", validTag)
+	v.RegisterStructValidation(validSplits, models.Transaction{})
+}
+
+// Struct checks the binding tags of v and returns an *Error listing every
+// invalid field, or nil.
+func Struct(v interface{}) error {
+	err := binding.Validator.ValidateStruct(v)
+	if err == nil {
+		return nil
+	}
+	if fields, ok := FromValidator(err); ok {
+		return &Error{Fields: fields}
+	}
+	return err
+}
+
+// FromValidator converts validator errors into field errors. Fields of
+// nested structs are named by their path, such as splits[0].category.
+func FromValidator(err error) ([]models.FieldError, bool) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil, false
+	}
+	fields := make([]models.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		field := fe.Field()
+		if path := strings.SplitN(fe.Namespace(), ".", 2); len(path) == 2 {
+			field = path[1]
+		}
+		fields = append(fields, models.FieldError{Field: field, Message: fieldMessage(fe)})
+	}
+	return fields, true
+}
+
+// jsonFieldName makes validation errors name fields the way clients send them.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" || name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validAmount accepts finite, positive amounts that fit DECIMAL(10, 2)
+// without rounding.
+func validAmount(fl validator.FieldLevel) bool {
+	amount := fl.Field().Float()
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return false
+	}
+	if amount <= 0 || amount > models.MaxTransactionAmount {
+		return false
+	}
+	return math.Abs(amount*100-math.Round(amount*100)) < 1e-6
+}
+
+// validSplits checks that the splits of a transaction, if any, add up to its
+// amount to the cent.
+func validSplits(sl validator.StructLevel) {
+	transaction := sl.Current().Interface().(models.Transaction)
+	if len(transaction.Splits) == 0 {
+		return
+	}
+	var total float64
+	for _, split := range transaction.Splits {
+		total += split.Amount
+	}
+	if math.Round(total*100) != math.Round(transaction.Amount*100) {
+		sl.ReportError(transaction.Splits, "splits", "Splits", "splits_total", "")
+	}
+}
+
+// tagPattern is a lowercase letter or digit followed by up to 49 more, or
+// hyphens and underscores, in any script.
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{Nd}][\p{Ll}\p{Nd}_-]{0,49}$`)
+
+func validTag(fl validator.FieldLevel) bool {
+	return tagPattern.MatchString(fl.Field().String())
+}
+
+func validTransactionType(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	for _, t := range models.TransactionTypes {
+		if value == t {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	for _, s := range models.Scopes {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validRole(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	for _, r := range models.Roles {
+		if value == r {
+			return true
+		}
+	}
+	return false
+}
+
+func validEventType(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	for _, t := range models.EventTypes {
+		if value == t {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at least %s entries", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "email":
+		return "must be an email address"
+	case "amount":
+		return fmt.Sprintf("must be a positive amount up to %.2f with at most 2 decimal places", models.MaxTransactionAmount)
+	case "iso4217":
+		return "must be an ISO 4217 currency code such as USD or RUB"
+	case "transaction_type":
+		return "must be one of " + strings.Join(models.TransactionTypes, ", ")
+	case "scope":
+		return "must be one of " + strings.Join(models.Scopes, ", ")
+	case "role":
+		return "must be one of " + strings.Join(models.Roles, ", ")
+	case "event_type":
+		return "must be one of " + strings.Join(models.EventTypes, ", ")
+	case "url":
+		return "must be an absolute URL"
+	case "tag":
+		return "must be 1 to 50 lowercase letters, digits, hyphens or underscores, starting with a letter or digit"
+	case "splits_total":
+		return "must add up to the amount"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
+
+// CheckReferences verifies that the user exists and that the account, if
+// given, exists and belongs to that user. Broken references come back as an
+// *Error; anything else is a database failure.
+func CheckReferences(ctx context.Context, db repo.DBTX, transaction models.Transaction) error {
+	var fields []models.FieldError
+
+	exists, err := repo.UserExists(ctx, transaction.UserID, db)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fields = append(fields, models.FieldError{Field: "user_id", Message: "user does not exist"})
+	}
+
+	if transaction.AccountID != nil {
+		owner, err := repo.AccountOwner(ctx, *transaction.AccountID, db)
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			fields = append(fields, models.FieldError{Field: "account_id", Message: "account does not exist"})
+		case err != nil:
+			return err
+		case owner != transaction.UserID:
+			fields = append(fields, models.FieldError{Field: "account_id", Message: "account does not belong to the user"})
+		}
+	}
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"DZ_ITOG/models"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fieldMap(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var invalid *Error
+	require.True(t, errors.As(err, &invalid), "expected *Error, got %v", err)
+	fields := map[string]string{}
+	for _, fe := range invalid.Fields {
+		fields[fe.Field] = fe.Message
+	}
+	return fields
+}
+
+func TestStruct(t *testing.T) {
+	valid := models.Transaction{UserID: 1, Amount: 10.5, Currency: "USD", TransactionType: models.TransactionTypePurchase}
+	assert.NoError(t, Struct(&valid))
+
+	err := Struct(&models.Transaction{Amount: 1.005, Currency: "usd", TransactionType: "обмен"})
+	assert.True(t, errors.Is(err, ErrInvalid))
+	fields := fieldMap(t, err)
+	assert.Equal(t, "is required", fields["user_id"])
+	assert.Contains(t, fields["amount"], "at most 2 decimal places")
+	assert.Contains(t, fields["currency"], "ISO 4217")
+	assert.Contains(t, fields["transaction_type"], models.TransactionTypeTransfer)
+
+	split := valid
+	split.Splits = []models.Split{{Category: "groceries", Amount: 8}, {Amount: 2}}
+	fields = fieldMap(t, Struct(&split))
+	assert.Equal(t, "is required", fields["splits[1].category"])
+	assert.Equal(t, "must add up to the amount", fields["splits"])
+
+	split.Splits[1] = models.Split{Category: "household", Amount: 2.5}
+	assert.NoError(t, Struct(&split))
+
+	tagged := valid
+	tagged.Tags = []string{"vacation-2026", "налоги", "Tax Deductible"}
+	fields = fieldMap(t, Struct(&tagged))
+	assert.Len(t, fields, 1)
+	assert.Contains(t, fields["tags[2]"], "lowercase")
+}
+
+func TestCheckReferences(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	accountID := 5
+	transaction := models.Transaction{UserID: 1, AccountID: &accountID}
+
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT user_id FROM accounts`).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	assert.Equal(t, "account does not belong to the user", fieldMap(t, CheckReferences(context.Background(), db, transaction))["account_id"])
+
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT user_id FROM accounts`).WithArgs(5).WillReturnError(sql.ErrNoRows)
+	fields := fieldMap(t, CheckReferences(context.Background(), db, transaction))
+	assert.Equal(t, "user does not exist", fields["user_id"])
+	assert.Equal(t, "account does not exist", fields["account_id"])
+
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnError(errors.New("connection reset"))
+	err = CheckReferences(context.Background(), db, transaction)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalid))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
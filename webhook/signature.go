@@ -0,0 +1,53 @@
+// Package webhook sends queued events to webhook subscriptions and signs
+// them so that receivers can tell they came from us.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrInvalidSignature is returned by Verify for a delivery that was not
+// signed with the secret, or was signed too long ago.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the X-Webhook-Signature of body sent at timestamp (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256, keyed with secret, of the
+// timestamp, a dot and the body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the timestamp and signature headers of a delivery of body,
+// as a receiver would. Deliveries signed more than tolerance before or after
+// now are rejected, so a captured request cannot be replayed later.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !strings.HasPrefix(signature, "sha256=") || !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
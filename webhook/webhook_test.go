@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	configs "DZ_ITOG/config"
+	"DZ_ITOG/models"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	signature := Sign("whsec_test", now.Unix(), body)
+	assert.Equal(t, "sha256=", signature[:7])
+
+	assert.NoError(t, Verify("whsec_test", "1700000000", signature, body, 5*time.Minute, now.Add(time.Minute)))
+	assert.ErrorIs(t, Verify("whsec_other", "1700000000", signature, body, 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_test", "1700000000", signature, []byte(`{"id":"evt_2"}`), 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_test", "1700000001", signature, body, 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("whsec_test", "1700000000", signature, body, 5*time.Minute, now.Add(time.Hour)), ErrInvalidSignature, "replayed")
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(configs.WebhookConfig{BackoffBase: 30 * time.Second, BackoffMax: 5 * time.Minute}, nil, nil)
+	assert.Equal(t, 30*time.Second, d.backoff(1))
+	assert.Equal(t, time.Minute, d.backoff(2))
+	assert.Equal(t, 4*time.Minute, d.backoff(4))
+	assert.Equal(t, 5*time.Minute, d.backoff(5))
+	assert.Equal(t, 5*time.Minute, d.backoff(40))
+}
+
+// received is a request seen by the test receiver.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func TestDeliverDue(t *testing.T) {
+	var status int
+	requests := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: body}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("try later"))
+	}))
+	defer receiver.Close()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	config := configs.WebhookConfig{Timeout: 5 * time.Second, BatchSize: 10, MaxAttempts: 3, BackoffBase: 30 * time.Second, BackoffMax: time.Hour}
+	d := NewDispatcher(config, db, receiver.Client())
+	now := time.Now().Truncate(time.Second)
+	d.now = func() time.Time { return now }
+	payload := `{"id":"evt_1","type":"transaction.created","occurred_at":"2024-01-01T00:00:00Z","data":{"id":1}}`
+
+	expectClaim := func(attempts int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM webhook_deliveries d JOIN webhooks w`).WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "webhook_id", "event_id", "event_type", "payload", "attempts", "created_at", "url", "secret"}).
+				AddRow(41, 2, "evt_1", models.EventTransactionCreated, payload, attempts, now, receiver.URL, "whsec_test"))
+		mock.ExpectExec(`UPDATE webhook_deliveries SET next_attempt_at`).WithArgs(int64(10000), `{41}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	expectRecord := func(code int, failure interface{}, status string, next interface{}) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO webhook_attempts`).WithArgs(41, now, code, failure, int64(0)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`UPDATE webhook_deliveries SET attempts = attempts \+ 1`).WithArgs(status, next, code, failure, now, 41).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		status = http.StatusNoContent
+		expectClaim(0)
+		expectRecord(http.StatusNoContent, "", models.DeliveryDelivered, nil)
+
+		n, err := d.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		got := <-requests
+		assert.Equal(t, payload, string(got.body))
+		assert.Equal(t, models.EventTransactionCreated, got.header.Get(HeaderEvent))
+		assert.Equal(t, "41", got.header.Get(HeaderDelivery))
+		assert.NoError(t, Verify("whsec_test", got.header.Get(HeaderTimestamp), got.header.Get(HeaderSignature), got.body, time.Minute, now))
+	})
+
+	t.Run("failed and retried", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		expectClaim(1)
+		expectRecord(http.StatusServiceUnavailable, "receiver answered 503: try later", models.DeliveryPending, now.Add(time.Minute))
+
+		_, err := d.DeliverDue(context.Background())
+		require.NoError(t, err)
+		<-requests
+	})
+
+	t.Run("dead after max attempts", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		expectClaim(2)
+		expectRecord(http.StatusInternalServerError, "receiver answered 500: try later", models.DeliveryDead, nil)
+
+		_, err := d.DeliverDue(context.Background())
+		require.NoError(t, err)
+		<-requests
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDefaultClientVerifiesCertificates(t *testing.T) {
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	insecure := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() { http.DefaultTransport.(*http.Transport).TLSClientConfig = insecure }()
+
+	d := NewDispatcher(configs.WebhookConfig{Timeout: 5 * time.Second}, nil, nil)
+	_, err := d.client.Get(receiver.URL)
+	assert.ErrorContains(t, err, "certificate", "the self-signed receiver is refused")
+}